@@ -0,0 +1,1303 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v29.3.0
+// source: accmgrpb/accmgr.proto
+
+package accmgrpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Server struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Group         string                 `protobuf:"bytes,3,opt,name=group,proto3" json:"group,omitempty"`
+	LoginUser     string                 `protobuf:"bytes,4,opt,name=login_user,json=loginUser,proto3" json:"login_user,omitempty"`
+	UseAgent      bool                   `protobuf:"varint,5,opt,name=use_agent,json=useAgent,proto3" json:"use_agent,omitempty"`
+	Accounts      []string               `protobuf:"bytes,6,rep,name=accounts,proto3" json:"accounts,omitempty"`
+	Health        *Health                `protobuf:"bytes,7,opt,name=health,proto3" json:"health,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Server) Reset() {
+	*x = Server{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Server) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Server) ProtoMessage() {}
+
+func (x *Server) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Server.ProtoReflect.Descriptor instead.
+func (*Server) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Server) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Server) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Server) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Server) GetLoginUser() string {
+	if x != nil {
+		return x.LoginUser
+	}
+	return ""
+}
+
+func (x *Server) GetUseAgent() bool {
+	if x != nil {
+		return x.UseAgent
+	}
+	return false
+}
+
+func (x *Server) GetAccounts() []string {
+	if x != nil {
+		return x.Accounts
+	}
+	return nil
+}
+
+func (x *Server) GetHealth() *Health {
+	if x != nil {
+		return x.Health
+	}
+	return nil
+}
+
+type Health struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	CheckedAtUnix    int64                  `protobuf:"varint,1,opt,name=checked_at_unix,json=checkedAtUnix,proto3" json:"checked_at_unix,omitempty"`
+	Reachable        bool                   `protobuf:"varint,2,opt,name=reachable,proto3" json:"reachable,omitempty"`
+	Error            string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	ClockSkewSeconds int64                  `protobuf:"varint,4,opt,name=clock_skew_seconds,json=clockSkewSeconds,proto3" json:"clock_skew_seconds,omitempty"`
+	ClockSkewHigh    bool                   `protobuf:"varint,5,opt,name=clock_skew_high,json=clockSkewHigh,proto3" json:"clock_skew_high,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Health) Reset() {
+	*x = Health{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Health) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Health) ProtoMessage() {}
+
+func (x *Health) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Health.ProtoReflect.Descriptor instead.
+func (*Health) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Health) GetCheckedAtUnix() int64 {
+	if x != nil {
+		return x.CheckedAtUnix
+	}
+	return 0
+}
+
+func (x *Health) GetReachable() bool {
+	if x != nil {
+		return x.Reachable
+	}
+	return false
+}
+
+func (x *Health) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Health) GetClockSkewSeconds() int64 {
+	if x != nil {
+		return x.ClockSkewSeconds
+	}
+	return 0
+}
+
+func (x *Health) GetClockSkewHigh() bool {
+	if x != nil {
+		return x.ClockSkewHigh
+	}
+	return false
+}
+
+type ListServersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListServersRequest) Reset() {
+	*x = ListServersRequest{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListServersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListServersRequest) ProtoMessage() {}
+
+func (x *ListServersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListServersRequest.ProtoReflect.Descriptor instead.
+func (*ListServersRequest) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListServersRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+type ListServersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Servers       []*Server              `protobuf:"bytes,1,rep,name=servers,proto3" json:"servers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListServersResponse) Reset() {
+	*x = ListServersResponse{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListServersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListServersResponse) ProtoMessage() {}
+
+func (x *ListServersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListServersResponse.ProtoReflect.Descriptor instead.
+func (*ListServersResponse) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListServersResponse) GetServers() []*Server {
+	if x != nil {
+		return x.Servers
+	}
+	return nil
+}
+
+type GetServerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetServerRequest) Reset() {
+	*x = GetServerRequest{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetServerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetServerRequest) ProtoMessage() {}
+
+func (x *GetServerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetServerRequest.ProtoReflect.Descriptor instead.
+func (*GetServerRequest) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetServerRequest) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+type Job struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Id          string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Kind        string                 `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Server      string                 `protobuf:"bytes,3,opt,name=server,proto3" json:"server,omitempty"`
+	Description string                 `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	// status is "running", "succeeded" or "failed"
+	Status   string `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	Progress string `protobuf:"bytes,6,opt,name=progress,proto3" json:"progress,omitempty"`
+	// exit_code is only set when the job's command ran to completion
+	ExitCode       *int32     `protobuf:"varint,7,opt,name=exit_code,json=exitCode,proto3,oneof" json:"exit_code,omitempty"`
+	Error          string     `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	StartedAtUnix  int64      `protobuf:"varint,9,opt,name=started_at_unix,json=startedAtUnix,proto3" json:"started_at_unix,omitempty"`
+	FinishedAtUnix int64      `protobuf:"varint,10,opt,name=finished_at_unix,json=finishedAtUnix,proto3" json:"finished_at_unix,omitempty"`
+	Notes          []*JobNote `protobuf:"bytes,11,rep,name=notes,proto3" json:"notes,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *Job) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *Job) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Job) GetProgress() string {
+	if x != nil {
+		return x.Progress
+	}
+	return ""
+}
+
+func (x *Job) GetExitCode() int32 {
+	if x != nil && x.ExitCode != nil {
+		return *x.ExitCode
+	}
+	return 0
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetStartedAtUnix() int64 {
+	if x != nil {
+		return x.StartedAtUnix
+	}
+	return 0
+}
+
+func (x *Job) GetFinishedAtUnix() int64 {
+	if x != nil {
+		return x.FinishedAtUnix
+	}
+	return 0
+}
+
+func (x *Job) GetNotes() []*JobNote {
+	if x != nil {
+		return x.Notes
+	}
+	return nil
+}
+
+// JobNote is a handoff note pinned to a job, e.g. "waiting on mirror, do not cancel"
+type JobNote struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Author        string                 `protobuf:"bytes,1,opt,name=author,proto3" json:"author,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	CreatedAtUnix int64                  `protobuf:"varint,3,opt,name=created_at_unix,json=createdAtUnix,proto3" json:"created_at_unix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobNote) Reset() {
+	*x = JobNote{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobNote) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobNote) ProtoMessage() {}
+
+func (x *JobNote) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobNote.ProtoReflect.Descriptor instead.
+func (*JobNote) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *JobNote) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *JobNote) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *JobNote) GetCreatedAtUnix() int64 {
+	if x != nil {
+		return x.CreatedAtUnix
+	}
+	return 0
+}
+
+type ListJobsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsRequest) Reset() {
+	*x = ListJobsRequest{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsRequest) ProtoMessage() {}
+
+func (x *ListJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsRequest.ProtoReflect.Descriptor instead.
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListJobsRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type ListJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsResponse) Reset() {
+	*x = ListJobsResponse{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsResponse) ProtoMessage() {}
+
+func (x *ListJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsResponse.ProtoReflect.Descriptor instead.
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListJobsResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type AddJobNoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Author        string                 `protobuf:"bytes,2,opt,name=author,proto3" json:"author,omitempty"`
+	Text          string                 `protobuf:"bytes,3,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddJobNoteRequest) Reset() {
+	*x = AddJobNoteRequest{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddJobNoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddJobNoteRequest) ProtoMessage() {}
+
+func (x *AddJobNoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddJobNoteRequest.ProtoReflect.Descriptor instead.
+func (*AddJobNoteRequest) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *AddJobNoteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AddJobNoteRequest) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *AddJobNoteRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type ExecRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Server   string                 `protobuf:"bytes,1,opt,name=server,proto3" json:"server,omitempty"`
+	Command  string                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	Escalate bool                   `protobuf:"varint,3,opt,name=escalate,proto3" json:"escalate,omitempty"`
+	// upload sends the command as a script file over SFTP instead of on stdin
+	Upload bool `protobuf:"varint,4,opt,name=upload,proto3" json:"upload,omitempty"`
+	// env is exported for this command only, overriding the configured variables
+	Env           map[string]string `protobuf:"bytes,5,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecRequest) Reset() {
+	*x = ExecRequest{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecRequest) ProtoMessage() {}
+
+func (x *ExecRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecRequest.ProtoReflect.Descriptor instead.
+func (*ExecRequest) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ExecRequest) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *ExecRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ExecRequest) GetEscalate() bool {
+	if x != nil {
+		return x.Escalate
+	}
+	return false
+}
+
+func (x *ExecRequest) GetUpload() bool {
+	if x != nil {
+		return x.Upload
+	}
+	return false
+}
+
+func (x *ExecRequest) GetEnv() map[string]string {
+	if x != nil {
+		return x.Env
+	}
+	return nil
+}
+
+type ExecOutput struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*ExecOutput_JobId
+	//	*ExecOutput_Line
+	//	*ExecOutput_Result
+	Payload       isExecOutput_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecOutput) Reset() {
+	*x = ExecOutput{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecOutput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecOutput) ProtoMessage() {}
+
+func (x *ExecOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecOutput.ProtoReflect.Descriptor instead.
+func (*ExecOutput) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ExecOutput) GetPayload() isExecOutput_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *ExecOutput) GetJobId() string {
+	if x != nil {
+		if x, ok := x.Payload.(*ExecOutput_JobId); ok {
+			return x.JobId
+		}
+	}
+	return ""
+}
+
+func (x *ExecOutput) GetLine() *OutputLine {
+	if x != nil {
+		if x, ok := x.Payload.(*ExecOutput_Line); ok {
+			return x.Line
+		}
+	}
+	return nil
+}
+
+func (x *ExecOutput) GetResult() *ExecResult {
+	if x != nil {
+		if x, ok := x.Payload.(*ExecOutput_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isExecOutput_Payload interface {
+	isExecOutput_Payload()
+}
+
+type ExecOutput_JobId struct {
+	// job_id is sent first so the caller can follow the job elsewhere
+	JobId string `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3,oneof"`
+}
+
+type ExecOutput_Line struct {
+	Line *OutputLine `protobuf:"bytes,2,opt,name=line,proto3,oneof"`
+}
+
+type ExecOutput_Result struct {
+	Result *ExecResult `protobuf:"bytes,3,opt,name=result,proto3,oneof"`
+}
+
+func (*ExecOutput_JobId) isExecOutput_Payload() {}
+
+func (*ExecOutput_Line) isExecOutput_Payload() {}
+
+func (*ExecOutput_Result) isExecOutput_Payload() {}
+
+type OutputLine struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// stream is "stdout", "stderr" or "step"; step lines name the script step that just started
+	Stream        string `protobuf:"bytes,1,opt,name=stream,proto3" json:"stream,omitempty"`
+	Text          string `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OutputLine) Reset() {
+	*x = OutputLine{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutputLine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutputLine) ProtoMessage() {}
+
+func (x *OutputLine) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutputLine.ProtoReflect.Descriptor instead.
+func (*OutputLine) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *OutputLine) GetStream() string {
+	if x != nil {
+		return x.Stream
+	}
+	return ""
+}
+
+func (x *OutputLine) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type ExecResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ExitCode      int32                  `protobuf:"varint,1,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,2,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Truncated     bool                   `protobuf:"varint,3,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecResult) Reset() {
+	*x = ExecResult{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecResult) ProtoMessage() {}
+
+func (x *ExecResult) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecResult.ProtoReflect.Descriptor instead.
+func (*ExecResult) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ExecResult) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *ExecResult) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *ExecResult) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+type WatchEventsRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	AfterId uint64                 `protobuf:"varint,1,opt,name=after_id,json=afterId,proto3" json:"after_id,omitempty"`
+	// types filters by event type; a bare prefix such as "job" matches every job event
+	Types         []string `protobuf:"bytes,2,rep,name=types,proto3" json:"types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *WatchEventsRequest) GetAfterId() uint64 {
+	if x != nil {
+		return x.AfterId
+	}
+	return 0
+}
+
+func (x *WatchEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+type Event struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type     string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	TimeUnix int64                  `protobuf:"varint,3,opt,name=time_unix,json=timeUnix,proto3" json:"time_unix,omitempty"`
+	// data_json is the JSON payload, the same as the "data" field of events on /events
+	DataJson      string `protobuf:"bytes,4,opt,name=data_json,json=dataJson,proto3" json:"data_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_accmgrpb_accmgr_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_accmgrpb_accmgr_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *Event) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetTimeUnix() int64 {
+	if x != nil {
+		return x.TimeUnix
+	}
+	return 0
+}
+
+func (x *Event) GetDataJson() string {
+	if x != nil {
+		return x.DataJson
+	}
+	return ""
+}
+
+var File_accmgrpb_accmgr_proto protoreflect.FileDescriptor
+
+const file_accmgrpb_accmgr_proto_rawDesc = "" +
+	"\n" +
+	"\x15accmgrpb/accmgr.proto\x12\taccmgr.v1\"\xc5\x01\n" +
+	"\x06Server\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05group\x18\x03 \x01(\tR\x05group\x12\x1d\n" +
+	"\n" +
+	"login_user\x18\x04 \x01(\tR\tloginUser\x12\x1b\n" +
+	"\tuse_agent\x18\x05 \x01(\bR\buseAgent\x12\x1a\n" +
+	"\baccounts\x18\x06 \x03(\tR\baccounts\x12)\n" +
+	"\x06health\x18\a \x01(\v2\x11.accmgr.v1.HealthR\x06health\"\xba\x01\n" +
+	"\x06Health\x12&\n" +
+	"\x0fchecked_at_unix\x18\x01 \x01(\x03R\rcheckedAtUnix\x12\x1c\n" +
+	"\treachable\x18\x02 \x01(\bR\treachable\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12,\n" +
+	"\x12clock_skew_seconds\x18\x04 \x01(\x03R\x10clockSkewSeconds\x12&\n" +
+	"\x0fclock_skew_high\x18\x05 \x01(\bR\rclockSkewHigh\"*\n" +
+	"\x12ListServersRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\"B\n" +
+	"\x13ListServersResponse\x12+\n" +
+	"\aservers\x18\x01 \x03(\v2\x11.accmgr.v1.ServerR\aservers\"\"\n" +
+	"\x10GetServerRequest\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\"\xd9\x02\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x16\n" +
+	"\x06server\x18\x03 \x01(\tR\x06server\x12 \n" +
+	"\vdescription\x18\x04 \x01(\tR\vdescription\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12\x1a\n" +
+	"\bprogress\x18\x06 \x01(\tR\bprogress\x12 \n" +
+	"\texit_code\x18\a \x01(\x05H\x00R\bexitCode\x88\x01\x01\x12\x14\n" +
+	"\x05error\x18\b \x01(\tR\x05error\x12&\n" +
+	"\x0fstarted_at_unix\x18\t \x01(\x03R\rstartedAtUnix\x12(\n" +
+	"\x10finished_at_unix\x18\n" +
+	" \x01(\x03R\x0efinishedAtUnix\x12(\n" +
+	"\x05notes\x18\v \x03(\v2\x12.accmgr.v1.JobNoteR\x05notesB\f\n" +
+	"\n" +
+	"_exit_code\"]\n" +
+	"\aJobNote\x12\x16\n" +
+	"\x06author\x18\x01 \x01(\tR\x06author\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12&\n" +
+	"\x0fcreated_at_unix\x18\x03 \x01(\x03R\rcreatedAtUnix\")\n" +
+	"\x0fListJobsRequest\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\"6\n" +
+	"\x10ListJobsResponse\x12\"\n" +
+	"\x04jobs\x18\x01 \x03(\v2\x0e.accmgr.v1.JobR\x04jobs\"\x1f\n" +
+	"\rGetJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"O\n" +
+	"\x11AddJobNoteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06author\x18\x02 \x01(\tR\x06author\x12\x12\n" +
+	"\x04text\x18\x03 \x01(\tR\x04text\"\xde\x01\n" +
+	"\vExecRequest\x12\x16\n" +
+	"\x06server\x18\x01 \x01(\tR\x06server\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\x12\x1a\n" +
+	"\bescalate\x18\x03 \x01(\bR\bescalate\x12\x16\n" +
+	"\x06upload\x18\x04 \x01(\bR\x06upload\x121\n" +
+	"\x03env\x18\x05 \x03(\v2\x1f.accmgr.v1.ExecRequest.EnvEntryR\x03env\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8e\x01\n" +
+	"\n" +
+	"ExecOutput\x12\x17\n" +
+	"\x06job_id\x18\x01 \x01(\tH\x00R\x05jobId\x12+\n" +
+	"\x04line\x18\x02 \x01(\v2\x15.accmgr.v1.OutputLineH\x00R\x04line\x12/\n" +
+	"\x06result\x18\x03 \x01(\v2\x15.accmgr.v1.ExecResultH\x00R\x06resultB\t\n" +
+	"\apayload\"8\n" +
+	"\n" +
+	"OutputLine\x12\x16\n" +
+	"\x06stream\x18\x01 \x01(\tR\x06stream\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\"h\n" +
+	"\n" +
+	"ExecResult\x12\x1b\n" +
+	"\texit_code\x18\x01 \x01(\x05R\bexitCode\x12\x1f\n" +
+	"\vduration_ms\x18\x02 \x01(\x03R\n" +
+	"durationMs\x12\x1c\n" +
+	"\ttruncated\x18\x03 \x01(\bR\ttruncated\"E\n" +
+	"\x12WatchEventsRequest\x12\x19\n" +
+	"\bafter_id\x18\x01 \x01(\x04R\aafterId\x12\x14\n" +
+	"\x05types\x18\x02 \x03(\tR\x05types\"e\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x1b\n" +
+	"\ttime_unix\x18\x03 \x01(\x03R\btimeUnix\x12\x1b\n" +
+	"\tdata_json\x18\x04 \x01(\tR\bdataJson2\xcb\x03\n" +
+	"\x0eAccountManager\x12L\n" +
+	"\vListServers\x12\x1d.accmgr.v1.ListServersRequest\x1a\x1e.accmgr.v1.ListServersResponse\x12;\n" +
+	"\tGetServer\x12\x1b.accmgr.v1.GetServerRequest\x1a\x11.accmgr.v1.Server\x12C\n" +
+	"\bListJobs\x12\x1a.accmgr.v1.ListJobsRequest\x1a\x1b.accmgr.v1.ListJobsResponse\x122\n" +
+	"\x06GetJob\x12\x18.accmgr.v1.GetJobRequest\x1a\x0e.accmgr.v1.Job\x12:\n" +
+	"\n" +
+	"AddJobNote\x12\x1c.accmgr.v1.AddJobNoteRequest\x1a\x0e.accmgr.v1.Job\x127\n" +
+	"\x04Exec\x12\x16.accmgr.v1.ExecRequest\x1a\x15.accmgr.v1.ExecOutput0\x01\x12@\n" +
+	"\vWatchEvents\x12\x1d.accmgr.v1.WatchEventsRequest\x1a\x10.accmgr.v1.Event0\x01B\x19Z\x17accountmanager/accmgrpbb\x06proto3"
+
+var (
+	file_accmgrpb_accmgr_proto_rawDescOnce sync.Once
+	file_accmgrpb_accmgr_proto_rawDescData []byte
+)
+
+func file_accmgrpb_accmgr_proto_rawDescGZIP() []byte {
+	file_accmgrpb_accmgr_proto_rawDescOnce.Do(func() {
+		file_accmgrpb_accmgr_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_accmgrpb_accmgr_proto_rawDesc), len(file_accmgrpb_accmgr_proto_rawDesc)))
+	})
+	return file_accmgrpb_accmgr_proto_rawDescData
+}
+
+var file_accmgrpb_accmgr_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
+var file_accmgrpb_accmgr_proto_goTypes = []any{
+	(*Server)(nil),              // 0: accmgr.v1.Server
+	(*Health)(nil),              // 1: accmgr.v1.Health
+	(*ListServersRequest)(nil),  // 2: accmgr.v1.ListServersRequest
+	(*ListServersResponse)(nil), // 3: accmgr.v1.ListServersResponse
+	(*GetServerRequest)(nil),    // 4: accmgr.v1.GetServerRequest
+	(*Job)(nil),                 // 5: accmgr.v1.Job
+	(*JobNote)(nil),             // 6: accmgr.v1.JobNote
+	(*ListJobsRequest)(nil),     // 7: accmgr.v1.ListJobsRequest
+	(*ListJobsResponse)(nil),    // 8: accmgr.v1.ListJobsResponse
+	(*GetJobRequest)(nil),       // 9: accmgr.v1.GetJobRequest
+	(*AddJobNoteRequest)(nil),   // 10: accmgr.v1.AddJobNoteRequest
+	(*ExecRequest)(nil),         // 11: accmgr.v1.ExecRequest
+	(*ExecOutput)(nil),          // 12: accmgr.v1.ExecOutput
+	(*OutputLine)(nil),          // 13: accmgr.v1.OutputLine
+	(*ExecResult)(nil),          // 14: accmgr.v1.ExecResult
+	(*WatchEventsRequest)(nil),  // 15: accmgr.v1.WatchEventsRequest
+	(*Event)(nil),               // 16: accmgr.v1.Event
+	nil,                         // 17: accmgr.v1.ExecRequest.EnvEntry
+}
+var file_accmgrpb_accmgr_proto_depIdxs = []int32{
+	1,  // 0: accmgr.v1.Server.health:type_name -> accmgr.v1.Health
+	0,  // 1: accmgr.v1.ListServersResponse.servers:type_name -> accmgr.v1.Server
+	6,  // 2: accmgr.v1.Job.notes:type_name -> accmgr.v1.JobNote
+	5,  // 3: accmgr.v1.ListJobsResponse.jobs:type_name -> accmgr.v1.Job
+	17, // 4: accmgr.v1.ExecRequest.env:type_name -> accmgr.v1.ExecRequest.EnvEntry
+	13, // 5: accmgr.v1.ExecOutput.line:type_name -> accmgr.v1.OutputLine
+	14, // 6: accmgr.v1.ExecOutput.result:type_name -> accmgr.v1.ExecResult
+	2,  // 7: accmgr.v1.AccountManager.ListServers:input_type -> accmgr.v1.ListServersRequest
+	4,  // 8: accmgr.v1.AccountManager.GetServer:input_type -> accmgr.v1.GetServerRequest
+	7,  // 9: accmgr.v1.AccountManager.ListJobs:input_type -> accmgr.v1.ListJobsRequest
+	9,  // 10: accmgr.v1.AccountManager.GetJob:input_type -> accmgr.v1.GetJobRequest
+	10, // 11: accmgr.v1.AccountManager.AddJobNote:input_type -> accmgr.v1.AddJobNoteRequest
+	11, // 12: accmgr.v1.AccountManager.Exec:input_type -> accmgr.v1.ExecRequest
+	15, // 13: accmgr.v1.AccountManager.WatchEvents:input_type -> accmgr.v1.WatchEventsRequest
+	3,  // 14: accmgr.v1.AccountManager.ListServers:output_type -> accmgr.v1.ListServersResponse
+	0,  // 15: accmgr.v1.AccountManager.GetServer:output_type -> accmgr.v1.Server
+	8,  // 16: accmgr.v1.AccountManager.ListJobs:output_type -> accmgr.v1.ListJobsResponse
+	5,  // 17: accmgr.v1.AccountManager.GetJob:output_type -> accmgr.v1.Job
+	5,  // 18: accmgr.v1.AccountManager.AddJobNote:output_type -> accmgr.v1.Job
+	12, // 19: accmgr.v1.AccountManager.Exec:output_type -> accmgr.v1.ExecOutput
+	16, // 20: accmgr.v1.AccountManager.WatchEvents:output_type -> accmgr.v1.Event
+	14, // [14:21] is the sub-list for method output_type
+	7,  // [7:14] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_accmgrpb_accmgr_proto_init() }
+func file_accmgrpb_accmgr_proto_init() {
+	if File_accmgrpb_accmgr_proto != nil {
+		return
+	}
+	file_accmgrpb_accmgr_proto_msgTypes[5].OneofWrappers = []any{}
+	file_accmgrpb_accmgr_proto_msgTypes[12].OneofWrappers = []any{
+		(*ExecOutput_JobId)(nil),
+		(*ExecOutput_Line)(nil),
+		(*ExecOutput_Result)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_accmgrpb_accmgr_proto_rawDesc), len(file_accmgrpb_accmgr_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   18,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_accmgrpb_accmgr_proto_goTypes,
+		DependencyIndexes: file_accmgrpb_accmgr_proto_depIdxs,
+		MessageInfos:      file_accmgrpb_accmgr_proto_msgTypes,
+	}.Build()
+	File_accmgrpb_accmgr_proto = out.File
+	file_accmgrpb_accmgr_proto_goTypes = nil
+	file_accmgrpb_accmgr_proto_depIdxs = nil
+}
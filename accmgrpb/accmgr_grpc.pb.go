@@ -0,0 +1,376 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v29.3.0
+// source: accmgrpb/accmgr.proto
+
+package accmgrpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	AccountManager_ListServers_FullMethodName = "/accmgr.v1.AccountManager/ListServers"
+	AccountManager_GetServer_FullMethodName   = "/accmgr.v1.AccountManager/GetServer"
+	AccountManager_ListJobs_FullMethodName    = "/accmgr.v1.AccountManager/ListJobs"
+	AccountManager_GetJob_FullMethodName      = "/accmgr.v1.AccountManager/GetJob"
+	AccountManager_AddJobNote_FullMethodName  = "/accmgr.v1.AccountManager/AddJobNote"
+	AccountManager_Exec_FullMethodName        = "/accmgr.v1.AccountManager/Exec"
+	AccountManager_WatchEvents_FullMethodName = "/accmgr.v1.AccountManager/WatchEvents"
+)
+
+// AccountManagerClient is the client API for AccountManager service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// AccountManager mirrors the /api/v1 REST API for callers that need streaming,
+// such as the dial-back agent and high-volume automation.
+type AccountManagerClient interface {
+	// ListServers returns servers with their latest health, optionally filtered by group
+	ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error)
+	// GetServer returns one server
+	GetServer(ctx context.Context, in *GetServerRequest, opts ...grpc.CallOption) (*Server, error)
+	// ListJobs returns recent jobs, newest first
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// GetJob returns one job
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// AddJobNote pins a handoff note to a running job; FailedPrecondition once it has finished
+	AddJobNote(ctx context.Context, in *AddJobNoteRequest, opts ...grpc.CallOption) (*Job, error)
+	// Exec runs a command and streams its output line by line, ending with the result
+	Exec(ctx context.Context, in *ExecRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExecOutput], error)
+	// WatchEvents streams job and alert events, replaying stored events after after_id first
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type accountManagerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAccountManagerClient(cc grpc.ClientConnInterface) AccountManagerClient {
+	return &accountManagerClient{cc}
+}
+
+func (c *accountManagerClient) ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListServersResponse)
+	err := c.cc.Invoke(ctx, AccountManager_ListServers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accountManagerClient) GetServer(ctx context.Context, in *GetServerRequest, opts ...grpc.CallOption) (*Server, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Server)
+	err := c.cc.Invoke(ctx, AccountManager_GetServer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accountManagerClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, AccountManager_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accountManagerClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, AccountManager_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accountManagerClient) AddJobNote(ctx context.Context, in *AddJobNoteRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, AccountManager_AddJobNote_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accountManagerClient) Exec(ctx context.Context, in *ExecRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExecOutput], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AccountManager_ServiceDesc.Streams[0], AccountManager_Exec_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExecRequest, ExecOutput]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AccountManager_ExecClient = grpc.ServerStreamingClient[ExecOutput]
+
+func (c *accountManagerClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AccountManager_ServiceDesc.Streams[1], AccountManager_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AccountManager_WatchEventsClient = grpc.ServerStreamingClient[Event]
+
+// AccountManagerServer is the server API for AccountManager service.
+// All implementations must embed UnimplementedAccountManagerServer
+// for forward compatibility.
+//
+// AccountManager mirrors the /api/v1 REST API for callers that need streaming,
+// such as the dial-back agent and high-volume automation.
+type AccountManagerServer interface {
+	// ListServers returns servers with their latest health, optionally filtered by group
+	ListServers(context.Context, *ListServersRequest) (*ListServersResponse, error)
+	// GetServer returns one server
+	GetServer(context.Context, *GetServerRequest) (*Server, error)
+	// ListJobs returns recent jobs, newest first
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// GetJob returns one job
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// AddJobNote pins a handoff note to a running job; FailedPrecondition once it has finished
+	AddJobNote(context.Context, *AddJobNoteRequest) (*Job, error)
+	// Exec runs a command and streams its output line by line, ending with the result
+	Exec(*ExecRequest, grpc.ServerStreamingServer[ExecOutput]) error
+	// WatchEvents streams job and alert events, replaying stored events after after_id first
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedAccountManagerServer()
+}
+
+// UnimplementedAccountManagerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAccountManagerServer struct{}
+
+func (UnimplementedAccountManagerServer) ListServers(context.Context, *ListServersRequest) (*ListServersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServers not implemented")
+}
+func (UnimplementedAccountManagerServer) GetServer(context.Context, *GetServerRequest) (*Server, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServer not implemented")
+}
+func (UnimplementedAccountManagerServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedAccountManagerServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedAccountManagerServer) AddJobNote(context.Context, *AddJobNoteRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddJobNote not implemented")
+}
+func (UnimplementedAccountManagerServer) Exec(*ExecRequest, grpc.ServerStreamingServer[ExecOutput]) error {
+	return status.Errorf(codes.Unimplemented, "method Exec not implemented")
+}
+func (UnimplementedAccountManagerServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedAccountManagerServer) mustEmbedUnimplementedAccountManagerServer() {}
+func (UnimplementedAccountManagerServer) testEmbeddedByValue()                        {}
+
+// UnsafeAccountManagerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AccountManagerServer will
+// result in compilation errors.
+type UnsafeAccountManagerServer interface {
+	mustEmbedUnimplementedAccountManagerServer()
+}
+
+func RegisterAccountManagerServer(s grpc.ServiceRegistrar, srv AccountManagerServer) {
+	// If the following call pancis, it indicates UnimplementedAccountManagerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AccountManager_ServiceDesc, srv)
+}
+
+func _AccountManager_ListServers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountManagerServer).ListServers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AccountManager_ListServers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccountManagerServer).ListServers(ctx, req.(*ListServersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AccountManager_GetServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountManagerServer).GetServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AccountManager_GetServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccountManagerServer).GetServer(ctx, req.(*GetServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AccountManager_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountManagerServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AccountManager_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccountManagerServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AccountManager_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountManagerServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AccountManager_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccountManagerServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AccountManager_AddJobNote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddJobNoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccountManagerServer).AddJobNote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AccountManager_AddJobNote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccountManagerServer).AddJobNote(ctx, req.(*AddJobNoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AccountManager_Exec_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExecRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AccountManagerServer).Exec(m, &grpc.GenericServerStream[ExecRequest, ExecOutput]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AccountManager_ExecServer = grpc.ServerStreamingServer[ExecOutput]
+
+func _AccountManager_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AccountManagerServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AccountManager_WatchEventsServer = grpc.ServerStreamingServer[Event]
+
+// AccountManager_ServiceDesc is the grpc.ServiceDesc for AccountManager service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AccountManager_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "accmgr.v1.AccountManager",
+	HandlerType: (*AccountManagerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListServers",
+			Handler:    _AccountManager_ListServers_Handler,
+		},
+		{
+			MethodName: "GetServer",
+			Handler:    _AccountManager_GetServer_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _AccountManager_ListJobs_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _AccountManager_GetJob_Handler,
+		},
+		{
+			MethodName: "AddJobNote",
+			Handler:    _AccountManager_AddJobNote_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Exec",
+			Handler:       _AccountManager_Exec_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _AccountManager_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "accmgrpb/accmgr.proto",
+}
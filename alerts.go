@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Alert is an active problem raised by a background check
+type Alert struct {
+	Key      string    `json:"key"`
+	Server   string    `json:"server"`
+	Severity string    `json:"severity"` // "warning" or "critical"
+	Message  string    `json:"message"`
+	RaisedAt time.Time `json:"raised_at"`
+}
+
+var (
+	alertsMu     sync.Mutex
+	activeAlerts = make(map[string]Alert)
+)
+
+// raiseAlert records or refreshes an alert; the original raise time is kept while it stays active.
+// Pollers re-raise failing checks every cycle, so an event is only published when the alert
+// is new or its severity or message changed.
+func raiseAlert(key, server, severity, message string) {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alert := Alert{Key: key, Server: server, Severity: severity, Message: message, RaisedAt: time.Now()}
+	existing, ok := activeAlerts[key]
+	if ok {
+		alert.RaisedAt = existing.RaisedAt
+	}
+	activeAlerts[key] = alert
+	if !ok || existing.Severity != severity || existing.Message != message {
+		publishEvent("alert.raised", alert)
+	}
+}
+
+// clearAlert resolves an alert if it is active
+func clearAlert(key string) {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+	if alert, ok := activeAlerts[key]; ok {
+		delete(activeAlerts, key)
+		publishEvent("alert.cleared", alert)
+	}
+}
+
+// currentAlerts returns active alerts, most severe and oldest first
+func currentAlerts() []Alert {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alerts := make([]Alert, 0, len(activeAlerts))
+	for _, alert := range activeAlerts {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Severity != alerts[j].Severity {
+			return alerts[i].Severity == "critical"
+		}
+		return alerts[i].RaisedAt.Before(alerts[j].RaisedAt)
+	})
+	return alerts
+}
+
+// dismissAlertHandler clears an alert by key; checks that still fail will raise it again
+func dismissAlertHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	clearAlert(r.FormValue("key"))
+	http.Redirect(w, r, appPath(r, "/"), http.StatusSeeOther)
+}
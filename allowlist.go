@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The web UI, the API and gRPC can be limited to a list of networks, such as the VPN's, so
+// they do not answer the internet even when the port is exposed by mistake. Addresses
+// outside the list get a bare 403 before anything else, sign-in included, looks at the
+// request. Behind a reverse proxy, -trust-proxy makes the list apply to the address the
+// proxy saw rather than the proxy's own.
+
+var (
+	// allowCIDRs are the networks allowed in, comma-separated, e.g. 10.8.0.0/16,192.168.1.5;
+	// empty allows every address
+	allowCIDRs string
+	// allowedNetworks are allowCIDRs parsed
+	allowedNetworks []netip.Prefix
+
+	deniedMu sync.Mutex
+	// deniedReported is when each refused address was last written to the audit log
+	deniedReported = make(map[string]time.Time)
+)
+
+// deniedReportInterval keeps an address that keeps knocking from filling the audit log
+const deniedReportInterval = time.Hour
+
+// parseNetworks parses comma-separated addresses and CIDR ranges given with the flag named
+// flagName; an address is a range of one
+func parseNetworks(flagName, value string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, entry := range splitList(value) {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is neither an address nor a CIDR range", flagName, entry)
+			}
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", flagName, err)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// networksContain reports whether an address is in one of the networks
+func networksContain(networks []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAllowlist parses allowCIDRs before anything is served
+func parseAllowlist() (err error) {
+	allowedNetworks, err = parseNetworks("-allow-cidr", allowCIDRs)
+	return err
+}
+
+// ipAllowed reports whether an address is on the allowlist
+func ipAllowed(ip string) bool {
+	return len(allowedNetworks) == 0 || networksContain(allowedNetworks, ip)
+}
+
+// reportDenied writes a refused address to the audit log, once an hour per address
+func reportDenied(r *http.Request, ip, detail string) {
+	now := time.Now()
+	deniedMu.Lock()
+	last, seen := deniedReported[ip]
+	if !seen || now.Sub(last) > deniedReportInterval {
+		deniedReported[ip] = now
+	}
+	for address, reported := range deniedReported {
+		if now.Sub(reported) > deniedReportInterval {
+			delete(deniedReported, address)
+		}
+	}
+	deniedMu.Unlock()
+	if !seen || now.Sub(last) > deniedReportInterval {
+		fmt.Printf("🚫 Refused %s: not on the allowlist\n", ip)
+		recordAudit(r, "access.denied", "", detail)
+	}
+}
+
+// withIPAllowlist refuses requests from addresses outside the allowlist
+func withIPAllowlist(next http.Handler) http.Handler {
+	if len(allowedNetworks) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := clientIP(r); !ipAllowed(ip) {
+			reportDenied(r, ip, "not on the allowlist: "+r.Method+" "+r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// grpcPeerAllowed refuses gRPC calls from addresses outside the allowlist
+func grpcPeerAllowed(ctx context.Context, method string) error {
+	if len(allowedNetworks) == 0 {
+		return nil
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.PermissionDenied, "forbidden")
+	}
+	ip, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		ip = p.Addr.String()
+	}
+	if !ipAllowed(ip) {
+		r := &http.Request{RemoteAddr: p.Addr.String()}
+		reportDenied(r, ip, "not on the allowlist: gRPC "+method)
+		return status.Error(codes.PermissionDenied, "forbidden")
+	}
+	return nil
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:generate go run . -generate-client client/client.go
+
+// apiParam documents a path or query parameter of an API route
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Description string
+}
+
+// apiRoute is one /api/v1 endpoint. The registry drives routing, the OpenAPI document
+// and the generated Go client, so a route only has to be described once.
+type apiRoute struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Params      []apiParam
+	Request     any // zero value of the JSON request body type, or nil
+	Response    any // zero value of the JSON response type
+	Handler     http.HandlerFunc
+}
+
+// APIServer is a server record as exposed over the API; credentials are never included
+type APIServer struct {
+	IP        string     `json:"ip"`
+	Name      string     `json:"name"`
+	Group     string     `json:"group,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	LoginUser string     `json:"login_user"`
+	Platform  string     `json:"platform"` // "linux" or "windows"
+	UseAgent  bool       `json:"use_agent"`
+	Accounts  []string   `json:"accounts"`
+	Health    *APIHealth `json:"health,omitempty"`
+}
+
+// APIHealth is the latest health poll for a server
+type APIHealth struct {
+	CheckedAt        time.Time `json:"checked_at"`
+	Reachable        bool      `json:"reachable"`
+	Error            string    `json:"error,omitempty"`
+	ClockSkewSeconds int       `json:"clock_skew_seconds"`
+	ClockSkewHigh    bool      `json:"clock_skew_high"`
+}
+
+// APIAlert is an active alert
+type APIAlert struct {
+	Key      string    `json:"key"`
+	Server   string    `json:"server"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+	RaisedAt time.Time `json:"raised_at"`
+}
+
+// APICommandRequest runs an ad-hoc command on a server
+type APICommandRequest struct {
+	Command  string `json:"command"`
+	Escalate bool   `json:"escalate,omitempty"`
+	// Upload sends the command as a script file over SFTP instead of on stdin
+	Upload bool `json:"upload,omitempty"`
+	// Env is exported for this command only, overriding the configured variables
+	Env map[string]string `json:"env,omitempty"`
+	// DryRun checks the login and returns the plan without running anything
+	DryRun bool `json:"dry_run,omitempty"`
+	// Artifacts are remote paths or glob patterns fetched over SFTP after the command runs
+	// and attached to its job
+	Artifacts []string `json:"artifacts,omitempty"`
+	// Timeout limits the command's job, e.g. "10s" or "30m"; the server's default applies
+	// when it is empty
+	Timeout string `json:"timeout,omitempty"`
+	// Priority is "low", "normal" or "urgent"; an urgent command waiting for a server that
+	// is busy runs before the other jobs waiting there
+	Priority string `json:"priority,omitempty"`
+}
+
+// APICommandResponse is the outcome of an ad-hoc command that ran to completion
+type APICommandResponse struct {
+	JobID      string `json:"job_id,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMS int64  `json:"duration_ms"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	Truncated  bool   `json:"truncated"`
+	// Plan is set instead of any output for dry runs
+	Plan *CommandPlan `json:"plan,omitempty"`
+	// Artifacts lists the files collected for the request's artifact patterns
+	Artifacts []JobArtifact `json:"artifacts,omitempty"`
+	// Pending is set, with no output, when an approval rule held the command back; it runs
+	// once another operator approves job_id
+	Pending bool `json:"pending,omitempty"`
+}
+
+// APIJob is a long-running operation and its outcome
+type APIJob struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	Server      string `json:"server,omitempty"`
+	Description string `json:"description"`
+	Operator    string `json:"operator,omitempty"`
+	Status      string `json:"status"`
+	Progress    string `json:"progress,omitempty"`
+	// Step and Steps are how far a recipe, install or upgrade got, e.g. step 3 of 7
+	Step       int        `json:"step,omitempty"`
+	Steps      int        `json:"steps,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	QueuedAt   *time.Time `json:"queued_at,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Notes      []JobNote  `json:"notes,omitempty"`
+	// Artifacts are files collected after the job ran, downloadable from the job page
+	Artifacts []JobArtifact `json:"artifacts,omitempty"`
+	// Log is the outcome of a queued job, such as a software install, once it finished
+	Log string `json:"log,omitempty"`
+	// CancelledBy is who cancelled the job, once it was cancelled
+	CancelledBy string `json:"cancelled_by,omitempty"`
+	// Notify overrides the global notification setting for the job
+	Notify string `json:"notify,omitempty"`
+	// TimeoutSeconds is the job's own time limit, when it set one
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// TimedOut is set when the job was stopped at its time limit
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Priority is "low" or "urgent" for a job that did not run at normal priority
+	Priority string `json:"priority,omitempty"`
+	// Targets are the servers of a batch job, such as a command template run on a group;
+	// its summary has each server's outcome
+	Targets []string `json:"targets,omitempty"`
+	// Parent is the batch job that started this server's job
+	Parent string `json:"parent,omitempty"`
+	// RetryOf is the batch job whose failed servers this one retried; the original's
+	// summary has the merged outcomes
+	RetryOf string `json:"retry_of,omitempty"`
+	// Approval is the approval rule that held the job as "pending" until someone approved it
+	Approval string `json:"approval,omitempty"`
+	// ApprovedBy is the operator who approved a held job
+	ApprovedBy string `json:"approved_by,omitempty"`
+	// HeldBy is the maintenance window a job is waiting for, while it waits
+	HeldBy string `json:"held_by,omitempty"`
+}
+
+// APIJobNoteRequest pins a handoff note to a running job; the note is signed with the
+// request's user
+type APIJobNoteRequest struct {
+	Text string `json:"text"`
+}
+
+// APIError is returned with every non-2xx response
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// apiRoutes is the /api/v1 route registry
+var apiRoutes = []apiRoute{
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/servers",
+		OperationID: "listServers",
+		Summary:     "List servers with their latest health",
+		Params: []apiParam{
+			{Name: "group", In: "query", Description: "Only return servers in this group"},
+			{Name: "tag", In: "query", Description: "Only return servers with this tag"},
+		},
+		Response: []APIServer{},
+		Handler:  apiListServersHandler,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/servers/{ip}",
+		OperationID: "getServer",
+		Summary:     "Get one server",
+		Params:      []apiParam{{Name: "ip", In: "path", Description: "Server IP address"}},
+		Response:    APIServer{},
+		Handler:     apiGetServerHandler,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/servers/{ip}/commands",
+		OperationID: "runCommand",
+		Summary:     "Run a command as the login user, or as root when escalate is set. With dry_run the login is checked and the exact command returned without running it. Returns 502 when the server cannot be reached. A command an approval rule holds back is not run: it gets 202 with pending set and the job that runs it once another operator approves it. A request repeating the Idempotency-Key header of an earlier one does not run again; it gets 409 with the Location of the first one's job, or 422 when its body differs",
+		Params:      []apiParam{{Name: "ip", In: "path", Description: "Server IP address"}},
+		Request:     APICommandRequest{},
+		Response:    APICommandResponse{},
+		Handler:     idempotent(apiRunCommandHandler),
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/alerts",
+		OperationID: "listAlerts",
+		Summary:     "List active alerts, most severe first",
+		Response:    []APIAlert{},
+		Handler:     apiListAlertsHandler,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/jobs",
+		OperationID: "listJobs",
+		Summary:     "List recent jobs, newest first. Live updates are available from the /events stream",
+		Params:      []apiParam{{Name: "status", In: "query", Description: "Only return jobs with this status: pending (waiting for approval), queued, running, succeeded, failed or cancelled"}},
+		Response:    []APIJob{},
+		Handler:     apiListJobsHandler,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/jobs/{id}",
+		OperationID: "getJob",
+		Summary:     "Get one job",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "Job ID"}},
+		Response:    APIJob{},
+		Handler:     apiGetJobHandler,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/jobs/{id}/summary",
+		OperationID: "getJobSummary",
+		Summary:     "Get the per-server outcomes of a batch job, such as a command template run on a group, with pass/fail counts. Returns 404 for a job that does not run on many servers",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "Batch job ID"}},
+		Response:    BatchSummary{},
+		Handler:     apiGetJobSummaryHandler,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/jobs/{id}/notes",
+		OperationID: "addJobNote",
+		Summary:     "Pin a handoff note to a running job, e.g. \"waiting on mirror, do not cancel\". Returns 409 once the job has finished",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "Job ID"}},
+		Request:     APIJobNoteRequest{},
+		Response:    APIJob{},
+		Handler:     apiAddJobNoteHandler,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/jobs/{id}/cancel",
+		OperationID: "cancelJob",
+		Summary:     "Cancel a pending, queued or running job. A pending job is rejected and a queued one removed from the queue; a running job's command is interrupted and the job finishes as cancelled shortly after. Returns 409 once the job has finished",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "Job ID"}},
+		Response:    APIJob{},
+		Handler:     apiCancelJobHandler,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/jobs/{id}/approve",
+		OperationID: "approveJob",
+		Summary:     "Approve a job an approval rule held as pending, so it is queued to run. Returns 403 for the operator who started the job or an unidentified one, and 409 for a job not waiting for approval",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "Job ID"}},
+		Response:    APIJob{},
+		Handler:     apiApproveJobHandler,
+	},
+}
+
+// registerAPIRoutes mounts the registry, the OpenAPI document and the docs page
+func registerAPIRoutes() {
+	for _, route := range apiRoutes {
+		http.HandleFunc(route.Method+" "+route.Path, route.Handler)
+	}
+	http.HandleFunc("GET /api/openapi.json", openAPIHandler)
+	http.HandleFunc("GET /api/docs", apiDocsHandler)
+}
+
+// writeJSON encodes a response body with the given status
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeAPIError sends an APIError body
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, APIError{Error: message})
+}
+
+// newAPIServer converts a server record for the API
+func newAPIServer(ip string, server ServerInfo, health map[string]ServerHealth) APIServer {
+	out := APIServer{
+		IP:        ip,
+		Name:      serverDisplayName(ip, server),
+		Group:     server.Group,
+		Tags:      server.Tags,
+		LoginUser: loginAccount(server).RootUsername,
+		Platform:  "linux",
+		UseAgent:  server.UseAgent,
+		Accounts:  []string{},
+	}
+	if server.isWindows() {
+		out.Platform = platformWindows
+	}
+	for _, account := range server.Accounts {
+		out.Accounts = append(out.Accounts, account.Username)
+	}
+	if h, ok := health[ip]; ok {
+		out.Health = &APIHealth{
+			CheckedAt:        h.CheckedAt,
+			Reachable:        h.Reachable,
+			Error:            h.Error,
+			ClockSkewSeconds: int(h.ClockSkew / time.Second),
+			ClockSkewHigh:    h.ClockSkewHigh,
+		}
+	}
+	return out
+}
+
+func apiListServersHandler(w http.ResponseWriter, r *http.Request) {
+	group, tag := r.URL.Query().Get("group"), r.URL.Query().Get("tag")
+	health := healthSnapshot()
+	servers := []APIServer{}
+	for ip, server := range requestServers(r) {
+		if (group == "" || server.Group == group) && (tag == "" || server.hasTag(tag)) {
+			servers = append(servers, newAPIServer(ip, server, health))
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].IP < servers[j].IP })
+	writeJSON(w, http.StatusOK, servers)
+}
+
+func apiGetServerHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.PathValue("ip")
+	server, ok := serversSnapshot()[ip]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIServer(ip, server, healthSnapshot()))
+}
+
+func apiRunCommandHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.PathValue("ip")
+	server, ok := serversSnapshot()[ip]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+
+	var req APICommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeAPIError(w, http.StatusBadRequest, "command is required")
+		return
+	}
+	for name := range req.Env {
+		if !envNamePattern.MatchString(name) {
+			writeAPIError(w, http.StatusBadRequest, "invalid environment variable name: "+name)
+			return
+		}
+	}
+	timeout, err := parseJobTimeout(req.Timeout)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	priority, err := parseJobPriority(req.Priority)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	operator := requestOperator(r)
+	server, err = operatorServer(server, operator)
+	if err != nil {
+		writeAPIError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	opts := adHocOptions{Escalate: req.Escalate, Upload: req.Upload, Env: req.Env}
+	if req.DryRun {
+		plan, err := planAdHocCommand(server, operatorScript(server, req.Command, operator, "dry-run"), opts)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := checkLogin(ip, plan); err != nil {
+			writeAPIError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, APICommandResponse{Plan: &plan})
+		return
+	}
+
+	if rule, ok := approvalRuleFor("command", map[string]ServerInfo{ip: server}, req.Command); ok {
+		job := requestApproval(operator, "command", ip, firstLine(req.Command), priority, rule.Name, jobTargets{"command", map[string]ServerInfo{ip: server}}, func(job *Job) jobResult {
+			job.setTimeout(timeout)
+			result, err := runAdHocCommand(job.context(), ip, server, operatorScript(server, req.Command, operator, job.ID), opts, job.output)
+			if err == nil && len(req.Artifacts) > 0 {
+				collectArtifacts(job, ip, server, req.Artifacts)
+			}
+			jobErr := job.commandOutcome(result, err)
+			var logBuilder strings.Builder
+			writeCommandLog(&logBuilder, result, err)
+			return jobResult{Log: logBuilder.String(), Err: jobErr, Template: "templates/logs.html", Data: logBuilder.String()}
+		})
+		submittedJob(r, job)
+		writeJSON(w, http.StatusAccepted, APICommandResponse{JobID: job.ID, Pending: true})
+		return
+	}
+
+	job := startPriorityJob(operator, "command", ip, firstLine(req.Command), priority)
+	submittedJob(r, job)
+	job.setTimeout(timeout)
+	result, err := runAdHocCommand(job.context(), ip, server, operatorScript(server, req.Command, operator, job.ID), opts, job.output)
+	var artifacts []JobArtifact
+	if err == nil && len(req.Artifacts) > 0 {
+		artifacts = collectArtifacts(job, ip, server, req.Artifacts)
+	}
+	job.finishCommand(result, err)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, APICommandResponse{
+		JobID:      job.ID,
+		ExitCode:   result.ExitCode,
+		DurationMS: result.Duration.Milliseconds(),
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+		Truncated:  result.Truncated,
+		Artifacts:  artifacts,
+	})
+}
+
+func apiListAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	alerts := []APIAlert{}
+	for _, alert := range visibleAlerts(r.Context(), currentAlerts()) {
+		alerts = append(alerts, APIAlert{
+			Key:      alert.Key,
+			Server:   alert.Server,
+			Severity: alert.Severity,
+			Message:  alert.Message,
+			RaisedAt: alert.RaisedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func apiListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	jobs := []APIJob{}
+	for _, job := range visibleJobs(r, jobsSnapshot()) {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, APIJob(job))
+		}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func apiGetJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	for _, job := range jobsSnapshot() {
+		if job.ID == id {
+			if jobAllowed(w, r, id) {
+				writeJSON(w, http.StatusOK, APIJob(job))
+			}
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, "job not found")
+}
+
+func apiAddJobNoteHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobAllowed(w, r, r.PathValue("id")) {
+		return
+	}
+	var req APIJobNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	author, text, err := validateJobNote(requestOperator(r), req.Text)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := addJobNote(r.PathValue("id"), author, text)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errJobNotRunning):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, APIJob(job))
+	}
+}
+
+func apiApproveJobHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobAllowed(w, r, r.PathValue("id")) {
+		return
+	}
+	job, err := approveJob(r.PathValue("id"), requestOperator(r))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errApprovalAnonymous), errors.Is(err, errApprovalSelf):
+		writeAPIError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, errJobQueueFull):
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		writeAPIError(w, http.StatusConflict, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, APIJob(job))
+	}
+}
+
+func apiCancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobAllowed(w, r, r.PathValue("id")) {
+		return
+	}
+	job, err := cancelJob(r.PathValue("id"), requestOperator(r))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errJobFinished):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, APIJob(job))
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API tokens let scripts and CI call the app as a user without the user's password. A
+// request sends one as "Authorization: Bearer <token>" and acts as the token's user with
+// the token's scope, a role no higher than the user's own. Only a hash of each token is
+// kept; the token itself is shown once, when it is created.
+
+// APIToken is a user's token for programmatic access
+type APIToken struct {
+	ID   string `json:"id"`
+	User string `json:"user"`
+	Name string `json:"name"`
+	// Scope is the role the token acts with; the user's role limits it when lower
+	Scope string `json:"scope"`
+	// Hash is the hex SHA-256 of the token
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// apiTokenPrefix marks the app's tokens, so they are easy to spot in scripts and logs
+const apiTokenPrefix = "accmgr_"
+
+// tokenScopeKey is the request context key of the scope of the API token the request used
+type tokenScopeKey struct{}
+
+// hashAPIToken returns the hash an API token is kept as
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the API token the request carries, or ""
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// lookupAPIToken returns the unexpired token a request's bearer token matches
+func lookupAPIToken(token string) (APIToken, bool) {
+	hash := hashAPIToken(token)
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	for _, candidate := range settings.APITokens {
+		if subtle.ConstantTimeCompare([]byte(candidate.Hash), []byte(hash)) != 1 {
+			continue
+		}
+		if candidate.ExpiresAt != nil && time.Now().After(*candidate.ExpiresAt) {
+			return APIToken{}, false
+		}
+		return candidate, true
+	}
+	return APIToken{}, false
+}
+
+// apiTokensHandler lists the operator's API tokens, every user's for admins, with a form to
+// create one
+func apiTokensHandler(w http.ResponseWriter, r *http.Request) {
+	renderAPITokens(w, r, "")
+}
+
+// renderAPITokens renders the API tokens page, with a just created token shown once
+func renderAPITokens(w http.ResponseWriter, r *http.Request, created string) {
+	operator := requestOperator(r)
+	admin := roleAllows(requestRole(r), roleAdmin)
+	var tokens []APIToken
+	usersMu.RLock()
+	for _, token := range settings.APITokens {
+		if admin || token.User == operator {
+			tokens = append(tokens, token)
+		}
+	}
+	usersMu.RUnlock()
+	role := requestRole(r)
+	scopes := roles[:slices.Index(roles, role)+1]
+	renderTemplate(w, r, "templates/apitokens.html", map[string]interface{}{
+		"Tokens":   tokens,
+		"Scopes":   scopes,
+		"Role":     role,
+		"Operator": operator,
+		"Created":  created,
+		"JobsURL":  externalURL(r, "/api/v1/jobs"),
+		"Now":      time.Now(),
+	})
+}
+
+// createAPITokenHandler creates an API token for the signed-in user and shows it once
+func createAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	operator := requestOperator(r)
+	if _, ok := webUser(operator); !ok {
+		http.Error(w, "❌ API tokens belong to web UI users; sign in as one to create a token", http.StatusForbidden)
+		return
+	}
+	if r.Context().Value(tokenScopeKey{}) != nil {
+		http.Error(w, "❌ API tokens cannot create API tokens", http.StatusForbidden)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	scope := r.FormValue("scope")
+	switch {
+	case name == "":
+		http.Error(w, "❌ A token needs a name, e.g. the script or pipeline that uses it", http.StatusBadRequest)
+		return
+	case !slices.Contains(roles, scope):
+		http.Error(w, "❌ Unknown scope "+scope, http.StatusBadRequest)
+		return
+	case !roleAllows(requestRole(r), scope):
+		http.Error(w, "❌ A token's scope cannot exceed your own role", http.StatusForbidden)
+		return
+	}
+	token := APIToken{ID: newIdempotencyKey()[:8], User: operator, Name: name, Scope: scope, CreatedAt: time.Now()}
+	if days := strings.TrimSpace(r.FormValue("expires_days")); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			http.Error(w, "❌ Expiry must be a positive number of days", http.StatusBadRequest)
+			return
+		}
+		expires := token.CreatedAt.AddDate(0, 0, n)
+		token.ExpiresAt = &expires
+	}
+	secret := apiTokenPrefix + newSessionToken()
+	token.Hash = hashAPIToken(secret)
+	usersMu.Lock()
+	settings.APITokens = append(settings.APITokens, token)
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("🔑 %s created API token %s (%s, %s scope)\n", operator, token.ID, name, scope)
+	renderAPITokens(w, r, secret)
+}
+
+// revokeAPITokenHandler revokes one of the operator's API tokens, or anyone's for admins
+func revokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.FormValue("id")
+	operator, admin := requestOperator(r), roleAllows(requestRole(r), roleAdmin)
+	usersMu.Lock()
+	i := slices.IndexFunc(settings.APITokens, func(token APIToken) bool { return token.ID == id })
+	if i < 0 {
+		usersMu.Unlock()
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return
+	}
+	if settings.APITokens[i].User != operator && !admin {
+		usersMu.Unlock()
+		http.Error(w, "❌ Only admins can revoke other users' tokens", http.StatusForbidden)
+		return
+	}
+	settings.APITokens = slices.Delete(settings.APITokens, i, i+1)
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/api-tokens"), http.StatusSeeOther)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Approval rules hold back jobs that could do damage, such as ad-hoc commands on production
+// servers or reboots, until a second operator approves them. A held job waits as "pending"
+// and goes through the job queue once approved; rejecting it cancels it. Approvers are the
+// signed-in users, or the operators a trusted proxy identifies.
+
+// ApprovalRule marks the jobs that need approval. Every condition that is set must match:
+// Kinds limits the rule to some of approvalKinds, Groups and Tags to servers in one of the
+// groups or with one of the tags, and Pattern, a regular expression, to jobs whose command
+// matches, e.g. `\b(reboot|shutdown)\b`. Installs match Pattern against their description,
+// e.g. "Uninstall nginx on 10.0.0.5".
+type ApprovalRule struct {
+	Name    string   `json:"name"`
+	Kinds   []string `json:"kinds,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+}
+
+// approvalKinds are the job kinds that can wait for approval
+var approvalKinds = []string{"command", "recipe", "software"}
+
+var (
+	// pendingApprovals are the held jobs with the work they run once approved
+	pendingApprovalsMu sync.Mutex
+	pendingApprovals   = make(map[string]queuedJob)
+)
+
+// Errors returned by approveJob
+var (
+	errApprovalAnonymous = errors.New("approving a job needs a signed-in operator")
+	errApprovalSelf      = errors.New("a job must be approved by someone other than the operator who started it")
+	errJobNotPending     = errors.New("the job is not waiting for approval")
+	// errJobRejected is the error of a held job cancelled instead of approved
+	errJobRejected = errors.New("rejected before it was approved")
+)
+
+// matches reports whether the rule holds back a job of kind on the server running text
+func (rule ApprovalRule) matches(kind string, server ServerInfo, text string) bool {
+	if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, kind) {
+		return false
+	}
+	if !rule.onServer(server) {
+		return false
+	}
+	if rule.Pattern != "" {
+		pattern, err := regexp.Compile(rule.Pattern)
+		// A rule whose pattern no longer compiles holds back every job it otherwise matches
+		if err == nil && !pattern.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// onServer reports whether the rule's groups and tags include the server
+func (rule ApprovalRule) onServer(server ServerInfo) bool {
+	if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, server.Group) {
+		return false
+	}
+	return len(rule.Tags) == 0 || slices.ContainsFunc(rule.Tags, func(tag string) bool { return slices.Contains(server.Tags, tag) })
+}
+
+// approvalRules returns the approval rules
+func approvalRules() []ApprovalRule {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return settings.ApprovalRules
+}
+
+// approvalRuleFor returns the first rule holding back a job of kind that runs text on any
+// of targets
+func approvalRuleFor(kind string, targets map[string]ServerInfo, text string) (ApprovalRule, bool) {
+	for _, rule := range approvalRules() {
+		for _, server := range targets {
+			if rule.matches(kind, server, text) {
+				return rule, true
+			}
+		}
+	}
+	return ApprovalRule{}, false
+}
+
+// validateApprovalRule checks a rule before it is stored
+func validateApprovalRule(rule ApprovalRule) error {
+	if rule.Name == "" {
+		return errors.New("a rule needs a name")
+	}
+	for _, kind := range rule.Kinds {
+		if !slices.Contains(approvalKinds, kind) {
+			return fmt.Errorf("unknown job kind %q; use %s", kind, strings.Join(approvalKinds, ", "))
+		}
+	}
+	if _, err := regexp.Compile(rule.Pattern); err != nil {
+		return fmt.Errorf("invalid pattern: %v", err)
+	}
+	return nil
+}
+
+// requestApproval registers a job held back by rule. It runs on server once approved, after
+// any other job there; software jobs pass no server since they start jobs of their own.
+func requestApproval(operator, kind, server, description, priority, rule string, targets jobTargets, run func(job *Job) jobResult) *Job {
+	jobsMu.Lock()
+	job := registerJob(operator, kind, server, description, "pending")
+	job.Priority, job.Approval = priority, rule
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	pendingApprovalsMu.Lock()
+	pendingApprovals[job.ID] = queuedJob{job: job, run: run, priority: priority, targets: targets}
+	pendingApprovalsMu.Unlock()
+	fmt.Printf("✋ %s waits for approval under rule %s\n", job.ID, rule)
+	publishEvent("job.pending", snapshot)
+	return job
+}
+
+// holdForApproval holds back the job a request would start on targets when a rule matches
+// it, and sends the operator to the held job's page; it reports whether it did. held names
+// the job's kind, server, description and priority.
+func holdForApproval(w http.ResponseWriter, r *http.Request, held Job, targets jobTargets, text string, run func(job *Job) jobResult) bool {
+	rule, ok := approvalRuleFor(held.Kind, targets.servers, text)
+	if !ok {
+		return false
+	}
+	job := requestApproval(requestOperator(r), held.Kind, held.Server, held.Description, held.Priority, rule.Name, targets, run)
+	submittedJob(r, job)
+	http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+	return true
+}
+
+// approveJob queues a held job on behalf of approver
+func approveJob(id, approver string) (Job, error) {
+	if approver == "" {
+		return Job{}, errApprovalAnonymous
+	}
+	jobsMu.Lock()
+	var job *Job
+	for _, candidate := range jobs {
+		if candidate.ID == id {
+			job = candidate
+			break
+		}
+	}
+	if job == nil {
+		jobsMu.Unlock()
+		return Job{}, errJobNotFound
+	}
+	if job.Status != "pending" {
+		jobsMu.Unlock()
+		return Job{}, errJobNotPending
+	}
+	if job.Operator == approver {
+		jobsMu.Unlock()
+		return Job{}, errApprovalSelf
+	}
+	pendingApprovalsMu.Lock()
+	queued := pendingApprovals[id]
+	jobQueueMu.Lock()
+	if len(jobQueue) >= maxQueuedJobs {
+		jobQueueMu.Unlock()
+		pendingApprovalsMu.Unlock()
+		jobsMu.Unlock()
+		return Job{}, errJobQueueFull
+	}
+	now := time.Now()
+	job.Status, job.QueuedAt, job.ApprovedBy = "queued", &now, approver
+	queued.priority, queued.queuedAt = job.Priority, now
+	jobQueue = append(jobQueue, queued)
+	jobQueueReady.Signal()
+	jobQueueMu.Unlock()
+	delete(pendingApprovals, id)
+	pendingApprovalsMu.Unlock()
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	fmt.Printf("👍 %s approved by %s\n", id, approver)
+	publishEvent("job.approved", snapshot)
+	markHeldQueuedJobs()
+	return snapshot, nil
+}
+
+// dropPendingApproval forgets the work of a held job that was rejected
+func dropPendingApproval(id string) {
+	pendingApprovalsMu.Lock()
+	delete(pendingApprovals, id)
+	pendingApprovalsMu.Unlock()
+}
+
+// approvalsHandler lists the jobs waiting for approval and the approval rules
+func approvalsHandler(w http.ResponseWriter, r *http.Request) {
+	var pending []Job
+	for _, job := range visibleJobs(r, jobsSnapshot()) {
+		if job.Status == "pending" {
+			pending = append(pending, job)
+		}
+	}
+	groups := serverGroups(requestServers(r))
+	sort.Strings(groups)
+	renderTemplate(w, r, "templates/approvals.html", map[string]interface{}{
+		"Pending":  pending,
+		"Rules":    approvalRules(),
+		"Kinds":    approvalKinds,
+		"Groups":   groups,
+		"Operator": requestOperator(r),
+	})
+}
+
+// approveJobHandler approves a held job from its page or the approvals page
+func approveJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	job, err := approveJob(r.FormValue("id"), requestOperator(r))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+	case errors.Is(err, errApprovalAnonymous), errors.Is(err, errApprovalSelf):
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, errJobQueueFull):
+		http.Error(w, "❌ "+err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+	default:
+		http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+	}
+}
+
+// saveApprovalRuleHandler adds an approval rule or replaces the one with the same name. Only
+// admins change the rules, so an operator cannot lift the rule holding back their own job.
+func saveApprovalRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	rule := ApprovalRule{
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		Kinds:   r.Form["kind"],
+		Groups:  r.Form["group"],
+		Tags:    splitList(r.FormValue("tags")),
+		Pattern: strings.TrimSpace(r.FormValue("pattern")),
+	}
+	if err := validateApprovalRule(rule); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	usersMu.Lock()
+	rules := slices.DeleteFunc(slices.Clone(settings.ApprovalRules), func(existing ApprovalRule) bool { return existing.Name == rule.Name })
+	settings.ApprovalRules = append(rules, rule)
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/approvals"), http.StatusSeeOther)
+}
+
+// deleteApprovalRuleHandler removes an approval rule; jobs it already holds keep waiting
+func deleteApprovalRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	usersMu.Lock()
+	settings.ApprovalRules = slices.DeleteFunc(slices.Clone(settings.ApprovalRules), func(rule ApprovalRule) bool { return rule.Name == name })
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/approvals"), http.StatusSeeOther)
+}
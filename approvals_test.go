@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApprovalRuleMatches(t *testing.T) {
+	web := ServerInfo{Group: "web", Tags: []string{"production"}}
+	db := ServerInfo{Group: "db"}
+	tests := []struct {
+		name   string
+		rule   ApprovalRule
+		kind   string
+		server ServerInfo
+		text   string
+		want   bool
+	}{
+		{"empty rule holds everything", ApprovalRule{}, "command", db, "ls", true},
+		{"kind matches", ApprovalRule{Kinds: []string{"command"}}, "command", db, "ls", true},
+		{"other kind", ApprovalRule{Kinds: []string{"recipe"}}, "command", db, "ls", false},
+		{"group matches", ApprovalRule{Groups: []string{"web"}}, "command", web, "ls", true},
+		{"other group", ApprovalRule{Groups: []string{"web"}}, "command", db, "ls", false},
+		{"tag matches", ApprovalRule{Tags: []string{"staging", "production"}}, "command", web, "ls", true},
+		{"untagged server", ApprovalRule{Tags: []string{"production"}}, "command", db, "ls", false},
+		{"group and tag both needed", ApprovalRule{Groups: []string{"db"}, Tags: []string{"production"}}, "command", web, "ls", false},
+		{"pattern matches", ApprovalRule{Pattern: `\breboot\b`}, "command", db, "sudo reboot now", true},
+		{"pattern does not match", ApprovalRule{Pattern: `\breboot\b`}, "command", db, "uptime", false},
+		{"broken pattern holds everything", ApprovalRule{Pattern: `(`}, "command", db, "uptime", true},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.matches(tt.kind, tt.server, tt.text); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApproveJob(t *testing.T) {
+	savedJobs, savedQueue, savedPending := jobs, jobQueue, pendingApprovals
+	t.Cleanup(func() { jobs, jobQueue, pendingApprovals = savedJobs, savedQueue, savedPending })
+	jobs = []*Job{
+		{ID: "held", Operator: "alice", Status: "pending"},
+		{ID: "running", Operator: "alice", Status: "running"},
+	}
+	jobQueue = nil
+	pendingApprovals = map[string]queuedJob{"held": {job: jobs[0]}}
+
+	tests := []struct {
+		name, id, approver string
+		want               error
+	}{
+		{"anonymous approver", "held", "", errApprovalAnonymous},
+		{"unknown job", "missing", "bob", errJobNotFound},
+		{"job not held", "running", "bob", errJobNotPending},
+		{"operator approves their own job", "held", "alice", errApprovalSelf},
+		{"second operator approves", "held", "bob", nil},
+		{"approved job cannot be approved again", "held", "carol", errJobNotPending},
+	}
+	for _, tt := range tests {
+		job, err := approveJob(tt.id, tt.approver)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: approveJob(%q, %q) error = %v, want %v", tt.name, tt.id, tt.approver, err, tt.want)
+			continue
+		}
+		if err == nil && (job.Status != "queued" || job.ApprovedBy != tt.approver) {
+			t.Errorf("%s: job is %s approved by %q, want queued approved by %q", tt.name, job.Status, job.ApprovedBy, tt.approver)
+		}
+	}
+	if len(jobQueue) != 1 {
+		t.Errorf("%d jobs queued, want 1", len(jobQueue))
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// artifactsDir holds files collected from servers after jobs, one directory per job ID
+const artifactsDir = "artifacts"
+
+const (
+	// maxJobArtifacts caps how many files one job collects across all its patterns
+	maxJobArtifacts = 50
+	// maxArtifactBytes is the largest single file a job collects
+	maxArtifactBytes = 64 << 20
+)
+
+// JobArtifact is a file fetched from a job's server after the job ran, e.g. a config dump,
+// build log or report. A pattern that matched nothing or a file that could not be fetched
+// is recorded with an Error so the job shows what was missing.
+type JobArtifact struct {
+	Name       string `json:"name"`
+	RemotePath string `json:"remote_path"`
+	Size       int64  `json:"size"`
+	Error      string `json:"error,omitempty"`
+}
+
+// parseArtifactPatterns reads one remote path or glob pattern per line, skipping blanks
+func parseArtifactPatterns(text string) []string {
+	var patterns []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
+
+// jobArtifactsDir is where a job's artifacts are stored locally
+func jobArtifactsDir(jobID string) string {
+	return filepath.Join(artifactsDir, jobID)
+}
+
+// uniqueArtifactName returns the base name of remotePath, suffixed when an artifact with
+// the same name was already collected, e.g. nginx.conf and nginx-2.conf
+func uniqueArtifactName(remotePath string, taken map[string]bool) string {
+	name := path.Base(remotePath)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; taken[name]; i++ {
+		name = stem + "-" + strconv.Itoa(i) + ext
+	}
+	taken[name] = true
+	return name
+}
+
+// collectArtifacts fetches the files matching each pattern from the job's server over SFTP
+// and attaches them to the job. Patterns are expanded on the server as the login account, so
+// relative ones start in its home directory and root-only files are reported as unreadable.
+func collectArtifacts(job *Job, ip string, server ServerInfo, patterns []string) []JobArtifact {
+	job.progress(fmt.Sprintf("collecting artifacts for %d patterns", len(patterns)))
+	dir := jobArtifactsDir(job.ID)
+	// Job IDs start over when the history is removed, so anything already here belongs to
+	// an older job
+	os.RemoveAll(dir)
+
+	var artifacts []JobArtifact
+	err := withSFTP(ip, server, func(client *sftp.Client) error {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+		taken := make(map[string]bool)
+		for _, pattern := range patterns {
+			matches, err := client.Glob(pattern)
+			if err != nil {
+				artifacts = append(artifacts, JobArtifact{RemotePath: pattern, Error: err.Error()})
+				continue
+			}
+			if len(matches) == 0 {
+				artifacts = append(artifacts, JobArtifact{RemotePath: pattern, Error: "no files matched"})
+				continue
+			}
+			for _, match := range matches {
+				if len(artifacts) >= maxJobArtifacts {
+					artifacts = append(artifacts, JobArtifact{RemotePath: match, Error: fmt.Sprintf("skipped, a job collects at most %d files", maxJobArtifacts)})
+					return nil
+				}
+				artifacts = append(artifacts, fetchArtifact(client, match, dir, taken))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		artifacts = append(artifacts, JobArtifact{Error: "collecting artifacts: " + err.Error()})
+	}
+
+	job.addArtifacts(artifacts)
+	return artifacts
+}
+
+// fetchArtifact copies one remote file into dir, skipping directories and oversized files
+func fetchArtifact(client *sftp.Client, remotePath, dir string, taken map[string]bool) JobArtifact {
+	artifact := JobArtifact{RemotePath: remotePath}
+	info, err := client.Stat(remotePath)
+	switch {
+	case err != nil:
+		artifact.Error = err.Error()
+		return artifact
+	case info.IsDir():
+		artifact.Error = "is a directory"
+		return artifact
+	case info.Size() > maxArtifactBytes:
+		artifact.Error = fmt.Sprintf("larger than the %d MB limit", maxArtifactBytes>>20)
+		return artifact
+	}
+
+	src, err := client.Open(remotePath)
+	if err != nil {
+		artifact.Error = err.Error()
+		return artifact
+	}
+	defer src.Close()
+
+	name := uniqueArtifactName(remotePath, taken)
+	dst, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		artifact.Error = err.Error()
+		return artifact
+	}
+	defer dst.Close()
+
+	artifact.Size, err = io.Copy(dst, io.LimitReader(src, maxArtifactBytes))
+	if err != nil {
+		artifact.Error = err.Error()
+		return artifact
+	}
+	artifact.Name = name
+	return artifact
+}
+
+// writeArtifactLog lists collected artifacts under a command's output, pointing to jobURL,
+// the page of the job that has them
+func writeArtifactLog(logBuilder *strings.Builder, jobURL string, artifacts []JobArtifact) {
+	collected := 0
+	logBuilder.WriteString("\n📦 Artifacts\n")
+	for _, artifact := range artifacts {
+		if artifact.Error != "" {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: %s\n", artifact.RemotePath, artifact.Error))
+			continue
+		}
+		collected++
+		logBuilder.WriteString(fmt.Sprintf("✅ %s (%d bytes)\n", artifact.RemotePath, artifact.Size))
+	}
+	logBuilder.WriteString(fmt.Sprintf("\n%d collected; download them from %s\n", collected, jobURL))
+}
+
+// findJob returns a copy of the job with the given ID
+func findJob(id string) (Job, bool) {
+	for _, job := range jobsSnapshot() {
+		if job.ID == id {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+// jobsHandler lists recent jobs, newest first
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, r, "templates/jobs.html", visibleJobs(r, jobsSnapshot()))
+}
+
+// jobHandler shows one job with its notes and artifacts
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	job, ok := findJob(r.FormValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	renderTemplate(w, r, "templates/job.html", job)
+}
+
+// cancelJobHandler cancels a queued or running job from its page
+func cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	job, err := cancelJob(r.FormValue("id"), requestOperator(r))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+	default:
+		http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+	}
+}
+
+// jobArtifactHandler downloads one collected artifact of a live or recorded job. Only
+// artifacts recorded on a known job are served, so names cannot reach outside the job's
+// directory.
+func jobArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	job, ok := findJob(r.FormValue("id"))
+	if !ok {
+		record, found := findJobRecord(r.FormValue("id"))
+		if !found {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		job = record.Job
+	}
+	name := r.FormValue("name")
+	for _, artifact := range job.Artifacts {
+		if artifact.Error == "" && artifact.Name == name {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+			http.ServeFile(w, r, filepath.Join(jobArtifactsDir(job.ID), name))
+			return
+		}
+	}
+	http.Error(w, "Artifact not found", http.StatusNotFound)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The audit log records what security needs to look back on, such as every sign-in tried,
+// lockouts and throttled requests. Entries are appended to auditLogFile as JSON lines, which survive
+// restarts and suit log shippers, and published on the event stream as "audit" events.
+// Admins read the newest entries on the audit page.
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	User   string    `json:"user,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+	// UserAgent is the browser or client the request came from
+	UserAgent string `json:"user_agent,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+var (
+	// auditLogFile is where audit entries are appended
+	auditLogFile = "audit.log"
+
+	auditMu sync.Mutex
+)
+
+// auditPageSize is how many entries the audit page shows
+const auditPageSize = 500
+
+// recordAudit appends an entry about the request to the audit log
+func recordAudit(r *http.Request, action, user, detail string) {
+	entry := AuditEntry{Time: time.Now(), Action: action, User: user, IP: clientIP(r), UserAgent: r.UserAgent(), Detail: detail}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	auditMu.Lock()
+	f, err := os.OpenFile(auditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		f.Close()
+	}
+	auditMu.Unlock()
+	if err != nil {
+		fmt.Println("❌ Writing the audit log:", err)
+	}
+	publishEvent("audit", entry)
+}
+
+// readAudit returns the newest entries of the audit log, newest first, up to limit. When
+// given, only entries whose action starts with action and those about user are returned.
+func readAudit(action, user string, limit int) ([]AuditEntry, error) {
+	f, err := os.Open(auditLogFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if (action == "" || strings.HasPrefix(entry.Action, action)) && (user == "" || entry.User == user) {
+			entries = append(entries, entry)
+		}
+		if len(entries) > 2*limit {
+			entries = slices.Clone(entries[len(entries)-limit:])
+		}
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	slices.Reverse(entries)
+	return entries, scanner.Err()
+}
+
+// auditHandler shows the newest audit entries, filtered by action and user, and the
+// accounts and IP addresses locked out now
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	action, user := strings.TrimSpace(r.FormValue("action")), strings.TrimSpace(r.FormValue("user"))
+	entries, err := readAudit(action, user, auditPageSize)
+	if err != nil {
+		http.Error(w, "❌ Reading the audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, r, "templates/audit.html", map[string]interface{}{
+		"Entries":      entries,
+		"Action":       action,
+		"User":         user,
+		"Limit":        auditPageSize,
+		"Lockouts":     lockouts(),
+		"LockoutAfter": lockoutAfter,
+		"LockoutBase":  lockoutBase,
+		"LockoutMax":   lockoutMax,
+	})
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The web UI holds the servers' root passwords, so every page and API needs a login. A
+// browser signs in on /login, with a password or the OpenID Connect provider, and carries
+// a session cookie; API clients send an API token, or the same user's credentials with HTTP
+// Basic authentication. A request a -proxy-auth proxy identified in the operator header
+// needs neither, since the proxy authenticated it. The signed-in user is the request's operator;
+// see requestOperator.
+
+// WebUser is an account that can sign in to the web UI
+type WebUser struct {
+	Name string `json:"name"`
+	// PasswordHash is the bcrypt hash of the password
+	PasswordHash string `json:"password_hash"`
+	// Role is one of roles; see userRole
+	Role string `json:"role,omitempty"`
+	// TOTPSecret is the base32 secret of the user's authenticator app, when they enrolled one
+	TOTPSecret string `json:"totp_secret,omitempty"`
+	// RecoveryCodes are the hashes of the user's unused recovery codes
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	// Provider is oidcProvider or ldapProvider for users who sign in with single sign-on or
+	// the directory; they have no password here
+	Provider string `json:"provider,omitempty"`
+	// Subject is the issuer and subject of a single sign-on user's ID tokens, the identity
+	// that signs in as them; see oidcSubject
+	Subject string `json:"subject,omitempty"`
+	// Servers limits the user to some servers; see serverScope
+	Servers []string `json:"servers,omitempty"`
+}
+
+// session is a signed-in browser
+type session struct {
+	user    string
+	expires time.Time
+}
+
+const (
+	// sessionCookie carries the session token
+	sessionCookie = "accmgr_session"
+	// minPasswordLength is the shortest password a user may be given
+	minPasswordLength = 8
+	// loginFailureDelay slows down password guessing on the login page
+	loginFailureDelay = time.Second
+)
+
+var (
+	// sessionTTL is how long a sign-in lasts
+	sessionTTL = 12 * time.Hour
+
+	sessionsMu sync.Mutex
+	// sessions maps session tokens to the signed-in users; they are lost on restart
+	sessions = make(map[string]session)
+
+	// usersMu guards the settings that decide who may do what, which requests read while
+	// admins and sign-ins change them: settings.Users, settings.APITokens,
+	// settings.TwoFactorRoles, the group mappings settings.OIDCGroups and
+	// settings.LDAPGroups, and settings.ApprovalRules. The roles, mappings and rules are
+	// replaced with new slices rather than changed in place, so readers may keep the slice
+	// they read.
+	usersMu sync.RWMutex
+	// errUserNotFound is returned by updateWebUser for a user that does not exist
+	errUserNotFound = errors.New("user not found")
+
+	userNamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+	// dummyPasswordHash is compared against for unknown users, so they take as long to
+	// refuse as wrong passwords
+	dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("accmgr4"), bcrypt.DefaultCost)
+)
+
+// loginUserKey is the request context key of the signed-in user, or of the one a
+// -proxy-auth proxy identified
+type loginUserKey struct{}
+
+// ensureLoginUser creates the admin user when there is none, so a new installation can be
+// signed in to. Its password is ACCMGR_ADMIN_PASSWORD, or a random one printed once.
+func ensureLoginUser() error {
+	if len(webUsersSnapshot()) > 0 {
+		return nil
+	}
+	password := os.Getenv("ACCMGR_ADMIN_PASSWORD")
+	generated := password == ""
+	if generated {
+		password = newSessionToken()[:16]
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	usersMu.Lock()
+	settings.Users = []WebUser{{Name: "admin", PasswordHash: string(hash), Role: roleAdmin}}
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		return err
+	}
+	if generated {
+		fmt.Printf("🔑 Created web UI user admin with password %s; change it on /web-users\n", password)
+	} else {
+		fmt.Println("🔑 Created web UI user admin with the password in ACCMGR_ADMIN_PASSWORD")
+	}
+	return nil
+}
+
+// authenticate reports whether password is the user's; directory users, and unknown users
+// when there is a directory, are checked against the directory
+func authenticate(name, password string) bool {
+	hash := dummyPasswordHash
+	user, exists := webUser(name)
+	if ldapEnabled() && (!exists || user.Provider == ldapProvider) {
+		return ldapAuthenticate(name, password)
+	}
+	if exists {
+		hash = []byte(user.PasswordHash)
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && exists
+}
+
+// webUser returns a copy of the web UI user with the given name
+func webUser(name string) (WebUser, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	i := slices.IndexFunc(settings.Users, func(user WebUser) bool { return user.Name == name })
+	if i < 0 {
+		return WebUser{}, false
+	}
+	return settings.Users[i], true
+}
+
+// webUsersSnapshot copies the web UI users
+func webUsersSnapshot() []WebUser {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return slices.Clone(settings.Users)
+}
+
+// updateWebUser changes the web UI user with the given name and saves the settings. change
+// runs under usersMu, so it replaces the user's slices rather than changing them in place.
+func updateWebUser(name string, change func(user *WebUser)) error {
+	usersMu.Lock()
+	i := slices.IndexFunc(settings.Users, func(user WebUser) bool { return user.Name == name })
+	if i < 0 {
+		usersMu.Unlock()
+		return errUserNotFound
+	}
+	change(&settings.Users[i])
+	usersMu.Unlock()
+	return saveSettings()
+}
+
+// saveProviderUser gives a user who signs in with provider, such as the directory, their
+// role, adding them at their first sign-in. A user of the same name who
+// signs in otherwise is refused.
+func saveProviderUser(name, provider, role string) error {
+	usersMu.Lock()
+	i := slices.IndexFunc(settings.Users, func(user WebUser) bool { return user.Name == name })
+	switch {
+	case i < 0:
+		settings.Users = append(settings.Users, WebUser{Name: name, Role: role, Provider: provider})
+	case settings.Users[i].Provider != provider:
+		usersMu.Unlock()
+		return fmt.Errorf("%s does not sign in with %s", name, provider)
+	case settings.Users[i].Role == role:
+		usersMu.Unlock()
+		return nil
+	default:
+		settings.Users[i].Role = role
+	}
+	usersMu.Unlock()
+	return saveSettings()
+}
+
+// newSessionToken returns a random token for a session cookie
+func newSessionToken() string {
+	token := make([]byte, 32)
+	rand.Read(token)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// startSession signs the user in and returns the session's token
+func startSession(user string) (string, time.Time) {
+	token := newSessionToken()
+	now := time.Now()
+	expires := now.Add(sessionTTL)
+	sessionsMu.Lock()
+	for existing, s := range sessions {
+		if now.After(s.expires) {
+			delete(sessions, existing)
+		}
+	}
+	sessions[token] = session{user: user, expires: expires}
+	sessionsMu.Unlock()
+	return token, expires
+}
+
+// sessionUser returns the user signed in with the request's session cookie, or ""
+func sessionUser(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[cookie.Value]
+	if !ok {
+		return ""
+	}
+	if time.Now().After(s.expires) {
+		delete(sessions, cookie.Value)
+		return ""
+	}
+	return s.user
+}
+
+// endSessions signs a user out everywhere, after their password changed or they were removed
+func endSessions(user string) {
+	sessionsMu.Lock()
+	for token, s := range sessions {
+		if s.user == user {
+			delete(sessions, token)
+		}
+	}
+	sessionsMu.Unlock()
+}
+
+// requestSecure reports whether the browser reached the app over HTTPS, directly or through
+// a trusted proxy, so the session cookie is only sent back over HTTPS
+func requestSecure(r *http.Request) bool {
+	return r.TLS != nil || forwardedHeader(r, "X-Forwarded-Proto") == "https"
+}
+
+// setSessionCookie sets the session cookie, scoped to the app's path; an empty token with
+// a zero expiry removes it
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     appPath(r, "/"),
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   requestSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if token == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// requireLogin serves only signed-in requests, plus the login page; API tokens sign in as
+// their user. Others are sent to the login page, or refused with 401 when they are API
+// calls. Requests the user's role does not allow are refused with 403, and users whose role
+// requires a second factor they have not enrolled are sent to enroll one.
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" || r.URL.Path == "/oidc/login" || r.URL.Path == "/oidc/callback" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		api := strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/graphql"
+		session := sessionUser(r)
+		user := session
+		if name, password, ok := r.BasicAuth(); ok && user == "" && !twoFactorEnabled(name) && !twoFactorRequired(name) {
+			if wait, ok := loginAllowed(r, name); !ok {
+				writeTooManyRequests(w, r, "Too many sign-in attempts", wait)
+				return
+			}
+			if authenticate(name, password) {
+				user = name
+				forgetLoginFailures(name)
+			} else {
+				loginFailed(r, name, "wrong user name or password over HTTP Basic authentication")
+			}
+		}
+		if bearer := bearerToken(r); bearer != "" && user == "" {
+			token, ok := lookupAPIToken(bearer)
+			if !ok {
+				writeAPIError(w, http.StatusUnauthorized, "unknown, revoked or expired API token")
+				return
+			}
+			user = token.User
+			r = r.WithContext(context.WithValue(r.Context(), tokenScopeKey{}, token.Scope))
+		}
+		if user == "" {
+			user = proxyUser(r)
+		}
+		if user != "" {
+			r = r.WithContext(context.WithValue(r.Context(), loginUserKey{}, user))
+		}
+		required, role := requiredRole(r), requestRole(r)
+		switch {
+		case session != "" && twoFactorRequired(session) && !twoFactorEnabled(session) && !twoFactorPaths[r.URL.Path]:
+			if api {
+				writeAPIError(w, http.StatusForbidden, "enroll a second factor on the two-factor page first")
+			} else {
+				http.Redirect(w, r, appPath(r, "/two-factor"), http.StatusSeeOther)
+			}
+		case user != "" && !roleAllows(role, required):
+			message := "this needs the " + required + " role; " + user + " has the " + role + " role"
+			if _, scoped := r.Context().Value(tokenScopeKey{}).(string); scoped {
+				message = "this needs the " + required + " role; the API token is scoped to " + role
+			}
+			if api {
+				writeAPIError(w, http.StatusForbidden, message)
+			} else {
+				http.Error(w, "❌ "+message, http.StatusForbidden)
+			}
+		case user != "":
+			next.ServeHTTP(w, r)
+		case api:
+			w.Header().Set("WWW-Authenticate", `Basic realm="accmgr4"`)
+			writeAPIError(w, http.StatusUnauthorized, "send an API token, or sign in with HTTP Basic authentication")
+		default:
+			target := "/login"
+			if r.Method == http.MethodGet {
+				target += "?next=" + url.QueryEscape(r.URL.RequestURI())
+			}
+			http.Redirect(w, r, appPath(r, target), http.StatusSeeOther)
+		}
+	})
+}
+
+// loginTarget returns the app path to go to after signing in, refusing anything that
+// leaves the app
+func loginTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, `/\`) {
+		return "/"
+	}
+	return next
+}
+
+// loginHandler shows the login form and signs users in
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{"Next": loginTarget(r.FormValue("next")), "SSO": oidcEnabled()}
+	if r.Method != http.MethodPost {
+		renderTemplate(w, r, "templates/login.html", data)
+		return
+	}
+	if challenge := r.FormValue("challenge"); challenge != "" {
+		loginSecondFactor(w, r, challenge, data)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("username"))
+	if wait, ok := loginAllowed(r, name); !ok {
+		data["Error"] = "Too many sign-in attempts; try again in " + wait.Round(time.Second).String() + "."
+		data["Username"] = name
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderTemplate(w, r, "templates/login.html", data)
+		return
+	}
+	if !authenticate(name, r.FormValue("password")) {
+		fmt.Printf("🔒 Failed sign-in as %q from %s\n", name, r.RemoteAddr)
+		loginFailed(r, name, "wrong user name or password")
+		time.Sleep(loginFailureDelay)
+		data["Error"] = "Wrong user name or password."
+		data["Username"] = name
+		w.WriteHeader(http.StatusUnauthorized)
+		renderTemplate(w, r, "templates/login.html", data)
+		return
+	}
+	if twoFactorEnabled(name) {
+		data["Challenge"] = startLoginChallenge(name, data["Next"].(string))
+		renderTemplate(w, r, "templates/login.html", data)
+		return
+	}
+	method := "password"
+	if user, ok := webUser(name); ok && user.Provider == ldapProvider {
+		method = "directory password"
+	}
+	loginSucceeded(r, name, method)
+	token, expires := startSession(name)
+	setSessionCookie(w, r, token, expires)
+	http.Redirect(w, r, appPath(r, data["Next"].(string)), http.StatusSeeOther)
+}
+
+// loginSecondFactor finishes a sign-in whose password was accepted once its TOTP or
+// recovery code checks out
+func loginSecondFactor(w http.ResponseWriter, r *http.Request, token string, data map[string]interface{}) {
+	challenge, ok := takeLoginChallenge(token)
+	if !ok {
+		data["Error"] = "The sign-in took too long; enter your password again."
+		w.WriteHeader(http.StatusUnauthorized)
+		renderTemplate(w, r, "templates/login.html", data)
+		return
+	}
+	if wait, locked := refuseLocked(r, challenge.user); locked {
+		endLoginChallenge(token)
+		data["Error"] = "Too many failed sign-ins; try again in " + wait.Round(time.Second).String() + "."
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderTemplate(w, r, "templates/login.html", data)
+		return
+	}
+	if !verifySecondFactor(challenge.user, r.FormValue("code")) {
+		fmt.Printf("🔒 Wrong second factor for %q from %s\n", challenge.user, r.RemoteAddr)
+		loginFailed(r, challenge.user, "wrong second factor")
+		time.Sleep(loginFailureDelay)
+		data["Error"] = "Wrong code."
+		data["Challenge"] = token
+		w.WriteHeader(http.StatusUnauthorized)
+		renderTemplate(w, r, "templates/login.html", data)
+		return
+	}
+	endLoginChallenge(token)
+	loginSucceeded(r, challenge.user, "password and second factor")
+	session, expires := startSession(challenge.user)
+	setSessionCookie(w, r, session, expires)
+	http.Redirect(w, r, appPath(r, challenge.next), http.StatusSeeOther)
+}
+
+// logoutHandler ends the browser's session
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		sessionsMu.Lock()
+		delete(sessions, cookie.Value)
+		sessionsMu.Unlock()
+	}
+	setSessionCookie(w, r, "", time.Time{})
+	http.Redirect(w, r, appPath(r, "/login"), http.StatusSeeOther)
+}
+
+// webUsersHandler lists the web UI users with their roles and a form to add one, or change
+// one's role or password
+func webUsersHandler(w http.ResponseWriter, r *http.Request) {
+	existing := webUsersSnapshot()
+	users := make([]WebUser, len(existing))
+	enrolled := make(map[string]bool)
+	for i, user := range existing {
+		users[i] = WebUser{Name: user.Name, Role: userRole(user.Name), Provider: user.Provider, Servers: user.Servers}
+		enrolled[user.Name] = user.TOTPSecret != ""
+	}
+	renderTemplate(w, r, "templates/webusers.html", map[string]interface{}{
+		"Users":          users,
+		"Roles":          roles,
+		"Operator":       requestOperator(r),
+		"TwoFactor":      enrolled,
+		"TwoFactorRoles": twoFactorRoles(),
+		"GroupProviders": groupProviders(r),
+	})
+}
+
+// saveWebUserHandler adds a web UI user, or changes an existing user's role and, when one is
+// given, password. A new password signs the user out everywhere; the last admin keeps the
+// admin role.
+func saveWebUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	password := r.FormValue("password")
+	user := WebUser{Name: name, Role: r.FormValue("role")}
+	existing, exists := webUser(name)
+	if exists && existing.Provider != "" {
+		http.Error(w, "❌ "+name+" signs in with "+existing.Provider+"; their role comes from the group mappings", http.StatusConflict)
+		return
+	}
+	if exists {
+		user.TOTPSecret, user.RecoveryCodes = existing.TOTPSecret, existing.RecoveryCodes
+		user.Servers = existing.Servers
+	}
+	if exists && password == "" {
+		user.PasswordHash = existing.PasswordHash
+	} else if err := validatePassword(password); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateWebUser(user); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if user.PasswordHash == "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		user.PasswordHash = string(hash)
+	}
+	usersMu.Lock()
+	users := slices.DeleteFunc(slices.Clone(settings.Users), func(existing WebUser) bool { return existing.Name == name })
+	users = append(users, user)
+	if admins(users) == 0 {
+		usersMu.Unlock()
+		http.Error(w, "❌ The last admin must keep the admin role", http.StatusConflict)
+		return
+	}
+	settings.Users = users
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if password != "" {
+		endSessions(name)
+	}
+	http.Redirect(w, r, appPath(r, "/web-users"), http.StatusSeeOther)
+}
+
+// deleteWebUserHandler removes a web UI user, ending their sessions and revoking their API
+// tokens; the last admin cannot
+// be removed, so someone can still manage the users
+func deleteWebUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	usersMu.Lock()
+	if !slices.ContainsFunc(settings.Users, func(user WebUser) bool { return user.Name == name }) {
+		usersMu.Unlock()
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	users := slices.DeleteFunc(slices.Clone(settings.Users), func(user WebUser) bool { return user.Name == name })
+	if admins(users) == 0 {
+		usersMu.Unlock()
+		http.Error(w, "❌ The last admin cannot be removed", http.StatusConflict)
+		return
+	}
+	settings.Users = users
+	settings.APITokens = slices.DeleteFunc(slices.Clone(settings.APITokens), func(token APIToken) bool { return token.User == name })
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	endSessions(name)
+	http.Redirect(w, r, appPath(r, "/web-users"), http.StatusSeeOther)
+}
+
+// validateWebUser checks a user's name and role before they are stored
+func validateWebUser(user WebUser) error {
+	if !userNamePattern.MatchString(user.Name) {
+		return fmt.Errorf("invalid user name %q; use letters, digits, dots, dashes, underscores and @", user.Name)
+	}
+	if !slices.Contains(roles, user.Role) {
+		return fmt.Errorf("unknown role %q; use %s", user.Role, strings.Join(roles, ", "))
+	}
+	return nil
+}
+
+// validatePassword checks a new password
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("the password needs at least %d characters", minPasswordLength)
+	}
+	return nil
+}
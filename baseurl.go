@@ -0,0 +1,136 @@
+package main
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// basePath is the subpath the app is mounted under, e.g. "/accmgr"; empty at the root
+	basePath string
+	// publicURL, when set, is the externally visible URL of the app root (including any
+	// base path) and is used for absolute links instead of guessing from the request
+	publicURL string
+	// trustProxy honours X-Forwarded-Proto, -Host and -Prefix; only enable it behind a proxy
+	// that sets or strips them, since clients can send them too
+	trustProxy bool
+)
+
+// envOr returns an environment variable, or fallback when it is unset
+func envOr(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
+
+// normalizeBasePath turns "accmgr/", "/accmgr" or "/" into "/accmgr" or ""
+func normalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// forwardedHeader returns the first value of an X-Forwarded-* header when proxies are trusted
+func forwardedHeader(r *http.Request, name string) string {
+	if !trustProxy {
+		return ""
+	}
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
+
+// clientIP returns the address the request came from: the one a trusted proxy saw, the last
+// in X-Forwarded-For since clients can send their own, or the connection's
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestBasePath is the path prefix links must carry for this request: whatever prefix a
+// trusted proxy stripped, followed by the configured base path
+func requestBasePath(r *http.Request) string {
+	return normalizeBasePath(forwardedHeader(r, "X-Forwarded-Prefix")) + basePath
+}
+
+// appPath prefixes an app-relative path such as "/sshd" for use in links and redirects
+func appPath(r *http.Request, path string) string {
+	return requestBasePath(r) + path
+}
+
+// externalURL builds an absolute URL for an app-relative path, for links that leave the
+// browser session such as emails, webhooks and API documents
+func externalURL(r *http.Request, path string) string {
+	if publicURL != "" {
+		return strings.TrimRight(publicURL, "/") + path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := forwardedHeader(r, "X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwarded := forwardedHeader(r, "X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host + appPath(r, path)
+}
+
+// withBasePath serves the app under basePath, stripping it before routing
+func withBasePath(next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, appPath(r, "/"), http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		http.StripPrefix(basePath, next).ServeHTTP(w, r)
+	})
+}
+
+// renderTemplate parses and executes a page template. Pages build links with {{ base }} so they
+// keep working when the app is mounted under a base path or behind a reverse proxy, and hide
+// disabled modules with {{ if feature "name" }}. Forms that take a job timeout show the
+// default with {{ jobTimeout }}, and forms that start jobs send {{ idempotencyKey }} so a
+// double submission runs once; see idempotent. Controls the user's role does not allow
+// are hidden with {{ if allowed "admin" }}, and every POST form sends {{ csrfToken }}; see
+// withCSRF.
+func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data any) {
+	funcs := template.FuncMap{
+		"base":           func() string { return requestBasePath(r) },
+		"feature":        featureEnabled,
+		"logLines":       logLines,
+		"jobTimeout":     func() time.Duration { return defaultJobTimeout },
+		"idempotencyKey": newIdempotencyKey,
+		"allowed":        func(role string) bool { return roleAllows(requestRole(r), role) },
+		"csrfToken":      func() string { return csrfToken(r) },
+	}
+	tmpl := template.Must(template.New(filepath.Base(name)).Funcs(funcs).ParseFiles(name))
+	tmpl.Execute(w, data)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// A batch is a job that runs on many servers, such as a command template on a group or a
+// group install. It lists its Targets, and each server's own job names it as its Parent, so
+// the batch summary can show every server's outcome in one table.
+//
+// A finished batch can retry the servers that failed: the batch's request runs again, as a
+// batch of its own on just those servers, and names the original as its RetryOf. The
+// original's summary counts each server's latest outcome from either, and its record takes
+// the merged status once the retry finished.
+
+// retryOfField is the form field that limits a replayed batch request to the servers that
+// failed in the batch it names
+const retryOfField = "retry_of"
+
+// BatchServer is one server's row in a batch summary
+type BatchServer struct {
+	IP string `json:"ip"`
+	// JobID is the server's own job; empty when none was started for it
+	JobID string `json:"job_id,omitempty"`
+	// Status is the job's status, "pending" while the batch has yet to reach the server, or
+	// "not run" when the batch finished without starting a job there
+	Status     string `json:"status"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// BatchSummary is the per-server result matrix of a batch job with its totals. Failed
+// counts cancelled jobs too; Pending counts servers still queued or running, including
+// those of a retry.
+type BatchSummary struct {
+	JobID       string        `json:"job_id"`
+	Description string        `json:"description"`
+	Status      string        `json:"status"`
+	Total       int           `json:"total"`
+	Succeeded   int           `json:"succeeded"`
+	Failed      int           `json:"failed"`
+	Pending     int           `json:"pending"`
+	NotRun      int           `json:"not_run"`
+	Servers     []BatchServer `json:"servers"`
+	// RetryOf is the batch this one retried the failed servers of
+	RetryOf string `json:"retry_of,omitempty"`
+	// Retries are the batches that retried this one's failed servers, oldest first
+	Retries []string `json:"retries,omitempty"`
+	// Retrying is the retry still to finish, if any
+	Retrying string `json:"retrying,omitempty"`
+}
+
+// Unfinished is how many servers did not succeed, failed or never run, so a retry would
+// run on them
+func (s BatchSummary) Unfinished() int {
+	return s.Failed + s.NotRun
+}
+
+// Duration is how long the server's job ran so far, to a tenth of a second
+func (s BatchServer) Duration() time.Duration {
+	return (time.Duration(s.DurationMS) * time.Millisecond).Round(100 * time.Millisecond)
+}
+
+// Finished reports whether the server's job has finished, so it is in the history
+func (s BatchServer) Finished() bool {
+	return s.JobID != "" && s.Status != "pending" && s.Status != "queued" && s.Status != "running"
+}
+
+// setTargets records the servers a batch job runs on
+func (j *Job) setTargets(ips []string) {
+	jobsMu.Lock()
+	j.Targets = append([]string(nil), ips...)
+	jobsMu.Unlock()
+}
+
+// setParent records the batch job a server's job belongs to
+func (j *Job) setParent(parent *Job) {
+	jobsMu.Lock()
+	j.Parent = parent.ID
+	jobsMu.Unlock()
+}
+
+// setRetryOf records that the job retries the failed servers of the batch with the given ID
+func (j *Job) setRetryOf(batchID string) {
+	jobsMu.Lock()
+	j.RetryOf = batchID
+	jobsMu.Unlock()
+}
+
+// batchSummary collects the outcome of every target of the batch job with the given ID,
+// from the live jobs and the history, counting the servers its retries ran on again. It
+// reports false for a job that is not a batch.
+func batchSummary(id string) (BatchSummary, bool) {
+	batch, ok := findJob(id)
+	if !ok {
+		record, found := findJobRecord(id)
+		if !found {
+			return BatchSummary{}, false
+		}
+		batch = record.Job
+	}
+	if len(batch.Targets) == 0 {
+		return BatchSummary{}, false
+	}
+
+	// A server may have run more than one job for the batch or its retries; the latest one
+	// counts
+	var known []Job
+	jobHistoryMu.Lock()
+	for _, record := range jobHistory {
+		known = append(known, record.Job)
+	}
+	jobHistoryMu.Unlock()
+	known = append(known, jobsSnapshot()...)
+	family := map[string]bool{id: true}
+	var retries []Job
+	for _, job := range known {
+		if job.RetryOf == id && !family[job.ID] {
+			family[job.ID] = true
+			retries = append(retries, job)
+		}
+	}
+	sort.Slice(retries, func(i, k int) bool { return retries[i].StartedAt.Before(retries[k].StartedAt) })
+	children := make(map[string]Job)
+	add := func(job Job) {
+		if !family[job.Parent] {
+			return
+		}
+		if current, ok := children[job.Server]; ok && current.ID != job.ID && current.StartedAt.After(job.StartedAt) {
+			return
+		}
+		children[job.Server] = job
+	}
+	for _, job := range known {
+		add(job)
+	}
+
+	batchDone := batch.Status != "pending" && batch.Status != "queued" && batch.Status != "running"
+	summary := BatchSummary{JobID: batch.ID, Description: batch.Description, Status: batch.Status, Total: len(batch.Targets), RetryOf: batch.RetryOf}
+	for _, retry := range retries {
+		summary.Retries = append(summary.Retries, retry.ID)
+		if retry.Status == "pending" || retry.Status == "queued" || retry.Status == "running" {
+			summary.Retrying = retry.ID
+		}
+	}
+	for _, ip := range batch.Targets {
+		row := BatchServer{IP: ip}
+		job, ok := children[ip]
+		switch {
+		case ok:
+			row.JobID, row.Status, row.ExitCode, row.Error = job.ID, job.Status, job.ExitCode, job.Error
+			end := time.Now()
+			if job.FinishedAt != nil {
+				end = *job.FinishedAt
+			}
+			if job.Status != "queued" && job.Status != "pending" {
+				row.DurationMS = end.Sub(job.StartedAt).Milliseconds()
+			}
+		case batchDone:
+			row.Status = "not run"
+		default:
+			row.Status = "pending"
+		}
+		switch row.Status {
+		case "succeeded":
+			summary.Succeeded++
+		case "failed", "cancelled":
+			summary.Failed++
+		case "not run":
+			summary.NotRun++
+		default:
+			summary.Pending++
+		}
+		summary.Servers = append(summary.Servers, row)
+	}
+	return summary, true
+}
+
+// jobSummaryHandler shows the per-server result matrix of a batch job
+func jobSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	summary, ok := batchSummary(r.FormValue("id"))
+	if !ok {
+		http.Error(w, "No batch job with this ID; only jobs that run on many servers have a summary", http.StatusNotFound)
+		return
+	}
+	renderTemplate(w, r, "templates/jobsummary.html", summary)
+}
+
+func apiGetJobSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobAllowed(w, r, r.PathValue("id")) {
+		return
+	}
+	summary, ok := batchSummary(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "batch job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// retryTargets returns the servers a retry of the batch with the given ID runs on: those
+// whose latest job failed or was cancelled, and those the batch never reached. Servers
+// removed since are left out.
+func retryTargets(batchID string) (map[string]ServerInfo, error) {
+	summary, ok := batchSummary(batchID)
+	switch {
+	case !ok:
+		return nil, errors.New("no batch job " + batchID)
+	case summary.Retrying != "":
+		return nil, fmt.Errorf("%s is still retrying the failed servers", summary.Retrying)
+	case summary.Pending > 0:
+		return nil, errors.New(batchID + " has servers still to finish")
+	}
+	servers := serversSnapshot()
+	targets := make(map[string]ServerInfo)
+	for _, row := range summary.Servers {
+		if row.Status == "succeeded" {
+			continue
+		}
+		if server, ok := servers[row.IP]; ok {
+			targets[row.IP] = server
+		}
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no failed servers to retry in " + batchID)
+	}
+	return targets, nil
+}
+
+// asRetry wraps the run of a batch that retries the failed servers of batchID, so the
+// original's record takes in the new outcomes once the retry's servers finished; with no
+// batchID it returns run unchanged
+func asRetry(batchID string, run func(job *Job) jobResult) func(job *Job) jobResult {
+	if batchID == "" {
+		return run
+	}
+	return func(job *Job) jobResult {
+		job.setRetryOf(batchID)
+		result := run(job)
+		mergeRetry(batchID)
+		return result
+	}
+}
+
+// mergeRetry gives the batch with the given ID the status its servers' latest outcomes add
+// up to, in the live jobs and the history: succeeded once every server succeeded, and
+// failed with the count of those that did not otherwise
+func mergeRetry(batchID string) {
+	summary, ok := batchSummary(batchID)
+	if !ok {
+		return
+	}
+	status, message := "succeeded", ""
+	if failed := summary.Unfinished(); failed > 0 {
+		status, message = "failed", fmt.Sprintf("%d of %d servers failed after retrying", failed, summary.Total)
+	}
+
+	jobsMu.Lock()
+	for _, job := range jobs {
+		if job.ID == batchID {
+			job.Status, job.Error = status, message
+		}
+	}
+	jobsMu.Unlock()
+	jobHistoryMu.Lock()
+	defer jobHistoryMu.Unlock()
+	for i := range jobHistory {
+		if jobHistory[i].ID == batchID {
+			jobHistory[i].Status, jobHistory[i].Error = status, message
+			saveJobHistory()
+			break
+		}
+	}
+}
+
+// retryFailedHandler runs a finished batch's request again on the servers that failed. The
+// retry belongs to the first batch even when started from a retry's page, so the first
+// batch's summary keeps every server's latest outcome. Software installs show their
+// preview first, like any re-run.
+func retryFailedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	record, ok := findJobRecord(r.FormValue("id"))
+	if ok && record.RetryOf != "" {
+		record, ok = findJobRecord(record.RetryOf)
+	}
+	if !ok || len(record.Targets) == 0 {
+		http.Error(w, "Only a finished batch job can retry its failed servers", http.StatusNotFound)
+		return
+	}
+	if record.Rerun == nil {
+		http.Error(w, "The batch cannot be re-run", http.StatusBadRequest)
+		return
+	}
+	rerun, ok := rerunHandlers[record.Rerun.Path]
+	if !ok || !rerun.groups {
+		http.Error(w, "The batch cannot be re-run", http.StatusBadRequest)
+		return
+	}
+	if _, err := retryTargets(record.ID); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+		return
+	}
+
+	form := maps.Clone(record.Rerun.Form)
+	form.Set(retryOfField, record.ID)
+	replay := r.Clone(r.Context())
+	replay.Form, replay.PostForm = form, form
+	rerun.handler(w, replay)
+}
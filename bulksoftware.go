@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bulkSoftwareRow is one server's line in the result matrix of a group install
+type bulkSoftwareRow struct {
+	IP   string
+	Name string
+	softwareOutcome
+}
+
+// DurationLabel formats how long the server took, to a tenth of a second
+func (b bulkSoftwareRow) DurationLabel() string {
+	return b.Duration.Round(100 * time.Millisecond).String()
+}
+
+// bulkSoftwareHandler installs or removes the selections on every server of a group in
+// parallel, each as its own job, and shows a matrix of the results. Servers that cannot take
+// the selection, e.g. Windows servers asked for a snap, are skipped rather than failing the
+// whole request. The run itself is a queued job whose result page is the matrix; previews
+// and dry runs answer directly.
+func bulkSoftwareHandler(w http.ResponseWriter, r *http.Request, group string, selections []softwareSelection, options softwareOptions) {
+	targets := upgradeTargets("", group)
+	retryOf := r.FormValue(retryOfField)
+	if retryOf != "" {
+		var err error
+		if targets, err = retryTargets(retryOf); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+			return
+		}
+	}
+	if len(targets) == 0 {
+		http.Error(w, "No matching servers", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, slices.Collect(maps.Keys(targets))) {
+		return
+	}
+	if options.Preview {
+		renderSoftwarePreview(w, r, group, selections, options, bulkSoftwareRows(targets, selections, options))
+		return
+	}
+	if options.DryRun {
+		renderTemplate(w, r, "templates/bulksoftware.html", bulkSoftwareData(group, selections, options, bulkSoftwareRows(targets, selections, options)))
+		return
+	}
+	if options.Purge {
+		if err := checkGroupConfirmation(r, OpPurgePackages, group); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	form, ctx := maps.Clone(r.PostForm), r.Context()
+	description := softwareJobDescription(selections, options, "group "+group)
+	if retryOf != "" {
+		description += fmt.Sprintf(", retrying %d failed servers of %s", len(targets), retryOf)
+	}
+	run := asRetry(retryOf, func(job *Job) jobResult {
+		job.setRerun(ctx, "/install-software", form)
+		job.setTimeout(options.Timeout)
+		options.Live, options.Parent = job.output, job
+		rows := bulkSoftwareRows(targets, selections, options)
+		data := bulkSoftwareData(group, selections, options, rows)
+		result := jobResult{Template: "templates/bulksoftware.html", Data: data}
+		var logBuilder strings.Builder
+		logBuilder.WriteString(fmt.Sprintf("📦 %s %s on group %s\n\n", data["Action"], data["Software"], group))
+		for _, row := range rows {
+			logBuilder.WriteString(fmt.Sprintf("%s %s: %s\n", bulkSoftwareMarker(row.Status), row.IP, row.Summary))
+		}
+		for _, row := range rows {
+			if row.Log != "" {
+				logBuilder.WriteString("\n" + row.Log)
+			}
+		}
+		result.Log = logBuilder.String()
+		if failed := data["Failed"].(int); failed > 0 {
+			result.Err = fmt.Errorf("%d of %d servers failed", failed, len(rows))
+		}
+		return result
+	})
+	held := jobTargets{options.jobKind(), targets}
+	if holdForApproval(w, r, Job{Kind: "software", Description: description, Priority: options.Priority}, held, description, run) {
+		return
+	}
+	job, err := queueOperatorJob(options.Operator, "software", description, options.Priority, held, run)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	submittedJob(r, job)
+	http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+}
+
+// bulkSoftwareMarker is the status emoji of a row in a plain-text log
+func bulkSoftwareMarker(status string) string {
+	switch status {
+	case softwareSucceeded:
+		return "✅"
+	case softwareSkipped:
+		return "⏭️"
+	case softwareFailed:
+		return "❌"
+	}
+	return "📝"
+}
+
+// bulkSoftwareRows runs the selections on every target in parallel, ordered by IP
+func bulkSoftwareRows(targets map[string]ServerInfo, selections []softwareSelection, options softwareOptions) []bulkSoftwareRow {
+	ips := make([]string, 0, len(targets))
+	for ip := range targets {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	if options.Parent != nil {
+		options.Parent.setTargets(ips)
+	}
+
+	rows := make([]bulkSoftwareRow, len(ips))
+	fanOut(ips, func(i int, ip string) {
+		server := targets[ip]
+		row := bulkSoftwareRow{IP: ip, Name: server.Name}
+		server, err := operatorServer(server, options.Operator)
+		switch {
+		case err != nil:
+			row.Status, row.Summary = softwareFailed, err.Error()
+		case windowsSelectionError(server, selections, options) != nil:
+			row.Status, row.Summary = softwareSkipped, windowsSelectionError(server, selections, options).Error()
+		default:
+			// Lines of the servers interleave in the group's output, so each is labelled
+			serverOptions := options
+			serverOptions.Live = prefixedOutput("["+ip+"] ", options.Live)
+			row.softwareOutcome = runSoftware(ip, server, selections, serverOptions)
+		}
+		rows[i] = row
+	})
+	return rows
+}
+
+// bulkSoftwareData is the result matrix page for the rows of a group run
+func bulkSoftwareData(group string, selections []softwareSelection, options softwareOptions, rows []bulkSoftwareRow) map[string]interface{} {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.Status]++
+	}
+	var names []string
+	for _, selection := range selections {
+		names = append(names, selection.Name)
+	}
+	action := "Install"
+	if options.Uninstall {
+		action = "Uninstall"
+	}
+	return map[string]interface{}{
+		"Action":    action,
+		"Group":     group,
+		"Software":  strings.Join(names, ", "),
+		"Rows":      rows,
+		"Succeeded": counts[softwareSucceeded],
+		"Failed":    counts[softwareFailed],
+		"Skipped":   counts[softwareSkipped],
+		"Planned":   counts[softwarePlanned],
+	}
+}
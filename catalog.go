@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// windowsPackageIDPattern matches winget IDs such as Git.Git and Chocolatey package names,
+// which are passed to the package managers unquoted
+var windowsPackageIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// CatalogEntry is one row of the catalog page
+type CatalogEntry struct {
+	Software
+	// BuiltIn is set for entries shipped with accmgr4 and Edited when settings override one
+	BuiltIn bool
+	Edited  bool
+}
+
+// softwareCatalog returns the built-in software followed by catalog entries from settings;
+// a settings entry with a built-in name replaces it, or removes it when hidden
+func softwareCatalog() []Software {
+	catalog := slices.Clone(commonSoftware)
+	for _, entry := range settings.Catalog {
+		i := slices.IndexFunc(catalog, func(s Software) bool { return s.Name == entry.Name })
+		switch {
+		case entry.Hidden && i >= 0:
+			catalog = slices.Delete(catalog, i, i+1)
+		case entry.Hidden:
+		case i >= 0:
+			catalog[i] = entry
+		default:
+			catalog = append(catalog, entry)
+		}
+	}
+	return catalog
+}
+
+// sharedCatalog returns the catalog entries from settings that library bundles carry;
+// hidden built-ins are a local choice and are left out
+func sharedCatalog() []Software {
+	var shared []Software
+	for _, entry := range settings.Catalog {
+		if !entry.Hidden {
+			shared = append(shared, entry)
+		}
+	}
+	return shared
+}
+
+// isBuiltInSoftware reports whether name is one of the entries shipped with accmgr4
+func isBuiltInSoftware(name string) bool {
+	return slices.ContainsFunc(commonSoftware, func(s Software) bool { return s.Name == name })
+}
+
+// validateSoftware checks an entry before it is stored or imported
+func validateSoftware(entry Software) error {
+	if entry.Name == "" || (len(entry.Packages) == 0 && entry.Snap == "" && entry.Flatpak == "" &&
+		entry.Pip == "" && entry.Npm == "" && entry.Gem == "" && entry.Compose == "" && entry.DebURL == "" && entry.RpmURL == "") {
+		return errors.New("a name and at least one package, snap, flatpak, pip, npm or gem package, compose file or package URL are required")
+	}
+	if entry.DebURL != "" {
+		if err := validatePackageURL(entry.DebURL, entry.DebSHA256); err != nil {
+			return err
+		}
+	}
+	if entry.RpmURL != "" {
+		if err := validatePackageURL(entry.RpmURL, entry.RpmSHA256); err != nil {
+			return err
+		}
+	}
+	for _, backend := range languageBackends {
+		if name := entry.languagePackage(backend); name != "" && !languageNamePatterns[backend].MatchString(name) {
+			return fmt.Errorf("invalid %s package name %q", backend, name)
+		}
+	}
+	for _, hooks := range [][]string{entry.PreInstall, entry.PostInstall} {
+		if err := validateHooks(hooks); err != nil {
+			return err
+		}
+	}
+	if entry.Verify != "" {
+		if err := validateHooks([]string{entry.Verify}); err != nil {
+			return fmt.Errorf("verification command: %w", err)
+		}
+	}
+	if entry.Compose != "" {
+		if err := validateCompose(entry.Compose); err != nil {
+			return err
+		}
+	}
+	if _, err := templateVariables(variableTexts(entry.PreInstall, entry.PostInstall, entry.Verify, entry.Compose)); err != nil {
+		return fmt.Errorf("invalid variable in the hooks, verification command or compose file: %w", err)
+	}
+	if sanitizePackageName(entry.Name) != entry.Name {
+		return fmt.Errorf("invalid name %q", entry.Name)
+	}
+	for _, pkg := range entry.Packages {
+		if sanitizePackageName(pkg) != pkg {
+			return fmt.Errorf("invalid package name %q", pkg)
+		}
+		if _, _, err := parsePackageSpec(pkg); err != nil {
+			return err
+		}
+	}
+	for _, name := range entry.Requires {
+		if sanitizePackageName(name) != name {
+			return fmt.Errorf("invalid required entry %q", name)
+		}
+	}
+	for _, name := range entry.Repositories {
+		if !repositoryNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid repository name %q", name)
+		}
+	}
+	if entry.Snap != "" && !snapNamePattern.MatchString(entry.Snap) {
+		return fmt.Errorf("invalid snap name %q", entry.Snap)
+	}
+	if entry.Flatpak != "" {
+		if err := validateFlatpakID(entry.Flatpak); err != nil {
+			return err
+		}
+	}
+	for _, id := range []string{entry.Winget, entry.Choco} {
+		if id != "" && !windowsPackageIDPattern.MatchString(id) {
+			return fmt.Errorf("invalid Windows package ID %q", id)
+		}
+	}
+	return nil
+}
+
+// saveCatalogEntry stores an entry in settings, replacing the one named original. Renaming
+// a built-in entry hides the original so it does not reappear next to the renamed copy.
+func saveCatalogEntry(original string, entry Software) error {
+	if err := validateSoftware(entry); err != nil {
+		return err
+	}
+	for _, name := range entry.Repositories {
+		if _, ok := findRepository(name); !ok {
+			return fmt.Errorf("repository %s not found", name)
+		}
+	}
+	if entry.Name != original && slices.ContainsFunc(softwareCatalog(), func(s Software) bool { return s.Name == entry.Name }) {
+		return fmt.Errorf("software %s already exists", entry.Name)
+	}
+	// Check the requirements against the catalog as it will be after the save
+	if len(entry.Requires) > 0 {
+		catalog := slices.DeleteFunc(softwareCatalog(), func(s Software) bool { return s.Name == original || s.Name == entry.Name })
+		if _, _, err := resolveRequires(append(catalog, entry), []string{entry.Name}); err != nil {
+			return err
+		}
+	}
+
+	settings.Catalog = slices.DeleteFunc(settings.Catalog, func(s Software) bool { return s.Name == original || s.Name == entry.Name })
+	if original != "" && original != entry.Name && isBuiltInSoftware(original) {
+		settings.Catalog = append(settings.Catalog, Software{Name: original, Hidden: true})
+	}
+	settings.Catalog = append(settings.Catalog, entry)
+	return saveSettings()
+}
+
+// deleteCatalogEntry removes an entry: a custom one is dropped from settings and a built-in
+// one is hidden
+func deleteCatalogEntry(name string) error {
+	settings.Catalog = slices.DeleteFunc(settings.Catalog, func(s Software) bool { return s.Name == name })
+	if isBuiltInSoftware(name) {
+		settings.Catalog = append(settings.Catalog, Software{Name: name, Hidden: true})
+	}
+	return saveSettings()
+}
+
+// catalogEntries lists the catalog sorted by category, then name
+func catalogEntries() []CatalogEntry {
+	var entries []CatalogEntry
+	for _, software := range softwareCatalog() {
+		builtIn := isBuiltInSoftware(software.Name)
+		edited := builtIn && slices.ContainsFunc(settings.Catalog, func(s Software) bool { return s.Name == software.Name })
+		entries = append(entries, CatalogEntry{Software: software, BuiltIn: builtIn, Edited: edited})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Category != entries[j].Category {
+			return entries[i].Category < entries[j].Category
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// hiddenSoftware lists the built-in entries removed from the catalog
+func hiddenSoftware() []string {
+	var hidden []string
+	for _, entry := range settings.Catalog {
+		if entry.Hidden && isBuiltInSoftware(entry.Name) {
+			hidden = append(hidden, entry.Name)
+		}
+	}
+	sort.Strings(hidden)
+	return hidden
+}
+
+// catalogHandler lists the software catalog with a form to add or edit an entry
+func catalogHandler(w http.ResponseWriter, r *http.Request) {
+	var editing Software
+	if name := r.FormValue("edit"); name != "" {
+		for _, software := range softwareCatalog() {
+			if software.Name == name {
+				editing = software
+			}
+		}
+	}
+	renderTemplate(w, r, "templates/catalog.html", map[string]interface{}{
+		"Entries":      catalogEntries(),
+		"Hidden":       hiddenSoftware(),
+		"Editing":      editing,
+		"Repositories": packageRepositories(),
+	})
+}
+
+// saveCatalogEntryHandler adds an entry or updates the one named original_name
+func saveCatalogEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entry := Software{
+		Name:         strings.TrimSpace(r.FormValue("name")),
+		Description:  strings.TrimSpace(r.FormValue("description")),
+		Category:     strings.TrimSpace(r.FormValue("category")),
+		Packages:     strings.Fields(strings.ReplaceAll(r.FormValue("packages"), ",", " ")),
+		Repositories: r.Form["repositories"],
+		Requires:     strings.Fields(strings.ReplaceAll(r.FormValue("requires"), ",", " ")),
+		Winget:       strings.TrimSpace(r.FormValue("winget")),
+		Choco:        strings.TrimSpace(r.FormValue("choco")),
+		Snap:         strings.TrimSpace(r.FormValue("snap")),
+		SnapClassic:  r.FormValue("snap_classic") == "on",
+		Flatpak:      strings.TrimSpace(r.FormValue("flatpak")),
+		Pip:          strings.TrimSpace(r.FormValue("pip")),
+		Npm:          strings.TrimSpace(r.FormValue("npm")),
+		Gem:          strings.TrimSpace(r.FormValue("gem")),
+		PreInstall:   parseHooks(r.FormValue("pre_install")),
+		PostInstall:  parseHooks(r.FormValue("post_install")),
+		Verify:       strings.TrimSpace(r.FormValue("verify")),
+		Compose:      strings.ReplaceAll(strings.TrimSpace(r.FormValue("compose")), "\r\n", "\n"),
+		DebURL:       strings.TrimSpace(r.FormValue("deb_url")),
+		DebSHA256:    strings.ToLower(strings.TrimSpace(r.FormValue("deb_sha256"))),
+		RpmURL:       strings.TrimSpace(r.FormValue("rpm_url")),
+		RpmSHA256:    strings.ToLower(strings.TrimSpace(r.FormValue("rpm_sha256"))),
+	}
+	if err := saveCatalogEntry(strings.TrimSpace(r.FormValue("original_name")), entry); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/catalog"), http.StatusSeeOther)
+}
+
+// deleteCatalogEntryHandler removes or hides an entry
+func deleteCatalogEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := deleteCatalogEntry(strings.TrimSpace(r.FormValue("name"))); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/catalog"), http.StatusSeeOther)
+}
+
+// restoreCatalogEntryHandler brings back a built-in entry in its shipped form, dropping
+// any edits
+func restoreCatalogEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	settings.Catalog = slices.DeleteFunc(settings.Catalog, func(s Software) bool { return s.Name == name })
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/catalog"), http.StatusSeeOther)
+}
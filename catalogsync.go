@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// catalogSyncStateFile records the last sync and the entries it manages
+	catalogSyncStateFile = "catalog_sync.json"
+	// defaultCatalogSyncInterval applies when CatalogSyncSettings.IntervalSeconds is unset
+	defaultCatalogSyncInterval = 15 * time.Minute
+	// defaultCatalogSyncPath is the document read from a Git repository when Path is unset
+	defaultCatalogSyncPath = "catalog.yaml"
+	// catalogSyncGitTimeout bounds cloning the source repository
+	catalogSyncGitTimeout = 2 * time.Minute
+)
+
+// gitRemotePattern matches the repository URLs a sync source may use: https, http, ssh and
+// git URLs, or the scp-like user@host:path form
+var gitRemotePattern = regexp.MustCompile(`^((https?|ssh|git)://[^\s]+|[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^\s]+)$`)
+
+// CatalogSyncSettings loads the software catalog and recipes from a source shared by several
+// instances, so they all offer one curated catalog. The source is a CatalogDocument in JSON
+// or YAML, fetched from URL or read from a Git repository.
+type CatalogSyncSettings struct {
+	URL string `json:"url,omitempty"`
+	// Git clones URL as a repository and reads Path from Branch, or the default branch
+	Git    bool   `json:"git,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// IntervalSeconds is how often the source is read again
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+}
+
+func (c CatalogSyncSettings) interval() time.Duration {
+	if c.IntervalSeconds > 0 {
+		return time.Duration(c.IntervalSeconds) * time.Second
+	}
+	return defaultCatalogSyncInterval
+}
+
+// IntervalMinutes is the interval as the library page shows it
+func (c CatalogSyncSettings) IntervalMinutes() int {
+	return int(c.interval() / time.Minute)
+}
+
+func (c CatalogSyncSettings) documentPath() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return defaultCatalogSyncPath
+}
+
+// Source describes where the catalog is read from
+func (c CatalogSyncSettings) Source() string {
+	if !c.Git {
+		return c.URL
+	}
+	source := c.URL + " " + c.documentPath()
+	if c.Branch != "" {
+		source += " on " + c.Branch
+	}
+	return source
+}
+
+// validate checks the settings before they are stored
+func (c CatalogSyncSettings) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	if c.Git {
+		if !gitRemotePattern.MatchString(c.URL) {
+			return errors.New("the repository must be an https, http, ssh or git URL, or user@host:path")
+		}
+		if c.Branch != "" && (strings.HasPrefix(c.Branch, "-") || strings.ContainsAny(c.Branch, " \t\n")) {
+			return fmt.Errorf("invalid branch %q", c.Branch)
+		}
+		if p := c.documentPath(); path.IsAbs(p) || !filepath.IsLocal(p) {
+			return fmt.Errorf("the document path %q must be relative to the repository", p)
+		}
+	} else if parsed, err := url.Parse(c.URL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return errors.New("the catalog URL must be an http or https URL")
+	}
+	if c.IntervalSeconds < 0 {
+		return errors.New("the interval cannot be negative")
+	}
+	return nil
+}
+
+// CatalogDocument is the content of a sync source. Entries use the field names of
+// settings.json, e.g. name, packages, requires and steps.
+type CatalogDocument struct {
+	Catalog []Software `json:"catalog,omitempty"`
+	Recipes []Recipe   `json:"recipes,omitempty"`
+}
+
+// CatalogSyncState is the outcome of the last sync. Catalog and Recipes name the entries
+// the source provided, so they can be removed from settings once the source drops them.
+type CatalogSyncState struct {
+	Source      string    `json:"source,omitempty"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success"`
+	// Revision is the Git commit, or a hash of the fetched document
+	Revision string   `json:"revision,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Catalog  []string `json:"catalog,omitempty"`
+	Recipes  []string `json:"recipes,omitempty"`
+	// Changes lists what the last successful sync changed, one line each
+	Changes []string `json:"changes,omitempty"`
+}
+
+var (
+	catalogSyncMu    sync.Mutex
+	catalogSyncState CatalogSyncState
+)
+
+// loadCatalogSyncState reads catalog_sync.json, starting empty when it is missing
+func loadCatalogSyncState() error {
+	file, err := os.Open(catalogSyncStateFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	catalogSyncMu.Lock()
+	defer catalogSyncMu.Unlock()
+	return json.NewDecoder(file).Decode(&catalogSyncState)
+}
+
+// saveCatalogSyncState writes catalog_sync.json; callers hold catalogSyncMu
+func saveCatalogSyncState() error {
+	file, err := os.Create(catalogSyncStateFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(catalogSyncState)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+// runCatalogSync reads the configured source on its interval
+func runCatalogSync() {
+	for {
+		if settings.Library.Sync.URL != "" {
+			syncCatalog()
+		}
+		time.Sleep(settings.Library.Sync.interval())
+	}
+}
+
+// syncCatalog reads the source and merges it into the settings, raising an alert when the
+// source cannot be read or holds invalid entries. A failed sync leaves the settings as they
+// were.
+func syncCatalog() CatalogSyncState {
+	catalogSyncMu.Lock()
+	defer catalogSyncMu.Unlock()
+
+	config := settings.Library.Sync
+	state := catalogSyncState
+	state.LastAttempt = time.Now()
+	// Entries of a previous source stay until the new one is read; they are then replaced,
+	// or removed like entries the source dropped
+	state.Source = config.Source()
+
+	data, revision, err := fetchCatalogSource(config)
+	var document CatalogDocument
+	if err == nil {
+		document, err = decodeCatalogDocument(data)
+	}
+	if err == nil {
+		err = applyCatalogDocument(document, &state)
+	}
+	if err != nil {
+		state.Error = err.Error()
+		raiseAlert("catalog-sync", "", "warning", "Catalog sync from "+config.Source()+" failed: "+err.Error())
+	} else {
+		state.Error = ""
+		state.LastSuccess = state.LastAttempt
+		state.Revision = revision
+		clearAlert("catalog-sync")
+	}
+	catalogSyncState = state
+	saveCatalogSyncState()
+	publishEvent("catalog.synced", state)
+	return state
+}
+
+// fetchCatalogSource returns the source document and its revision
+func fetchCatalogSource(config CatalogSyncSettings) ([]byte, string, error) {
+	if err := config.validate(); err != nil {
+		return nil, "", err
+	}
+	if !config.Git {
+		body, err := fetchURL(config.URL)
+		if err != nil {
+			return nil, "", err
+		}
+		defer body.Close()
+		data, err := readCatalogDocument(body)
+		if err != nil {
+			return nil, "", err
+		}
+		sum := sha256.Sum256(data)
+		return data, hex.EncodeToString(sum[:])[:12], nil
+	}
+
+	dir, err := os.MkdirTemp("", "accmgr4-catalog-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), catalogSyncGitTimeout)
+	defer cancel()
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if config.Branch != "" {
+		args = append(args, "--branch", config.Branch)
+	}
+	if _, err := runGit(ctx, "", append(args, "--", config.URL, dir)...); err != nil {
+		return nil, "", err
+	}
+	revision, err := runGit(ctx, dir, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := os.Open(filepath.Join(dir, filepath.FromSlash(config.documentPath())))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading %s from the repository: %w", config.documentPath(), errors.Unwrap(err))
+	}
+	defer file.Close()
+	data, err := readCatalogDocument(file)
+	return data, strings.TrimSpace(revision), err
+}
+
+// runGit runs git without prompting for credentials, which must come from the host's SSH
+// agent, keys or credential helper
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// readCatalogDocument reads a source document of at most maxBundleSize bytes
+func readCatalogDocument(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBundleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBundleSize {
+		return nil, errors.New("the catalog document is too large")
+	}
+	return data, nil
+}
+
+// decodeCatalogDocument parses a JSON or YAML document. YAML is converted to JSON first so
+// both use the JSON field names, and unknown fields are rejected to catch typos.
+func decodeCatalogDocument(data []byte) (CatalogDocument, error) {
+	var document CatalogDocument
+	var generic interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return document, fmt.Errorf("reading the catalog document: %w", err)
+	}
+	converted, err := json.Marshal(generic)
+	if err != nil {
+		return document, fmt.Errorf("reading the catalog document: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(converted))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&document); err != nil {
+		return document, fmt.Errorf("reading the catalog document: %w", err)
+	}
+	return document, nil
+}
+
+// applyCatalogDocument replaces the entries in settings that the source provides, removes
+// those it provided before but no longer does, and records them in state. Local entries with
+// the same name as a source entry are replaced: the shared catalog wins.
+func applyCatalogDocument(document CatalogDocument, state *CatalogSyncState) error {
+	var catalogNames, recipeNames []string
+	for _, entry := range document.Catalog {
+		if entry.Hidden {
+			return fmt.Errorf("catalog entry %s is hidden; a shared catalog cannot hide entries", entry.Name)
+		}
+		if err := validateSoftware(entry); err != nil {
+			return fmt.Errorf("catalog entry %q: %w", entry.Name, err)
+		}
+		if slices.Contains(catalogNames, entry.Name) {
+			return fmt.Errorf("catalog entry %s appears twice", entry.Name)
+		}
+		catalogNames = append(catalogNames, entry.Name)
+	}
+	for _, recipe := range document.Recipes {
+		if err := validateRecipe(recipe); err != nil {
+			return fmt.Errorf("recipe %q: %w", recipe.Name, err)
+		}
+		if slices.Contains(recipeNames, recipe.Name) {
+			return fmt.Errorf("recipe %s appears twice", recipe.Name)
+		}
+		recipeNames = append(recipeNames, recipe.Name)
+	}
+
+	var changes []string
+	catalog := slices.DeleteFunc(slices.Clone(settings.Catalog), func(s Software) bool {
+		if slices.Contains(catalogNames, s.Name) {
+			return true
+		}
+		if slices.Contains(state.Catalog, s.Name) {
+			changes = append(changes, "🗑️ Removed software "+s.Name)
+			return true
+		}
+		return false
+	})
+	for _, entry := range document.Catalog {
+		i := slices.IndexFunc(settings.Catalog, func(s Software) bool { return s.Name == entry.Name })
+		switch {
+		case i < 0:
+			changes = append(changes, "✅ Added software "+entry.Name)
+		case !sameJSON(settings.Catalog[i], entry):
+			changes = append(changes, "♻️ Updated software "+entry.Name)
+		}
+		catalog = append(catalog, entry)
+	}
+	saved := settings.Catalog
+	settings.Catalog = catalog
+	_, _, err := resolveRequires(softwareCatalog(), catalogNames)
+	settings.Catalog = saved
+	if err != nil {
+		return err
+	}
+
+	recipeList := slices.DeleteFunc(slices.Clone(settings.Recipes), func(r Recipe) bool {
+		if slices.Contains(recipeNames, r.Name) {
+			return true
+		}
+		if slices.Contains(state.Recipes, r.Name) {
+			changes = append(changes, "🗑️ Removed recipe "+r.Name)
+			return true
+		}
+		return false
+	})
+	for _, recipe := range document.Recipes {
+		i := slices.IndexFunc(settings.Recipes, func(r Recipe) bool { return r.Name == recipe.Name })
+		switch {
+		case i < 0:
+			changes = append(changes, "✅ Added recipe "+recipe.Name)
+		case !sameJSON(settings.Recipes[i], recipe):
+			changes = append(changes, "♻️ Updated recipe "+recipe.Name)
+		}
+		recipeList = append(recipeList, recipe)
+	}
+
+	state.Catalog, state.Recipes = catalogNames, recipeNames
+	if len(changes) == 0 {
+		state.Changes = nil
+		return nil
+	}
+	settings.Catalog, settings.Recipes = catalog, recipeList
+	state.Changes = changes
+	return saveSettings()
+}
+
+// sameJSON reports whether two values encode to the same JSON
+func sameJSON(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// updateCatalogSyncHandler saves the sync source and reads it straight away
+func updateCatalogSyncHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	config := CatalogSyncSettings{
+		URL:    strings.TrimSpace(r.FormValue("url")),
+		Git:    r.FormValue("git") == "on",
+		Branch: strings.TrimSpace(r.FormValue("branch")),
+		Path:   strings.TrimSpace(r.FormValue("path")),
+	}
+	if minutes := strings.TrimSpace(r.FormValue("interval_minutes")); minutes != "" {
+		n, err := strconv.Atoi(minutes)
+		if err != nil || n < 1 {
+			http.Error(w, "❌ The interval must be a whole number of minutes", http.StatusBadRequest)
+			return
+		}
+		config.IntervalSeconds = n * 60
+	}
+	if err := config.validate(); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.Library.Sync = config
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if config.URL != "" {
+		syncCatalog()
+	}
+	http.Redirect(w, r, appPath(r, "/library"), http.StatusSeeOther)
+}
+
+// syncCatalogHandler reads the source now and shows what changed
+func syncCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if settings.Library.Sync.URL == "" {
+		http.Error(w, "❌ No catalog source is configured", http.StatusBadRequest)
+		return
+	}
+	state := syncCatalog()
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString("🔄 Catalog sync from " + state.Source + "\n\n")
+	if state.Error != "" {
+		logBuilder.WriteString("❌ " + state.Error + "\n")
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
+	}
+	logBuilder.WriteString(fmt.Sprintf("Revision %s: %d catalog entries, %d recipes\n\n", state.Revision, len(state.Catalog), len(state.Recipes)))
+	for _, change := range state.Changes {
+		logBuilder.WriteString(change + "\n")
+	}
+	if len(state.Changes) == 0 {
+		logBuilder.WriteString("⏭️ The catalog is already up to date\n")
+	}
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
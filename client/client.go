@@ -0,0 +1,309 @@
+// Code generated by "accountmanager -generate-client"; DO NOT EDIT.
+
+// Package client is a typed Go client for the accmgr4 /api/v1 endpoints.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client calls the accmgr4 API at BaseURL, e.g. "http://accmgr:8080", as the user of
+// Token, an API token
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the given base URL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+// do sends one request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr Error
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Alert mirrors the server's APIAlert type
+type Alert struct {
+	Key      string    `json:"key"`
+	Server   string    `json:"server"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+	RaisedAt time.Time `json:"raised_at"`
+}
+
+// BatchServer mirrors the server's BatchServer type
+type BatchServer struct {
+	IP         string `json:"ip"`
+	JobID      string `json:"job_id,omitempty"`
+	Status     string `json:"status"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// BatchSummary mirrors the server's BatchSummary type
+type BatchSummary struct {
+	JobID       string        `json:"job_id"`
+	Description string        `json:"description"`
+	Status      string        `json:"status"`
+	Total       int           `json:"total"`
+	Succeeded   int           `json:"succeeded"`
+	Failed      int           `json:"failed"`
+	Pending     int           `json:"pending"`
+	NotRun      int           `json:"not_run"`
+	Servers     []BatchServer `json:"servers"`
+	RetryOf     string        `json:"retry_of,omitempty"`
+	Retries     []string      `json:"retries,omitempty"`
+	Retrying    string        `json:"retrying,omitempty"`
+}
+
+// CommandPlan mirrors the server's CommandPlan type
+type CommandPlan struct {
+	Login      string `json:"login"`
+	Command    string `json:"command"`
+	Stdin      string `json:"stdin"`
+	UploadPath string `json:"upload_path,omitempty"`
+	Upload     string `json:"upload,omitempty"`
+	Fallback   string `json:"fallback,omitempty"`
+}
+
+// CommandRequest mirrors the server's APICommandRequest type
+type CommandRequest struct {
+	Command   string            `json:"command"`
+	Escalate  bool              `json:"escalate,omitempty"`
+	Upload    bool              `json:"upload,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	DryRun    bool              `json:"dry_run,omitempty"`
+	Artifacts []string          `json:"artifacts,omitempty"`
+	Timeout   string            `json:"timeout,omitempty"`
+	Priority  string            `json:"priority,omitempty"`
+}
+
+// CommandResponse mirrors the server's APICommandResponse type
+type CommandResponse struct {
+	JobID      string        `json:"job_id,omitempty"`
+	ExitCode   int           `json:"exit_code"`
+	DurationMS int64         `json:"duration_ms"`
+	Stdout     string        `json:"stdout"`
+	Stderr     string        `json:"stderr"`
+	Truncated  bool          `json:"truncated"`
+	Plan       *CommandPlan  `json:"plan,omitempty"`
+	Artifacts  []JobArtifact `json:"artifacts,omitempty"`
+	Pending    bool          `json:"pending,omitempty"`
+}
+
+// Error mirrors the server's APIError type
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Health mirrors the server's APIHealth type
+type Health struct {
+	CheckedAt        time.Time `json:"checked_at"`
+	Reachable        bool      `json:"reachable"`
+	Error            string    `json:"error,omitempty"`
+	ClockSkewSeconds int       `json:"clock_skew_seconds"`
+	ClockSkewHigh    bool      `json:"clock_skew_high"`
+}
+
+// Job mirrors the server's APIJob type
+type Job struct {
+	ID             string        `json:"id"`
+	Kind           string        `json:"kind"`
+	Server         string        `json:"server,omitempty"`
+	Description    string        `json:"description"`
+	Operator       string        `json:"operator,omitempty"`
+	Status         string        `json:"status"`
+	Progress       string        `json:"progress,omitempty"`
+	Step           int           `json:"step,omitempty"`
+	Steps          int           `json:"steps,omitempty"`
+	ExitCode       *int          `json:"exit_code,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	QueuedAt       *time.Time    `json:"queued_at,omitempty"`
+	StartedAt      time.Time     `json:"started_at"`
+	FinishedAt     *time.Time    `json:"finished_at,omitempty"`
+	Notes          []JobNote     `json:"notes,omitempty"`
+	Artifacts      []JobArtifact `json:"artifacts,omitempty"`
+	Log            string        `json:"log,omitempty"`
+	CancelledBy    string        `json:"cancelled_by,omitempty"`
+	Notify         string        `json:"notify,omitempty"`
+	TimeoutSeconds int           `json:"timeout_seconds,omitempty"`
+	TimedOut       bool          `json:"timed_out,omitempty"`
+	Priority       string        `json:"priority,omitempty"`
+	Targets        []string      `json:"targets,omitempty"`
+	Parent         string        `json:"parent,omitempty"`
+	RetryOf        string        `json:"retry_of,omitempty"`
+	Approval       string        `json:"approval,omitempty"`
+	ApprovedBy     string        `json:"approved_by,omitempty"`
+	HeldBy         string        `json:"held_by,omitempty"`
+}
+
+// JobArtifact mirrors the server's JobArtifact type
+type JobArtifact struct {
+	Name       string `json:"name"`
+	RemotePath string `json:"remote_path"`
+	Size       int64  `json:"size"`
+	Error      string `json:"error,omitempty"`
+}
+
+// JobNote mirrors the server's JobNote type
+type JobNote struct {
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JobNoteRequest mirrors the server's APIJobNoteRequest type
+type JobNoteRequest struct {
+	Text string `json:"text"`
+}
+
+// Server mirrors the server's APIServer type
+type Server struct {
+	IP        string   `json:"ip"`
+	Name      string   `json:"name"`
+	Group     string   `json:"group,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	LoginUser string   `json:"login_user"`
+	Platform  string   `json:"platform"`
+	UseAgent  bool     `json:"use_agent"`
+	Accounts  []string `json:"accounts"`
+	Health    *Health  `json:"health,omitempty"`
+}
+
+// ListServers calls GET /api/v1/servers: List servers with their latest health
+func (c *Client) ListServers(ctx context.Context, group string, tag string) ([]Server, error) {
+	query := url.Values{}
+	if group != "" {
+		query.Set("group", group)
+	}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	var out []Server
+	err := c.do(ctx, "GET", "/api/v1/servers", query, nil, &out)
+	return out, err
+}
+
+// GetServer calls GET /api/v1/servers/{ip}: Get one server
+func (c *Client) GetServer(ctx context.Context, ip string) (Server, error) {
+	query := url.Values{}
+	var out Server
+	err := c.do(ctx, "GET", "/api/v1/servers/"+url.PathEscape(ip), query, nil, &out)
+	return out, err
+}
+
+// RunCommand calls POST /api/v1/servers/{ip}/commands: Run a command as the login user, or as root when escalate is set. With dry_run the login is checked and the exact command returned without running it. Returns 502 when the server cannot be reached. A command an approval rule holds back is not run: it gets 202 with pending set and the job that runs it once another operator approves it. A request repeating the Idempotency-Key header of an earlier one does not run again; it gets 409 with the Location of the first one's job, or 422 when its body differs
+func (c *Client) RunCommand(ctx context.Context, ip string, body CommandRequest) (CommandResponse, error) {
+	query := url.Values{}
+	var out CommandResponse
+	err := c.do(ctx, "POST", "/api/v1/servers/"+url.PathEscape(ip)+"/commands", query, body, &out)
+	return out, err
+}
+
+// ListAlerts calls GET /api/v1/alerts: List active alerts, most severe first
+func (c *Client) ListAlerts(ctx context.Context) ([]Alert, error) {
+	query := url.Values{}
+	var out []Alert
+	err := c.do(ctx, "GET", "/api/v1/alerts", query, nil, &out)
+	return out, err
+}
+
+// ListJobs calls GET /api/v1/jobs: List recent jobs, newest first. Live updates are available from the /events stream
+func (c *Client) ListJobs(ctx context.Context, status string) ([]Job, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	var out []Job
+	err := c.do(ctx, "GET", "/api/v1/jobs", query, nil, &out)
+	return out, err
+}
+
+// GetJob calls GET /api/v1/jobs/{id}: Get one job
+func (c *Client) GetJob(ctx context.Context, id string) (Job, error) {
+	query := url.Values{}
+	var out Job
+	err := c.do(ctx, "GET", "/api/v1/jobs/"+url.PathEscape(id), query, nil, &out)
+	return out, err
+}
+
+// GetJobSummary calls GET /api/v1/jobs/{id}/summary: Get the per-server outcomes of a batch job, such as a command template run on a group, with pass/fail counts. Returns 404 for a job that does not run on many servers
+func (c *Client) GetJobSummary(ctx context.Context, id string) (BatchSummary, error) {
+	query := url.Values{}
+	var out BatchSummary
+	err := c.do(ctx, "GET", "/api/v1/jobs/"+url.PathEscape(id)+"/summary", query, nil, &out)
+	return out, err
+}
+
+// AddJobNote calls POST /api/v1/jobs/{id}/notes: Pin a handoff note to a running job, e.g. "waiting on mirror, do not cancel". Returns 409 once the job has finished
+func (c *Client) AddJobNote(ctx context.Context, id string, body JobNoteRequest) (Job, error) {
+	query := url.Values{}
+	var out Job
+	err := c.do(ctx, "POST", "/api/v1/jobs/"+url.PathEscape(id)+"/notes", query, body, &out)
+	return out, err
+}
+
+// CancelJob calls POST /api/v1/jobs/{id}/cancel: Cancel a pending, queued or running job. A pending job is rejected and a queued one removed from the queue; a running job's command is interrupted and the job finishes as cancelled shortly after. Returns 409 once the job has finished
+func (c *Client) CancelJob(ctx context.Context, id string) (Job, error) {
+	query := url.Values{}
+	var out Job
+	err := c.do(ctx, "POST", "/api/v1/jobs/"+url.PathEscape(id)+"/cancel", query, nil, &out)
+	return out, err
+}
+
+// ApproveJob calls POST /api/v1/jobs/{id}/approve: Approve a job an approval rule held as pending, so it is queued to run. Returns 403 for the operator who started the job or an unidentified one, and 409 for a job not waiting for approval
+func (c *Client) ApproveJob(ctx context.Context, id string) (Job, error) {
+	query := url.Values{}
+	var out Job
+	err := c.do(ctx, "POST", "/api/v1/jobs/"+url.PathEscape(id)+"/approve", query, nil, &out)
+	return out, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// withEnv prefixes a script with export lines for env. Values are single-quoted, so they are
+// passed through literally and never expanded. Exports inside the script also survive sudo's
+// environment reset, unlike variables sent with the SSH "env" request, which most sshd
+// configurations refuse anyway.
+func withEnv(script string, env map[string]string) string {
+	if len(env) == 0 {
+		return script
+	}
+	var exports strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if !envNamePattern.MatchString(name) {
+			continue
+		}
+		exports.WriteString("export " + name + "=" + shellQuote(env[name]) + "\n")
+	}
+	return exports.String() + script
+}
+
+// mergeEnv layers narrower variables over broader ones without modifying either map
+func mergeEnv(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	maps.Copy(merged, base)
+	maps.Copy(merged, override)
+	return merged
+}
+
+// parseEnvAssignments reads NAME=value lines from a form field; blank lines and # comments are skipped
+func parseEnvAssignments(text string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment variable %q; use NAME=value", line)
+		}
+		env[name] = value
+	}
+	if len(env) == 0 {
+		return nil, nil
+	}
+	return env, nil
+}
+
+// formatEnvAssignments renders variables as sorted NAME=value lines for a form field
+func formatEnvAssignments(env map[string]string) string {
+	var lines []string
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		lines = append(lines, name+"="+env[name])
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CommandTemplate is a saved ad-hoc command such as "systemctl restart {{.Service}}".
+// Its parameters are the template's variables, entered each time it runs on a server or
+// group; a parameter with a default may be left empty.
+type CommandTemplate struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Command     string `json:"command"`
+	// Defaults are the values of parameters left empty; a parameter without one is required
+	Defaults map[string]string `json:"defaults,omitempty"`
+	Escalate bool              `json:"escalate,omitempty"`
+	// Upload sends the command as a script file, like upload mode on the command form
+	Upload bool `json:"upload,omitempty"`
+	// Env is exported for the command, on top of the global, group and server variables
+	Env map[string]string `json:"env,omitempty"`
+	// Artifacts are remote paths or glob patterns collected after each run, on every server
+	// of a group run
+	Artifacts []string `json:"artifacts,omitempty"`
+}
+
+// Parameters lists the variables the command uses; templates are validated when saved, so
+// a parse error means none
+func (c CommandTemplate) Parameters() []string {
+	names, _ := templateVariables([]string{c.Command})
+	return names
+}
+
+// options are the adHocOptions the template runs with
+func (c CommandTemplate) options() adHocOptions {
+	return adHocOptions{Escalate: c.Escalate, Upload: c.Upload, Env: c.Env}
+}
+
+// render substitutes the parameters read from the form into the command. Values follow
+// the same rules as catalog variables, since they end up in a shell command.
+func (c CommandTemplate) render(form url.Values) (string, error) {
+	values := make(map[string]string)
+	for _, name := range c.Parameters() {
+		value := strings.TrimSpace(form.Get(parameterField(name)))
+		if value == "" {
+			value = c.Defaults[name]
+		}
+		switch {
+		case value == "":
+			return "", fmt.Errorf("enter a value for %s", name)
+		case !variableValuePattern.MatchString(value):
+			return "", fmt.Errorf("invalid value %q for %s: use letters, digits and . _ : / @ + -", value, name)
+		}
+		values[name] = value
+	}
+	return renderVariable(c.Command, values)
+}
+
+// parameterField is the form field holding a parameter's value
+func parameterField(name string) string {
+	return "param." + name
+}
+
+// findCommandTemplate looks a template up by name
+func findCommandTemplate(name string) (CommandTemplate, bool) {
+	i := slices.IndexFunc(settings.CommandTemplates, func(c CommandTemplate) bool { return c.Name == name })
+	if i < 0 {
+		return CommandTemplate{}, false
+	}
+	return settings.CommandTemplates[i], true
+}
+
+// validateCommandTemplate checks a template before it is stored
+func validateCommandTemplate(tmpl CommandTemplate) error {
+	if !scheduleNamePattern.MatchString(tmpl.Name) {
+		return fmt.Errorf("invalid template name %q; use lowercase letters, digits and dashes", tmpl.Name)
+	}
+	if strings.TrimSpace(tmpl.Command) == "" {
+		return errors.New("command is required")
+	}
+	names, err := templateVariables([]string{tmpl.Command})
+	if err != nil {
+		return fmt.Errorf("invalid command template: %w", err)
+	}
+	for name, value := range tmpl.Defaults {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("default for %s, which the command does not use", name)
+		}
+		if !variableValuePattern.MatchString(value) {
+			return fmt.Errorf("invalid default %q for %s: use letters, digits and . _ : / @ + -", value, name)
+		}
+	}
+	return nil
+}
+
+// commandTemplatesHandler lists the saved templates with a form to add or edit one
+func commandTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	var editing CommandTemplate
+	if name := r.FormValue("edit"); name != "" {
+		editing, _ = findCommandTemplate(name)
+	}
+	renderTemplate(w, r, "templates/commandtemplates.html", map[string]interface{}{
+		"Templates":   settings.CommandTemplates,
+		"Editing":     editing,
+		"EditingEnv":  formatEnvAssignments(editing.Env),
+		"EditingDefs": formatEnvAssignments(editing.Defaults),
+	})
+}
+
+// saveCommandTemplateHandler adds a template or replaces the one with the same name
+func saveCommandTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tmpl := CommandTemplate{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Command:     strings.ReplaceAll(r.FormValue("command"), "\r\n", "\n"),
+		Escalate:    r.FormValue("escalate") == "on",
+		Upload:      r.FormValue("mode") == "upload",
+		Artifacts:   parseArtifactPatterns(r.FormValue("artifacts")),
+	}
+	var err error
+	if tmpl.Env, err = parseEnvAssignments(r.FormValue("env")); err != nil {
+		http.Error(w, "❌ Environment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tmpl.Defaults, err = parseEnvAssignments(r.FormValue("defaults")); err != nil {
+		http.Error(w, "❌ Defaults: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCommandTemplate(tmpl); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.CommandTemplates = slices.DeleteFunc(settings.CommandTemplates, func(c CommandTemplate) bool { return c.Name == tmpl.Name })
+	settings.CommandTemplates = append(settings.CommandTemplates, tmpl)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/command-templates"), http.StatusSeeOther)
+}
+
+// deleteCommandTemplateHandler removes a template
+func deleteCommandTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	settings.CommandTemplates = slices.DeleteFunc(settings.CommandTemplates, func(c CommandTemplate) bool { return c.Name == name })
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/command-templates"), http.StatusSeeOther)
+}
+
+// commandTemplateHandler shows the form that runs one template, asking for its parameters
+// and the server or group to run on
+func commandTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, ok := findCommandTemplate(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	servers := requestServers(r)
+	ips := make([]string, 0, len(servers))
+	for ip := range servers {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	renderTemplate(w, r, "templates/commandtemplate.html", map[string]interface{}{
+		"Template": tmpl,
+		"IPs":      ips,
+		"Servers":  servers,
+		"Groups":   serverGroups(servers),
+	})
+}
+
+// runCommandTemplateHandler runs a template on one server, through the command form so it
+// gets the same log, artifacts and history, or on every server of a group in parallel as a
+// queued job with one command job per server
+func runCommandTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmpl, ok := findCommandTemplate(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	command, err := tmpl.render(r.Form)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	serverIP, group := strings.TrimSpace(r.FormValue("server_ip")), strings.TrimSpace(r.FormValue("group"))
+	if (serverIP == "") == (group == "") {
+		http.Error(w, "Choose either a server or a group", http.StatusBadRequest)
+		return
+	}
+	timeout, err := parseJobTimeout(r.FormValue("timeout"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	priority, err := parseJobPriority(r.FormValue("priority"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if serverIP != "" {
+		form := url.Values{
+			"server_ip": {serverIP},
+			"command":   {command},
+			"env":       {formatEnvAssignments(tmpl.Env)},
+			"dry_run":   {r.FormValue("dry_run")},
+			"timeout":   {r.FormValue("timeout")},
+			"priority":  {priority},
+			"artifacts": {strings.Join(tmpl.Artifacts, "\n")},
+		}
+		if tmpl.Escalate {
+			form.Set("escalate", "on")
+		}
+		if tmpl.Upload {
+			form.Set("mode", "upload")
+		}
+		replay := r.Clone(r.Context())
+		replay.Form, replay.PostForm = form, form
+		executeCommandHandler(w, replay)
+		return
+	}
+
+	targets := upgradeTargets("", group)
+	retryOf := r.FormValue(retryOfField)
+	if retryOf != "" {
+		if targets, err = retryTargets(retryOf); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+			return
+		}
+	}
+	if len(targets) == 0 {
+		http.Error(w, "No servers in group "+group, http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, slices.Collect(maps.Keys(targets))) {
+		return
+	}
+	operator := requestOperator(r)
+	if r.FormValue("dry_run") == "on" {
+		renderTemplate(w, r, "templates/logs.html", planTemplateGroup(tmpl, command, group, targets, operator))
+		return
+	}
+	form, ctx, jobURL := maps.Clone(r.PostForm), r.Context(), appPath(r, "/job?id=")
+	description := fmt.Sprintf("Template %s on group %s", tmpl.Name, group)
+	if retryOf != "" {
+		description += fmt.Sprintf(", retrying %d failed servers of %s", len(targets), retryOf)
+	}
+	run := asRetry(retryOf, func(job *Job) jobResult {
+		job.setRerun(ctx, "/run-command-template", form)
+		job.setTimeout(timeout)
+		log, failed := runTemplateGroup(job, tmpl, command, group, targets, operator, timeout, priority, jobURL)
+		result := jobResult{Log: log, Template: "templates/logs.html", Data: log}
+		if failed > 0 {
+			result.Err = fmt.Errorf("%d of %d servers failed", failed, len(targets))
+		}
+		return result
+	})
+	if holdForApproval(w, r, Job{Kind: "command", Description: description, Priority: priority}, jobTargets{"command", targets}, command, run) {
+		return
+	}
+	job, err := queueOperatorJob(operator, "command", description, priority, jobTargets{"command", targets}, run)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	submittedJob(r, job)
+	http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+}
+
+// runTemplateGroup runs the command on every target in parallel, each as its own job whose
+// output also reaches the group's job labelled with the server, and returns the log and the
+// number of servers that failed. Artifacts stay with each server's job, linked as jobURL
+// followed by its ID.
+func runTemplateGroup(parent *Job, tmpl CommandTemplate, command, group string, targets map[string]ServerInfo, operator string, timeout time.Duration, priority, jobURL string) (string, int) {
+	ips := make([]string, 0, len(targets))
+	for ip := range targets {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	parent.setTargets(ips)
+
+	logs := make([]string, len(ips))
+	ok := make([]bool, len(ips))
+	fanOut(ips, func(i int, ip string) {
+		var logBuilder strings.Builder
+		logBuilder.WriteString(fmt.Sprintf("── %s ──\n", ip))
+		server, err := operatorServer(targets[ip], operator)
+		if err != nil {
+			logBuilder.WriteString("❌ " + err.Error() + "\n")
+			logs[i] = logBuilder.String()
+			return
+		}
+		job := startPriorityJob(operator, "command", ip, firstLine(command), priority)
+		job.setParent(parent)
+		job.setTimeout(timeout)
+		stop := job.followCancel(parent)
+		result, err := runAdHocCommand(job.context(), ip, server, operatorScript(server, command, operator, job.ID), tmpl.options(), job.teeOutput(prefixedOutput("["+ip+"] ", parent.output)))
+		stop()
+		var artifacts []JobArtifact
+		if err == nil && len(tmpl.Artifacts) > 0 {
+			artifacts = collectArtifacts(job, ip, server, tmpl.Artifacts)
+		}
+		job.finishCommand(result, err)
+		ok[i] = writeCommandLog(&logBuilder, result, err) && result.OK()
+		if len(artifacts) > 0 {
+			writeArtifactLog(&logBuilder, jobURL+job.ID, artifacts)
+		}
+		logs[i] = logBuilder.String()
+	})
+
+	failed := 0
+	for _, succeeded := range ok {
+		if !succeeded {
+			failed++
+		}
+	}
+	header := fmt.Sprintf("▶️ Template %s on group %s: %d of %d servers succeeded\n\n", tmpl.Name, group, len(ips)-failed, len(ips))
+	return header + strings.Join(logs, "\n"), failed
+}
+
+// planTemplateGroup is the dry run of a group run: the plan for each server and whether it
+// accepted the login
+func planTemplateGroup(tmpl CommandTemplate, command, group string, targets map[string]ServerInfo, operator string) string {
+	ips := make([]string, 0, len(targets))
+	for ip := range targets {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("▶️ Template %s on group %s\n\n", tmpl.Name, group))
+	for _, ip := range ips {
+		logBuilder.WriteString(fmt.Sprintf("── %s ──\n", ip))
+		server, err := operatorServer(targets[ip], operator)
+		var plan CommandPlan
+		if err == nil {
+			plan, err = planAdHocCommand(server, operatorScript(server, command, operator, "dry-run"), tmpl.options())
+		}
+		if err != nil {
+			logBuilder.WriteString("❌ " + err.Error() + "\n\n")
+			continue
+		}
+		writeDryRunLog(&logBuilder, plan, checkLogin(ip, plan))
+		logBuilder.WriteString("\n")
+	}
+	return logBuilder.String()
+}
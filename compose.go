@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// backendCompose deploys a Docker Compose stack instead of installing packages
+	backendCompose = "compose"
+	// composeAppsDir holds one directory per deployed app with its compose file and any
+	// bind-mounted data the file refers to with relative paths
+	composeAppsDir = "/opt/accmgr4/apps"
+	// maxComposeBytes is the largest compose file a catalog entry may carry
+	maxComposeBytes = 64 << 10
+)
+
+// composeProjectInvalid matches the characters Compose does not allow in project names
+var composeProjectInvalid = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// composeSlug is an app's name as Compose accepts it, e.g. "Uptime Kuma" becomes uptime-kuma
+func composeSlug(name string) string {
+	return strings.Trim(composeProjectInvalid.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// composeProject is the Compose project name of an app
+func composeProject(name string) string {
+	return "accmgr4-" + composeSlug(name)
+}
+
+// composeDir is where an app's compose file is stored on the server
+func composeDir(name string) string {
+	return composeAppsDir + "/" + composeSlug(name)
+}
+
+// validateCompose does the checks possible without Docker; the server runs
+// docker compose config on the file before deploying it
+func validateCompose(content string) error {
+	if len(content) > maxComposeBytes {
+		return fmt.Errorf("the compose file is larger than %d KB", maxComposeBytes>>10)
+	}
+	if !strings.Contains(content, "services:") {
+		return errors.New("the compose file has no services: section")
+	}
+	return nil
+}
+
+// portainerCompose runs Portainer CE on https port 9443
+const portainerCompose = `services:
+  portainer:
+    image: portainer/portainer-ce:lts
+    restart: unless-stopped
+    ports:
+      - "9443:9443"
+    volumes:
+      - /var/run/docker.sock:/var/run/docker.sock
+      - portainer_data:/data
+volumes:
+  portainer_data:
+`
+
+// uptimeKumaCompose runs Uptime Kuma on port 3001
+const uptimeKumaCompose = `services:
+  uptime-kuma:
+    image: louislam/uptime-kuma:1
+    restart: unless-stopped
+    ports:
+      - "3001:3001"
+    volumes:
+      - uptime_kuma_data:/app/data
+volumes:
+  uptime_kuma_data:
+`
+
+// composePackages are the distribution packages providing Docker and the compose plugin on
+// managers without Docker's own repository
+var composePackages = map[string][]string{
+	"apk":    {"docker", "docker-cli-compose"},
+	"pacman": {"docker", "docker-compose"},
+	"zypper": {"docker", "docker-compose"},
+}
+
+// composeBootstrap installs Docker with the compose plugin when docker compose is missing,
+// from Docker's repository on apt, dnf and yum and from the distribution elsewhere, and
+// makes sure the daemon is running
+func composeBootstrap(manager PackageManager, verbosity string) (string, error) {
+	var install string
+	if packages, ok := composePackages[manager.Name()]; ok {
+		install = manager.Update(verbosity) + " && " + manager.Install(packages, verbosity)
+	} else {
+		repository, _ := findRepository("docker")
+		addRepository, err := addRepositoryScript(manager, repository, verbosity)
+		if err != nil {
+			return "", err
+		}
+		install = addRepository + " && " + manager.Update(verbosity) + " && " +
+			manager.Install([]string{"docker-ce", "docker-ce-cli", "containerd.io", "docker-compose-plugin"}, verbosity)
+	}
+	return "if ! docker compose version >/dev/null 2>&1; then " + install + "; fi && " +
+		"{ systemctl enable --now docker 2>/dev/null || { rc-update add docker default && rc-service docker start; }; } && " +
+		"docker compose version", nil
+}
+
+// composeWrite stores the app's compose file, keeping the previous one if the new file
+// does not pass docker compose config
+func composeWrite(selection softwareSelection) string {
+	dir := composeDir(selection.Name)
+	return "install -d -m 0750 " + dir + " && " +
+		"printf '%s\\n' " + shellQuote(strings.TrimRight(selection.Compose, "\n")) + " > " + dir + "/compose.yaml.new && " +
+		"docker compose -p " + composeProject(selection.Name) + " -f " + dir + "/compose.yaml.new config -q && " +
+		"mv " + dir + "/compose.yaml.new " + dir + "/compose.yaml"
+}
+
+// composeUp starts the app, pulling images first and recreating changed containers
+func composeUp(selection softwareSelection) string {
+	return "docker compose -p " + composeProject(selection.Name) + " -f " + composeDir(selection.Name) + "/compose.yaml up -d --pull always"
+}
+
+// composeDown stops and removes the app's containers; purge also deletes its named volumes
+// and its directory with any bind-mounted data
+func composeDown(selection softwareSelection, purge bool) string {
+	command := "docker compose -p " + composeProject(selection.Name) + " down"
+	if purge {
+		command += " --volumes && rm -rf " + composeDir(selection.Name)
+	}
+	return command
+}
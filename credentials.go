@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// credentialCheck is the outcome of verifying a new password against one server
+type credentialCheck struct {
+	IP     string
+	Server ServerInfo
+	Err    error
+}
+
+// passwordLogin is the admin record with only the password left to authenticate with, so
+// a key or the agent cannot make a wrong password look verified
+func passwordLogin(server ServerInfo, password string) ServerInfo {
+	login := server
+	login.RootPassword = password
+	login.UseAgent = false
+	login.KeyFile, login.CertFile = "", ""
+	login.RunAs = nil
+	return login
+}
+
+// verifyPassword logs in to every server in parallel with the new password
+func verifyPassword(servers map[string]ServerInfo, password string) []credentialCheck {
+	checks := make([]credentialCheck, 0, len(servers))
+	for ip, server := range servers {
+		checks = append(checks, credentialCheck{IP: ip, Server: server})
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].IP < checks[j].IP })
+
+	ips := make([]string, len(checks))
+	for i, check := range checks {
+		ips[i] = check.IP
+	}
+	fanOut(ips, func(i int, ip string) {
+		client, err := dialServer(ip, passwordLogin(checks[i].Server, password))
+		if err != nil {
+			checks[i].Err = err
+			return
+		}
+		client.Close()
+	})
+	return checks
+}
+
+// credentialsHandler shows the bulk credential update form
+func credentialsHandler(w http.ResponseWriter, r *http.Request) {
+	servers := serversSnapshot()
+	counts := make(map[string]int)
+	for _, server := range servers {
+		for _, tag := range server.Tags {
+			counts[tag]++
+		}
+	}
+
+	data := map[string]interface{}{
+		"Tags":   serverTags(servers),
+		"Counts": counts,
+	}
+	renderTemplate(w, r, "templates/credentials.html", data)
+}
+
+// updateCredentialsHandler verifies a new admin password on every server with a tag and
+// saves it only for the servers that accepted it
+func updateCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tag := strings.TrimSpace(r.FormValue("tag"))
+	password := r.FormValue("password")
+	if tag == "" {
+		http.Error(w, "Tag is required", http.StatusBadRequest)
+		return
+	}
+	if password == "" {
+		http.Error(w, "New password is required", http.StatusBadRequest)
+		return
+	}
+	if password != r.FormValue("confirm_password") {
+		http.Error(w, "❌ The passwords do not match", http.StatusBadRequest)
+		return
+	}
+
+	targets := make(map[string]ServerInfo)
+	for ip, server := range serversSnapshot() {
+		if server.hasTag(tag) {
+			targets[ip] = server
+		}
+	}
+	if len(targets) == 0 {
+		http.Error(w, "No servers have the tag "+tag, http.StatusBadRequest)
+		return
+	}
+
+	job := startJob("credentials", "", fmt.Sprintf("Update the admin password on %d servers tagged %s", len(targets), tag))
+	job.progress(fmt.Sprintf("verifying on %d servers", len(targets)))
+	checks := verifyPassword(targets, password)
+
+	// Only records left untouched while verifying are updated, so a concurrent edit wins
+	var applied, failed, changed []credentialCheck
+	ipMapMu.Lock()
+	for _, check := range checks {
+		current, ok := ipMap[check.IP]
+		switch {
+		case check.Err != nil:
+			failed = append(failed, check)
+		case !ok || current.RootUsername != check.Server.RootUsername || current.RootPassword != check.Server.RootPassword:
+			changed = append(changed, check)
+		default:
+			current.RootPassword = password
+			ipMap[check.IP] = current
+			applied = append(applied, check)
+		}
+	}
+	ipMapMu.Unlock()
+	if len(applied) > 0 {
+		if err := saveIPMap(); err != nil {
+			job.finish(err)
+			http.Error(w, "Error saving servers: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Printf("🔑 Admin password updated on %d of %d servers tagged %s\n", len(applied), len(checks), tag)
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("🔑 Bulk credential update for tag %s\n\n", tag))
+	logBuilder.WriteString(fmt.Sprintf("Updated %d of %d servers. The password was verified on each server before it was saved.\n\n", len(applied), len(checks)))
+	for _, check := range applied {
+		logBuilder.WriteString(fmt.Sprintf("✅ %s: %s logged in with the new password; saved\n", check.IP, check.Server.RootUsername))
+	}
+	for _, check := range failed {
+		logBuilder.WriteString(fmt.Sprintf("❌ %s: login as %s failed, stored password left unchanged: %v\n", check.IP, check.Server.RootUsername, check.Err))
+	}
+	for _, check := range changed {
+		logBuilder.WriteString(fmt.Sprintf("⚠️ %s: the server record changed during verification; not updated\n", check.IP))
+	}
+
+	if rest := len(failed) + len(changed); rest > 0 {
+		job.finish(fmt.Errorf("%d of %d servers were not updated", rest, len(checks)))
+	} else {
+		job.finish(nil)
+	}
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec is a parsed five-field cron expression: minute, hour, day of month, month and
+// day of week. Each field is a bit set of the values it matches.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day field. As in cron, when both day fields are
+	// restricted a day matching either one matches.
+	domAny, dowAny bool
+}
+
+// cronField is the range and value names of one cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday as well as 0
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronShorthands are the @ forms cron accepts
+var cronShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxCronSearch bounds the search for the next run of an expression that never matches,
+// such as "0 0 31 2 *"
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+// parseCron parses an expression such as "*/15 * * * *", "30 2 * * mon-fri" or "@daily"
+func parseCron(expr string) (cronSpec, error) {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	if full, ok := cronShorthands[expr]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return cronSpec{}, fmt.Errorf("invalid cron expression %q; use five fields: minute hour day-of-month month day-of-week", expr)
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		set, err := cronFields[i].parse(field)
+		if err != nil {
+			return cronSpec{}, err
+		}
+		bits[i] = set
+	}
+	// Fold Sunday as 7 into 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	spec := cronSpec{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}
+	if spec.next(time.Now()).IsZero() {
+		return cronSpec{}, fmt.Errorf("cron expression %q never runs", expr)
+	}
+	return spec, nil
+}
+
+// parse reads one field: a comma-separated list of "*", values, ranges such as "1-5" and
+// steps such as "*/10" or "8-18/2"
+func (f cronField) parse(field string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in the %s field", stepPart, f.name)
+			}
+			step = n
+		}
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = f.value(from); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if stepped {
+				// "5/15" means from 5 to the end in steps of 15
+				high = f.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q in the %s field", rangePart, f.name)
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value reads one number or name of the field
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if s == name {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s %q; use %d-%d", f.name, s, f.min, f.max)
+	}
+	return n, nil
+}
+
+// matchesDay reports whether the expression runs on t's day
+func (c cronSpec) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// next returns the first minute after t the expression runs in, in t's location, or the
+// zero time if it never runs
+func (c cronSpec) next(t time.Time) time.Time {
+	limit := t.Add(maxCronSearch)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
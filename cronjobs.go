@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CronJob runs a recorded job again on a cron schedule, e.g. a cleanup command every night
+// or an install that keeps a package present. It sends the request the job was started
+// with, against the same server or group.
+type CronJob struct {
+	Name string `json:"name"`
+	// Spec is a five-field cron expression such as "30 2 * * mon-fri", or a shorthand
+	// such as @daily, on the management host's clock
+	Spec string `json:"spec"`
+	// Kind and Description describe the job it runs, as the job history showed them
+	Kind        string   `json:"kind"`
+	Description string   `json:"description"`
+	Rerun       JobRerun `json:"rerun"`
+	Paused      bool     `json:"paused,omitempty"`
+	// CatchUp runs once straight away when accmgr4 was down at a scheduled time;
+	// otherwise missed runs are skipped and counted
+	CatchUp bool `json:"catch_up,omitempty"`
+	// Operator created the cron job; its runs are attributed to them
+	Operator string `json:"operator,omitempty"`
+}
+
+// Target is the server or group the cron job runs on
+func (c CronJob) Target() string {
+	if group := c.Rerun.Form.Get("group"); group != "" {
+		return "group " + group
+	}
+	return c.Rerun.Form.Get("server_ip")
+}
+
+// Next is when the cron job runs next, or the zero time while it is paused
+func (c CronJob) Next() time.Time {
+	spec, err := parseCron(c.Spec)
+	if c.Paused || err != nil {
+		return time.Time{}
+	}
+	return spec.next(time.Now())
+}
+
+// CronState is what the scheduler remembers about a cron job across restarts
+type CronState struct {
+	// Checked is the last minute the scheduler looked at the job; scheduled times between
+	// it and now were missed while accmgr4 was down
+	Checked time.Time  `json:"checked"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+	// LastJob is the job the last run started
+	LastJob string `json:"last_job,omitempty"`
+	// LastError is why the last run could not start a job
+	LastError  string     `json:"last_error,omitempty"`
+	Missed     int        `json:"missed,omitempty"`
+	LastMissed *time.Time `json:"last_missed,omitempty"`
+}
+
+// cronStateFile keeps the scheduler's state across restarts
+const cronStateFile = "cron_state.json"
+
+var (
+	cronStateMu sync.Mutex
+	cronStates  = make(map[string]*CronState)
+	// runningCronJobs holds the cron jobs whose request is still going, so a slow run is
+	// not started again on top of itself
+	runningCronJobs = make(map[string]bool)
+)
+
+// loadCronState reads cron_state.json; a missing file means nothing has run yet
+func loadCronState() error {
+	file, err := os.Open(cronStateFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	cronStateMu.Lock()
+	defer cronStateMu.Unlock()
+	return json.NewDecoder(file).Decode(&cronStates)
+}
+
+// saveCronState writes cron_state.json; callers hold cronStateMu
+func saveCronState() error {
+	file, err := os.Create(cronStateFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(cronStates)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+// cronStateFor returns the job's state, creating it; callers hold cronStateMu
+func cronStateFor(name string) *CronState {
+	state, ok := cronStates[name]
+	if !ok {
+		state = &CronState{}
+		cronStates[name] = state
+	}
+	return state
+}
+
+// findCronJob looks a cron job up by name
+func findCronJob(name string) (CronJob, bool) {
+	i := slices.IndexFunc(settings.CronJobs, func(c CronJob) bool { return c.Name == name })
+	if i < 0 {
+		return CronJob{}, false
+	}
+	return settings.CronJobs[i], true
+}
+
+// validateCronJob checks a cron job before it is stored
+func validateCronJob(job CronJob) error {
+	if !scheduleNamePattern.MatchString(job.Name) {
+		return fmt.Errorf("invalid name %q; use lowercase letters, digits and dashes", job.Name)
+	}
+	if _, err := parseCron(job.Spec); err != nil {
+		return err
+	}
+	if _, ok := rerunHandlers[job.Rerun.Path]; !ok {
+		return errors.New("this kind of job cannot be scheduled")
+	}
+	return nil
+}
+
+// runCronScheduler checks the cron jobs at the top of every minute. It runs under
+// superviseWorker, which restarts it if it panics.
+func runCronScheduler() {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		now = time.Now().Truncate(time.Minute)
+		for _, job := range slices.Clone(settings.CronJobs) {
+			checkCronJob(job, now)
+		}
+	}
+}
+
+// checkCronJob starts the job when it is due in the minute of now. Scheduled times since
+// the last check that have passed were missed while accmgr4 was down: a job with CatchUp
+// runs once for all of them, any other job skips them. Paused jobs miss nothing.
+func checkCronJob(job CronJob, now time.Time) {
+	spec, err := parseCron(job.Spec)
+	if err != nil {
+		return
+	}
+	cronStateMu.Lock()
+	state := cronStateFor(job.Name)
+	checked := state.Checked
+	state.Checked = now
+	if checked.IsZero() || job.Paused {
+		checked = now.Add(-time.Minute)
+	}
+	var missed []time.Time
+	due := false
+	for t := spec.next(checked); !t.IsZero() && !t.After(now); t = spec.next(t) {
+		if t.Equal(now) {
+			due = true
+		} else {
+			missed = append(missed, t)
+		}
+	}
+	catchUp := job.CatchUp && !due && len(missed) > 0
+	if skipped := len(missed); skipped > 0 {
+		if catchUp {
+			skipped--
+		}
+		last := missed[len(missed)-1]
+		state.Missed += skipped
+		state.LastMissed = &last
+		fmt.Printf("⏰ Cron job %s missed %d runs while accmgr4 was down\n", job.Name, len(missed))
+	}
+	if err := saveCronState(); err != nil {
+		fmt.Println("❌ Saving cron state:", err)
+	}
+	cronStateMu.Unlock()
+
+	if job.Paused || !(due || catchUp) {
+		return
+	}
+	go func() {
+		defer catchWorkerPanic("cron-scheduler")
+		runCronJob(job)
+	}()
+}
+
+// runCronJob sends the cron job's request as its operator would have and records which job
+// it started, or why it could not start one. It does nothing while the job's previous run
+// is still going.
+func runCronJob(job CronJob) {
+	cronStateMu.Lock()
+	if runningCronJobs[job.Name] {
+		cronStateMu.Unlock()
+		fmt.Printf("⚠️ Cron job %s is still running; skipping this run\n", job.Name)
+		return
+	}
+	runningCronJobs[job.Name] = true
+	now := time.Now()
+	state := cronStateFor(job.Name)
+	state.LastRun, state.LastJob, state.LastError = &now, "", ""
+	cronStateMu.Unlock()
+
+	started := func(started *Job) {
+		cronStateMu.Lock()
+		cronStateFor(job.Name).LastJob = started.ID
+		if err := saveCronState(); err != nil {
+			fmt.Println("❌ Saving cron state:", err)
+		}
+		cronStateMu.Unlock()
+		publishEvent("cron.started", map[string]interface{}{"cron_job": job.Name, "job": started.ID})
+	}
+	form := maps.Clone(job.Rerun.Form)
+	// Installs otherwise stop at the preview
+	form.Set("confirmed", "on")
+	request := httptest.NewRequest(http.MethodPost, job.Rerun.Path, nil)
+	ctx := context.WithValue(context.Background(), jobStartedKey{}, started)
+	if job.Operator != "" {
+		ctx = context.WithValue(ctx, loginUserKey{}, job.Operator)
+	}
+	request = request.WithContext(ctx)
+	request.Form, request.PostForm = form, form
+	response := httptest.NewRecorder()
+	rerunHandlers[job.Rerun.Path].handler(response, request)
+
+	cronStateMu.Lock()
+	delete(runningCronJobs, job.Name)
+	state = cronStateFor(job.Name)
+	if response.Code >= http.StatusBadRequest {
+		state.LastError = strings.TrimPrefix(strings.TrimSpace(response.Body.String()), "❌ ")
+	}
+	if err := saveCronState(); err != nil {
+		fmt.Println("❌ Saving cron state:", err)
+	}
+	lastError := state.LastError
+	cronStateMu.Unlock()
+
+	alertKey := "cron:" + job.Name
+	if lastError != "" {
+		raiseAlert(alertKey, job.Target(), "warning", "Cron job "+job.Name+" could not start: "+lastError)
+	} else {
+		clearAlert(alertKey)
+	}
+}
+
+// cronJobRow is one cron job as the cron jobs page lists it
+type cronJobRow struct {
+	CronJob
+	State   CronState
+	Running bool
+	// LastStatus is the status of the job the last run started, while it is known
+	LastStatus string
+}
+
+// cronJobsHandler lists the cron jobs with their next and last runs
+func cronJobsHandler(w http.ResponseWriter, r *http.Request) {
+	var rows []cronJobRow
+	cronStateMu.Lock()
+	for _, job := range settings.CronJobs {
+		row := cronJobRow{CronJob: job, Running: runningCronJobs[job.Name]}
+		if state, ok := cronStates[job.Name]; ok {
+			row.State = *state
+		}
+		rows = append(rows, row)
+	}
+	cronStateMu.Unlock()
+	// Limited users see only the cron jobs that run on servers in their scope
+	if scope := requestScope(r); len(scope) > 0 {
+		name := requestOperator(r)
+		rows = slices.DeleteFunc(rows, func(row cronJobRow) bool {
+			return formOutOfScope(scope, name, row.Rerun.Path, row.Rerun.Form) != ""
+		})
+	}
+	for i, row := range rows {
+		if row.State.LastJob == "" {
+			continue
+		}
+		if job, ok := findJob(row.State.LastJob); ok {
+			rows[i].LastStatus = job.Status
+		} else if record, ok := findJobRecord(row.State.LastJob); ok {
+			rows[i].LastStatus = record.Status
+		}
+	}
+
+	var editing CronJob
+	if name := r.FormValue("edit"); name != "" {
+		editing, _ = findCronJob(name)
+		if formOutOfScope(requestScope(r), requestOperator(r), editing.Rerun.Path, editing.Rerun.Form) != "" {
+			editing = CronJob{}
+		}
+	}
+	renderTemplate(w, r, "templates/cronjobs.html", map[string]interface{}{
+		"Jobs":    rows,
+		"Editing": editing,
+		"Zone":    time.Now().Format("MST"),
+	})
+}
+
+// saveCronJobHandler schedules a job from the job history, or changes the schedule of an
+// existing cron job when no job is given
+func saveCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	job, exists := findCronJob(name)
+	if id := r.FormValue("job"); id != "" {
+		record, ok := findJobRecord(id)
+		if !ok || record.Rerun == nil {
+			http.Error(w, "The job cannot be scheduled", http.StatusNotFound)
+			return
+		}
+		if exists {
+			http.Error(w, "❌ A cron job named "+name+" already exists", http.StatusConflict)
+			return
+		}
+		job = CronJob{Name: name, Kind: record.Kind, Description: record.Description, Rerun: *record.Rerun, Operator: requestOperator(r)}
+	} else if !exists {
+		http.Error(w, "Cron job not found", http.StatusNotFound)
+		return
+	}
+	if !formAllowed(w, r, job.Rerun.Path, job.Rerun.Form) {
+		return
+	}
+	job.Spec = strings.TrimSpace(r.FormValue("spec"))
+	job.CatchUp = r.FormValue("catch_up") == "on"
+	job.Paused = r.FormValue("paused") == "on"
+	if err := validateCronJob(job); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := storeCronJob(job); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/cron-jobs"), http.StatusSeeOther)
+}
+
+// storeCronJob adds the cron job or replaces the one with the same name and saves the settings
+func storeCronJob(job CronJob) error {
+	i := slices.IndexFunc(settings.CronJobs, func(c CronJob) bool { return c.Name == job.Name })
+	if i < 0 {
+		settings.CronJobs = append(settings.CronJobs, job)
+	} else {
+		settings.CronJobs[i] = job
+	}
+	return saveSettings()
+}
+
+// toggleCronJobHandler pauses or resumes a cron job. A resumed job does not count the runs
+// it missed while paused.
+func toggleCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := findCronJob(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Cron job not found", http.StatusNotFound)
+		return
+	}
+	if !formAllowed(w, r, job.Rerun.Path, job.Rerun.Form) {
+		return
+	}
+	job.Paused = !job.Paused
+	if err := storeCronJob(job); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/cron-jobs"), http.StatusSeeOther)
+}
+
+// deleteCronJobHandler removes a cron job; the jobs it started stay in the history
+func deleteCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if job, ok := findCronJob(name); ok && !formAllowed(w, r, job.Rerun.Path, job.Rerun.Form) {
+		return
+	}
+	settings.CronJobs = slices.DeleteFunc(settings.CronJobs, func(c CronJob) bool { return c.Name == name })
+	cronStateMu.Lock()
+	delete(cronStates, name)
+	saveCronState()
+	cronStateMu.Unlock()
+	clearAlert("cron:" + name)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/cron-jobs"), http.StatusSeeOther)
+}
+
+// runCronJobHandler runs a cron job now in the background
+func runCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := findCronJob(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Cron job not found", http.StatusNotFound)
+		return
+	}
+	if !formAllowed(w, r, job.Rerun.Path, job.Rerun.Form) {
+		return
+	}
+	go func() {
+		defer catchWorkerPanic("cron-scheduler")
+		runCronJob(job)
+	}()
+	http.Redirect(w, r, appPath(r, "/cron-jobs"), http.StatusSeeOther)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Every browser gets a random CSRF token in a cookie, and every form that changes something
+// sends it back in a hidden field, {{ csrfToken }} in the templates. Another site can make
+// the browser post a form, with its cookies, but cannot read the token to put in it, so a
+// post whose field does not match the cookie is refused. Scripts send the token in the
+// X-CSRF-Token header instead. API clients are no browsers and need no token: those with an
+// API token, which browsers never send on their own, and those signing in with HTTP Basic
+// authentication unless the browser marks the request as cross-site.
+
+const (
+	csrfCookie = "accmgr_csrf"
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfKey is the request context key of the browser's CSRF token
+type csrfKey struct{}
+
+// csrfToken returns the CSRF token forms on the request's page must send
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// withCSRF gives browsers a CSRF token and refuses requests that change something without
+// it
+func withCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+			token = cookie.Value
+		} else {
+			token = newSessionToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    token,
+				Path:     appPath(r, "/"),
+				HttpOnly: true,
+				Secure:   requestSecure(r),
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		r = r.WithContext(context.WithValue(r.Context(), csrfKey{}, token))
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if bearerToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, _, ok := r.BasicAuth(); ok && r.Header.Get("Sec-Fetch-Site") != "cross-site" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sent := r.Header.Get(csrfHeader)
+		if sent == "" {
+			sent = r.FormValue(csrfField)
+		}
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			message := "the request did not carry this browser's CSRF token; reload the page and try again"
+			if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/graphql" {
+				writeAPIError(w, http.StatusForbidden, message)
+			} else {
+				http.Error(w, "❌ The form expired or was sent from another site; reload the page and try again", http.StatusForbidden)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
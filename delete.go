@@ -3,11 +3,12 @@ package main
 import (
 	"encoding/csv"
 	"fmt"
-	"html/template"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/xuri/excelize/v2"
@@ -15,18 +16,28 @@ import (
 
 // deleteCSVHandler renders the delete form template
 func deleteCSVHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/delete.html"))
-	tmpl.Execute(w, ipMap)
+	renderTemplate(w, r, "templates/delete.html", requestServers(r))
 }
 
 // deleteUsersHandler processes the CSV file and deletes users from the server
 func deleteUsersHandler(w http.ResponseWriter, r *http.Request) {
 	ip := strings.TrimSpace(r.FormValue("server_ip"))
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "❌ IP not found in records", http.StatusBadRequest)
 		fmt.Println("Received IP:", ip)
-		fmt.Println("Available IPs:", ipMap)
+		fmt.Println("Available IPs:", slices.Sorted(maps.Keys(serversSnapshot())))
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "User management") {
+		return
+	}
+
+	if err := checkConfirmation(r, OpDeleteUsers, ip, server); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -76,13 +87,13 @@ func deleteUsersHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Delete user and their home directory
+		script.WriteString(scriptStep("delete user "+username) + "\n")
 		if server.RootUsername == "root" {
 			// Running as root on Alpine - use deluser command
 			script.WriteString(fmt.Sprintf("deluser --remove-home %s 2>/dev/null || echo 'User %s not found or already deleted'\n", username, username))
 		} else {
-			// Not running as root on Ubuntu - use sudo with userdel
-			script.WriteString(fmt.Sprintf("echo '%s' | sudo -S userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n",
-				server.RootPassword, username, username))
+			// Not running as root on Ubuntu - userdel runs under sudo
+			script.WriteString(fmt.Sprintf("userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n", username, username))
 		}
 		deleted = append(deleted, username)
 	}
@@ -91,11 +102,11 @@ func deleteUsersHandler(w http.ResponseWriter, r *http.Request) {
 		logBuilder.WriteString("⚠️ No valid user entries found.\n")
 	}
 
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
-	if err != nil {
-		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	result, err := runPrivilegedCommand(ip, server, script.String())
+	if !writeCommandLog(&logBuilder, result, err) {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
 	}
-	logBuilder.WriteString(output)
 
 	// Remove deleted users from accounts list
 	var updatedAccounts []UserAccount
@@ -113,11 +124,9 @@ func deleteUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	server.Accounts = updatedAccounts
-	ipMap[ip] = server
-	saveIPMap()
+	setServer(ip, server)
 
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
 }
 
 // deleteSingleUserHandler deletes a single user from the server
@@ -130,29 +139,39 @@ func deleteSingleUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "❌ IP not found in records", http.StatusBadRequest)
 		return
 	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "User management") {
+		return
+	}
+
+	if err := checkConfirmation(r, OpDeleteUsers, ip, server); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	var script string
 	if server.RootUsername == "root" {
 		// Running as root on Alpine - use deluser command
 		script = fmt.Sprintf("deluser --remove-home %s 2>/dev/null || echo 'User %s not found or already deleted'", username, username)
 	} else {
-		// Not running as root on Ubuntu - use sudo with userdel
-		script = fmt.Sprintf("echo '%s' | sudo -S userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'",
-			server.RootPassword, username, username)
+		// Not running as root on Ubuntu - userdel runs under sudo
+		script = fmt.Sprintf("userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'", username, username)
 	}
 
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script)
+	result, err := runPrivilegedCommand(ip, server, script)
 
 	var logBuilder strings.Builder
-	if err != nil {
-		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	if !writeCommandLog(&logBuilder, result, err) {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
 	}
-	logBuilder.WriteString(output)
 
 	// Remove user from accounts list
 	var updatedAccounts []UserAccount
@@ -163,11 +182,9 @@ func deleteSingleUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	server.Accounts = updatedAccounts
-	ipMap[ip] = server
-	saveIPMap()
+	setServer(ip, server)
 
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
 }
 
 // deleteSelectedUsersHandler deletes multiple selected users from the server
@@ -192,16 +209,27 @@ func deleteSelectedUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get server info
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "Server not found", http.StatusNotFound)
 		return
 	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "User management") {
+		return
+	}
+
+	if err := checkConfirmation(r, OpDeleteUsers, ip, server); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Get selected usernames
 	selectedUsers := r.Form["selected_users"]
 	if len(selectedUsers) == 0 {
-		http.Redirect(w, r, "/?msg=No+users+selected", http.StatusSeeOther)
+		http.Redirect(w, r, appPath(r, "/?msg=No+users+selected"), http.StatusSeeOther)
 		return
 	}
 
@@ -212,22 +240,22 @@ func deleteSelectedUsersHandler(w http.ResponseWriter, r *http.Request) {
 	logBuilder.WriteString(fmt.Sprintf("🗑️ Deleting %d selected users from %s\n\n", len(selectedUsers), ip))
 
 	for _, username := range selectedUsers {
+		script.WriteString(scriptStep("delete user "+username) + "\n")
 		if server.RootUsername == "root" {
 			// Running as root on Alpine - use deluser command
 			script.WriteString(fmt.Sprintf("deluser --remove-home %s 2>/dev/null || echo 'User %s not found or already deleted'\n", username, username))
 		} else {
-			// Not running as root on Ubuntu - use sudo with userdel
-			script.WriteString(fmt.Sprintf("echo '%s' | sudo -S userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n",
-				server.RootPassword, username, username))
+			// Not running as root on Ubuntu - userdel runs under sudo
+			script.WriteString(fmt.Sprintf("userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n", username, username))
 		}
 	}
 
 	// Execute the script
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
-	if err != nil {
-		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	result, err := runPrivilegedCommand(ip, server, script.String())
+	if !writeCommandLog(&logBuilder, result, err) {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
 	}
-	logBuilder.WriteString(output)
 
 	// Remove deleted users from accounts list
 	var updatedAccounts []UserAccount
@@ -245,12 +273,10 @@ func deleteSelectedUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	server.Accounts = updatedAccounts
-	ipMap[ip] = server
-	saveIPMap()
+	setServer(ip, server)
 
 	// Show logs
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
 }
 
 // deleteAllUsersHandler deletes all users from a specific server
@@ -275,15 +301,26 @@ func deleteAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get server info
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "Server not found", http.StatusNotFound)
 		return
 	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "User management") {
+		return
+	}
+
+	if err := checkConfirmation(r, OpDeleteUsers, ip, server); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Check if there are any users to delete
 	if len(server.Accounts) == 0 {
-		http.Redirect(w, r, "/?msg=No+users+to+delete", http.StatusSeeOther)
+		http.Redirect(w, r, appPath(r, "/?msg=No+users+to+delete"), http.StatusSeeOther)
 		return
 	}
 
@@ -296,13 +333,13 @@ func deleteAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Add each user to the deletion script
 	for _, account := range server.Accounts {
+		script.WriteString(scriptStep("delete user "+account.Username) + "\n")
 		if server.RootUsername == "root" {
 			// Running as root on Alpine - use deluser command
 			script.WriteString(fmt.Sprintf("deluser --remove-home %s 2>/dev/null || echo 'User %s not found or already deleted'\n", account.Username, account.Username))
 		} else {
-			// Not running as root on Ubuntu - use sudo with userdel
-			script.WriteString(fmt.Sprintf("echo '%s' | sudo -S userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n",
-				server.RootPassword, account.Username, account.Username))
+			// Not running as root on Ubuntu - userdel runs under sudo
+			script.WriteString(fmt.Sprintf("userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n", account.Username, account.Username))
 		}
 		logBuilder.WriteString(fmt.Sprintf("- %s\n", account.Username))
 	}
@@ -310,38 +347,46 @@ func deleteAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 	logBuilder.WriteString("\nExecution Log:\n")
 
 	// Execute the script
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
-	if err != nil {
-		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	result, err := runPrivilegedCommand(ip, server, script.String())
+	if !writeCommandLog(&logBuilder, result, err) {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
 	}
-	logBuilder.WriteString(output)
 
 	// Clear all accounts from the server
 	server.Accounts = []UserAccount{}
-	ipMap[ip] = server
-	saveIPMap()
+	setServer(ip, server)
 
 	logBuilder.WriteString(fmt.Sprintf("\n✅ All users have been deleted from server %s\n", ip))
 
 	// Show logs
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
 }
 
 // deleteExcelHandler renders the delete from Excel form template
 func deleteExcelHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/delete_excel.html"))
-	tmpl.Execute(w, ipMap)
+	renderTemplate(w, r, "templates/delete_excel.html", requestServers(r))
 }
 
 // deleteUsersFromExcelHandler processes Excel file and deletes users from the server
 func deleteUsersFromExcelHandler(w http.ResponseWriter, r *http.Request) {
 	ip := strings.TrimSpace(r.FormValue("server_ip"))
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "❌ IP not found in records", http.StatusBadRequest)
 		fmt.Println("Received IP:", ip)
-		fmt.Println("Available IPs:", ipMap)
+		fmt.Println("Available IPs:", slices.Sorted(maps.Keys(serversSnapshot())))
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "User management") {
+		return
+	}
+
+	if err := checkConfirmation(r, OpDeleteUsers, ip, server); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -404,13 +449,13 @@ func deleteUsersFromExcelHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Delete user and their home directory
+		script.WriteString(scriptStep("delete user "+username) + "\n")
 		if server.RootUsername == "root" {
 			// Running as root on Alpine - use deluser command
 			script.WriteString(fmt.Sprintf("deluser --remove-home %s 2>/dev/null || echo 'User %s not found or already deleted'\n", username, username))
 		} else {
-			// Not running as root on Ubuntu - use sudo with userdel
-			script.WriteString(fmt.Sprintf("echo '%s' | sudo -S userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n",
-				server.RootPassword, username, username))
+			// Not running as root on Ubuntu - userdel runs under sudo
+			script.WriteString(fmt.Sprintf("userdel -r %s 2>/dev/null || echo 'User %s not found or already deleted'\n", username, username))
 		}
 		deleted = append(deleted, username)
 	}
@@ -426,11 +471,11 @@ func deleteUsersFromExcelHandler(w http.ResponseWriter, r *http.Request) {
 		logBuilder.WriteString("\nExecution Log:\n")
 	}
 
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
-	if err != nil {
-		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	result, err := runPrivilegedCommand(ip, server, script.String())
+	if !writeCommandLog(&logBuilder, result, err) {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
 	}
-	logBuilder.WriteString(output)
 
 	// Remove deleted users from accounts list
 	var updatedAccounts []UserAccount
@@ -448,9 +493,7 @@ func deleteUsersFromExcelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	server.Accounts = updatedAccounts
-	ipMap[ip] = server
-	saveIPMap()
+	setServer(ip, server)
 
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// diagnosticTimeout bounds each network stage of a connection diagnosis
+const diagnosticTimeout = 5 * time.Second
+
+// errProbe aborts an auth method after recording that the server offered it
+var errProbe = errors.New("auth method probe")
+
+// DiagnosticStage is the outcome of one step of a connection diagnosis
+type DiagnosticStage struct {
+	Name     string
+	Status   string // "ok", "failed", "skipped" or "warning"
+	Detail   string
+	Hint     string
+	Duration time.Duration
+}
+
+// diagnoseConnection runs the staged connection check and stops at the first failing stage
+func diagnoseConnection(ip string, server ServerInfo) []DiagnosticStage {
+	addr := net.JoinHostPort(ip, "22")
+	opts := effectiveSSHOptions(server)
+	via := ""
+	if label := opts.proxyLabel(); label != "" {
+		via = " via " + label
+	}
+
+	stages := []struct {
+		name string
+		run  func() (detail, hint string, err error)
+	}{
+		{"DNS resolution", func() (string, string, error) {
+			if net.ParseIP(ip) != nil {
+				return "Address is an IP literal, no lookup needed", "", nil
+			}
+			if opts.proxyLabel() != "" {
+				return "Connections go through a proxy, which may resolve the name itself", "", nil
+			}
+			addrs, err := net.LookupHost(ip)
+			if err != nil {
+				return err.Error(), "Check the hostname spelling and the DNS servers configured on the management host.", err
+			}
+			return "Resolved to " + strings.Join(addrs, ", "), "", nil
+		}},
+		{"TCP reachability", func() (string, string, error) {
+			conn, err := dialTCP(addr, opts, diagnosticTimeout)
+			if err != nil {
+				if via != "" {
+					return err.Error(), "Check the proxy URL and credentials on the SSH settings page, and that the proxy allows CONNECT to port 22.", err
+				}
+				return err.Error(), "Make sure sshd is running and port 22 is open in every firewall and security group between here and the server.", err
+			}
+			conn.Close()
+			return "Port 22 accepted the connection" + via, "", nil
+		}},
+		{"SSH banner", func() (string, string, error) {
+			conn, err := dialTCP(addr, opts, diagnosticTimeout)
+			if err != nil {
+				return err.Error(), "The port stopped answering between stages; check for rate limiting such as fail2ban.", err
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(diagnosticTimeout))
+			banner, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				return err.Error(), "The port is open but no SSH banner arrived. Another service may be listening on port 22, or sshd is overloaded (MaxStartups).", err
+			}
+			banner = strings.TrimSpace(banner)
+			if !strings.HasPrefix(banner, "SSH-") {
+				return "Unexpected banner: " + banner, "Something other than sshd answers on port 22.", errors.New("not an SSH banner")
+			}
+			return banner, "", nil
+		}},
+		{"Auth methods offered", func() (string, string, error) {
+			methods, err := probeAuthMethods(addr, server)
+			if len(methods) == 0 {
+				if err != nil {
+					return err.Error(), "The SSH handshake failed before authentication. Legacy devices may need legacy algorithms enabled on the SSH settings page.", err
+				}
+				return "Server offered no usable methods", "Enable PasswordAuthentication in sshd_config for this account.", errors.New("no auth methods")
+			}
+			detail := "Server offers: " + strings.Join(methods, ", ")
+			for _, method := range methods {
+				if method == "password" || method == "keyboard-interactive" || (method == "publickey" && (server.UseAgent || server.KeyFile != "")) {
+					return detail, "", nil
+				}
+			}
+			return detail, "Password authentication is disabled on the server; enable PasswordAuthentication in sshd_config.", errors.New("password auth not offered")
+		}},
+		{"Authentication", func() (string, string, error) {
+			login := loginAccount(server)
+			client, err := dialServer(ip, login)
+			if err != nil {
+				hint := "Check the stored username and password."
+				if login.UseAgent {
+					hint = "Check that SSH_AUTH_SOCK points at a running ssh-agent holding a key authorized for " + login.RootUsername + " (ssh-add -l)."
+				}
+				if login.CertFile != "" {
+					hint = "Check that the certificate is current (ssh-keygen -L -f " + login.CertFile + "), lists " + login.RootUsername + " as a principal, and that sshd trusts the CA through TrustedUserCAKeys."
+				} else if login.KeyFile != "" {
+					hint = "Check that the public key for " + login.KeyFile + " is in ~" + login.RootUsername + "/.ssh/authorized_keys."
+				}
+				if login.RootUsername == "root" {
+					hint += " Direct root logins are often blocked by PermitRootLogin in sshd_config."
+				}
+				return err.Error(), hint, err
+			}
+			client.Close()
+			return "Logged in as " + login.RootUsername, "", nil
+		}},
+		{"Sudo check", func() (string, string, error) {
+			admin := escalationAccount(server)
+			if admin.RootUsername == "root" {
+				return "Privileged work logs in as root, sudo is not needed", "", nil
+			}
+			if server.isWindows() {
+				return "Windows hosts have no sudo; OpenSSH elevates administrator logins", "", nil
+			}
+			if err := commandError(runPrivilegedCommand(ip, server, "true")); err != nil {
+				return err.Error(), "Add " + admin.RootUsername + " to the sudo (Ubuntu) or wheel group, or grant it a sudoers entry.", err
+			}
+			return admin.RootUsername + " can run commands through sudo", "", nil
+		}},
+	}
+
+	var results []DiagnosticStage
+	failed := false
+	for _, stage := range stages {
+		if failed {
+			results = append(results, DiagnosticStage{Name: stage.name, Status: "skipped"})
+			continue
+		}
+		start := time.Now()
+		detail, hint, err := stage.run()
+		result := DiagnosticStage{Name: stage.name, Status: "ok", Detail: detail, Duration: time.Since(start).Round(time.Millisecond)}
+		if err != nil {
+			result.Status = "failed"
+			result.Hint = hint
+			failed = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// probeAuthMethods completes the handshake and records the auth methods the server offers
+func probeAuthMethods(addr string, server ServerInfo) ([]string, error) {
+	var offered []string
+	record := func(method string) {
+		offered = append(offered, method)
+	}
+
+	config := sshClientConfig(server)
+	opts := effectiveSSHOptions(server)
+	// Each callback only runs when the server lists its method, then aborts the attempt
+	config.Auth = []ssh.AuthMethod{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			record("publickey")
+			return nil, errProbe
+		}),
+		ssh.PasswordCallback(func() (string, error) {
+			record("password")
+			return "", errProbe
+		}),
+		ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			record("keyboard-interactive")
+			return nil, errProbe
+		}),
+	}
+
+	conn, err := dialTCP(addr, opts, opts.connectTimeout())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(opts.bannerTimeout()))
+
+	sshConn, _, _, err := ssh.NewClientConn(conn, addr, config)
+	if err == nil {
+		// The server let us in without credentials
+		sshConn.Close()
+		return []string{"none"}, nil
+	}
+	return offered, err
+}
+
+// diagnoseHandler runs the staged connection check for a server and shows the report
+func diagnoseHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.FormValue("ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+
+	stages := diagnoseConnection(ip, server)
+
+	summary := "✅ All stages passed"
+	for _, stage := range stages {
+		if stage.Status == "failed" {
+			summary = fmt.Sprintf("❌ Failed at stage: %s", stage.Name)
+			break
+		}
+	}
+
+	data := map[string]interface{}{
+		"IP":      ip,
+		"Name":    serverDisplayName(ip, server),
+		"Stages":  stages,
+		"Summary": summary,
+	}
+
+	renderTemplate(w, r, "templates/diagnose.html", data)
+}
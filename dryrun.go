@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandPlan is what a remote operation would send to the server, shown by dry runs
+type CommandPlan struct {
+	// Login is the account the SSH connection authenticates as
+	Login string `json:"login"`
+	// Command is the exec request, after OS translation and sudo wrapping
+	Command string `json:"command"`
+	// Stdin is what the command reads on standard input; the sudo password is never shown
+	Stdin string `json:"stdin"`
+	// UploadPath and Upload describe the script copied over SFTP first, in upload mode
+	UploadPath string `json:"upload_path,omitempty"`
+	Upload     string `json:"upload,omitempty"`
+	// Fallback is the exec request used instead on hosts where sudo requires a terminal
+	Fallback string `json:"fallback,omitempty"`
+
+	account ServerInfo // the server record the connection would log in with
+}
+
+// sudoPasswordStdin stands in for the password in a plan's stdin
+const sudoPasswordStdin = "(the sudo password, not shown)"
+
+// planLoginCommand is the dry-run counterpart of runRemoteCommand
+func planLoginCommand(server ServerInfo, script string) CommandPlan {
+	login := loginAccount(server)
+	return CommandPlan{
+		Login:   login.RootUsername,
+		account: login,
+		Command: loginShellCommand(login),
+		Stdin:   withServerEnv(login, script, effectiveSSHOptions(login).Env),
+	}
+}
+
+// planPrivilegedCommand is the dry-run counterpart of runPrivilegedCommand
+func planPrivilegedCommand(server ServerInfo, script string) CommandPlan {
+	server = escalationAccount(server)
+	if server.RootUsername == "root" || server.isWindows() {
+		return planLoginCommand(server, script)
+	}
+	return CommandPlan{
+		Login:    server.RootUsername,
+		account:  server,
+		Command:  sudoCommand(),
+		Stdin:    sudoPasswordStdin + "\n" + withEnv(script, effectiveSSHOptions(server).Env),
+		Fallback: sudoPTYCommand(),
+	}
+}
+
+// planAdHocCommand is the dry-run counterpart of runAdHocCommand
+func planAdHocCommand(server ServerInfo, command string, opts adHocOptions) (CommandPlan, error) {
+	switch {
+	case opts.Upload:
+		if server.isWindows() {
+			return CommandPlan{}, errUploadWindows
+		}
+		// The real name is random per run
+		remotePath := "/tmp/.accmgr-XXXXXXXXXXXXXXXX.sh"
+		wrapper := uploadWrapper(remotePath, command, opts.Env)
+		plan := planLoginCommand(server, wrapper)
+		if opts.Escalate {
+			plan = planPrivilegedCommand(server, wrapper)
+		}
+		plan.UploadPath, plan.Upload = remotePath, command
+		return plan, nil
+	case opts.Escalate:
+		return planPrivilegedCommand(server, withServerEnv(server, command, opts.Env)), nil
+	default:
+		return planLoginCommand(server, withServerEnv(server, command, opts.Env)), nil
+	}
+}
+
+// checkLogin connects and authenticates as the plan's login without opening a session,
+// so nothing runs on the server
+func checkLogin(ip string, plan CommandPlan) error {
+	_, release, err := acquireClient(ip, plan.account)
+	if err != nil {
+		return err
+	}
+	release(false)
+	return nil
+}
+
+// writeDryRunLog describes a plan and whether the server accepted the login
+func writeDryRunLog(logBuilder *strings.Builder, plan CommandPlan, loginErr error) {
+	logBuilder.WriteString("🧪 Dry run: nothing was executed on the server\n\n")
+	if loginErr != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Login as %s failed: %v\n\n", plan.Login, loginErr))
+	} else {
+		logBuilder.WriteString(fmt.Sprintf("✅ Login as %s succeeded\n\n", plan.Login))
+	}
+	if plan.Upload != "" {
+		logBuilder.WriteString("Upload over SFTP to " + plan.UploadPath + ":\n" + plan.Upload + "\n\n")
+	}
+	logBuilder.WriteString("Exec request:\n" + plan.Command + "\n\n")
+	logBuilder.WriteString("Standard input:\n" + plan.Stdin + "\n")
+	if plan.Fallback != "" {
+		logBuilder.WriteString("\nIf sudo requires a terminal, on a PTY instead:\n" + plan.Fallback + "\n")
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// EnvProfile is a named set of system-wide environment variables rendered from a template
+type EnvProfile struct {
+	Name string `json:"name"`
+	// Target is "environment" for a managed block in /etc/environment or "profile.d" for its own snippet
+	Target string `json:"target"`
+	// Template renders KEY=VALUE lines; it can use {{.IP}}, {{.Name}} and {{.Group}}
+	Template string   `json:"template"`
+	Servers  []string `json:"servers,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	// Packages must stay installed on every targeted server
+	Packages []string `json:"packages,omitempty"`
+	// AutoReapply restores locked servers as soon as drift is detected
+	AutoReapply bool          `json:"auto_reapply,omitempty"`
+	Locks       []ProfileLock `json:"locks,omitempty"`
+}
+
+// EnvDriftResult is the outcome of comparing a deployed profile with its template
+type EnvDriftResult struct {
+	IP       string
+	Status   string // "in-sync", "drifted", "missing" or "error"
+	Expected string
+	Actual   string
+	Error    string
+
+	MissingPackages []string
+	Lock            *ProfileLock
+}
+
+// Verified reports whether the server passes verification and can be locked
+func (r EnvDriftResult) Verified() bool {
+	return r.Status == "in-sync" && len(r.MissingPackages) == 0
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// appliesTo reports whether the profile targets the server directly or through its group
+func (p EnvProfile) appliesTo(ip string, server ServerInfo) bool {
+	return slices.Contains(p.Servers, ip) || (server.Group != "" && slices.Contains(p.Groups, server.Group))
+}
+
+// path returns the remote file the profile is written to
+func (p EnvProfile) path() string {
+	if p.Target == "profile.d" {
+		return "/etc/profile.d/accmgr4-" + p.Name + ".sh"
+	}
+	return "/etc/environment"
+}
+
+// render expands the template for a server and formats the variables for the target file
+func (p EnvProfile) render(ip string, server ServerInfo) (string, error) {
+	tmpl, err := texttemplate.New(p.Name).Option("missingkey=error").Parse(p.Template)
+	if err != nil {
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+
+	var rendered bytes.Buffer
+	data := map[string]string{"IP": ip, "Name": serverDisplayName(ip, server), "Group": server.Group}
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("rendering template: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(rendered.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envNamePattern.MatchString(key) {
+			return "", fmt.Errorf("invalid variable line: %q", line)
+		}
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "\"") && p.Target != "profile.d" {
+			return "", fmt.Errorf("value for %s cannot contain double quotes in /etc/environment", key)
+		}
+
+		if p.Target == "profile.d" {
+			lines = append(lines, "export "+key+"="+shellQuote(value))
+		} else {
+			// /etc/environment is parsed by pam_env, not a shell, so only plain quoting applies
+			lines = append(lines, key+"=\""+value+"\"")
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// blockMarkers returns the lines delimiting the managed block inside /etc/environment
+func (p EnvProfile) blockMarkers() (string, string) {
+	return "# BEGIN accmgr4 " + p.Name, "# END accmgr4 " + p.Name
+}
+
+// applyScript writes the rendered content to the target file on the server
+func (p EnvProfile) applyScript(content string) string {
+	if p.Target == "profile.d" {
+		return fmt.Sprintf("cat > %s <<'ACCMGR_EOF'\n# Managed by accmgr4 profile %s\n%s\nACCMGR_EOF\nchmod 644 %s\n",
+			p.path(), p.Name, content, p.path())
+	}
+
+	begin, end := p.blockMarkers()
+	// Drop any previous copy of the block, then append the fresh one
+	return fmt.Sprintf(`touch /etc/environment
+awk -v b=%s -v e=%s '$0==b{skip=1;next} $0==e{skip=0;next} !skip' /etc/environment > /etc/environment.accmgr4.tmp
+cat >> /etc/environment.accmgr4.tmp <<'ACCMGR_EOF'
+%s
+%s
+%s
+ACCMGR_EOF
+cat /etc/environment.accmgr4.tmp > /etc/environment && rm -f /etc/environment.accmgr4.tmp
+`, shellQuote(begin), shellQuote(end), begin, content, end)
+}
+
+// readScript prints the currently deployed content, or MISSING when it is absent
+func (p EnvProfile) readScript() string {
+	if p.Target == "profile.d" {
+		return fmt.Sprintf("if [ -f %s ]; then grep -v '^# Managed by accmgr4' %s; else echo __ACCMGR_MISSING__; fi\n", p.path(), p.path())
+	}
+	begin, end := p.blockMarkers()
+	return fmt.Sprintf("if grep -qxF %s /etc/environment 2>/dev/null; then awk -v b=%s -v e=%s '$0==b{f=1;next} $0==e{f=0;next} f' /etc/environment; else echo __ACCMGR_MISSING__; fi\n",
+		shellQuote(begin), shellQuote(begin), shellQuote(end))
+}
+
+// checkEnvDrift compares the deployed profile on a server with the rendered template
+func checkEnvDrift(profile EnvProfile, ip string, server ServerInfo) EnvDriftResult {
+	result := EnvDriftResult{IP: ip}
+
+	expected, err := profile.render(ip, server)
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+	result.Expected = expected
+
+	output, err := runProbeCommand(ip, server, profile.readScript())
+	if err := commandError(output, err); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	actual := strings.TrimSpace(output.Stdout)
+	result.Actual = actual
+	alertKey := "env-drift:" + profile.Name + ":" + ip
+	switch {
+	case actual == "__ACCMGR_MISSING__":
+		result.Status = "missing"
+		result.Actual = ""
+		raiseAlert(alertKey, ip, "warning", "Environment profile "+profile.Name+" is not deployed")
+	case actual != expected:
+		result.Status = "drifted"
+		raiseAlert(alertKey, ip, "warning", "Environment profile "+profile.Name+" has drifted from its template")
+	default:
+		result.Status = "in-sync"
+		clearAlert(alertKey)
+	}
+
+	if len(profile.Packages) > 0 {
+		missing, err := missingPackages(ip, server, profile.Packages)
+		if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+			return result
+		}
+		result.MissingPackages = missing
+	}
+	return result
+}
+
+// findEnvProfile looks up a profile by name
+func findEnvProfile(name string) (EnvProfile, int, bool) {
+	for i, profile := range settings.EnvProfiles {
+		if profile.Name == name {
+			return profile, i, true
+		}
+	}
+	return EnvProfile{}, -1, false
+}
+
+// profileTargets returns the Linux servers a profile applies to, sorted by IP
+func profileTargets(profile EnvProfile) ([]string, map[string]ServerInfo) {
+	servers := serversSnapshot()
+	var ips []string
+	for ip, server := range servers {
+		// Profiles write /etc/environment or profile.d, which Windows hosts do not have
+		if profile.appliesTo(ip, server) && !server.isWindows() {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	return ips, servers
+}
+
+// profileServers returns the servers a profile touches: those it targets and those locked
+// to it
+func profileServers(profile EnvProfile) []string {
+	ips, _ := profileTargets(profile)
+	for _, lock := range profile.Locks {
+		if !slices.Contains(ips, lock.IP) {
+			ips = append(ips, lock.IP)
+		}
+	}
+	return ips
+}
+
+// environmentHandler lists the environment profiles the user may see, those touching only
+// their servers, and the form to create or edit them
+func environmentHandler(w http.ResponseWriter, r *http.Request) {
+	scope, servers := requestScope(r), serversSnapshot()
+	var profiles []EnvProfile
+	for _, profile := range envProfilesSnapshot() {
+		if !slices.ContainsFunc(profileServers(profile), func(ip string) bool { return !serverInScope(scope, servers, ip) }) {
+			profiles = append(profiles, profile)
+		}
+	}
+	data := map[string]interface{}{
+		"Profiles": profiles,
+		"Servers":  requestServers(r),
+	}
+
+	renderTemplate(w, r, "templates/environment.html", data)
+}
+
+// saveEnvProfileHandler creates or replaces an environment profile
+func saveEnvProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profile := EnvProfile{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Target:   r.FormValue("target"),
+		Template: strings.ReplaceAll(r.FormValue("template"), "\r\n", "\n"),
+		Servers:  splitList(r.FormValue("servers")),
+		Groups:   splitList(r.FormValue("groups")),
+		Packages: splitList(r.FormValue("packages")),
+
+		AutoReapply: r.FormValue("auto_reapply") == "on",
+	}
+	if !profileNamePattern.MatchString(profile.Name) {
+		http.Error(w, "Profile name must use lowercase letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+	if profile.Target != "environment" && profile.Target != "profile.d" {
+		http.Error(w, "Invalid target", http.StatusBadRequest)
+		return
+	}
+	// Render once against an empty server to catch syntax errors before saving
+	if _, err := profile.render("", ServerInfo{}); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Both the profile as it was and as it will be must touch only the user's servers
+	ips, _ := profileTargets(profile)
+	if existing, _, ok := findEnvProfile(profile.Name); ok {
+		ips = append(ips, profileServers(existing)...)
+	}
+	if !serversAllowed(w, r, ips) {
+		return
+	}
+
+	envProfilesMu.Lock()
+	if existing, i, ok := findEnvProfile(profile.Name); ok {
+		// Locks keep their known-good baseline across template edits
+		profile.Locks = existing.Locks
+		settings.EnvProfiles[i] = profile
+	} else {
+		settings.EnvProfiles = append(settings.EnvProfiles, profile)
+	}
+	envProfilesMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/environment"), http.StatusSeeOther)
+}
+
+// deleteEnvProfileHandler removes a profile definition; deployed files are left in place
+func deleteEnvProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	existing, _, ok := findEnvProfile(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, profileServers(existing)) {
+		return
+	}
+	envProfilesMu.Lock()
+	_, i, ok := findEnvProfile(existing.Name)
+	if ok {
+		settings.EnvProfiles = append(settings.EnvProfiles[:i], settings.EnvProfiles[i+1:]...)
+	}
+	envProfilesMu.Unlock()
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/environment"), http.StatusSeeOther)
+}
+
+// applyEnvProfileHandler deploys a profile to every server it targets
+func applyEnvProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profile, _, ok := findEnvProfile(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	ips, servers := profileTargets(profile)
+	if !serversAllowed(w, r, ips) {
+		return
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("🌱 Applying environment profile %s to %s\n\n", profile.Name, profile.path()))
+	if len(ips) == 0 {
+		logBuilder.WriteString("⚠️ The profile does not target any server.\n")
+	}
+
+	job := startJob("env-profile", "", "Apply environment profile "+profile.Name)
+	failed := 0
+	for i, ip := range ips {
+		server := servers[ip]
+		job.progress(fmt.Sprintf("%s (%d of %d)", ip, i+1, len(ips)))
+		if _, locked := profile.lockFor(ip); locked {
+			logBuilder.WriteString(fmt.Sprintf("🔒 %s is locked to its verified state; unlock it to apply changes\n", ip))
+			continue
+		}
+		content, err := profile.render(ip, server)
+		if err != nil {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: %v\n", ip, err))
+			failed++
+			continue
+		}
+		if err := commandError(runPrivilegedCommandLive(job.context(), ip, server, profile.applyScript(content), nil)); err != nil {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: %v\n", ip, err))
+			failed++
+			continue
+		}
+		clearAlert("env-drift:" + profile.Name + ":" + ip)
+		logBuilder.WriteString(fmt.Sprintf("✅ %s updated\n", ip))
+	}
+	if failed > 0 {
+		job.finish(fmt.Errorf("%d of %d servers failed", failed, len(ips)))
+	} else {
+		job.finish(nil)
+	}
+
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
+
+// envDriftHandler checks every targeted server for drift in parallel
+func envDriftHandler(w http.ResponseWriter, r *http.Request) {
+	profile, _, ok := findEnvProfile(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	ips, servers := profileTargets(profile)
+	if !serversAllowed(w, r, ips) {
+		return
+	}
+	results := make([]EnvDriftResult, len(ips))
+	fanOut(ips, func(i int, ip string) {
+		results[i] = checkEnvDrift(profile, ip, servers[ip])
+		if lock, ok := profile.lockFor(ip); ok {
+			results[i].Lock = &lock
+		}
+	})
+
+	data := map[string]interface{}{
+		"Profile": profile,
+		"Path":    profile.path(),
+		"Results": results,
+	}
+
+	renderTemplate(w, r, "templates/environment_drift.html", data)
+}
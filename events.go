@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxEventHistory is how many recent events are kept for clients resuming with Last-Event-ID
+const maxEventHistory = 1000
+
+// eventHeartbeat keeps idle SSE connections open through proxies that drop silent streams
+const eventHeartbeat = 15 * time.Second
+
+// Event is one typed entry on the /events stream, e.g. "job.finished" or "alert.raised"
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+var (
+	eventsMu     sync.Mutex
+	eventHistory []Event
+	lastEventID  uint64
+	eventClients = make(map[chan Event]struct{})
+)
+
+// publishEvent stamps an event with the next ID, keeps it for replay and fans it out to listeners
+func publishEvent(eventType string, data interface{}) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	lastEventID++
+	event := Event{ID: lastEventID, Type: eventType, Time: time.Now(), Data: data}
+	eventHistory = append(eventHistory, event)
+	if len(eventHistory) > maxEventHistory {
+		eventHistory = eventHistory[len(eventHistory)-maxEventHistory:]
+	}
+	for client := range eventClients {
+		// A listener that cannot keep up is dropped rather than blocking publishers
+		select {
+		case client <- event:
+		default:
+			delete(eventClients, client)
+			close(client)
+		}
+	}
+}
+
+// subscribeEvents registers a listener and returns the stored events newer than afterID,
+// so a resuming client gets the backlog and the live feed without gaps or duplicates
+func subscribeEvents(afterID uint64) ([]Event, chan Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	var backlog []Event
+	for _, event := range eventHistory {
+		if event.ID > afterID {
+			backlog = append(backlog, event)
+		}
+	}
+	client := make(chan Event, 64)
+	eventClients[client] = struct{}{}
+	return backlog, client
+}
+
+// unsubscribeEvents removes a listener unless publishEvent already dropped it
+func unsubscribeEvents(client chan Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if _, ok := eventClients[client]; ok {
+		delete(eventClients, client)
+		close(client)
+	}
+}
+
+// eventsHandler streams events as server-sent events. Clients resume with the standard
+// Last-Event-ID header (or ?last_event_id=) and may filter with ?types=job,alert.raised.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	afterID, _ := strconv.ParseUint(lastID, 10, 64)
+
+	var types []string
+	for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	wanted := func(event Event) bool { return eventMatches(types, event.Type) && eventVisible(r.Context(), event) }
+
+	backlog, client := subscribeEvents(afterID)
+	defer unsubscribeEvents(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	for _, event := range backlog {
+		if wanted(event) {
+			writeEvent(w, event)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event, open := <-client:
+			if !open {
+				// Dropped for falling behind; the client reconnects and resumes from its last ID
+				return
+			}
+			if wanted(event) {
+				writeEvent(w, event)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// eventMatches reports whether an event type passes a filter; an empty filter matches everything
+// and a bare prefix such as "job" matches every job event
+func eventMatches(types []string, eventType string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if eventType == t || strings.HasPrefix(eventType, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEvent writes one event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
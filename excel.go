@@ -3,11 +3,12 @@ package main
 import (
 	"encoding/csv"
 	"fmt"
-	"html/template"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,18 +17,23 @@ import (
 
 // uploadExcelHandler handles Excel file uploads for user creation
 func uploadExcelHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/upload_excel.html"))
-	tmpl.Execute(w, ipMap)
+	renderTemplate(w, r, "templates/upload_excel.html", requestServers(r))
 }
 
 // createUsersFromExcelHandler processes Excel files to create users
 func createUsersFromExcelHandler(w http.ResponseWriter, r *http.Request) {
 	ip := strings.TrimSpace(r.FormValue("server_ip"))
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "❌ IP not found in records", http.StatusBadRequest)
 		fmt.Println("Received IP:", ip)
-		fmt.Println("Available IPs:", ipMap)
+		fmt.Println("Available IPs:", slices.Sorted(maps.Keys(serversSnapshot())))
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "User management") {
 		return
 	}
 
@@ -108,12 +114,13 @@ func createUsersFromExcelHandler(w http.ResponseWriter, r *http.Request) {
 		safePass := strings.ReplaceAll(password, `'`, `'\''`)
 
 		// Create user command - use appropriate command for the OS
+		script.WriteString(scriptStep("create user "+linuxUsername) + "\n")
 		if server.RootUsername == "root" {
 			// Running as root on Alpine - use adduser command
 			script.WriteString(fmt.Sprintf("adduser -D -s /bin/bash %s && echo '%s:%s' | chpasswd\n", linuxUsername, linuxUsername, safePass))
 		} else {
-			// Not running as root on Ubuntu - use sudo with useradd
-			script.WriteString(fmt.Sprintf("echo '%s' | sudo -S useradd -m -s /bin/bash -G users %s && echo '%s:%s' | sudo -S chpasswd\n", server.RootPassword, linuxUsername, linuxUsername, safePass))
+			// Not running as root on Ubuntu - useradd runs under sudo
+			script.WriteString(fmt.Sprintf("useradd -m -s /bin/bash -G users %s && echo '%s:%s' | chpasswd\n", linuxUsername, linuxUsername, safePass))
 		}
 
 		// Store the username and password in the accounts list
@@ -124,19 +131,15 @@ func createUsersFromExcelHandler(w http.ResponseWriter, r *http.Request) {
 		logBuilder.WriteString("⚠️ No valid user entries found.\n")
 	}
 
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
-	if err != nil {
-		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	result, err := runPrivilegedCommand(ip, server, script.String())
+	if !writeCommandLog(&logBuilder, result, err) {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
 	}
-	logBuilder.WriteString(output)
 
-	s := ipMap[ip]
-	s.Accounts = append(s.Accounts, created...)
-	ipMap[ip] = s
-	saveIPMap()
+	updateServer(ip, func(s *ServerInfo) { s.Accounts = append(s.Accounts, created...) })
 
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
 }
 
 // downloadUsersHandler generates and serves a CSV file with user accounts
@@ -147,11 +150,14 @@ func downloadUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "Server not found", http.StatusNotFound)
 		return
 	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
 
 	// Set headers for download
 	timestamp := time.Now().Format("20060102-150405")
@@ -188,7 +194,7 @@ func downloadAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 	writer.Write([]string{"Username", "Password", "Server IP", "Notes"})
 
 	// Write data
-	for ip, server := range ipMap {
+	for ip, server := range serversSnapshot() {
 		for _, account := range server.Accounts {
 			writer.Write([]string{account.Username, account.Password, ip, ""})
 		}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+)
+
+// FeatureFlag is a module that can be switched off per deployment
+type FeatureFlag struct {
+	Name        string
+	Title       string
+	Description string
+	Default     bool
+}
+
+// featureFlags lists every flag in the order shown on the features page
+var featureFlags = []FeatureFlag{
+	{Name: "terminal", Title: "Interactive terminal", Description: "Browser SSH sessions over a WebSocket.", Default: true},
+	{Name: "directory_sync", Title: "Directory sync", Description: "Pushing local directory trees to servers from the file transfer page.", Default: true},
+	{Name: "sshd_management", Title: "sshd_config management", Description: "Rendering and rolling out sshd_config with automatic rollback.", Default: true},
+	{Name: "auto_remediation", Title: "Auto-remediation", Description: "Re-applying locked environment profiles when they drift. When off, drift is only alerted.", Default: true},
+	{Name: "graphql", Title: "GraphQL API", Description: "The read-only /graphql endpoint and its explorer.", Default: true},
+	{Name: "grpc", Title: "gRPC API", Description: "The gRPC service used by the agent and automation. The listener stays open but rejects calls.", Default: true},
+	{Name: "events", Title: "Event stream", Description: "The /events server-sent events feed.", Default: true},
+}
+
+// featureEnabled reports whether a flag is on, falling back to its default when unset
+func featureEnabled(name string) bool {
+	if enabled, ok := settings.Features[name]; ok {
+		return enabled
+	}
+	for _, flag := range featureFlags {
+		if flag.Name == name {
+			return flag.Default
+		}
+	}
+	return false
+}
+
+// requireFeature serves next only while the flag is on, so turning a flag off takes effect
+// immediately without a restart
+func requireFeature(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled(name) {
+			http.Error(w, "❌ This feature is disabled on this deployment", http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// featureView is one row on the features page
+type featureView struct {
+	FeatureFlag
+	Enabled bool
+	Changed bool // differs from the default
+}
+
+// featuresHandler displays every feature flag and its state
+func featuresHandler(w http.ResponseWriter, r *http.Request) {
+	var flags []featureView
+	for _, flag := range featureFlags {
+		enabled := featureEnabled(flag.Name)
+		flags = append(flags, featureView{FeatureFlag: flag, Enabled: enabled, Changed: enabled != flag.Default})
+	}
+	renderTemplate(w, r, "templates/features.html", flags)
+}
+
+// updateFeaturesHandler saves the flags; unchecked boxes turn a feature off
+func updateFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	features := make(map[string]bool)
+	for _, flag := range featureFlags {
+		// Only differences from the default are stored, so new defaults reach untouched flags
+		if enabled := r.FormValue(flag.Name) == "on"; enabled != flag.Default {
+			features[flag.Name] = enabled
+		}
+	}
+	settings.Features = features
+
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/features"), http.StatusSeeOther)
+}
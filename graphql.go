@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// graphqlSchema covers the read-only fleet inventory. Credentials are never exposed.
+const graphqlSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	servers(group: String): [Server!]!
+	server(ip: String!): Server
+	groups: [Group!]!
+	alerts(severity: String): [Alert!]!
+}
+
+type Server {
+	ip: String!
+	name: String!
+	group: String
+	loginUser: String!
+	useAgent: Boolean!
+	accounts: [Account!]!
+	health: Health
+	alerts: [Alert!]!
+	lockedProfiles: [String!]!
+}
+
+type Account {
+	username: String!
+}
+
+type Health {
+	checkedAt: String!
+	reachable: Boolean!
+	error: String
+	clockSkewSeconds: Int!
+	clockSkewHigh: Boolean!
+}
+
+type Group {
+	name: String!
+	servers: [Server!]!
+}
+
+type Alert {
+	key: String!
+	server: String!
+	severity: String!
+	message: String!
+	raisedAt: String!
+}
+`
+
+// graphqlRoot resolves the Query type
+type graphqlRoot struct{}
+
+// sortedServers returns resolvers for every server the query's user may see matching the
+// filter, ordered by IP
+func sortedServers(ctx context.Context, filter func(ServerInfo) bool) []*serverResolver {
+	servers := scopedServers(contextScope(ctx))
+	var resolvers []*serverResolver
+	for ip, server := range servers {
+		if filter == nil || filter(server) {
+			resolvers = append(resolvers, &serverResolver{ip: ip, server: server})
+		}
+	}
+	sort.Slice(resolvers, func(i, j int) bool { return resolvers[i].ip < resolvers[j].ip })
+	return resolvers
+}
+
+func (*graphqlRoot) Servers(ctx context.Context, args struct{ Group *string }) []*serverResolver {
+	if args.Group == nil {
+		return sortedServers(ctx, nil)
+	}
+	return sortedServers(ctx, func(server ServerInfo) bool { return server.Group == *args.Group })
+}
+
+func (*graphqlRoot) Server(ctx context.Context, args struct{ IP string }) *serverResolver {
+	server, ok := scopedServers(contextScope(ctx))[args.IP]
+	if !ok {
+		return nil
+	}
+	return &serverResolver{ip: args.IP, server: server}
+}
+
+func (*graphqlRoot) Groups(ctx context.Context) []*groupResolver {
+	names := make(map[string]bool)
+	for _, server := range scopedServers(contextScope(ctx)) {
+		if server.Group != "" {
+			names[server.Group] = true
+		}
+	}
+	var groups []*groupResolver
+	for name := range names {
+		groups = append(groups, &groupResolver{name: name})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
+func (*graphqlRoot) Alerts(ctx context.Context, args struct{ Severity *string }) []*alertResolver {
+	var resolvers []*alertResolver
+	for _, alert := range visibleAlerts(ctx, currentAlerts()) {
+		if args.Severity == nil || alert.Severity == *args.Severity {
+			resolvers = append(resolvers, &alertResolver{alert})
+		}
+	}
+	return resolvers
+}
+
+// serverResolver resolves the Server type
+type serverResolver struct {
+	ip     string
+	server ServerInfo
+}
+
+func (s *serverResolver) IP() string        { return s.ip }
+func (s *serverResolver) Name() string      { return serverDisplayName(s.ip, s.server) }
+func (s *serverResolver) LoginUser() string { return s.server.RootUsername }
+func (s *serverResolver) UseAgent() bool    { return s.server.UseAgent }
+
+func (s *serverResolver) Group() *string {
+	if s.server.Group == "" {
+		return nil
+	}
+	return &s.server.Group
+}
+
+func (s *serverResolver) Accounts() []*accountResolver {
+	accounts := make([]*accountResolver, len(s.server.Accounts))
+	for i, account := range s.server.Accounts {
+		accounts[i] = &accountResolver{account.Username}
+	}
+	return accounts
+}
+
+func (s *serverResolver) Health() *healthResolver {
+	health, ok := healthSnapshot()[s.ip]
+	if !ok {
+		return nil
+	}
+	return &healthResolver{health}
+}
+
+func (s *serverResolver) Alerts() []*alertResolver {
+	var resolvers []*alertResolver
+	for _, alert := range currentAlerts() {
+		if alert.Server == s.ip {
+			resolvers = append(resolvers, &alertResolver{alert})
+		}
+	}
+	return resolvers
+}
+
+func (s *serverResolver) LockedProfiles() []string {
+	locked := []string{}
+	for _, profile := range envProfilesSnapshot() {
+		if _, ok := profile.lockFor(s.ip); ok {
+			locked = append(locked, profile.Name)
+		}
+	}
+	return locked
+}
+
+// accountResolver resolves the Account type
+type accountResolver struct {
+	username string
+}
+
+func (a *accountResolver) Username() string { return a.username }
+
+// healthResolver resolves the Health type
+type healthResolver struct {
+	health ServerHealth
+}
+
+func (h *healthResolver) CheckedAt() string       { return h.health.CheckedAt.Format(time.RFC3339) }
+func (h *healthResolver) Reachable() bool         { return h.health.Reachable }
+func (h *healthResolver) ClockSkewSeconds() int32 { return int32(h.health.ClockSkew / time.Second) }
+func (h *healthResolver) ClockSkewHigh() bool     { return h.health.ClockSkewHigh }
+
+func (h *healthResolver) Error() *string {
+	if h.health.Error == "" {
+		return nil
+	}
+	return &h.health.Error
+}
+
+// groupResolver resolves the Group type
+type groupResolver struct {
+	name string
+}
+
+func (g *groupResolver) Name() string { return g.name }
+
+func (g *groupResolver) Servers(ctx context.Context) []*serverResolver {
+	return sortedServers(ctx, func(server ServerInfo) bool { return server.Group == g.name })
+}
+
+// alertResolver resolves the Alert type
+type alertResolver struct {
+	alert Alert
+}
+
+func (a *alertResolver) Key() string      { return a.alert.Key }
+func (a *alertResolver) Server() string   { return a.alert.Server }
+func (a *alertResolver) Severity() string { return a.alert.Severity }
+func (a *alertResolver) Message() string  { return a.alert.Message }
+func (a *alertResolver) RaisedAt() string { return a.alert.RaisedAt.Format(time.RFC3339) }
+
+// graphqlAPI executes queries posted as {"query": ..., "variables": ...}
+var graphqlAPI = &relay.Handler{
+	Schema: graphql.MustParseSchema(graphqlSchema, &graphqlRoot{}),
+}
+
+// graphqlHandler serves the query explorer on GET and executes queries on POST
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		graphqlAPI.ServeHTTP(w, r)
+		return
+	}
+
+	renderTemplate(w, r, "templates/graphql.html", graphqlSchema)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"accountmanager/accmgrpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative accmgrpb/accmgr.proto
+
+// grpcServer implements the AccountManager service on top of the same state as the REST API
+type grpcServer struct {
+	accmgrpb.UnimplementedAccountManagerServer
+}
+
+// errGRPCDisabled is returned for every call while the grpc feature flag is off
+var errGRPCDisabled = status.Error(codes.Unavailable, "gRPC is disabled on this deployment")
+
+// grpcOperatorMethods are the calls that change something and need the operator role; the
+// others only read and are open to viewers
+var grpcOperatorMethods = map[string]bool{
+	accmgrpb.AccountManager_AddJobNote_FullMethodName: true,
+	accmgrpb.AccountManager_Exec_FullMethodName:       true,
+}
+
+// grpcAuthenticate checks the API token a call sends as "authorization: Bearer <token>"
+// metadata, the same tokens the REST API takes, and returns the call's context carrying the
+// token's user and scope
+func grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	var bearer string
+	for _, value := range metadata.ValueFromIncomingContext(ctx, "authorization") {
+		if scheme, token, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			bearer = strings.TrimSpace(token)
+		}
+	}
+	if bearer == "" {
+		return nil, status.Error(codes.Unauthenticated, "send an API token as authorization: Bearer <token> metadata")
+	}
+	token, ok := lookupAPIToken(bearer)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unknown, revoked or expired API token")
+	}
+	required, role := roleViewer, userRole(token.User)
+	if grpcOperatorMethods[method] {
+		required = roleOperator
+	}
+	if !roleAllows(token.Scope, role) {
+		role = token.Scope
+	}
+	if !roleAllows(role, required) {
+		return nil, status.Error(codes.PermissionDenied, "this needs the "+required+" role; the API token acts with the "+role+" role")
+	}
+	ctx = context.WithValue(ctx, loginUserKey{}, token.User)
+	return context.WithValue(ctx, tokenScopeKey{}, token.Scope), nil
+}
+
+// authenticatedStream is a server stream with the context grpcAuthenticate returned
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context { return s.ctx }
+
+// serveGRPC listens for gRPC on addr alongside the HTTP server
+func serveGRPC(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println("❌ gRPC listener:", err)
+		return
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if !featureEnabled("grpc") {
+				return nil, errGRPCDisabled
+			}
+			if err := grpcPeerAllowed(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			ctx, err := grpcAuthenticate(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if !featureEnabled("grpc") {
+				return errGRPCDisabled
+			}
+			if err := grpcPeerAllowed(stream.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			ctx, err := grpcAuthenticate(stream.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, authenticatedStream{stream, ctx})
+		}),
+	)
+	accmgrpb.RegisterAccountManagerServer(server, &grpcServer{})
+	fmt.Println("gRPC", addr)
+	if err := server.Serve(listener); err != nil {
+		fmt.Println("❌ gRPC server:", err)
+	}
+}
+
+// newPBServer converts a server record for gRPC, reusing the REST conversion
+func newPBServer(ip string, server ServerInfo, health map[string]ServerHealth) *accmgrpb.Server {
+	api := newAPIServer(ip, server, health)
+	out := &accmgrpb.Server{
+		Ip:        api.IP,
+		Name:      api.Name,
+		Group:     api.Group,
+		LoginUser: api.LoginUser,
+		UseAgent:  api.UseAgent,
+		Accounts:  api.Accounts,
+	}
+	if h := api.Health; h != nil {
+		out.Health = &accmgrpb.Health{
+			CheckedAtUnix:    h.CheckedAt.Unix(),
+			Reachable:        h.Reachable,
+			Error:            h.Error,
+			ClockSkewSeconds: int64(h.ClockSkewSeconds),
+			ClockSkewHigh:    h.ClockSkewHigh,
+		}
+	}
+	return out
+}
+
+// newPBJob converts a job for gRPC
+func newPBJob(job Job) *accmgrpb.Job {
+	out := &accmgrpb.Job{
+		Id:            job.ID,
+		Kind:          job.Kind,
+		Server:        job.Server,
+		Description:   job.Description,
+		Status:        job.Status,
+		Progress:      job.Progress,
+		Error:         job.Error,
+		StartedAtUnix: job.StartedAt.Unix(),
+	}
+	if job.ExitCode != nil {
+		code := int32(*job.ExitCode)
+		out.ExitCode = &code
+	}
+	if job.FinishedAt != nil {
+		out.FinishedAtUnix = job.FinishedAt.Unix()
+	}
+	for _, note := range job.Notes {
+		out.Notes = append(out.Notes, &accmgrpb.JobNote{Author: note.Author, Text: note.Text, CreatedAtUnix: note.CreatedAt.Unix()})
+	}
+	return out
+}
+
+func (g *grpcServer) ListServers(ctx context.Context, req *accmgrpb.ListServersRequest) (*accmgrpb.ListServersResponse, error) {
+	health := healthSnapshot()
+	resp := &accmgrpb.ListServersResponse{}
+	for ip, server := range scopedServers(contextScope(ctx)) {
+		if req.GetGroup() == "" || server.Group == req.GetGroup() {
+			resp.Servers = append(resp.Servers, newPBServer(ip, server, health))
+		}
+	}
+	sort.Slice(resp.Servers, func(i, j int) bool { return resp.Servers[i].Ip < resp.Servers[j].Ip })
+	return resp, nil
+}
+
+func (g *grpcServer) GetServer(ctx context.Context, req *accmgrpb.GetServerRequest) (*accmgrpb.Server, error) {
+	server, ok := scopedServers(contextScope(ctx))[req.GetIp()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "server not found")
+	}
+	return newPBServer(req.GetIp(), server, healthSnapshot()), nil
+}
+
+func (g *grpcServer) ListJobs(ctx context.Context, req *accmgrpb.ListJobsRequest) (*accmgrpb.ListJobsResponse, error) {
+	resp := &accmgrpb.ListJobsResponse{}
+	for _, job := range jobsSnapshot() {
+		if (req.GetStatus() == "" || job.Status == req.GetStatus()) && jobVisible(ctx, job) {
+			resp.Jobs = append(resp.Jobs, newPBJob(job))
+		}
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) GetJob(ctx context.Context, req *accmgrpb.GetJobRequest) (*accmgrpb.Job, error) {
+	for _, job := range jobsSnapshot() {
+		if job.ID == req.GetId() && jobVisible(ctx, job) {
+			return newPBJob(job), nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "job not found")
+}
+
+func (g *grpcServer) AddJobNote(ctx context.Context, req *accmgrpb.AddJobNoteRequest) (*accmgrpb.Job, error) {
+	if job, ok := lookupJob(req.GetId()); ok && !jobVisible(ctx, job) {
+		return nil, status.Error(codes.NotFound, errJobNotFound.Error())
+	}
+	author, text, err := validateJobNote(grpcOperator(ctx), req.GetText())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	job, err := addJobNote(req.GetId(), author, text)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errJobNotRunning):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return newPBJob(job), nil
+}
+
+// Exec streams output lines as they arrive. A transport failure ends the stream with
+// codes.Unavailable; a non-zero exit is reported in the final result like any other. A
+// command an approval rule holds back is refused with codes.FailedPrecondition, since the
+// stream cannot wait for the approval; run it through the web UI or the REST API.
+func (g *grpcServer) Exec(req *accmgrpb.ExecRequest, stream grpc.ServerStreamingServer[accmgrpb.ExecOutput]) error {
+	ip := req.GetServer()
+	server, ok := scopedServers(contextScope(stream.Context()))[ip]
+	if !ok {
+		return status.Error(codes.NotFound, "server not found")
+	}
+	if strings.TrimSpace(req.GetCommand()) == "" {
+		return status.Error(codes.InvalidArgument, "command is required")
+	}
+	for name := range req.GetEnv() {
+		if !envNamePattern.MatchString(name) {
+			return status.Error(codes.InvalidArgument, "invalid environment variable name: "+name)
+		}
+	}
+
+	operator := grpcOperator(stream.Context())
+	server, err := operatorServer(server, operator)
+	if err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	if rule, ok := approvalRuleFor("command", map[string]ServerInfo{ip: server}, req.GetCommand()); ok {
+		return status.Error(codes.FailedPrecondition, "approval rule "+rule.Name+" holds this command back until another operator approves it; submit it through the web UI or the REST API")
+	}
+
+	job := startOperatorJob(operator, "command", ip, firstLine(req.GetCommand()))
+	if err := stream.Send(&accmgrpb.ExecOutput{Payload: &accmgrpb.ExecOutput_JobId{JobId: job.ID}}); err != nil {
+		job.finish(err)
+		return err
+	}
+
+	// stdout and stderr arrive on separate goroutines, but a stream allows one sender at a time
+	var sendMu sync.Mutex
+	live := func(line OutputLine) {
+		if line.Stream == "step" {
+			job.progress(line.Text)
+		}
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		stream.Send(&accmgrpb.ExecOutput{Payload: &accmgrpb.ExecOutput_Line{
+			Line: &accmgrpb.OutputLine{Stream: line.Stream, Text: line.Text},
+		}})
+	}
+
+	result, err := runAdHocCommand(job.context(), ip, server, operatorScript(server, req.GetCommand(), operator, job.ID), adHocOptions{
+		Escalate: req.GetEscalate(),
+		Upload:   req.GetUpload(),
+		Env:      req.GetEnv(),
+	}, job.teeOutput(live))
+	job.finishCommand(result, err)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return stream.Send(&accmgrpb.ExecOutput{Payload: &accmgrpb.ExecOutput_Result{Result: &accmgrpb.ExecResult{
+		ExitCode:   int32(result.ExitCode),
+		DurationMs: result.Duration.Milliseconds(),
+		Truncated:  result.Truncated,
+	}}})
+}
+
+// WatchEvents replays stored events after after_id and then follows the live feed, leaving
+// out what the caller may not see
+func (g *grpcServer) WatchEvents(req *accmgrpb.WatchEventsRequest, stream grpc.ServerStreamingServer[accmgrpb.Event]) error {
+	backlog, client := subscribeEvents(req.GetAfterId())
+	defer unsubscribeEvents(client)
+
+	send := func(event Event) error {
+		if !eventMatches(req.GetTypes(), event.Type) || !eventVisible(stream.Context(), event) {
+			return nil
+		}
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil
+		}
+		return stream.Send(&accmgrpb.Event{
+			Id:       event.ID,
+			Type:     event.Type,
+			TimeUnix: event.Time.Unix(),
+			DataJson: string(data),
+		})
+	}
+
+	for _, event := range backlog {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, open := <-client:
+			if !open {
+				return status.Error(codes.ResourceExhausted, "event stream fell behind; resume with after_id")
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthSettings controls the background health poller
+type HealthSettings struct {
+	PollIntervalSeconds       int `json:"poll_interval_seconds"`
+	ClockSkewThresholdSeconds int `json:"clock_skew_threshold_seconds"`
+	// SiteCheckIntervalSeconds is how often servers tagged "web" have their site fetched
+	SiteCheckIntervalSeconds int `json:"site_check_interval_seconds,omitempty"`
+	// UnmanagedCheckIntervalSeconds is how often servers are checked for changes made
+	// outside accmgr4
+	UnmanagedCheckIntervalSeconds int `json:"unmanaged_check_interval_seconds,omitempty"`
+	// OutdatedCheckIntervalSeconds is how often servers are checked for pending updates and
+	// OutdatedThreshold how many pending updates flag a server
+	OutdatedCheckIntervalSeconds int `json:"outdated_check_interval_seconds,omitempty"`
+	OutdatedThreshold            int `json:"outdated_threshold,omitempty"`
+}
+
+// ServerHealth is the latest poll result for a server
+type ServerHealth struct {
+	CheckedAt time.Time
+	Reachable bool
+	Error     string
+	// ClockSkew is remote time minus management host time, at one second resolution
+	ClockSkew     time.Duration
+	ClockSkewHigh bool
+}
+
+var (
+	healthMu     sync.RWMutex
+	healthStatus = make(map[string]ServerHealth)
+	// lastPollRound and lastPollDuration describe the poller's most recent finished round
+	lastPollRound    time.Time
+	lastPollDuration time.Duration
+)
+
+// pollInterval returns the configured poll interval, defaulting to one minute
+func (h HealthSettings) pollInterval() time.Duration {
+	if h.PollIntervalSeconds <= 0 {
+		return time.Minute
+	}
+	return time.Duration(h.PollIntervalSeconds) * time.Second
+}
+
+// clockSkewThreshold returns the skew that raises an alert, defaulting to ten seconds
+func (h HealthSettings) clockSkewThreshold() time.Duration {
+	if h.ClockSkewThresholdSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(h.ClockSkewThresholdSeconds) * time.Second
+}
+
+// SkewLabel formats the clock skew for display, e.g. "+3s" or "-1m2s"
+func (h ServerHealth) SkewLabel() string {
+	if h.ClockSkew >= 0 {
+		return "+" + h.ClockSkew.String()
+	}
+	return h.ClockSkew.String()
+}
+
+// runHealthPoller polls every server on the configured interval and enforces profile locks.
+// It runs under superviseWorker, which restarts it if it panics.
+func runHealthPoller() {
+	for {
+		start := time.Now()
+		pollAllServers()
+		enforceProfileLocks()
+		healthMu.Lock()
+		lastPollRound = time.Now()
+		lastPollDuration = lastPollRound.Sub(start)
+		healthMu.Unlock()
+		time.Sleep(settings.Health.pollInterval())
+	}
+}
+
+// pollAllServers checks every server through the worker pool and waits for the round to
+// finish
+func pollAllServers() {
+	servers := serversSnapshot()
+	fanOut(slices.Sorted(maps.Keys(servers)), func(i int, ip string) {
+		defer catchWorkerPanic("health-poller")
+		pollServer(ip, servers[ip])
+	})
+}
+
+// pollServer measures reachability and clock skew for one server
+func pollServer(ip string, server ServerInfo) {
+	health := ServerHealth{CheckedAt: time.Now()}
+
+	start := time.Now()
+	clock := "date +%s"
+	if server.isWindows() {
+		clock = "[DateTimeOffset]::UtcNow.ToUnixTimeSeconds()"
+	}
+	result, err := runProbeCommand(ip, server, clock)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		health.Error = err.Error()
+	} else if remote, parseErr := strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64); parseErr != nil || !result.OK() {
+		health.Reachable = true
+		health.Error = "unexpected date output: " + strings.TrimSpace(result.Output())
+	} else {
+		health.Reachable = true
+		// Compare against the local clock at the midpoint of the round trip
+		local := start.Add(elapsed / 2).Truncate(time.Second)
+		health.ClockSkew = time.Unix(remote, 0).Sub(local)
+	}
+
+	alertKey := "clock-skew:" + ip
+	threshold := settings.Health.clockSkewThreshold()
+	if health.Reachable && health.Error == "" && (health.ClockSkew > threshold || health.ClockSkew < -threshold) {
+		health.ClockSkewHigh = true
+		raiseAlert(alertKey, ip, "warning", fmt.Sprintf("Clock skew of %s exceeds %s; TLS and Kerberos may fail", health.SkewLabel(), threshold))
+	} else if health.Reachable {
+		clearAlert(alertKey)
+	}
+
+	healthMu.Lock()
+	healthStatus[ip] = health
+	healthMu.Unlock()
+}
+
+// healthSnapshot returns a copy of the latest health results
+func healthSnapshot() map[string]ServerHealth {
+	healthMu.RLock()
+	defer healthMu.RUnlock()
+	snapshot := make(map[string]ServerHealth, len(healthStatus))
+	for ip, health := range healthStatus {
+		snapshot[ip] = health
+	}
+	return snapshot
+}
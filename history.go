@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jobHistoryFile keeps finished jobs across restarts
+	jobHistoryFile = "job_history.json"
+	// maxJobRecords is how many finished jobs the history keeps; the oldest are dropped first
+	maxJobRecords = 1000
+	// maxRecordedOutput caps the output a job record shows, and keeps inline when its log
+	// could not be stored; the end of the output is kept
+	maxRecordedOutput = 256 << 10
+)
+
+// JobRerun is the request that started a job, so the history can send it again
+type JobRerun struct {
+	Path string     `json:"path"`
+	Form url.Values `json:"form"`
+}
+
+// JobRecord is a finished job as the history keeps it. Its output is in its log under
+// job_logs/, of LogSize bytes; Output holds it instead when the log could not be stored.
+type JobRecord struct {
+	Job
+	Output  string    `json:"output,omitempty"`
+	LogSize int64     `json:"log_size,omitempty"`
+	Rerun   *JobRerun `json:"rerun,omitempty"`
+}
+
+// Duration is how long the job ran, to a tenth of a second
+func (j JobRecord) Duration() time.Duration {
+	if j.FinishedAt == nil {
+		return 0
+	}
+	return j.FinishedAt.Sub(j.StartedAt).Round(100 * time.Millisecond)
+}
+
+// LogSizeText is the size of the job's log on disk, e.g. "12 KB" or "3.4 MB"
+func (j JobRecord) LogSizeText() string {
+	if j.LogSize < 1<<20 {
+		return fmt.Sprintf("%d KB", (j.LogSize+1023)>>10)
+	}
+	return fmt.Sprintf("%.1f MB", float64(j.LogSize)/(1<<20))
+}
+
+// rerunHandler is a request a job can be re-run with. The server_ip field, and group where
+// groups is set, are replaced by the target chosen on the history page.
+type rerunHandler struct {
+	handler http.HandlerFunc
+	groups  bool
+}
+
+// rerunHandlers are the requests jobs record for re-running, by path
+var rerunHandlers = map[string]rerunHandler{
+	"/install-software":     {installSoftwareHandler, true},
+	"/execute-command":      {executeCommandHandler, false},
+	"/run-recipe":           {runRecipeHandler, false},
+	"/run-command-template": {runCommandTemplateHandler, true},
+}
+
+var (
+	jobHistoryMu sync.Mutex
+	jobHistory   []JobRecord // newest first
+	jobReruns    = make(map[string]*JobRerun)
+)
+
+// loadJobHistory reads job_history.json and continues job IDs after the newest recorded
+// one, so IDs stay unique across restarts
+func loadJobHistory() error {
+	file, err := os.Open(jobHistoryFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	jobHistoryMu.Lock()
+	defer jobHistoryMu.Unlock()
+	if err := json.NewDecoder(file).Decode(&jobHistory); err != nil {
+		return err
+	}
+	jobsMu.Lock()
+	for _, record := range jobHistory {
+		if n, err := strconv.Atoi(strings.TrimPrefix(record.ID, "job-")); err == nil && n > nextJobID {
+			nextJobID = n
+		}
+	}
+	jobsMu.Unlock()
+	return nil
+}
+
+// saveJobHistory writes job_history.json; callers hold jobHistoryMu
+func saveJobHistory() error {
+	file, err := os.Create(jobHistoryFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(jobHistory)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+// jobStartedKey is the request context key of a func(*Job) that learns which job a
+// replayed request started, e.g. for a cron job to link its last run
+type jobStartedKey struct{}
+
+// setRerun records the request that started the job; call it before the job finishes.
+// ctx is the request's context.
+func (j *Job) setRerun(ctx context.Context, path string, form url.Values) {
+	form = maps.Clone(form)
+	form.Del("confirmed")
+	form.Del(idempotencyKeyField)
+	form.Del(csrfField)
+	// A re-run covers the whole target again, not just the servers a retry picked
+	form.Del(retryOfField)
+	jobHistoryMu.Lock()
+	jobReruns[j.ID] = &JobRerun{Path: path, Form: form}
+	jobHistoryMu.Unlock()
+	if started, ok := ctx.Value(jobStartedKey{}).(func(*Job)); ok {
+		started(j)
+	}
+}
+
+// jobOutputText joins the job's live output into a log, marking stderr and step lines
+func jobOutputText(id string) string {
+	lines, _, _ := jobOutputSince(id, 0)
+	var text strings.Builder
+	for _, line := range lines {
+		text.WriteString(outputLineText(line))
+	}
+	return text.String()
+}
+
+// recordJobHistory stores a finished job, closing its log on disk. Without a stored log the
+// job's result log or live output is kept in the record.
+func recordJobHistory(job Job) {
+	record := JobRecord{Job: job, LogSize: closeJobLog(job.ID, job.Log)}
+	if record.LogSize == 0 {
+		output := job.Log
+		if output == "" {
+			output = jobOutputText(job.ID)
+		}
+		if len(output) > maxRecordedOutput {
+			output = "… (earlier output dropped)\n" + strings.ToValidUTF8(output[len(output)-maxRecordedOutput:], "")
+		}
+		record.Output = output
+	}
+	record.Log = ""
+
+	jobHistoryMu.Lock()
+	defer jobHistoryMu.Unlock()
+	record.Rerun = jobReruns[job.ID]
+	delete(jobReruns, job.ID)
+	jobHistory = append([]JobRecord{record}, jobHistory...)
+	if len(jobHistory) > maxJobRecords {
+		for _, dropped := range jobHistory[maxJobRecords:] {
+			if len(dropped.Artifacts) > 0 {
+				os.RemoveAll(jobArtifactsDir(dropped.ID))
+			}
+		}
+		jobHistory = jobHistory[:maxJobRecords]
+	}
+	saveJobHistory()
+}
+
+// findJobRecord returns a finished job from the history
+func findJobRecord(id string) (JobRecord, bool) {
+	jobHistoryMu.Lock()
+	defer jobHistoryMu.Unlock()
+	for _, record := range jobHistory {
+		if record.ID == id {
+			return record, true
+		}
+	}
+	return JobRecord{}, false
+}
+
+// jobHistoryHandler lists finished jobs, filtered by server, kind and status, or shows one
+// with its output and a form to run it again
+func jobHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if id := r.FormValue("id"); id != "" {
+		if !jobAllowed(w, r, id) {
+			return
+		}
+		record, ok := findJobRecord(id)
+		if !ok {
+			http.Error(w, "Job not found in the history", http.StatusNotFound)
+			return
+		}
+		data := map[string]interface{}{}
+		if record.LogSize > 0 {
+			output, truncated, err := readJobLogTail(record.ID, maxRecordedOutput)
+			if err != nil && !os.IsNotExist(err) {
+				http.Error(w, "❌ Reading the log: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			record.Output = output
+			data["LogExpired"] = err != nil
+			data["LogTruncated"] = truncated
+		}
+		data["Record"] = record
+		if record.Rerun != nil {
+			servers := requestServers(r)
+			ips := make([]string, 0, len(servers))
+			for ip := range servers {
+				ips = append(ips, ip)
+			}
+			sort.Strings(ips)
+			data["Servers"] = ips
+			if rerunHandlers[record.Rerun.Path].groups {
+				data["Groups"] = serverGroups(servers)
+			}
+			data["Target"] = record.Rerun.Form.Get("server_ip")
+		}
+		renderTemplate(w, r, "templates/jobrecord.html", data)
+		return
+	}
+
+	server, kind, status := r.FormValue("server"), r.FormValue("kind"), r.FormValue("status")
+	scope, servers, operator := requestScope(r), serversSnapshot(), requestOperator(r)
+	var records []JobRecord
+	kinds := make(map[string]bool)
+	jobHistoryMu.Lock()
+	for _, record := range jobHistory {
+		kinds[record.Kind] = true
+		if (server == "" || record.Server == server) && (kind == "" || record.Kind == kind) && (status == "" || record.Status == status) && jobInScope(scope, servers, operator, record.Job) {
+			records = append(records, record)
+		}
+	}
+	jobHistoryMu.Unlock()
+	kindList := make([]string, 0, len(kinds))
+	for k := range kinds {
+		kindList = append(kindList, k)
+	}
+	sort.Strings(kindList)
+
+	logs, _ := jobLogFiles()
+	var logSize int64
+	for _, log := range logs {
+		logSize += log.Size()
+	}
+
+	renderTemplate(w, r, "templates/jobhistory.html", map[string]interface{}{
+		"Logs":    len(logs),
+		"LogMB":   float64(logSize) / (1 << 20),
+		"JobLogs": settings.JobLogs,
+		"Records": records,
+		"Kinds":   kindList,
+		"Server":  server,
+		"Kind":    kind,
+		"Status":  status,
+	})
+}
+
+// rerunJobHandler sends a recorded job's request again against the chosen server or group.
+// Software installs show their preview again before anything runs.
+func rerunJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	record, ok := findJobRecord(r.FormValue("id"))
+	if !ok || record.Rerun == nil {
+		http.Error(w, "The job cannot be re-run", http.StatusNotFound)
+		return
+	}
+	rerun, ok := rerunHandlers[record.Rerun.Path]
+	if !ok {
+		http.Error(w, "The job cannot be re-run", http.StatusBadRequest)
+		return
+	}
+	serverIP, group := strings.TrimSpace(r.FormValue("server_ip")), strings.TrimSpace(r.FormValue("group"))
+	switch {
+	case rerun.groups && (serverIP == "") == (group == ""):
+		http.Error(w, "Choose either a server or a group", http.StatusBadRequest)
+		return
+	case !rerun.groups && (serverIP == "" || group != ""):
+		http.Error(w, "Choose a server", http.StatusBadRequest)
+		return
+	}
+
+	form := maps.Clone(record.Rerun.Form)
+	form.Set("server_ip", serverIP)
+	if rerun.groups {
+		form.Set("group", group)
+	}
+	replay := r.Clone(r.Context())
+	replay.Form, replay.PostForm = form, form
+	rerun.handler(w, replay)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxHookLength caps a single hook command
+const maxHookLength = 1000
+
+// softwareHook is one setup or verification command from a catalog entry
+type softwareHook struct {
+	// Stage is "pre-install", run before anything is installed, "post-install", run
+	// after everything is, or "verify", run last to decide whether the install succeeded
+	Stage    string
+	Software string
+	Command  string
+}
+
+// parseHooks reads hook commands, one per line, skipping blank lines
+func parseHooks(text string) []string {
+	var hooks []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			hooks = append(hooks, line)
+		}
+	}
+	return hooks
+}
+
+// validateHooks checks the hook commands of a catalog entry
+func validateHooks(hooks []string) error {
+	for _, hook := range hooks {
+		if strings.TrimSpace(hook) == "" || strings.ContainsAny(hook, "\r\n") {
+			return fmt.Errorf("invalid hook %q; give one command per line", hook)
+		}
+		if len(hook) > maxHookLength {
+			return fmt.Errorf("hook %q is longer than %d characters", hook[:40]+"...", maxHookLength)
+		}
+	}
+	return nil
+}
+
+// softwareHooks lists the hooks of the selections in the order they run: every pre-install
+// hook, then every post-install hook, then every verification command
+func softwareHooks(selections []softwareSelection) []softwareHook {
+	var hooks []softwareHook
+	for _, selection := range selections {
+		for _, command := range selection.PreInstall {
+			hooks = append(hooks, softwareHook{Stage: "pre-install", Software: selection.Name, Command: command})
+		}
+	}
+	for _, selection := range selections {
+		for _, command := range selection.PostInstall {
+			hooks = append(hooks, softwareHook{Stage: "post-install", Software: selection.Name, Command: command})
+		}
+	}
+	for _, selection := range selections {
+		if selection.Verify != "" {
+			hooks = append(hooks, softwareHook{Stage: "verify", Software: selection.Name, Command: selection.Verify})
+		}
+	}
+	return hooks
+}
+
+// hookStep runs hook number i as a tracked command, so the log can tell which hooks passed,
+// which failed and which never ran
+func hookStep(i int, hook softwareHook) softwareStep {
+	name := hook.Stage + " hook for " + hook.Software
+	if hook.Stage == "verify" {
+		name = "verifying " + hook.Software
+	}
+	return softwareStep{Name: name, Command: trackedCommand(i, hook.Command)}
+}
+
+// failedVerifications names the software whose verification command failed
+func failedVerifications(hooks []softwareHook, statuses []stepStatus) []string {
+	var failed []string
+	for i, hook := range hooks {
+		if hook.Stage == "verify" && statuses[i] == stepFailed {
+			failed = append(failed, hook.Software)
+		}
+	}
+	return failed
+}
+
+// writeHookLog reports every hook with its status
+func writeHookLog(logBuilder *strings.Builder, hooks []softwareHook, statuses []stepStatus) {
+	logBuilder.WriteString("Hooks:\n")
+	for i, hook := range hooks {
+		logBuilder.WriteString(fmt.Sprintf("%s %s %s: %s\n", statuses[i].Marker(), hook.Stage, hook.Software, hook.Command))
+	}
+	logBuilder.WriteString("\n")
+}
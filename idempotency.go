@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Forms that start jobs carry an idempotency key, fresh with every page load, and API
+// clients may send one in the Idempotency-Key header. A request repeating the key of an
+// earlier one is not run again but sent to what the first one started, so a double-clicked
+// Install button installs once.
+const (
+	idempotencyKeyField  = "idempotency_key"
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyWindow is how long a key is remembered after its request started a job
+	idempotencyWindow = time.Hour
+)
+
+// submission is a request that carried an idempotency key. It is kept once the request
+// started something, with location the page that shows it; a request that failed or only
+// previewed forgets its key, so the form can be fixed and sent again.
+type submission struct {
+	fingerprint string
+	jobID       string
+	location    string
+	at          time.Time
+	// settled is closed once the request started something or finished without
+	settled chan struct{}
+}
+
+var (
+	submissionsMu sync.Mutex
+	submissions   = make(map[string]*submission)
+)
+
+// submissionKey is the request context key of the request's *submission
+type submissionKey struct{}
+
+// newIdempotencyKey returns a random key for a form to send with its submission
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+// requestFingerprint hashes what a request asks for, so a key sent again with a different
+// request is refused rather than answered with the wrong job
+func requestFingerprint(r *http.Request, fromHeader bool) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+	if fromHeader {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	} else {
+		form := maps.Clone(r.PostForm)
+		form.Del(idempotencyKeyField)
+		io.WriteString(hash, form.Encode())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// expireSubmissions forgets keys past idempotencyWindow; callers hold submissionsMu
+func expireSubmissions(now time.Time) {
+	for key, sub := range submissions {
+		if sub.location != "" && now.Sub(sub.at) > idempotencyWindow {
+			delete(submissions, key)
+		}
+	}
+}
+
+// idempotent wraps a handler that starts jobs. A request with a key seen before waits
+// until the first one started its job and is then redirected to it, or for API clients
+// answered with 409 and the job's location; a key reused for a different request is
+// refused with 422.
+func idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, fromHeader := r.Header.Get(idempotencyKeyHeader), true
+		if key == "" {
+			key, fromHeader = r.FormValue(idempotencyKeyField), false
+		}
+		if r.Method != http.MethodPost || key == "" {
+			next(w, r)
+			return
+		}
+		fingerprint, err := requestFingerprint(r, fromHeader)
+		if err != nil {
+			http.Error(w, "❌ Reading the request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		key = requestOperator(r) + "\x00" + key
+
+		for {
+			submissionsMu.Lock()
+			expireSubmissions(time.Now())
+			sub, seen := submissions[key]
+			if !seen {
+				sub = &submission{fingerprint: fingerprint, at: time.Now(), settled: make(chan struct{})}
+				submissions[key] = sub
+				submissionsMu.Unlock()
+				defer settleSubmission(key, sub)
+				next(w, r.WithContext(context.WithValue(r.Context(), submissionKey{}, sub)))
+				return
+			}
+			submissionsMu.Unlock()
+
+			if sub.fingerprint != fingerprint {
+				refuseSubmission(w, fromHeader, http.StatusUnprocessableEntity, "This idempotency key was already used for a different request", "")
+				return
+			}
+			select {
+			case <-sub.settled:
+			case <-r.Context().Done():
+				return
+			}
+			submissionsMu.Lock()
+			jobID, location := sub.jobID, sub.location
+			submissionsMu.Unlock()
+			if location == "" {
+				// The first request started nothing, so this one runs in its place
+				continue
+			}
+			if fromHeader {
+				message := "This request was already submitted"
+				if jobID != "" {
+					message, location = message+" as "+jobID, "/api/v1/jobs/"+jobID
+				}
+				refuseSubmission(w, true, http.StatusConflict, message, appPath(r, location))
+				return
+			}
+			http.Redirect(w, r, appPath(r, location), http.StatusSeeOther)
+			return
+		}
+	}
+}
+
+// refuseSubmission answers a repeated request, in JSON for API clients
+func refuseSubmission(w http.ResponseWriter, api bool, status int, message, location string) {
+	if location != "" {
+		w.Header().Set("Location", location)
+	}
+	if api {
+		writeAPIError(w, status, message)
+		return
+	}
+	http.Error(w, "❌ "+message, status)
+}
+
+// settleSubmission forgets the key of a request that started nothing and releases the
+// requests waiting on it
+func settleSubmission(key string, sub *submission) {
+	submissionsMu.Lock()
+	defer submissionsMu.Unlock()
+	if sub.location == "" {
+		delete(submissions, key)
+	}
+	select {
+	case <-sub.settled:
+	default:
+		close(sub.settled)
+	}
+}
+
+// submitted records that the request started what location shows, e.g. the jobs page for
+// a group upgrade, so repeats of it are sent there
+func submitted(r *http.Request, location string) {
+	recordSubmission(r, "", location)
+}
+
+// submittedJob records that the request started job
+func submittedJob(r *http.Request, job *Job) {
+	recordSubmission(r, job.ID, "/job?id="+job.ID)
+}
+
+// recordSubmission settles the request's submission with what it started; only the first
+// call counts
+func recordSubmission(r *http.Request, jobID, location string) {
+	sub, ok := r.Context().Value(submissionKey{}).(*submission)
+	if !ok {
+		return
+	}
+	submissionsMu.Lock()
+	defer submissionsMu.Unlock()
+	if sub.location != "" {
+		return
+	}
+	sub.jobID, sub.location, sub.at = jobID, location, time.Now()
+	close(sub.settled)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// What an install does with packages the server already has
+const (
+	// ifInstalledSkip leaves them alone, so only missing packages are installed
+	ifInstalledSkip = "skip"
+	// ifInstalledUpgrade upgrades them to the newest version the repositories offer
+	ifInstalledUpgrade = "upgrade"
+	// ifInstalledReinstall passes them to the install like any other package, as before
+	ifInstalledReinstall = "reinstall"
+)
+
+// parseIfInstalled reads the if_installed form value, skipping by default
+func parseIfInstalled(value string) string {
+	switch value {
+	case ifInstalledUpgrade, ifInstalledReinstall:
+		return value
+	}
+	return ifInstalledSkip
+}
+
+// installedVersions returns the version of every package installed on a Linux server
+func installedVersions(ip string, server ServerInfo, manager PackageManager) (map[string]string, error) {
+	result, err := runProbeCommand(ip, server, manager.ListVersions())
+	if err := commandError(result, err); err != nil {
+		return nil, fmt.Errorf("listing installed packages: %w", err)
+	}
+	versions := make(map[string]string)
+	for _, pkg := range parseInventory(result.Stdout) {
+		versions[pkg.Name] = pkg.Version
+	}
+	return versions, nil
+}
+
+// versionSatisfies reports whether an installed version is the one a spec pins, ignoring a
+// Debian epoch the spec leaves out. An unpinned spec accepts any version.
+func versionSatisfies(installed, pinned string) bool {
+	if pinned == "" {
+		return true
+	}
+	candidates := []string{installed}
+	if _, withoutEpoch, found := strings.Cut(installed, ":"); found {
+		candidates = append(candidates, withoutEpoch)
+	}
+	prefix, wildcard := wildcardVersion(pinned)
+	for _, candidate := range candidates {
+		if candidate == pinned || (wildcard && strings.HasPrefix(candidate, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyInstalled finds the native packages of the selections the server already has at the
+// requested version and handles them as mode asks: skipped, moved to the selection's
+// upgrades, or left to be installed again. Selections with nothing left to install are
+// dropped together with their hooks. It returns the remaining selections and the packages
+// found installed.
+func applyInstalled(selections []softwareSelection, versions map[string]string, mode string) ([]softwareSelection, []InstalledPackage) {
+	var kept []softwareSelection
+	var found []InstalledPackage
+	for _, selection := range selections {
+		if selection.Backend != backendNative || len(selection.Packages) == 0 {
+			kept = append(kept, selection)
+			continue
+		}
+		var missing []string
+		for _, spec := range selection.Packages {
+			name, pinned, _ := parsePackageSpec(spec)
+			version, ok := versions[name]
+			if !ok || !versionSatisfies(version, pinned) {
+				missing = append(missing, spec)
+				continue
+			}
+			found = append(found, InstalledPackage{Name: name, Version: version})
+			switch mode {
+			case ifInstalledUpgrade:
+				selection.Upgrades = append(selection.Upgrades, name)
+			case ifInstalledReinstall:
+				missing = append(missing, spec)
+			}
+		}
+		selection.Packages = missing
+		if len(selection.Packages) > 0 || len(selection.Upgrades) > 0 {
+			kept = append(kept, selection)
+		}
+	}
+	return kept, found
+}
+
+// writeInstalledLog reports the packages found installed and what the job does with them
+func writeInstalledLog(logBuilder *strings.Builder, found []InstalledPackage, mode string) {
+	if len(found) == 0 {
+		return
+	}
+	action := map[string]string{
+		ifInstalledSkip:      "skipped",
+		ifInstalledUpgrade:   "upgraded if a newer version is available",
+		ifInstalledReinstall: "passed to the package manager anyway",
+	}[mode]
+	marker := "•"
+	if mode == ifInstalledSkip {
+		marker = "⏭️"
+	}
+	logBuilder.WriteString("Already installed (" + action + "):\n")
+	for _, pkg := range found {
+		logBuilder.WriteString(fmt.Sprintf("%s %s %s\n", marker, pkg.Name, pkg.Version))
+	}
+	if mode == ifInstalledSkip {
+		logBuilder.WriteString("Choose \"Upgrade\" for packages already installed to bring them up to date.\n")
+	}
+}
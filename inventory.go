@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inventoryFile stores the latest package inventory of every server across restarts
+const inventoryFile = "inventory.json"
+
+// InstalledPackage is one package in a server's inventory
+type InstalledPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// PackageInventory is the installed packages of one server when it was last queried
+type PackageInventory struct {
+	CapturedAt time.Time          `json:"captured_at"`
+	Manager    string             `json:"manager"`
+	Packages   []InstalledPackage `json:"packages"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// inventoryRow is one line of the inventory page
+type inventoryRow struct {
+	IP string
+	InstalledPackage
+}
+
+var (
+	inventoryMu sync.Mutex
+	inventories = make(map[string]PackageInventory)
+)
+
+// loadInventory reads inventory.json; a missing file means nothing was queried yet
+func loadInventory() error {
+	file, err := os.Open(inventoryFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	return json.NewDecoder(file).Decode(&inventories)
+}
+
+// saveInventory writes inventory.json; callers hold inventoryMu
+func saveInventory() error {
+	file, err := os.Create(inventoryFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(inventories)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+// parseInventory reads "name version" lines, sorted by name
+func parseInventory(output string) []InstalledPackage {
+	var packages []InstalledPackage
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		packages = append(packages, InstalledPackage{Name: fields[0], Version: fields[1]})
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return packages
+}
+
+// queryInventory reads the package database of a Linux server and stores the result. A
+// failed query keeps the previous package list and records the error next to it.
+func queryInventory(ip string, server ServerInfo) PackageInventory {
+	inventory := PackageInventory{CapturedAt: time.Now()}
+	manager, err := detectPackageManager(ip, server)
+	if err == nil {
+		inventory.Manager = manager.Name()
+		var result CommandResult
+		result, err = runProbeCommand(ip, server, manager.ListVersions())
+		err = commandError(result, err)
+		inventory.Packages = parseInventory(result.Stdout)
+	}
+
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	if err != nil {
+		inventory = inventories[ip]
+		inventory.Error = err.Error()
+	}
+	inventories[ip] = inventory
+	if err := saveInventory(); err != nil {
+		fmt.Println("❌ Saving the package inventory:", err)
+	}
+	return inventory
+}
+
+// inventorySnapshot returns a copy of the stored inventories
+func inventorySnapshot() map[string]PackageInventory {
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	snapshot := make(map[string]PackageInventory, len(inventories))
+	for ip, inventory := range inventories {
+		snapshot[ip] = inventory
+	}
+	return snapshot
+}
+
+// inventoryHandler lists stored packages, filtered by server and by a case-insensitive
+// substring of the package name
+func inventoryHandler(w http.ResponseWriter, r *http.Request) {
+	selected := r.FormValue("ip")
+	query := strings.TrimSpace(r.FormValue("q"))
+	needle := strings.ToLower(query)
+
+	stored := inventorySnapshot()
+	ips := linuxServerIPs(requestServers(r))
+
+	var rows []inventoryRow
+	for _, ip := range ips {
+		if selected != "" && ip != selected {
+			continue
+		}
+		for _, pkg := range stored[ip].Packages {
+			if needle == "" || strings.Contains(strings.ToLower(pkg.Name), needle) {
+				rows = append(rows, inventoryRow{IP: ip, InstalledPackage: pkg})
+			}
+		}
+	}
+
+	data := map[string]interface{}{
+		"IPs":         ips,
+		"Inventories": stored,
+		"Selected":    selected,
+		"Query":       query,
+		"Rows":        rows,
+	}
+	renderTemplate(w, r, "templates/inventory.html", data)
+}
+
+// refreshInventoryHandler queries one server, or every Linux server in parallel when no
+// server is given
+func refreshInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := r.FormValue("server_ip")
+	servers := requestServers(r)
+	if ip != "" {
+		server, ok := servers[ip]
+		if !ok {
+			http.Error(w, "Server not found", http.StatusNotFound)
+			return
+		}
+		if !linuxOnly(w, server, "Package inventory") {
+			return
+		}
+		queryInventory(ip, server)
+	} else {
+		fanOut(linuxServerIPs(servers), func(i int, ip string) {
+			queryInventory(ip, servers[ip])
+		})
+	}
+
+	http.Redirect(w, r, appPath(r, "/inventory?ip="+url.QueryEscape(ip)), http.StatusSeeOther)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobLogsDir holds the full output of every job, one <job-id>.log file per job
+const jobLogsDir = "job_logs"
+
+// jobLogJanitorInterval is how often expired job logs are removed
+const jobLogJanitorInterval = time.Hour
+
+// JobLogSettings is the retention policy of the job logs on disk; zero values mean the
+// defaults
+type JobLogSettings struct {
+	// MaxLogMB caps one job's log; past it the start and the end of the output are kept
+	MaxLogMB int `json:"max_log_mb,omitempty"`
+	// RetentionDays is how long a log is kept after its job finished
+	RetentionDays int `json:"retention_days,omitempty"`
+	// MaxTotalMB caps all logs together; the oldest are removed first
+	MaxTotalMB int `json:"max_total_mb,omitempty"`
+}
+
+func (s JobLogSettings) maxLogBytes() int64 {
+	if s.MaxLogMB <= 0 {
+		return 10 << 20
+	}
+	return int64(s.MaxLogMB) << 20
+}
+
+func (s JobLogSettings) retention() time.Duration {
+	if s.RetentionDays <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(s.RetentionDays) * 24 * time.Hour
+}
+
+func (s JobLogSettings) maxTotalBytes() int64 {
+	if s.MaxTotalMB <= 0 {
+		return 1 << 30
+	}
+	return int64(s.MaxTotalMB) << 20
+}
+
+// jobLog is the log file of a running job. The first three quarters of the size limit are
+// written as lines arrive; once that is full, the latest lines are held back in tail,
+// within the last quarter, and written with a truncation marker when the job finishes.
+type jobLog struct {
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	headMax int64
+	tailMax int64
+
+	tail         []string
+	tailSize     int64
+	omitted      int
+	omittedBytes int64
+}
+
+var (
+	jobLogsMu sync.Mutex
+	// jobLogs are the open logs of running jobs; nil marks a log that could not be created
+	jobLogs = make(map[string]*jobLog)
+)
+
+// jobLogPath is where a job's log is stored
+func jobLogPath(jobID string) string {
+	return filepath.Join(jobLogsDir, jobID+".log")
+}
+
+// outputLineText renders one output line as the logs store it, marking stderr and step
+// lines
+func outputLineText(line OutputLine) string {
+	switch line.Stream {
+	case "stderr":
+		return stderrPrefix + line.Text + "\n"
+	case "step":
+		return "▶ " + line.Text + "\n"
+	}
+	return line.Text + "\n"
+}
+
+// openJobLog creates the job's log file on its first line; callers hold jobLogsMu. Job IDs
+// may repeat when the history was removed, so an existing file belongs to an older job and
+// is replaced.
+func openJobLog(id string) *jobLog {
+	if log, ok := jobLogs[id]; ok {
+		return log
+	}
+	var log *jobLog
+	file, err := func() (*os.File, error) {
+		if err := os.MkdirAll(jobLogsDir, 0o755); err != nil {
+			return nil, err
+		}
+		return os.Create(jobLogPath(id))
+	}()
+	if err != nil {
+		fmt.Printf("⚠️ Cannot store the log of %s: %v\n", id, err)
+	} else {
+		limit := settings.JobLogs.maxLogBytes()
+		log = &jobLog{file: file, writer: bufio.NewWriter(file), headMax: limit - limit/4, tailMax: limit / 4}
+	}
+	jobLogs[id] = log
+	return log
+}
+
+// add writes a line while the head has room and keeps it in the tail after that
+func (l *jobLog) add(text string) {
+	n := int64(len(text))
+	if len(l.tail) == 0 && l.size+n <= l.headMax {
+		l.writer.WriteString(text)
+		l.size += n
+		return
+	}
+	l.tail = append(l.tail, text)
+	l.tailSize += n
+	for l.tailSize > l.tailMax && len(l.tail) > 0 {
+		dropped := int64(len(l.tail[0]))
+		l.tail = l.tail[1:]
+		l.tailSize -= dropped
+		l.omitted++
+		l.omittedBytes += dropped
+	}
+}
+
+// close writes the held-back tail behind a truncation marker and closes the file,
+// returning the log's size
+func (l *jobLog) close() (int64, error) {
+	if l.omitted > 0 {
+		marker := fmt.Sprintf("✂️ %d lines (%.1f MB) omitted here: job logs are capped at %d MB\n",
+			l.omitted, float64(l.omittedBytes)/(1<<20), (l.headMax+l.tailMax)>>20)
+		l.writer.WriteString(marker)
+		l.size += int64(len(marker))
+	}
+	for _, text := range l.tail {
+		l.writer.WriteString(text)
+		l.size += int64(len(text))
+	}
+	l.tail = nil
+	err := l.writer.Flush()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return l.size, err
+}
+
+// appendJobLog stores one line of a job's output on disk
+func appendJobLog(id string, line OutputLine) {
+	jobLogsMu.Lock()
+	defer jobLogsMu.Unlock()
+	if log := openJobLog(id); log != nil {
+		log.add(outputLineText(line))
+	}
+}
+
+// closeJobLog finishes a job's log, adding the job's result log after its output, and
+// returns the size stored; 0 means the job has no log on disk
+func closeJobLog(id, result string) int64 {
+	jobLogsMu.Lock()
+	defer jobLogsMu.Unlock()
+	log, ok := jobLogs[id]
+	if !ok && result != "" {
+		log = openJobLog(id)
+	} else if ok && log != nil && result != "" {
+		log.add("\n📄 Result\n")
+	}
+	delete(jobLogs, id)
+	if log == nil {
+		return 0
+	}
+	for _, line := range strings.SplitAfter(result, "\n") {
+		if line != "" {
+			log.add(line)
+		}
+	}
+	size, err := log.close()
+	if err != nil {
+		fmt.Printf("⚠️ Storing the log of %s: %v\n", id, err)
+		return 0
+	}
+	return size
+}
+
+// flushJobLog writes out what a running job's log has buffered, so a download is current
+func flushJobLog(id string) {
+	jobLogsMu.Lock()
+	defer jobLogsMu.Unlock()
+	if log := jobLogs[id]; log != nil {
+		log.writer.Flush()
+	}
+}
+
+// readJobLogTail returns the end of a job's log, at most limit bytes from a line start, and
+// whether earlier output was left out
+func readJobLogTail(id string, limit int64) (string, bool, error) {
+	file, err := os.Open(jobLogPath(id))
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	offset := max(info.Size()-limit, 0)
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return "", false, err
+	}
+	if offset > 0 {
+		if i := strings.IndexByte(string(data), '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return string(data), offset > 0, nil
+}
+
+// jobLogFiles lists the stored logs of finished jobs, oldest first
+func jobLogFiles() ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(jobLogsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	jobLogsMu.Lock()
+	var files []fs.FileInfo
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".log")
+		if _, running := jobLogs[id]; running || !entry.Type().IsRegular() || id == entry.Name() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	jobLogsMu.Unlock()
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	return files, nil
+}
+
+// expireJobLogs removes the logs past the retention period, then the oldest ones until all
+// logs fit the total size limit
+func expireJobLogs() {
+	files, err := jobLogFiles()
+	if err != nil {
+		fmt.Printf("⚠️ Listing job logs: %v\n", err)
+		return
+	}
+	policy := settings.JobLogs
+	var total int64
+	for _, file := range files {
+		total += file.Size()
+	}
+	cutoff := time.Now().Add(-policy.retention())
+	removed, freed := 0, int64(0)
+	for _, file := range files {
+		if !file.ModTime().Before(cutoff) && total <= policy.maxTotalBytes() {
+			break
+		}
+		if err := os.Remove(filepath.Join(jobLogsDir, file.Name())); err != nil {
+			fmt.Printf("⚠️ Removing job log %s: %v\n", file.Name(), err)
+			continue
+		}
+		total -= file.Size()
+		removed++
+		freed += file.Size()
+	}
+	if removed > 0 {
+		fmt.Printf("🧹 Removed %d expired job logs (%.1f MB)\n", removed, float64(freed)/(1<<20))
+	}
+}
+
+// runJobLogJanitor expires job logs at startup and then every hour
+func runJobLogJanitor() {
+	for {
+		expireJobLogs()
+		time.Sleep(jobLogJanitorInterval)
+	}
+}
+
+// jobLogHandler downloads a job's full log, also while the job runs
+func jobLogHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if !jobAllowed(w, r, id) {
+		return
+	}
+	if _, ok := findJob(id); !ok {
+		if _, ok := findJobRecord(id); !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+	}
+	flushJobLog(id)
+	if _, err := os.Stat(jobLogPath(id)); err != nil {
+		http.Error(w, "No log is stored for "+id+"; it had no output or has expired", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.FormValue("inline") == "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".log"))
+	}
+	http.ServeFile(w, r, jobLogPath(id))
+}
+
+// saveJobLogSettingsHandler updates the retention policy and applies it right away
+func saveJobLogSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var policy JobLogSettings
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{
+		{"max_log_mb", &policy.MaxLogMB},
+		{"retention_days", &policy.RetentionDays},
+		{"max_total_mb", &policy.MaxTotalMB},
+	} {
+		text := strings.TrimSpace(r.FormValue(field.name))
+		if text == "" {
+			continue
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("❌ %s must be a whole number of at least 1", field.name), http.StatusBadRequest)
+			return
+		}
+		*field.value = n
+	}
+	if policy.maxLogBytes() > policy.maxTotalBytes() {
+		http.Error(w, "❌ A single log cannot be larger than all logs together", http.StatusBadRequest)
+		return
+	}
+	settings.JobLogs = policy
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expireJobLogs()
+	http.Redirect(w, r, appPath(r, "/job-history"), http.StatusSeeOther)
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxJobHistory is how many finished jobs are kept in memory for status lookups
+const maxJobHistory = 200
+
+const (
+	// maxJobNotes is how many handoff notes one job keeps; the oldest are dropped first
+	maxJobNotes = 20
+	// maxJobNoteLength caps the text of one note, in characters
+	maxJobNoteLength = 500
+)
+
+// JobNote is a handoff note pinned to a job, e.g. "waiting on mirror, do not cancel"
+type JobNote struct {
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Job tracks one long-running operation, such as an install or a profile rollout
+type Job struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	Server      string `json:"server,omitempty"`
+	Description string `json:"description"`
+	// Operator is the accmgr4 user who started the job, when a trusted proxy identified one
+	Operator string `json:"operator,omitempty"`
+	Status   string `json:"status"` // "pending", "queued", "running", "succeeded", "failed" or "cancelled"
+	Progress string `json:"progress,omitempty"`
+	// Step and Steps are how far a job running numbered steps got, e.g. 3 of 7
+	Step       int        `json:"step,omitempty"`
+	Steps      int        `json:"steps,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	QueuedAt   *time.Time `json:"queued_at,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Notes      []JobNote  `json:"notes,omitempty"`
+	// Artifacts are files collected from the server after the job ran
+	Artifacts []JobArtifact `json:"artifacts,omitempty"`
+	// Log is the outcome of a queued job, as the request would have shown it
+	Log string `json:"log,omitempty"`
+	// CancelledBy is who asked for the job to be cancelled
+	CancelledBy string `json:"cancelled_by,omitempty"`
+	// Notify overrides the global notification setting for this job: "always", "failure"
+	// or "never"
+	Notify string `json:"notify,omitempty"`
+	// TimeoutSeconds is the job's own time limit, overriding defaultJobTimeout
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// TimedOut is set once the job was stopped at its time limit
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Priority orders the job among those waiting for a worker or its server: "low",
+	// "urgent" or empty for normal
+	Priority string `json:"priority,omitempty"`
+	// Targets are the servers of a batch job, which runs a job of its own on each; see
+	// batchSummary
+	Targets []string `json:"targets,omitempty"`
+	// Parent is the batch job this server's job belongs to
+	Parent string `json:"parent,omitempty"`
+	// RetryOf is the batch job whose failed servers this batch runs on again
+	RetryOf string `json:"retry_of,omitempty"`
+	// Approval is the approval rule that held the job back as "pending"; see approveJob
+	Approval string `json:"approval,omitempty"`
+	// ApprovedBy is the operator who let a held job run
+	ApprovedBy string `json:"approved_by,omitempty"`
+	// HeldBy is the maintenance window the job waits for before it claims its server
+	HeldBy string `json:"held_by,omitempty"`
+}
+
+var (
+	jobsMu    sync.Mutex
+	jobs      []*Job
+	nextJobID int
+	// jobContexts are cancelled with their unfinished job; the job's commands watch them
+	jobContexts = make(map[string]context.Context)
+	jobCancels  = make(map[string]context.CancelFunc)
+)
+
+// startJob registers a running job and announces it on the event stream
+func startJob(kind, server, description string) *Job {
+	return startOperatorJob("", kind, server, description)
+}
+
+// startOperatorJob is startJob for a job an operator started
+func startOperatorJob(operator, kind, server, description string) *Job {
+	return startPriorityJob(operator, kind, server, description, "")
+}
+
+// startPriorityJob is startOperatorJob with a priority. A job on one server first waits for
+// the server's maintenance windows to let it run, then for any other job there to finish,
+// and for the waiting jobs that go before it; see claimServer. Its time limit starts once
+// it holds the server.
+func startPriorityJob(operator, kind, server, description, priority string) *Job {
+	jobsMu.Lock()
+	job := registerJob(operator, kind, server, description, "running")
+	job.Priority = priority
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	publishEvent("job.started", snapshot)
+	if server != "" {
+		job.awaitMaintenanceWindow()
+		job.claimServer()
+	}
+	jobsMu.Lock()
+	job.armTimeout()
+	jobsMu.Unlock()
+	return job
+}
+
+// registerJob adds a job with the next ID; callers hold jobsMu
+func registerJob(operator, kind, server, description, status string) *Job {
+	nextJobID++
+	job := &Job{
+		ID:          fmt.Sprintf("job-%d", nextJobID),
+		Kind:        kind,
+		Server:      server,
+		Description: description,
+		Operator:    operator,
+		Status:      status,
+		StartedAt:   time.Now(),
+	}
+	if status == "queued" {
+		queuedAt := job.StartedAt
+		job.QueuedAt = &queuedAt
+	}
+	jobContexts[job.ID], jobCancels[job.ID] = context.WithCancel(context.Background())
+	jobs = append(jobs, job)
+	pruneJobs()
+	return job
+}
+
+// begin marks a queued job running once a worker picks it up. It reports false for a job
+// cancelled while it waited, which the worker drops.
+func (j *Job) begin() bool {
+	jobsMu.Lock()
+	if ctx, ok := jobContexts[j.ID]; !ok || ctx.Err() != nil {
+		jobsMu.Unlock()
+		return false
+	}
+	j.Status = "running"
+	j.StartedAt = time.Now()
+	if j.HeldBy != "" {
+		j.HeldBy, j.Progress = "", ""
+	}
+	j.armTimeout()
+	snapshot := j.snapshot()
+	jobsMu.Unlock()
+
+	publishEvent("job.started", snapshot)
+	return true
+}
+
+// context is cancelled when the job is; pass it to the commands the job runs
+func (j *Job) context() context.Context {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if ctx, ok := jobContexts[j.ID]; ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// followCancel cancels the job once parent is cancelled, e.g. an install started by a
+// queued request; call the returned stop once the job finished
+func (j *Job) followCancel(parent *Job) (stop func() bool) {
+	return context.AfterFunc(parent.context(), func() {
+		cancelled, _ := findJob(parent.ID)
+		cancelJob(j.ID, cancelled.CancelledBy)
+	})
+}
+
+// progress records what the job is doing now
+func (j *Job) progress(message string) {
+	jobsMu.Lock()
+	j.Progress = message
+	snapshot := j.snapshot()
+	jobsMu.Unlock()
+
+	publishEvent("job.progress", snapshot)
+}
+
+// stepProgress records that the job reached step number step of count, from 1
+func (j *Job) stepProgress(step, count int, name string) {
+	jobsMu.Lock()
+	j.Step, j.Steps = step, count
+	j.Progress = fmt.Sprintf("step %d/%d: %s", step, count, name)
+	snapshot := j.snapshot()
+	jobsMu.Unlock()
+
+	publishEvent("job.progress", snapshot)
+}
+
+// finish marks the job done; a nil error means it succeeded, and an error after the job was
+// cancelled marks it cancelled, or failed when it ran out of time. A job on one server, even a failed one, may have changed
+// it, so the server's managed baseline is re-captured; a rejected job never ran, so it is not.
+func (j *Job) finish(err error) {
+	jobsMu.Lock()
+	now := time.Now()
+	j.FinishedAt = &now
+	j.Status = "succeeded"
+	if err != nil {
+		j.Status = "failed"
+		j.Error = err.Error()
+		if ctx, ok := jobContexts[j.ID]; ok && ctx.Err() != nil {
+			j.Status = "cancelled"
+		}
+		if j.TimedOut {
+			j.Status = "failed"
+			j.Error = fmt.Sprintf("timed out after %s", j.Timeout())
+			if errors.Is(err, errCommandInterrupted) {
+				j.Error += "; the command was killed before it finished"
+			} else if !errors.Is(err, errCommandCancelled) {
+				j.Error += ": " + err.Error()
+			}
+		}
+	} else {
+		j.TimedOut = false
+	}
+	releaseJobContext(j.ID)
+	snapshot := j.snapshot()
+	jobsMu.Unlock()
+	releaseServer(snapshot.ID, snapshot.Server)
+
+	publishEvent("job.finished", snapshot)
+	closeJobOutput(snapshot.ID)
+	recordJobHistory(snapshot)
+	notifyJobFinished(snapshot)
+	if snapshot.Server != "" && !errors.Is(err, errJobRejected) {
+		recordManagedChange(snapshot.Server, snapshot.ID+": "+snapshot.Description)
+	}
+}
+
+// finishCommand marks a single-command job done, recording the exit code when the command ran
+func (j *Job) finishCommand(result CommandResult, err error) {
+	j.finish(j.commandOutcome(result, err))
+}
+
+// commandOutcome records the exit code of a single-command job when the command ran, and
+// returns the error the job finishes with
+func (j *Job) commandOutcome(result CommandResult, err error) error {
+	if err == nil {
+		jobsMu.Lock()
+		code := result.ExitCode
+		j.ExitCode = &code
+		jobsMu.Unlock()
+		if !result.OK() {
+			err = errors.New(result.Status())
+		}
+	}
+	return err
+}
+
+// addArtifacts records the files collected for the job
+func (j *Job) addArtifacts(artifacts []JobArtifact) {
+	jobsMu.Lock()
+	j.Artifacts = append(j.Artifacts, artifacts...)
+	jobsMu.Unlock()
+}
+
+// releaseJobContext forgets the context of a finished job; callers hold jobsMu
+func releaseJobContext(id string) {
+	if cancel, ok := jobCancels[id]; ok {
+		cancel()
+	}
+	if timer, ok := jobTimers[id]; ok {
+		timer.Stop()
+	}
+	delete(jobContexts, id)
+	delete(jobCancels, id)
+	delete(jobTimers, id)
+}
+
+// Errors returned by addJobNote and cancelJob
+var (
+	errJobNotFound   = errors.New("job not found")
+	errJobNotRunning = errors.New("notes can only be added while a job is pending, queued or running")
+	errJobFinished   = errors.New("the job has already finished")
+	// errJobDequeued is the error of a job cancelled before a worker picked it up
+	errJobDequeued = errors.New("cancelled before it started")
+)
+
+// cancelJob cancels a pending, queued or running job. A pending job is rejected and a queued
+// one dropped from the queue, and both finish straight away; a running job's current command is interrupted through its SSH
+// session and the job finishes as cancelled once it returns.
+func cancelJob(id, operator string) (Job, error) {
+	jobsMu.Lock()
+	var job *Job
+	for _, candidate := range jobs {
+		if candidate.ID == id {
+			job = candidate
+			break
+		}
+	}
+	if job == nil {
+		jobsMu.Unlock()
+		return Job{}, errJobNotFound
+	}
+	cancel, ok := jobCancels[id]
+	if !ok || (job.Status != "running" && job.Status != "queued" && job.Status != "pending") {
+		jobsMu.Unlock()
+		return Job{}, errJobFinished
+	}
+	if job.CancelledBy == "" {
+		job.CancelledBy = operator
+		if job.CancelledBy == "" {
+			job.CancelledBy = "anonymous"
+		}
+	}
+	// begin refuses a job whose context is cancelled, so a worker skips a queued one
+	cancel()
+	pending, queued := job.Status == "pending", job.Status == "queued"
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	fmt.Printf("🛑 %s cancelled by %s\n", id, snapshot.CancelledBy)
+	if pending {
+		dropPendingApproval(id)
+		job.finish(errJobRejected)
+		snapshot, _ = findJob(id)
+		return snapshot, nil
+	}
+	if queued {
+		job.finish(errJobDequeued)
+		snapshot, _ = findJob(id)
+		return snapshot, nil
+	}
+	publishEvent("job.cancelling", snapshot)
+	return snapshot, nil
+}
+
+// addJobNote pins a note to a running job so whoever picks it up next sees it, and
+// announces it on the event stream
+func addJobNote(id, author, text string) (Job, error) {
+	jobsMu.Lock()
+	var job *Job
+	for _, candidate := range jobs {
+		if candidate.ID == id {
+			job = candidate
+			break
+		}
+	}
+	if job == nil {
+		jobsMu.Unlock()
+		return Job{}, errJobNotFound
+	}
+	if job.Status != "running" && job.Status != "queued" && job.Status != "pending" {
+		jobsMu.Unlock()
+		return Job{}, errJobNotRunning
+	}
+	note := JobNote{Author: author, Text: text, CreatedAt: time.Now()}
+	job.Notes = append(job.Notes, note)
+	if len(job.Notes) > maxJobNotes {
+		job.Notes = job.Notes[len(job.Notes)-maxJobNotes:]
+	}
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	fmt.Printf("📌 Note on %s by %s: %s\n", id, author, text)
+	publishEvent("job.note", map[string]interface{}{"job": id, "note": note})
+	return snapshot, nil
+}
+
+// setJobNotify overrides whether a queued or running job is notified about when it
+// finishes; an empty value follows the global setting again
+func setJobNotify(id, notify string) (Job, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, job := range jobs {
+		if job.ID != id {
+			continue
+		}
+		if job.Status != "running" && job.Status != "queued" && job.Status != "pending" {
+			return Job{}, errJobFinished
+		}
+		job.Notify = notify
+		return job.snapshot(), nil
+	}
+	return Job{}, errJobNotFound
+}
+
+// validateJobNote trims a note and checks it has an author, the user adding it, and fits
+// maxJobNoteLength
+func validateJobNote(author, text string) (string, string, error) {
+	author, text = strings.TrimSpace(author), strings.TrimSpace(text)
+	switch {
+	case author == "":
+		return "", "", errors.New("author is required")
+	case text == "":
+		return "", "", errors.New("text is required")
+	case utf8.RuneCountInString(text) > maxJobNoteLength:
+		return "", "", fmt.Errorf("text is longer than %d characters", maxJobNoteLength)
+	}
+	return author, text, nil
+}
+
+// snapshot copies the job so the copy can be read without jobsMu; callers hold jobsMu
+func (j *Job) snapshot() Job {
+	copied := *j
+	copied.Notes = append([]JobNote(nil), j.Notes...)
+	copied.Artifacts = append([]JobArtifact(nil), j.Artifacts...)
+	copied.Targets = append([]string(nil), j.Targets...)
+	return copied
+}
+
+// pruneJobs drops the oldest finished jobs beyond maxJobHistory, with their results; their
+// artifacts stay with the history. Callers hold jobsMu.
+func pruneJobs() {
+	for len(jobs) > maxJobHistory {
+		removed := false
+		for i, job := range jobs {
+			if job.Status != "running" && job.Status != "queued" && job.Status != "pending" {
+				dropJobResult(job.ID)
+				dropJobOutput(job.ID)
+				jobs = append(jobs[:i], jobs[i+1:]...)
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			return
+		}
+	}
+}
+
+// jobsSnapshot returns copies of the known jobs, newest first
+func jobsSnapshot() []Job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	snapshot := make([]Job, 0, len(jobs))
+	for i := len(jobs) - 1; i >= 0; i-- {
+		snapshot = append(snapshot, jobs[i].snapshot())
+	}
+	return snapshot
+}
+
+// firstLine shortens a multi-line command to a one-line job description
+func firstLine(command string) string {
+	command = strings.TrimSpace(command)
+	if i := strings.IndexByte(command, '\n'); i >= 0 {
+		return command[:i] + " …"
+	}
+	return command
+}
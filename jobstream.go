@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxJobOutputLines caps the live output kept per job; the oldest lines are dropped first
+const maxJobOutputLines = 5000
+
+// jobOutput is the live output of one job. Lines are numbered from 1 across the whole run,
+// so a client resuming after dropped lines still gets consistent IDs.
+type jobOutput struct {
+	lines   []OutputLine
+	dropped int
+	done    bool
+	// listeners are woken, without blocking, whenever lines arrive or the job finishes
+	listeners map[chan struct{}]struct{}
+}
+
+var (
+	jobOutputsMu sync.Mutex
+	jobOutputs   = make(map[string]*jobOutput)
+)
+
+// outputFor returns the job's output, creating it; callers hold jobOutputsMu
+func outputFor(id string) *jobOutput {
+	output, ok := jobOutputs[id]
+	if !ok {
+		output = &jobOutput{listeners: make(map[chan struct{}]struct{})}
+		jobOutputs[id] = output
+	}
+	return output
+}
+
+// wake signals every listener; callers hold jobOutputsMu
+func (o *jobOutput) wake() {
+	for listener := range o.listeners {
+		select {
+		case listener <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// output records one line of the job's live output and its log on disk. Tracked-step
+// markers are bookkeeping for the final log and are left out; numbered steps also update
+// the job's progress.
+func (j *Job) output(line OutputLine) {
+	if strings.HasPrefix(strings.TrimSpace(line.Text), trackedMarker) {
+		return
+	}
+	if line.Stream == "step" {
+		if step, count, name, ok := parseNumberedStep(line.Text); ok {
+			j.stepProgress(step, count, name)
+		}
+	}
+	jobOutputsMu.Lock()
+	defer jobOutputsMu.Unlock()
+	output := outputFor(j.ID)
+	if !output.done {
+		appendJobLog(j.ID, line)
+	}
+	output.lines = append(output.lines, line)
+	if len(output.lines) > maxJobOutputLines {
+		drop := len(output.lines) - maxJobOutputLines
+		output.lines = output.lines[drop:]
+		output.dropped += drop
+	}
+	output.wake()
+}
+
+// teeOutput sends each line to the job's own output and to also, when set
+func (j *Job) teeOutput(also liveOutput) liveOutput {
+	return func(line OutputLine) {
+		j.output(line)
+		if also != nil {
+			also(line)
+		}
+	}
+}
+
+// prefixedOutput labels each line before passing it on, e.g. with the server of a group run
+func prefixedOutput(prefix string, live liveOutput) liveOutput {
+	if live == nil {
+		return nil
+	}
+	return func(line OutputLine) {
+		line.Text = prefix + line.Text
+		live(line)
+	}
+}
+
+// closeJobOutput ends the job's stream once it finished
+func closeJobOutput(id string) {
+	jobOutputsMu.Lock()
+	defer jobOutputsMu.Unlock()
+	output := outputFor(id)
+	output.done = true
+	output.wake()
+}
+
+// dropJobOutput forgets the output of a pruned job
+func dropJobOutput(id string) {
+	jobOutputsMu.Lock()
+	defer jobOutputsMu.Unlock()
+	delete(jobOutputs, id)
+}
+
+// jobOutputSince returns the lines numbered after afterID, the number of the last one and
+// whether the job finished
+func jobOutputSince(id string, afterID int) ([]OutputLine, int, bool) {
+	jobOutputsMu.Lock()
+	defer jobOutputsMu.Unlock()
+	output := outputFor(id)
+	last := output.dropped + len(output.lines)
+	start := max(afterID-output.dropped, 0)
+	if start >= len(output.lines) {
+		return nil, last, output.done
+	}
+	return append([]OutputLine(nil), output.lines[start:]...), last, output.done
+}
+
+// listenJobOutput registers a listener for new lines of the job
+func listenJobOutput(id string) (chan struct{}, func()) {
+	listener := make(chan struct{}, 1)
+	jobOutputsMu.Lock()
+	outputFor(id).listeners[listener] = struct{}{}
+	jobOutputsMu.Unlock()
+	return listener, func() {
+		jobOutputsMu.Lock()
+		delete(outputFor(id).listeners, listener)
+		jobOutputsMu.Unlock()
+	}
+}
+
+// jobStreamHandler streams a job's output as server-sent events: a "line" event per output
+// line, with its number as the event ID, then a "done" event with the finished job. Clients
+// resume with Last-Event-ID (or ?last_event_id=) like on /events.
+func jobStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	id := r.FormValue("id")
+	if !jobAllowed(w, r, id) {
+		return
+	}
+	if _, ok := findJob(id); !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	afterID, _ := strconv.Atoi(lastID)
+
+	listener, stop := listenJobOutput(id)
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		lines, last, done := jobOutputSince(id, afterID)
+		for i, line := range lines {
+			data, _ := json.Marshal(line)
+			fmt.Fprintf(w, "id: %d\nevent: line\ndata: %s\n\n", last-len(lines)+i+1, data)
+		}
+		afterID = max(afterID, last)
+		if done {
+			job, _ := findJob(id)
+			data, _ := json.Marshal(APIJob(job))
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-listener:
+		}
+	}
+}
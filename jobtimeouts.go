@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxJobTimeout caps the time limit a job may ask for
+const maxJobTimeout = 24 * time.Hour
+
+var (
+	// defaultJobTimeout limits jobs that set no timeout of their own; 0 means no limit
+	defaultJobTimeout = 2 * time.Hour
+	// jobTimers stop running jobs at their time limit; guarded by jobsMu
+	jobTimers = make(map[string]*time.Timer)
+)
+
+// parseJobTimeout reads a job's timeout from a form or API request, such as "10s", "30m",
+// "1h30m" or a number of seconds. An empty value means the default.
+func parseJobTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := time.ParseDuration(value)
+	if seconds, convErr := strconv.Atoi(value); convErr == nil {
+		limit, err = time.Duration(seconds)*time.Second, nil
+	}
+	if err != nil || limit < time.Second || limit > maxJobTimeout {
+		return 0, fmt.Errorf("invalid timeout %q; use e.g. 10s, 30m or 2h, up to %g hours", value, maxJobTimeout.Hours())
+	}
+	return limit.Round(time.Second), nil
+}
+
+// Timeout returns the job's time limit, its own or the default
+func (j Job) Timeout() time.Duration {
+	if j.TimeoutSeconds > 0 {
+		return time.Duration(j.TimeoutSeconds) * time.Second
+	}
+	return defaultJobTimeout
+}
+
+// armTimeout starts the job's time limit from now, replacing any earlier one; callers
+// hold jobsMu
+func (j *Job) armTimeout() {
+	if timer, ok := jobTimers[j.ID]; ok {
+		timer.Stop()
+		delete(jobTimers, j.ID)
+	}
+	if limit := j.Timeout(); limit > 0 {
+		id := j.ID
+		jobTimers[id] = time.AfterFunc(limit, func() { timeoutJob(id) })
+	}
+}
+
+// setTimeout gives the job its own time limit. A running job's limit restarts from now; a
+// queued job's starts once a worker picks it up. Zero keeps the default.
+func (j *Job) setTimeout(limit time.Duration) {
+	if limit <= 0 {
+		return
+	}
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	j.TimeoutSeconds = int(limit / time.Second)
+	if j.Status == "running" {
+		j.armTimeout()
+	}
+}
+
+// timeoutJob stops a job that ran past its time limit: its current command is interrupted
+// as for cancelJob, but the job finishes as failed
+func timeoutJob(id string) {
+	jobsMu.Lock()
+	var job *Job
+	for _, candidate := range jobs {
+		if candidate.ID == id {
+			job = candidate
+			break
+		}
+	}
+	if job == nil || job.Status != "running" || job.CancelledBy != "" {
+		jobsMu.Unlock()
+		return
+	}
+	job.TimedOut = true
+	cancel := jobCancels[id]
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	fmt.Printf("⏱️ %s timed out after %s\n", id, snapshot.Timeout())
+	publishEvent("job.timeout", snapshot)
+	if cancel != nil {
+		cancel()
+	}
+}
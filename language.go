@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Language package manager backends, for tools published to PyPI, npm or RubyGems rather
+// than the distribution
+const (
+	backendPip = "pip"
+	backendNpm = "npm"
+	backendGem = "gem"
+)
+
+// languageBackends lists the language backends in the order catalog entries prefer them
+var languageBackends = []string{backendPip, backendNpm, backendGem}
+
+var (
+	// pipNamePattern matches PyPI project names such as httpie or ansible-core
+	pipNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+	// npmNamePattern matches npm package names, optionally scoped, e.g. @angular/cli
+	npmNamePattern = regexp.MustCompile(`^(@[a-z0-9][a-z0-9._-]*/)?[a-z0-9][a-z0-9._-]*$`)
+	// gemNamePattern matches gem names such as bundler or rails
+	gemNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// languageNamePatterns maps each language backend to its package name pattern
+var languageNamePatterns = map[string]*regexp.Regexp{
+	backendPip: pipNamePattern,
+	backendNpm: npmNamePattern,
+	backendGem: gemNamePattern,
+}
+
+// languageRuntimes are the distribution packages providing each language package manager,
+// keyed by backend and then by package manager
+var languageRuntimes = map[string]map[string][]string{
+	backendPip: {
+		"apt": {"python3-pip"}, "apk": {"py3-pip"}, "dnf": {"python3-pip"}, "yum": {"python3-pip"},
+		"pacman": {"python-pip"}, "zypper": {"python3-pip"},
+	},
+	backendNpm: {
+		"apt": {"nodejs", "npm"}, "apk": {"nodejs", "npm"}, "dnf": {"nodejs", "npm"}, "yum": {"nodejs", "npm"},
+		"pacman": {"nodejs", "npm"}, "zypper": {"nodejs", "npm"},
+	},
+	backendGem: {
+		"apt": {"ruby"}, "apk": {"ruby"}, "dnf": {"ruby", "rubygems"}, "yum": {"ruby", "rubygems"},
+		"pacman": {"ruby", "rubygems"}, "zypper": {"ruby"},
+	},
+}
+
+// languageCommands are the binaries whose absence triggers the runtime install
+var languageCommands = map[string]string{backendPip: "pip3", backendNpm: "npm", backendGem: "gem"}
+
+// isLanguageBackend reports whether backend installs through pip, npm or gem
+func isLanguageBackend(backend string) bool {
+	_, ok := languageNamePatterns[backend]
+	return ok
+}
+
+// parseLanguageSpec splits "name" or "name=version" for a language backend and validates
+// both parts; versions follow package specs, so a trailing .* accepts any matching release
+func parseLanguageSpec(backend, spec string) (string, string, error) {
+	name, version, err := parsePackageSpec(spec)
+	if err != nil {
+		return "", "", err
+	}
+	if !languageNamePatterns[backend].MatchString(name) {
+		return "", "", fmt.Errorf("invalid %s package name %q", backend, name)
+	}
+	return name, version, nil
+}
+
+// languageBootstrap installs the runtime and package manager for backend with the
+// distribution's package manager when its command is missing
+func languageBootstrap(backend string, manager PackageManager, verbosity string) (string, error) {
+	packages, ok := languageRuntimes[backend][manager.Name()]
+	if !ok {
+		return "", fmt.Errorf("%s is not supported with %s", backend, manager.Name())
+	}
+	return "command -v " + languageCommands[backend] + " >/dev/null 2>&1 || { " +
+		manager.Update(verbosity) + " && " + manager.Install(packages, verbosity) + "; }", nil
+}
+
+// languageVersion translates a package spec version for backend: pip keeps ==1.2.*, npm
+// uses 1.2.x and gem a pessimistic ~> 1.2.0
+func languageVersion(backend, version string) string {
+	prefix, wildcard := wildcardVersion(version)
+	switch {
+	case backend == backendPip:
+		return "==" + version
+	case wildcard && backend == backendNpm:
+		return prefix + ".x"
+	case wildcard && backend == backendGem:
+		return "~> " + prefix + ".0"
+	}
+	return version
+}
+
+// languageInstall installs one package globally. pip installs system-wide into
+// /usr/local, past the externally-managed marker newer distributions set, since these
+// are tools for every user rather than libraries for one project.
+func languageInstall(selection softwareSelection, verbosity string) string {
+	name := selection.LanguagePackage
+	switch selection.Backend {
+	case backendPip:
+		spec := name
+		if selection.Version != "" {
+			spec += languageVersion(backendPip, selection.Version)
+		}
+		return "PIP_BREAK_SYSTEM_PACKAGES=1 PIP_ROOT_USER_ACTION=ignore pip3 install " +
+			verbosityFlag(verbosity, "-q", "-v") + "--upgrade " + shellQuote(spec)
+	case backendNpm:
+		spec := name
+		if selection.Version != "" {
+			spec += "@" + languageVersion(backendNpm, selection.Version)
+		}
+		return "npm install -g " + verbosityFlag(verbosity, "--silent", "--loglevel=verbose") + shellQuote(spec)
+	}
+	command := "gem install " + verbosityFlag(verbosity, "--quiet", "--verbose") + "--no-document " + shellQuote(name)
+	if selection.Version != "" {
+		command += " -v " + shellQuote(languageVersion(backendGem, selection.Version))
+	}
+	return command
+}
+
+// languageRemove uninstalls global packages of one backend
+func languageRemove(backend string, names []string, verbosity string) string {
+	switch backend {
+	case backendPip:
+		return "PIP_BREAK_SYSTEM_PACKAGES=1 PIP_ROOT_USER_ACTION=ignore pip3 uninstall " + verbosityFlag(verbosity, "-q", "-v") + "-y " + quotedPackages(names)
+	case backendNpm:
+		return "npm uninstall -g " + verbosityFlag(verbosity, "--silent", "--loglevel=verbose") + quotedPackages(names)
+	}
+	return "gem uninstall " + verbosityFlag(verbosity, "--quiet", "--verbose") + "-a -x " + quotedPackages(names)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Users without a local password can sign in with their LDAP or Active Directory one. The
+// app binds with its service account, searches the base DN for the user with the user
+// filter, and binds again as the entry it found to check the password. The entry's group
+// attribute, memberOf by default, and the groups the group filter finds list the user's
+// groups, and the group mappings admins keep on the web UI users page give them a role, at
+// every sign-in. Like single sign-on users, directory users are kept as web UI users
+// without a password.
+
+// ldapProvider marks web UI users that sign in with the directory
+const ldapProvider = "ldap"
+
+// ldapTimeout limits a whole sign-in against the directory
+const ldapTimeout = 10 * time.Second
+
+var (
+	// ldapURL is the directory server, ldap://host[:389] or ldaps://host[:636]
+	ldapURL string
+	// ldapStartTLS upgrades an ldap:// connection with StartTLS before binding
+	ldapStartTLS bool
+	// ldapCAFile is a PEM file of the CA certificates to trust the server's certificate with,
+	// instead of the system's
+	ldapCAFile string
+	// ldapBindDN and ldapBindPassword are the service account that searches for users;
+	// empty binds anonymously
+	ldapBindDN, ldapBindPassword string
+	// ldapBaseDN is where users and groups are searched
+	ldapBaseDN string
+	// ldapUserFilter finds the user signing in; {username} is replaced with the user name
+	ldapUserFilter = "(&(objectClass=person)(uid={username}))"
+	// ldapGroupAttribute is the user entry's attribute that lists the DNs of its groups
+	ldapGroupAttribute = "memberOf"
+	// ldapGroupFilter, when set, finds more of the user's groups; {dn} is replaced with the
+	// user's DN and {username} with the user name
+	ldapGroupFilter string
+)
+
+// ldapEnabled reports whether users can sign in with the directory
+func ldapEnabled() bool {
+	return ldapURL != ""
+}
+
+// validateLDAPFlags checks the LDAP flags before anything is served
+func validateLDAPFlags() error {
+	if !ldapEnabled() {
+		return nil
+	}
+	u, err := url.Parse(ldapURL)
+	switch {
+	case err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "":
+		return errors.New("-ldap-url must be ldap://host[:port] or ldaps://host[:port]")
+	case ldapStartTLS && u.Scheme == "ldaps":
+		return errors.New("-ldap-starttls is for ldap:// URLs; ldaps:// is TLS already")
+	case ldapBaseDN == "":
+		return errors.New("-ldap-base-dn is required with -ldap-url")
+	case !strings.Contains(ldapUserFilter, "{username}"):
+		return errors.New("-ldap-user-filter must contain {username}")
+	}
+	for _, filter := range []string{ldapUserFilter, ldapGroupFilter} {
+		if filter == "" {
+			continue
+		}
+		if _, err := ldap.CompileFilter(strings.NewReplacer("{username}", "x", "{dn}", "x").Replace(filter)); err != nil {
+			return fmt.Errorf("LDAP filter %s: %w", filter, err)
+		}
+	}
+	if _, err := ldapTLSConfig(""); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ldapTLSConfig returns the TLS configuration to reach the directory server at host with
+func ldapTLSConfig(host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if ldapCAFile != "" {
+		pem, err := os.ReadFile(ldapCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading -ldap-ca-file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("-ldap-ca-file holds no PEM certificates")
+		}
+	}
+	return config, nil
+}
+
+// ldapSignIn checks a user's directory password and returns their groups
+func ldapSignIn(name, password string) ([]string, error) {
+	if password == "" {
+		// an empty password would be an unauthenticated bind, which servers accept
+		return nil, errors.New("empty password")
+	}
+	conn, err := dialLDAP()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := bindService(conn); err != nil {
+		return nil, fmt.Errorf("binding as the service account: %w", err)
+	}
+	filter := strings.ReplaceAll(ldapUserFilter, "{username}", ldap.EscapeFilter(name))
+	entries, err := searchLDAP(conn, filter, []string{ldapGroupAttribute})
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("searching for the user: %w", err)
+	case len(entries) == 0:
+		return nil, errors.New("no such user")
+	case len(entries) > 1:
+		return nil, fmt.Errorf("the user filter matches %d entries", len(entries))
+	}
+	user := entries[0]
+	if err := conn.Bind(user.DN, password); err != nil {
+		return nil, err
+	}
+	groups := user.GetEqualFoldAttributeValues(ldapGroupAttribute)
+	if ldapGroupFilter != "" {
+		if err := bindService(conn); err != nil {
+			return nil, fmt.Errorf("binding as the service account: %w", err)
+		}
+		filter := strings.NewReplacer("{dn}", ldap.EscapeFilter(user.DN), "{username}", ldap.EscapeFilter(name)).Replace(ldapGroupFilter)
+		found, err := searchLDAP(conn, filter, []string{"1.1"})
+		if err != nil {
+			return nil, fmt.Errorf("searching for the user's groups: %w", err)
+		}
+		for _, group := range found {
+			groups = append(groups, group.DN)
+		}
+	}
+	return groups, nil
+}
+
+// ldapGroupMatches reports whether a mapped group names a group DN: the whole DN, or the
+// value of its first component, e.g. ops-admins for cn=ops-admins,ou=groups,dc=example,dc=com
+func ldapGroupMatches(mapped, dn string) bool {
+	if strings.EqualFold(mapped, dn) {
+		return true
+	}
+	first, _, _ := strings.Cut(dn, ",")
+	_, value, ok := strings.Cut(first, "=")
+	return ok && strings.EqualFold(mapped, strings.TrimSpace(value))
+}
+
+// ldapAuthenticate signs a user in with their directory password, as the web UI user of
+// the same name with the role their groups map to
+func ldapAuthenticate(name, password string) bool {
+	groups, err := ldapSignIn(name, password)
+	if err != nil {
+		fmt.Printf("🔒 Directory sign-in as %q refused: %v\n", name, err)
+		return false
+	}
+	role := groupRole(providerGroups(ldapProvider), groups, ldapGroupMatches)
+	if role == "" {
+		fmt.Printf("🔒 Directory sign-in as %q refused: in no group that is given a role\n", name)
+		return false
+	}
+	if user, exists := webUser(name); exists && user.Provider != ldapProvider {
+		fmt.Printf("🔒 Directory sign-in as %q refused: the user signs in with %s\n", name, user.Provider)
+		return false
+	}
+	if err := saveProviderUser(name, ldapProvider, role); err != nil {
+		fmt.Println("❌ Saving settings:", err)
+	}
+	return true
+}
+
+// dialLDAP connects to the directory server, with TLS when it is configured
+func dialLDAP() (*ldap.Conn, error) {
+	u, _ := url.Parse(ldapURL)
+	config, err := ldapTLSConfig(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ldap.DialURL(ldapURL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}), ldap.DialWithTLSConfig(config))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if ldapStartTLS {
+		if err := conn.StartTLS(config); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bindService binds as the service account, or anonymously when there is none
+func bindService(conn *ldap.Conn) error {
+	if ldapBindDN == "" && ldapBindPassword == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(ldapBindDN, ldapBindPassword)
+}
+
+// searchLDAP returns the entries under the base DN that filter matches, with the attributes
+// asked for
+func searchLDAP(conn *ldap.Conn, filter string, attributes []string) ([]*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(ldapBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		100, int(ldapTimeout/time.Second), false, filter, attributes, nil)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
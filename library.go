@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bundleFormat identifies library bundles; importers reject other values
+const bundleFormat = "accmgr4-library/1"
+
+const (
+	// librarySigningKeyFile holds this instance's Ed25519 seed, created on first export
+	librarySigningKeyFile = "library_signing.key"
+	// maxBundleSize caps uploaded and fetched bundles
+	maxBundleSize = 4 << 20
+	// directoryFetchTimeout bounds one request to a template directory
+	directoryFetchTimeout = 30 * time.Second
+)
+
+// LibrarySettings controls sharing catalog entries and profile templates between instances
+type LibrarySettings struct {
+	// TrustedKeys are base64 Ed25519 public keys whose bundles may be imported; bundles
+	// signed by this instance are always trusted
+	TrustedKeys []string `json:"trusted_keys,omitempty"`
+	// DirectoryURL is an optional JSON index of shared bundles, see DirectoryEntry
+	DirectoryURL string `json:"directory_url,omitempty"`
+	// Sync keeps the catalog and recipes in step with a shared source
+	Sync CatalogSyncSettings `json:"sync,omitempty"`
+}
+
+// Bundle is the shareable content of a library export. Profiles carry only their template
+// and packages: server and group targets and locks are specific to one deployment.
+type Bundle struct {
+	Format      string       `json:"format"`
+	Origin      string       `json:"origin,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Catalog     []Software   `json:"catalog,omitempty"`
+	EnvProfiles []EnvProfile `json:"env_profiles,omitempty"`
+}
+
+// SignedBundle is the file format: the bundle's JSON and a signature over its compact form,
+// so the file can be re-indented without breaking the signature
+type SignedBundle struct {
+	Bundle    json.RawMessage `json:"bundle"`
+	PublicKey string          `json:"public_key"`
+	Signature string          `json:"signature"`
+}
+
+// DirectoryEntry is one bundle listed by a template directory
+type DirectoryEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url"`
+}
+
+// ImportSummary describes what an import changed
+type ImportSummary struct {
+	Added    []string
+	Replaced []string
+	Skipped  []string
+}
+
+var librarySigningMu sync.Mutex
+
+// librarySigningKey loads this instance's signing key, creating it on first use
+func librarySigningKey() (ed25519.PrivateKey, error) {
+	librarySigningMu.Lock()
+	defer librarySigningMu.Unlock()
+
+	data, err := os.ReadFile(librarySigningKeyFile)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%s is not a valid signing key", librarySigningKeyFile)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key.Seed()) + "\n"
+	if err := os.WriteFile(librarySigningKeyFile, []byte(encoded), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// libraryPublicKey returns this instance's public key in the form TrustedKeys uses
+func libraryPublicKey() (string, error) {
+	key, err := librarySigningKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
+
+// exportBundle signs the catalog entries from settings and the environment profile templates
+func exportBundle(origin string) (SignedBundle, error) {
+	bundle := Bundle{Format: bundleFormat, Origin: origin, CreatedAt: time.Now().UTC(), Catalog: sharedCatalog()}
+	envProfilesMu.Lock()
+	for _, profile := range settings.EnvProfiles {
+		bundle.EnvProfiles = append(bundle.EnvProfiles, EnvProfile{
+			Name:     profile.Name,
+			Target:   profile.Target,
+			Template: profile.Template,
+			Packages: profile.Packages,
+		})
+	}
+	envProfilesMu.Unlock()
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return SignedBundle{}, err
+	}
+	key, err := librarySigningKey()
+	if err != nil {
+		return SignedBundle{}, err
+	}
+	return SignedBundle{
+		Bundle:    data,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	}, nil
+}
+
+// verifyBundle checks the signature and that the signer is trusted, then decodes the bundle
+func verifyBundle(signed SignedBundle) (Bundle, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(signed.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return Bundle{}, errors.New("the bundle has no valid public key")
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, signed.Bundle); err != nil {
+		return Bundle{}, fmt.Errorf("decoding the bundle: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(publicKey, compact.Bytes(), signature) {
+		return Bundle{}, errors.New("the bundle signature does not match its content")
+	}
+	own, err := libraryPublicKey()
+	if err != nil {
+		return Bundle{}, err
+	}
+	if signed.PublicKey != own && !slices.Contains(settings.Library.TrustedKeys, signed.PublicKey) {
+		return Bundle{}, fmt.Errorf("the bundle is signed by %s, which is not a trusted key", signed.PublicKey)
+	}
+
+	var bundle Bundle
+	if err := json.Unmarshal(signed.Bundle, &bundle); err != nil {
+		return Bundle{}, fmt.Errorf("decoding the bundle: %w", err)
+	}
+	if bundle.Format != bundleFormat {
+		return Bundle{}, fmt.Errorf("unsupported bundle format %q", bundle.Format)
+	}
+	return bundle, nil
+}
+
+// validateBundle rejects entries that the software and environment pages would not accept
+func validateBundle(bundle Bundle) error {
+	for _, entry := range bundle.Catalog {
+		if entry.Hidden {
+			return fmt.Errorf("catalog entry %s is hidden; hidden entries are not shared", entry.Name)
+		}
+		if err := validateSoftware(entry); err != nil {
+			return fmt.Errorf("catalog entry %q: %w", entry.Name, err)
+		}
+	}
+	for _, profile := range bundle.EnvProfiles {
+		if !profileNamePattern.MatchString(profile.Name) {
+			return fmt.Errorf("invalid profile name %q", profile.Name)
+		}
+		if profile.Target != "environment" && profile.Target != "profile.d" {
+			return fmt.Errorf("profile %s has an invalid target", profile.Name)
+		}
+		if _, err := profile.render("", ServerInfo{}); err != nil {
+			return fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+	}
+	return nil
+}
+
+// importBundle merges a verified bundle into the settings. Existing entries are replaced
+// only when overwrite is set; imported profiles keep the local targets and locks.
+func importBundle(bundle Bundle, overwrite bool) (ImportSummary, error) {
+	if err := validateBundle(bundle); err != nil {
+		return ImportSummary{}, err
+	}
+
+	var summary ImportSummary
+	for _, entry := range bundle.Catalog {
+		label := "software " + entry.Name
+		i := slices.IndexFunc(settings.Catalog, func(s Software) bool { return s.Name == entry.Name })
+		switch {
+		case i < 0:
+			settings.Catalog = append(settings.Catalog, entry)
+			summary.Added = append(summary.Added, label)
+		case overwrite:
+			settings.Catalog[i] = entry
+			summary.Replaced = append(summary.Replaced, label)
+		default:
+			summary.Skipped = append(summary.Skipped, label)
+		}
+	}
+
+	envProfilesMu.Lock()
+	for _, profile := range bundle.EnvProfiles {
+		label := "profile " + profile.Name
+		existing, i, ok := findEnvProfile(profile.Name)
+		switch {
+		case !ok:
+			settings.EnvProfiles = append(settings.EnvProfiles, EnvProfile{Name: profile.Name, Target: profile.Target, Template: profile.Template, Packages: profile.Packages})
+			summary.Added = append(summary.Added, label)
+		case overwrite:
+			existing.Target, existing.Template, existing.Packages = profile.Target, profile.Template, profile.Packages
+			settings.EnvProfiles[i] = existing
+			summary.Replaced = append(summary.Replaced, label)
+		default:
+			summary.Skipped = append(summary.Skipped, label)
+		}
+	}
+	envProfilesMu.Unlock()
+
+	return summary, saveSettings()
+}
+
+// readSignedBundle decodes a bundle file of at most maxBundleSize bytes
+func readSignedBundle(r io.Reader) (SignedBundle, error) {
+	var signed SignedBundle
+	data, err := io.ReadAll(io.LimitReader(r, maxBundleSize+1))
+	if err != nil {
+		return signed, err
+	}
+	if len(data) > maxBundleSize {
+		return signed, errors.New("the bundle is too large")
+	}
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return signed, fmt.Errorf("not a library bundle: %w", err)
+	}
+	return signed, nil
+}
+
+// fetchURL GETs a directory index or bundle
+func fetchURL(target string) (io.ReadCloser, error) {
+	client := &http.Client{Timeout: directoryFetchTimeout}
+	resp, err := client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// fetchDirectory reads the configured template directory index. Relative bundle URLs are
+// resolved against the index URL.
+func fetchDirectory() ([]DirectoryEntry, error) {
+	base, err := url.Parse(settings.Library.DirectoryURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := fetchURL(base.String())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var entries []DirectoryEntry
+	if err := json.NewDecoder(io.LimitReader(body, maxBundleSize)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("reading the directory index: %w", err)
+	}
+	for i, entry := range entries {
+		ref, err := url.Parse(entry.URL)
+		if err != nil {
+			return nil, fmt.Errorf("directory entry %s: %w", entry.Name, err)
+		}
+		entries[i].URL = base.ResolveReference(ref).String()
+	}
+	return entries, nil
+}
+
+// libraryHandler shows the export, import and directory options
+func libraryHandler(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := libraryPublicKey()
+	if err != nil {
+		http.Error(w, "Error loading the signing key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"PublicKey":    publicKey,
+		"TrustedKeys":  settings.Library.TrustedKeys,
+		"DirectoryURL": settings.Library.DirectoryURL,
+		"Catalog":      sharedCatalog(),
+		"Profiles":     settings.EnvProfiles,
+		"Sync":         settings.Library.Sync,
+	}
+	catalogSyncMu.Lock()
+	data["SyncState"] = catalogSyncState
+	catalogSyncMu.Unlock()
+	if settings.Library.DirectoryURL != "" {
+		entries, err := fetchDirectory()
+		data["Directory"] = entries
+		if err != nil {
+			data["DirectoryError"] = err.Error()
+		}
+	}
+	renderTemplate(w, r, "templates/library.html", data)
+}
+
+// exportLibraryHandler downloads a signed bundle
+func exportLibraryHandler(w http.ResponseWriter, r *http.Request) {
+	signed, err := exportBundle(externalURL(r, "/"))
+	if err != nil {
+		http.Error(w, "Error exporting the library: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=accmgr4-library-"+time.Now().Format("20060102-150405")+".json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(signed)
+}
+
+// importLibraryHandler imports an uploaded bundle, or one listed in the template directory
+func importLibraryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var signed SignedBundle
+	var source string
+	if directoryURL := r.FormValue("directory_url"); directoryURL != "" {
+		// Only bundles the configured directory lists can be fetched
+		entries, err := fetchDirectory()
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		if !slices.ContainsFunc(entries, func(e DirectoryEntry) bool { return e.URL == directoryURL }) {
+			http.Error(w, "❌ The bundle is not listed in the template directory", http.StatusBadRequest)
+			return
+		}
+		body, err := fetchURL(directoryURL)
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		signed, err = readSignedBundle(body)
+		body.Close()
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		source = directoryURL
+	} else {
+		file, header, err := r.FormFile("bundle")
+		if err != nil {
+			http.Error(w, "A bundle file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if signed, err = readSignedBundle(file); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		source = header.Filename
+	}
+
+	bundle, err := verifyBundle(signed)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	summary, err := importBundle(bundle, r.FormValue("overwrite") == "on")
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString("📚 Library import from " + source + "\n\n")
+	if bundle.Origin != "" {
+		logBuilder.WriteString("Exported by " + bundle.Origin + " on " + bundle.CreatedAt.Format("2006-01-02 15:04") + "\n")
+	}
+	logBuilder.WriteString("Signed by " + signed.PublicKey + "\n\n")
+	for _, item := range summary.Added {
+		logBuilder.WriteString("✅ Added " + item + "\n")
+	}
+	for _, item := range summary.Replaced {
+		logBuilder.WriteString("♻️ Replaced " + item + "\n")
+	}
+	for _, item := range summary.Skipped {
+		logBuilder.WriteString("⏭️ Skipped " + item + ": it already exists (tick overwrite to replace it)\n")
+	}
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
+
+// updateLibrarySettingsHandler saves the trusted keys and the template directory URL
+func updateLibrarySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var keys []string
+	for _, key := range strings.Fields(r.FormValue("trusted_keys")) {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(decoded) != ed25519.PublicKeySize {
+			http.Error(w, "❌ Not an Ed25519 public key: "+key, http.StatusBadRequest)
+			return
+		}
+		keys = append(keys, key)
+	}
+	directoryURL := strings.TrimSpace(r.FormValue("directory_url"))
+	if directoryURL != "" {
+		if parsed, err := url.Parse(directoryURL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			http.Error(w, "❌ The directory URL must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+	}
+
+	settings.Library.TrustedKeys, settings.Library.DirectoryURL = keys, directoryURL
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/library"), http.StatusSeeOther)
+}
@@ -4,15 +4,16 @@ package main
 import (
 	"encoding/csv"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"html/template"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
-
-	"golang.org/x/crypto/ssh"
+	"sync"
 )
 
 type UserAccount struct {
@@ -21,13 +22,35 @@ type UserAccount struct {
 }
 
 type ServerInfo struct {
+	Name  string `json:"name,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Tags label servers for bulk operations, e.g. "rack-12"; a server can carry several
+	Tags         []string      `json:"tags,omitempty"`
 	RootUsername string        `json:"root_username"`
 	RootPassword string        `json:"root_password"`
 	Accounts     []UserAccount `json:"accounts"`
+	SSH          *SSHOptions   `json:"ssh,omitempty"`
+	// UseAgent authenticates with keys held by the local ssh-agent before trying the password
+	UseAgent bool `json:"use_agent,omitempty"`
+	// KeyFile is a private key on the management host. CertFile, when set, is an SSH
+	// certificate for that key signed by a CA the server trusts. Both are read on every
+	// connection, so renewed short-lived certificates are picked up without a restart.
+	KeyFile  string `json:"key_file,omitempty"`
+	CertFile string `json:"cert_file,omitempty"`
+	// Platform is "windows" for Windows hosts, which run PowerShell; empty means Linux
+	Platform string `json:"platform,omitempty"`
+	// RunAs is an optional unprivileged service account used for everyday logins
+	RunAs *RunAsUser `json:"run_as,omitempty"`
+	// SiteURL is the page the site monitor fetches for servers tagged "web"; empty means
+	// http://<ip>/
+	SiteURL string `json:"site_url,omitempty"`
 }
 
 var ipMap map[string]ServerInfo
 
+// ipMapMu guards ipMap against background pollers reading it while handlers update records
+var ipMapMu sync.RWMutex
+
 func loadIPMap() error {
 	file, err := os.Open("ipmap.json")
 	if err != nil {
@@ -49,71 +72,153 @@ func saveIPMap() error {
 		return err
 	}
 	defer file.Close()
+	ipMapMu.RLock()
 	err = json.NewEncoder(file).Encode(ipMap)
+	ipMapMu.RUnlock()
 	if err == nil {
 		file.Sync()
 	}
 	return err
 }
 
+// setServer stores a server record and persists the map
+func setServer(ip string, server ServerInfo) {
+	ipMapMu.Lock()
+	ipMap[ip] = server
+	ipMapMu.Unlock()
+	saveIPMap()
+}
+
+// lookupServer returns the record of the server with an IP address
+func lookupServer(ip string) (ServerInfo, bool) {
+	ipMapMu.RLock()
+	defer ipMapMu.RUnlock()
+	server, ok := lookupServer(ip)
+	return server, ok
+}
+
+// updateServer changes the record of a server and persists the map; it reports whether
+// there is such a server
+func updateServer(ip string, change func(*ServerInfo)) bool {
+	ipMapMu.Lock()
+	server, ok := lookupServer(ip)
+	if ok {
+		change(&server)
+		ipMap[ip] = server
+	}
+	ipMapMu.Unlock()
+	if ok {
+		saveIPMap()
+	}
+	return ok
+}
+
+// hasTag reports whether the server carries tag
+func (s ServerInfo) hasTag(tag string) bool {
+	return slices.Contains(s.Tags, tag)
+}
+
+// serverTags returns every tag in use, sorted
+func serverTags(servers map[string]ServerInfo) []string {
+	var tags []string
+	for _, server := range servers {
+		for _, tag := range server.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// serverGroups returns every group in use, sorted
+func serverGroups(servers map[string]ServerInfo) []string {
+	var groups []string
+	for _, server := range servers {
+		if server.Group != "" && !slices.Contains(groups, server.Group) {
+			groups = append(groups, server.Group)
+		}
+	}
+	slices.Sort(groups)
+	return groups
+}
+
+// serversSnapshot returns a copy of the server map that is safe to use from background goroutines
+func serversSnapshot() map[string]ServerInfo {
+	ipMapMu.RLock()
+	defer ipMapMu.RUnlock()
+	snapshot := make(map[string]ServerInfo, len(ipMap))
+	for ip, server := range ipMap {
+		snapshot[ip] = server
+	}
+	return snapshot
+}
+
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/index.html"))
-	tmpl.Execute(w, ipMap)
+	data := map[string]interface{}{
+		"Servers": requestServers(r),
+		"Health":  healthSnapshot(),
+		"Sites":   sitesSnapshot(),
+		"Alerts":  visibleAlerts(r.Context(), currentAlerts()),
+		"User":    requestOperator(r),
+		"Role":    requestRole(r),
+	}
+
+	renderTemplate(w, r, "templates/index.html", data)
 }
 
 func addIPHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		ip := strings.TrimSpace(r.FormValue("ip"))
+		name := strings.TrimSpace(r.FormValue("name"))
+		group := strings.TrimSpace(r.FormValue("group"))
+		tags := splitList(r.FormValue("tags"))
 		rootUser := strings.TrimSpace(r.FormValue("root_username"))
 		rootPass := strings.TrimSpace(r.FormValue("root_password"))
+		useAgent := r.FormValue("use_agent") == "on"
+		keyFile := strings.TrimSpace(r.FormValue("key_file"))
+		certFile := strings.TrimSpace(r.FormValue("cert_file"))
+		siteURL := strings.TrimSpace(r.FormValue("site_url"))
+		platform := ""
+		if r.FormValue("platform") == platformWindows {
+			platform = platformWindows
+		}
 
-		ipMap[ip] = ServerInfo{
+		setServer(ip, ServerInfo{
+			Name:         name,
+			Group:        group,
+			Tags:         tags,
 			RootUsername: rootUser,
 			RootPassword: rootPass,
 			Accounts:     []UserAccount{},
-		}
-		saveIPMap()
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+			UseAgent:     useAgent,
+			KeyFile:      keyFile,
+			CertFile:     certFile,
+			Platform:     platform,
+			SiteURL:      siteURL,
+		})
+		http.Redirect(w, r, appPath(r, "/"), http.StatusSeeOther)
 	}
 }
 
-func runRemoteCommand(ip, user, pass, script string) (string, error) {
-	client, err := ssh.Dial("tcp", ip+":22", &ssh.ClientConfig{
-		User:            user,
-		Auth:            []ssh.AuthMethod{ssh.Password(pass)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	})
-	if err != nil {
-		return "", err
-	}
-	defer client.Close()
-
-	session, err := client.NewSession()
-	if err != nil {
-		return "", err
-	}
-	defer session.Close()
-
-	var output strings.Builder
-	session.Stdout = &output
-	session.Stderr = &output
-	session.Stdin = strings.NewReader(script)
-	err = session.Run("sh -s")
-	return output.String(), err
-}
-
 func uploadCSVHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/upload.html"))
-	tmpl.Execute(w, ipMap)
+	renderTemplate(w, r, "templates/upload.html", requestServers(r))
 }
 
 func createUsersHandler(w http.ResponseWriter, r *http.Request) {
 	ip := strings.TrimSpace(r.FormValue("server_ip"))
-	server, ok := ipMap[ip]
+	server, ok := lookupServer(ip)
 	if !ok {
 		http.Error(w, "❌ IP not found in records", http.StatusBadRequest)
 		fmt.Println("Received IP:", ip)
-		fmt.Println("Available IPs:", ipMap)
+		fmt.Println("Available IPs:", slices.Sorted(maps.Keys(serversSnapshot())))
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "User management") {
 		return
 	}
 
@@ -164,12 +269,13 @@ func createUsersHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		safePass := strings.ReplaceAll(password, `'`, `'\''`)
 		// Create user command - use appropriate command for the OS
+		script.WriteString(scriptStep("create user "+username) + "\n")
 		if server.RootUsername == "root" {
 			// Running as root on Alpine - use adduser command
 			script.WriteString(fmt.Sprintf("adduser -D -s /bin/bash %s && echo '%s:%s' | chpasswd\n", username, username, safePass))
 		} else {
-			// Not running as root on Ubuntu - use sudo with useradd
-			script.WriteString(fmt.Sprintf("echo '%s' | sudo -S useradd -m -s /bin/bash -G users %s && echo '%s:%s' | sudo -S chpasswd\n", server.RootPassword, username, username, safePass))
+			// Not running as root on Ubuntu - useradd runs under sudo
+			script.WriteString(fmt.Sprintf("useradd -m -s /bin/bash -G users %s && echo '%s:%s' | chpasswd\n", username, username, safePass))
 		}
 		created = append(created, UserAccount{Username: username, Password: password})
 	}
@@ -178,27 +284,153 @@ func createUsersHandler(w http.ResponseWriter, r *http.Request) {
 		logBuilder.WriteString("⚠️ No valid user entries found.\n")
 	}
 
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
-	if err != nil {
-		logBuilder.WriteString("❌ Remote script execution failed:\n")
+	result, err := runPrivilegedCommand(ip, server, script.String())
+	if !writeCommandLog(&logBuilder, result, err) {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
 	}
-	logBuilder.WriteString(output)
 
-	s := ipMap[ip]
-	s.Accounts = append(s.Accounts, created...)
-	ipMap[ip] = s
-	saveIPMap()
+	updateServer(ip, func(s *ServerInfo) { s.Accounts = append(s.Accounts, created...) })
 
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
 }
 
 func main() {
+	generateClient := flag.String("generate-client", "", "write the generated Go API client to this file and exit")
+	grpcAddr := flag.String("grpc", "", "gRPC listen address, e.g. :9090; empty disables gRPC. Calls authenticate with an API token.")
+	flag.StringVar(&basePath, "base-path", envOr("ACCMGR_BASE_PATH", ""), "serve the app under this subpath, e.g. /accmgr")
+	flag.StringVar(&publicURL, "public-url", envOr("ACCMGR_PUBLIC_URL", ""), "external URL of the app root, used for absolute links")
+	flag.BoolVar(&trustProxy, "trust-proxy", envOr("ACCMGR_TRUST_PROXY", "") == "true", "honour X-Forwarded-For, -Proto, -Host and -Prefix from a reverse proxy; it never signs users in, see -proxy-auth")
+	flag.DurationVar(&poolIdleTimeout, "ssh-pool-idle", poolIdleTimeout, "how long an idle cached SSH connection stays open; 0 disables connection reuse")
+	flag.DurationVar(&defaultJobTimeout, "job-timeout", defaultJobTimeout, "time limit of jobs that set none of their own; 0 for no limit")
+	flag.IntVar(&serverWorkers, "workers", serverWorkers, "how many server tasks, such as health checks or the servers of a group run, run at once")
+	flag.IntVar(&hostWorkers, "host-workers", hostWorkers, "how many of those tasks run at once against one server")
+	flag.IntVar(&jobWorkers, "job-workers", jobWorkers, "how many queued jobs run at once")
+	flag.DurationVar(&sessionTTL, "session-ttl", sessionTTL, "how long a web UI sign-in lasts")
+	flag.StringVar(&listenAddr, "listen", envOr("ACCMGR_LISTEN", listenAddr), "web UI and API listen address, e.g. :443 with HTTPS")
+	flag.StringVar(&tlsCertFile, "tls-cert", envOr("ACCMGR_TLS_CERT", ""), "PEM certificate file to serve HTTPS with")
+	flag.StringVar(&tlsKeyFile, "tls-key", envOr("ACCMGR_TLS_KEY", ""), "PEM private key file of -tls-cert")
+	flag.StringVar(&acmeHosts, "acme-host", envOr("ACCMGR_ACME_HOST", ""), "comma-separated hostnames to get Let's Encrypt certificates for and serve HTTPS with")
+	flag.StringVar(&acmeEmail, "acme-email", envOr("ACCMGR_ACME_EMAIL", ""), "contact email for Let's Encrypt")
+	flag.StringVar(&acmeCache, "acme-cache", envOr("ACCMGR_ACME_CACHE", acmeCache), "directory to keep Let's Encrypt keys and certificates in")
+	flag.StringVar(&redirectAddr, "http-redirect", envOr("ACCMGR_HTTP_REDIRECT", ""), "plain HTTP listen address that redirects to HTTPS, e.g. :80; also answers ACME challenges")
+	flag.StringVar(&oidcIssuer, "oidc-issuer", envOr("ACCMGR_OIDC_ISSUER", ""), "OpenID Connect issuer URL to offer single sign-on with, e.g. https://keycloak.example.com/realms/ops")
+	flag.StringVar(&oidcClientID, "oidc-client-id", envOr("ACCMGR_OIDC_CLIENT_ID", ""), "client ID registered with the OpenID Connect provider")
+	flag.StringVar(&oidcClientSecret, "oidc-client-secret", envOr("ACCMGR_OIDC_CLIENT_SECRET", ""), "client secret of -oidc-client-id; prefer ACCMGR_OIDC_CLIENT_SECRET")
+	flag.StringVar(&oidcScopes, "oidc-scopes", envOr("ACCMGR_OIDC_SCOPES", oidcScopes), "space-separated scopes to ask the OpenID Connect provider for")
+	flag.StringVar(&oidcGroupsClaim, "oidc-groups-claim", envOr("ACCMGR_OIDC_GROUPS_CLAIM", oidcGroupsClaim), "ID token claim listing the user's groups, mapped to roles on /web-users")
+	flag.StringVar(&ldapURL, "ldap-url", envOr("ACCMGR_LDAP_URL", ""), "LDAP or Active Directory server to sign users in with, e.g. ldaps://dc.example.com")
+	flag.BoolVar(&ldapStartTLS, "ldap-starttls", envOr("ACCMGR_LDAP_STARTTLS", "") == "true", "upgrade an ldap:// connection with StartTLS")
+	flag.StringVar(&ldapCAFile, "ldap-ca-file", envOr("ACCMGR_LDAP_CA_FILE", ""), "PEM CA certificates to verify the LDAP server with instead of the system's")
+	flag.StringVar(&ldapBindDN, "ldap-bind-dn", envOr("ACCMGR_LDAP_BIND_DN", ""), "DN of the service account that searches for users; empty binds anonymously")
+	flag.StringVar(&ldapBindPassword, "ldap-bind-password", envOr("ACCMGR_LDAP_BIND_PASSWORD", ""), "password of -ldap-bind-dn; prefer ACCMGR_LDAP_BIND_PASSWORD")
+	flag.StringVar(&ldapBaseDN, "ldap-base-dn", envOr("ACCMGR_LDAP_BASE_DN", ""), "DN to search for users and groups under, e.g. dc=example,dc=com")
+	flag.StringVar(&ldapUserFilter, "ldap-user-filter", envOr("ACCMGR_LDAP_USER_FILTER", ldapUserFilter), "filter finding the user signing in, with {username}; (sAMAccountName={username}) for Active Directory")
+	flag.StringVar(&ldapGroupAttribute, "ldap-group-attribute", envOr("ACCMGR_LDAP_GROUP_ATTRIBUTE", ldapGroupAttribute), "user attribute listing the DNs of the user's groups")
+	flag.StringVar(&ldapGroupFilter, "ldap-group-filter", envOr("ACCMGR_LDAP_GROUP_FILTER", ""), "filter finding more of the user's groups, with {dn} and {username}, e.g. (member={dn})")
+	flag.IntVar(&loginRate, "login-rate", loginRate, "sign-ins an IP address may try a minute, counting every request with HTTP Basic authentication; 0 for no limit")
+	flag.IntVar(&jobRate, "job-rate", jobRate, "jobs and other changes a user may submit a minute, three times as many an IP address; 0 for no limit")
+	flag.IntVar(&lockoutAfter, "lockout-after", lockoutAfter, "failed sign-ins in a row that lock an account, four times as many an IP address; 0 never locks")
+	flag.DurationVar(&lockoutBase, "lockout-duration", lockoutBase, "first lockout after -lockout-after failed sign-ins; each further failure doubles it")
+	flag.DurationVar(&lockoutMax, "lockout-max", lockoutMax, "longest lockout; a long one keeps accounts locked until an admin unlocks them on the audit page")
+	flag.StringVar(&syncRoot, "sync-root", envOr("ACCMGR_SYNC_ROOT", syncRoot), "directory that directory sync pushes from; the local directories of syncs are paths inside it")
+	flag.StringVar(&proxyAuthCIDRs, "proxy-auth", envOr("ACCMGR_PROXY_AUTH", ""), "comma-separated addresses and CIDR ranges of reverse proxies that authenticate users and pass them in the X-Forwarded-User header (or the accountability header setting), which then signs them in without a password; the proxies must set or strip the header. Empty ignores the header")
+	flag.StringVar(&allowCIDRs, "allow-cidr", envOr("ACCMGR_ALLOW_CIDR", ""), "comma-separated addresses and CIDR ranges the web UI, API and gRPC answer, e.g. 10.8.0.0/16; empty answers all")
+	flag.StringVar(&auditLogFile, "audit-log", envOr("ACCMGR_AUDIT_LOG", auditLogFile), "file to append the security audit log to, as JSON lines")
+	flag.Parse()
+	basePath = normalizeBasePath(basePath)
+	if err := validateWorkerPool(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
+	if err := validateTLSFlags(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
+	if err := validateOIDCFlags(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
+	if err := validateLDAPFlags(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
+	if err := validateLockoutFlags(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
+	if err := parseAllowlist(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
+	if err := parseProxyAuth(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
+	if *generateClient != "" {
+		if err := writeAPIClient(*generateClient); err != nil {
+			fmt.Println("❌", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	os.MkdirAll("uploads", 0755)
 	ipMap = make(map[string]ServerInfo)
 	loadIPMap()
+	if err := loadSettings(); err != nil {
+		fmt.Println("❌ Reading the settings:", err)
+		os.Exit(1)
+	}
+	if err := ensureLoginUser(); err != nil {
+		fmt.Println("❌ Creating the admin user:", err)
+		os.Exit(1)
+	}
+	loadBaselines()
+	loadInventory()
+	loadOutdated()
+	loadScheduleRuns()
+	loadCatalogSyncState()
+	loadJobHistory()
+	loadCronState()
+	superviseWorker("health-poller", runHealthPoller)
+	superviseWorker("site-monitor", runSiteMonitor)
+	superviseWorker("unmanaged-changes", runUnmanagedChangeReport)
+	superviseWorker("outdated-packages", runOutdatedCheck)
+	superviseWorker("update-scheduler", runUpdateScheduler)
+	superviseWorker("cron-scheduler", runCronScheduler)
+	superviseWorker("catalog-sync", runCatalogSync)
+	superviseWorker("job-log-janitor", runJobLogJanitor)
+	superviseWorker("maintenance-windows", runMaintenanceWatcher)
+	for i := 1; i <= jobWorkers; i++ {
+		superviseWorker(fmt.Sprintf("job-worker-%d", i), runJobWorker)
+	}
+	if *grpcAddr != "" {
+		superviseWorker("grpc", func() { serveGRPC(*grpcAddr) })
+	}
 
 	http.HandleFunc("/", indexHandler)
+	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/oidc/login", oidcLoginHandler)
+	http.HandleFunc("/oidc/callback", oidcCallbackHandler)
+	http.HandleFunc("/save-group-role", saveGroupRoleHandler)
+	http.HandleFunc("/delete-group-role", deleteGroupRoleHandler)
+	http.HandleFunc("/logout", logoutHandler)
+	http.HandleFunc("/web-users", webUsersHandler)
+	http.HandleFunc("/save-web-user", saveWebUserHandler)
+	http.HandleFunc("/delete-web-user", deleteWebUserHandler)
+	http.HandleFunc("/save-user-servers", saveUserServersHandler)
+	http.HandleFunc("/audit", auditHandler)
+	http.HandleFunc("/unlock-login", unlockLoginHandler)
+	http.HandleFunc("/api-tokens", apiTokensHandler)
+	http.HandleFunc("/create-api-token", createAPITokenHandler)
+	http.HandleFunc("/revoke-api-token", revokeAPITokenHandler)
+	http.HandleFunc("/two-factor", twoFactorHandler)
+	http.HandleFunc("/enable-two-factor", enableTwoFactorHandler)
+	http.HandleFunc("/disable-two-factor", disableTwoFactorHandler)
+	http.HandleFunc("/regenerate-recovery-codes", regenerateRecoveryCodesHandler)
+	http.HandleFunc("/reset-two-factor", resetTwoFactorHandler)
+	http.HandleFunc("/save-two-factor-policy", saveTwoFactorPolicyHandler)
 	http.HandleFunc("/add-ip", addIPHandler)
 	http.HandleFunc("/upload-csv", uploadCSVHandler)
 	http.HandleFunc("/create-users", createUsersHandler)
@@ -218,8 +450,154 @@ func main() {
 
 	// Software installation
 	http.HandleFunc("/software", softwareHandler)
-	http.HandleFunc("/install-software", installSoftwareHandler)
+	http.HandleFunc("/install-software", idempotent(installSoftwareHandler))
+	http.HandleFunc("/catalog", catalogHandler)
+	http.HandleFunc("/save-catalog-entry", saveCatalogEntryHandler)
+	http.HandleFunc("/delete-catalog-entry", deleteCatalogEntryHandler)
+	http.HandleFunc("/restore-catalog-entry", restoreCatalogEntryHandler)
+	http.HandleFunc("/upgrade-packages", idempotent(upgradePackagesHandler))
+	http.HandleFunc("/security-updates", idempotent(securityUpdatesHandler))
+	http.HandleFunc("/schedules", schedulesHandler)
+	http.HandleFunc("/save-schedule", saveScheduleHandler)
+	http.HandleFunc("/delete-schedule", deleteScheduleHandler)
+	http.HandleFunc("/run-schedule", runScheduleHandler)
+	http.HandleFunc("/schedule-run", scheduleRunHandler)
+	http.HandleFunc("/cron-jobs", cronJobsHandler)
+	http.HandleFunc("/save-cron-job", saveCronJobHandler)
+	http.HandleFunc("/toggle-cron-job", toggleCronJobHandler)
+	http.HandleFunc("/delete-cron-job", deleteCronJobHandler)
+	http.HandleFunc("/run-cron-job", runCronJobHandler)
+	http.HandleFunc("/command-templates", commandTemplatesHandler)
+	http.HandleFunc("/save-command-template", saveCommandTemplateHandler)
+	http.HandleFunc("/delete-command-template", deleteCommandTemplateHandler)
+	http.HandleFunc("/command-template", commandTemplateHandler)
+	http.HandleFunc("/run-command-template", idempotent(runCommandTemplateHandler))
+	http.HandleFunc("/inventory", inventoryHandler)
+	http.HandleFunc("/refresh-inventory", refreshInventoryHandler)
+	http.HandleFunc("/mirrors", mirrorsHandler)
+	http.HandleFunc("/mirror-speed-test", mirrorSpeedTestHandler)
+	http.HandleFunc("/apply-mirror", applyMirrorHandler)
+	http.HandleFunc("/repositories", repositoriesHandler)
+	http.HandleFunc("/save-repository", saveRepositoryHandler)
+	http.HandleFunc("/delete-repository", deleteRepositoryHandler)
+	http.HandleFunc("/apply-repository", applyRepositoryHandler)
+	http.HandleFunc("/recipes", recipesHandler)
+	http.HandleFunc("/save-recipe", saveRecipeHandler)
+	http.HandleFunc("/delete-recipe", deleteRecipeHandler)
+	http.HandleFunc("/run-recipe", idempotent(runRecipeHandler))
 
-	fmt.Println(":8080")
-	http.ListenAndServe(":8080", nil)
+	// Library sharing between instances
+	http.HandleFunc("/library", libraryHandler)
+	http.HandleFunc("/export-library", exportLibraryHandler)
+	http.HandleFunc("/import-library", importLibraryHandler)
+	http.HandleFunc("/update-library-settings", updateLibrarySettingsHandler)
+	http.HandleFunc("/update-catalog-sync", updateCatalogSyncHandler)
+	http.HandleFunc("/sync-catalog", syncCatalogHandler)
+
+	// File transfer
+	http.HandleFunc("/files", filesHandler)
+	http.HandleFunc("/sftp-upload", sftpUploadHandler)
+	http.HandleFunc("/sftp-download", sftpDownloadHandler)
+	http.Handle("/sync-directory", requireFeature("directory_sync", http.HandlerFunc(syncDirectoryHandler)))
+
+	// Connection diagnostics
+	http.HandleFunc("/diagnose", diagnoseHandler)
+
+	// Ad-hoc commands
+	http.HandleFunc("/run-command", runCommandHandler)
+	http.HandleFunc("/execute-command", idempotent(executeCommandHandler))
+
+	// Jobs and their artifacts
+	http.HandleFunc("/jobs", jobsHandler)
+	http.HandleFunc("/job", jobHandler)
+	http.HandleFunc("/job-summary", jobSummaryHandler)
+	http.HandleFunc("/retry-failed", idempotent(retryFailedHandler))
+	http.HandleFunc("/job-artifact", jobArtifactHandler)
+	http.HandleFunc("/job-log", jobLogHandler)
+	http.HandleFunc("/save-job-log-settings", saveJobLogSettingsHandler)
+	http.HandleFunc("/job-result", jobResultHandler)
+	http.HandleFunc("/job-stream", jobStreamHandler)
+	http.HandleFunc("/cancel-job", cancelJobHandler)
+	http.HandleFunc("/approve-job", approveJobHandler)
+	http.HandleFunc("/approvals", approvalsHandler)
+	http.HandleFunc("/maintenance-windows", maintenanceWindowsHandler)
+	http.HandleFunc("/save-maintenance-window", saveMaintenanceWindowHandler)
+	http.HandleFunc("/delete-maintenance-window", deleteMaintenanceWindowHandler)
+	http.HandleFunc("/save-approval-rule", saveApprovalRuleHandler)
+	http.HandleFunc("/delete-approval-rule", deleteApprovalRuleHandler)
+	http.HandleFunc("/job-notify", jobNotifyHandler)
+	http.HandleFunc("/job-priority", jobPriorityHandler)
+	http.HandleFunc("/notifications", notificationsHandler)
+	http.HandleFunc("/save-notifications", saveNotificationsHandler)
+	http.HandleFunc("/test-notification", testNotificationHandler)
+	http.HandleFunc("/job-history", jobHistoryHandler)
+	http.HandleFunc("/rerun-job", idempotent(rerunJobHandler))
+
+	// Interactive terminal
+	http.Handle("/terminal", requireFeature("terminal", http.HandlerFunc(terminalHandler)))
+	http.Handle("/terminal-ws", requireFeature("terminal", terminalSocket))
+
+	// Bulk credential updates
+	http.HandleFunc("/credentials", credentialsHandler)
+	http.HandleFunc("/update-credentials", updateCredentialsHandler)
+
+	// Session recordings
+	http.HandleFunc("/recordings", recordingsHandler)
+	http.HandleFunc("/recording", recordingHandler)
+	http.HandleFunc("/recording-file", recordingFileHandler)
+
+	// Environment variable profiles
+	http.HandleFunc("/environment", environmentHandler)
+	http.HandleFunc("/save-env-profile", saveEnvProfileHandler)
+	http.HandleFunc("/delete-env-profile", deleteEnvProfileHandler)
+	http.HandleFunc("/apply-env-profile", applyEnvProfileHandler)
+	http.HandleFunc("/env-drift", envDriftHandler)
+	http.HandleFunc("/lock-env-profile", lockProfileHandler)
+	http.HandleFunc("/unlock-env-profile", unlockProfileHandler)
+
+	// Alerts
+	http.HandleFunc("/dismiss-alert", dismissAlertHandler)
+
+	// Changes made outside accmgr4
+	http.HandleFunc("/unmanaged-changes", unmanagedChangesHandler)
+	http.HandleFunc("/run-unmanaged-report", runUnmanagedReportHandler)
+	http.HandleFunc("/accept-unmanaged-changes", acceptUnmanagedChangesHandler)
+	http.HandleFunc("/outdated-packages", outdatedPackagesHandler)
+	http.HandleFunc("/run-outdated-report", runOutdatedReportHandler)
+
+	// Event stream
+	http.Handle("/events", requireFeature("events", http.HandlerFunc(eventsHandler)))
+
+	// GraphQL API
+	http.Handle("/graphql", requireFeature("graphql", http.HandlerFunc(graphqlHandler)))
+
+	// REST API
+	registerAPIRoutes()
+
+	// sshd_config management
+	http.Handle("/sshd", requireFeature("sshd_management", http.HandlerFunc(sshdHandler)))
+	http.Handle("/save-sshd-template", requireFeature("sshd_management", http.HandlerFunc(saveSSHDTemplateHandler)))
+	http.Handle("/sshd-preview", requireFeature("sshd_management", http.HandlerFunc(sshdPreviewHandler)))
+	http.Handle("/apply-sshd-config", requireFeature("sshd_management", http.HandlerFunc(applySSHDConfigHandler)))
+
+	// Feature flags
+	http.HandleFunc("/features", featuresHandler)
+	http.HandleFunc("/update-features", updateFeaturesHandler)
+
+	// Self-diagnostics
+	http.HandleFunc("/admin/diagnostics", selfDiagnosticsHandler)
+
+	// SSH client options
+	http.HandleFunc("/ssh-settings", sshSettingsHandler)
+	http.HandleFunc("/update-ssh-settings", updateSSHSettingsHandler)
+
+	scheme := "http"
+	if tlsEnabled() {
+		scheme = "https"
+	}
+	fmt.Println(scheme + "://" + listenAddr + basePath)
+	if err := serveWeb(withIPAllowlist(withBasePath(withCSRF(requireLogin(restrictServers(limitJobSubmissions(http.DefaultServeMux))))))); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Maintenance windows control when disruptive jobs may touch a server. An allow window lets
+// them run only while it is open, e.g. Sundays 02:00-06:00; a block window is a freeze that
+// keeps them off while it is open, e.g. weekdays 09:00-17:00. A queued job held by a window
+// stays in the queue, leaving the job workers to other jobs, and a job started directly
+// waits before it claims its server; either starts once the windows let it, so an upgrade
+// submitted on Friday runs on Sunday at 02:00. Its time limit starts only then.
+
+// MaintenanceWindow is a weekly window on some servers. Start and End are 15:04 on the
+// management host's clock; an End before Start runs past midnight into the next day, and
+// an End equal to Start spans the whole day. Servers, Groups and Tags pick the servers it
+// covers, every server when none is set, and Kinds the jobs it holds, all of
+// maintenanceKinds when none is set.
+type MaintenanceWindow struct {
+	Name string `json:"name"`
+	// Block makes the window a freeze: disruptive jobs wait while it is open instead of
+	// running only then
+	Block   bool     `json:"block,omitempty"`
+	Servers []string `json:"servers,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Kinds   []string `json:"kinds,omitempty"`
+	// Days are the lowercase weekdays the window opens on; none means every day
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// maintenanceKinds are the job kinds that change a server and wait for its windows
+var maintenanceKinds = []string{"command", "recipe", "install", "uninstall", "upgrade", "mirror", "repository"}
+
+// maintenanceRecheck is how often a held job checks the windows again, so edits to them
+// take effect without waiting for the time the job was told
+const maintenanceRecheck = time.Minute
+
+// maintenanceScan is how far ahead heldUntil looks for the windows to let a job run
+const maintenanceScan = 8 * 24 * time.Hour
+
+// validateMaintenanceWindow checks a window before it is stored
+func validateMaintenanceWindow(window MaintenanceWindow) error {
+	if !scheduleNamePattern.MatchString(window.Name) {
+		return fmt.Errorf("invalid window name %q; use lowercase letters, digits and dashes", window.Name)
+	}
+	for _, value := range []string{window.Start, window.End} {
+		if _, err := time.Parse("15:04", value); err != nil {
+			return fmt.Errorf("invalid time %q; use HH:MM", value)
+		}
+	}
+	for _, day := range window.Days {
+		if !slices.Contains(weekdays, day) {
+			return fmt.Errorf("invalid weekday %q", day)
+		}
+	}
+	for _, kind := range window.Kinds {
+		if !slices.Contains(maintenanceKinds, kind) {
+			return fmt.Errorf("unknown job kind %q; use %s", kind, strings.Join(maintenanceKinds, ", "))
+		}
+	}
+	return nil
+}
+
+// covers reports whether the window holds jobs of kind on the server
+func (w MaintenanceWindow) covers(ip string, server ServerInfo, kind string) bool {
+	kinds := w.Kinds
+	if len(kinds) == 0 {
+		kinds = maintenanceKinds
+	}
+	return slices.Contains(kinds, kind) && w.onServer(ip, server)
+}
+
+// onServer reports whether the window's servers, groups and tags include the server; a
+// window naming none covers every server
+func (w MaintenanceWindow) onServer(ip string, server ServerInfo) bool {
+	if len(w.Servers) == 0 && len(w.Groups) == 0 && len(w.Tags) == 0 {
+		return true
+	}
+	return slices.Contains(w.Servers, ip) || slices.Contains(w.Groups, server.Group) ||
+		slices.ContainsFunc(w.Tags, func(tag string) bool { return slices.Contains(server.Tags, tag) })
+}
+
+// servers returns the IP addresses of the servers the window covers
+func (w MaintenanceWindow) servers() []string {
+	ips := slices.Clone(w.Servers)
+	for ip, server := range serversSnapshot() {
+		if !slices.Contains(ips, ip) && w.onServer(ip, server) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// onDay reports whether the window opens on the weekday
+func (w MaintenanceWindow) onDay(day time.Weekday) bool {
+	return len(w.Days) == 0 || slices.Contains(w.Days, weekdays[day])
+}
+
+// open reports whether the window is open at now. The part of a window past midnight
+// belongs to the day it opened on.
+func (w MaintenanceWindow) open(now time.Time) bool {
+	start, _ := time.Parse("15:04", w.Start)
+	end, _ := time.Parse("15:04", w.End)
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	minute := now.Hour()*60 + now.Minute()
+	if from < to {
+		return from <= minute && minute < to && w.onDay(now.Weekday())
+	}
+	if minute >= from {
+		return w.onDay(now.Weekday())
+	}
+	return minute < to && w.onDay((now.Weekday()+6)%7)
+}
+
+// When describes when the window is open, e.g. "sunday, saturday 02:00-06:00"
+func (w MaintenanceWindow) When() string {
+	days := "every day"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ", ")
+	}
+	return days + " " + w.Start + "-" + w.End
+}
+
+// Targets describes the servers the window covers
+func (w MaintenanceWindow) Targets() string {
+	var targets []string
+	targets = append(targets, w.Servers...)
+	for _, group := range w.Groups {
+		targets = append(targets, "group "+group)
+	}
+	for _, tag := range w.Tags {
+		targets = append(targets, "tag "+tag)
+	}
+	if len(targets) == 0 {
+		return "every server"
+	}
+	return strings.Join(targets, ", ")
+}
+
+// maintenanceHold returns the window that keeps a job of kind off the server at now: an
+// open block window, or an allow window when the server has allow windows and none is open
+func maintenanceHold(ip string, server ServerInfo, kind string, now time.Time) (MaintenanceWindow, bool) {
+	var closed []MaintenanceWindow
+	allowed := false
+	for _, window := range settings.MaintenanceWindows {
+		if !window.covers(ip, server, kind) {
+			continue
+		}
+		switch open := window.open(now); {
+		case window.Block && open:
+			return window, true
+		case open:
+			allowed = true
+		case !window.Block:
+			closed = append(closed, window)
+		}
+	}
+	if !allowed && len(closed) > 0 {
+		return closed[0], true
+	}
+	return MaintenanceWindow{}, false
+}
+
+// heldUntil returns the next minute the windows let a job of kind run on the server, or
+// false when they do not within maintenanceScan
+func heldUntil(ip string, server ServerInfo, kind string, now time.Time) (time.Time, bool) {
+	minute := now.Truncate(time.Minute)
+	for at := minute.Add(time.Minute); at.Sub(minute) <= maintenanceScan; at = at.Add(time.Minute) {
+		if _, held := maintenanceHold(ip, server, kind, at); !held {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// jobTargets are the servers a queued job changes and the kind of change, which decide
+// whether maintenance windows hold it in the queue
+type jobTargets struct {
+	kind    string
+	servers map[string]ServerInfo
+}
+
+// hold returns the window that keeps the job off one of its servers at now, and that
+// server
+func (t jobTargets) hold(now time.Time) (MaintenanceWindow, string, bool) {
+	ips := make([]string, 0, len(t.servers))
+	for ip := range t.servers {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		if window, held := maintenanceHold(ip, t.servers[ip], t.kind, now); held {
+			return window, ip, true
+		}
+	}
+	return MaintenanceWindow{}, "", false
+}
+
+// runMaintenanceWatcher wakes the job workers at every minute, when windows may have opened
+// or closed, so they take up the queued jobs the windows now let run
+func runMaintenanceWatcher() {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		markHeldQueuedJobs()
+	}
+}
+
+// markHeldQueuedJobs wakes the job workers and shows on every queued job which window, if
+// any, keeps it in the queue
+func markHeldQueuedJobs() {
+	jobQueueMu.Lock()
+	queue := slices.Clone(jobQueue)
+	jobQueueReady.Broadcast()
+	jobQueueMu.Unlock()
+
+	now := time.Now()
+	for _, queued := range queue {
+		heldBy, message := "", ""
+		if window, ip, held := queued.targets.hold(now); held {
+			heldBy = window.Name
+			message = "held by maintenance window " + window.Name + " on " + ip
+			if until, ok := heldUntil(ip, queued.targets.servers[ip], queued.targets.kind, now); ok {
+				message += " until " + until.Format("Mon 15:04")
+			}
+		}
+		job := queued.job
+		jobsMu.Lock()
+		changed := job.Status == "queued" && (job.HeldBy != heldBy || job.Progress != message)
+		if changed {
+			job.HeldBy, job.Progress = heldBy, message
+		}
+		snapshot := job.snapshot()
+		jobsMu.Unlock()
+		if changed {
+			publishEvent("job.progress", snapshot)
+		}
+	}
+}
+
+// awaitMaintenanceWindow waits until the maintenance windows of the job's server let it
+// run, showing which window holds it. A job cancelled while it waits stops waiting; its
+// commands then refuse to start, so it finishes as cancelled without touching the server.
+func (j *Job) awaitMaintenanceWindow() {
+	ctx := j.context()
+	server, ok := serversSnapshot()[j.Server]
+	if !ok {
+		return
+	}
+	message := ""
+	defer func() {
+		if message != "" {
+			jobsMu.Lock()
+			j.HeldBy = ""
+			jobsMu.Unlock()
+			j.progress("")
+		}
+	}()
+	for {
+		now := time.Now()
+		window, held := maintenanceHold(j.Server, server, j.Kind, now)
+		if !held {
+			return
+		}
+		wait := maintenanceRecheck
+		current := "held by maintenance window " + window.Name + " until the windows change"
+		if until, ok := heldUntil(j.Server, server, j.Kind, now); ok {
+			current = "held by maintenance window " + window.Name + " until " + until.Format("Mon 15:04")
+			wait = min(wait, until.Sub(now))
+		}
+		if current != message {
+			message = current
+			jobsMu.Lock()
+			j.HeldBy = window.Name
+			jobsMu.Unlock()
+			j.progress(message)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// maintenanceWindowsHandler lists the maintenance windows, whether each is open now, and a
+// form to add one
+func maintenanceWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	var editing MaintenanceWindow
+	if name := r.FormValue("edit"); name != "" {
+		if i := slices.IndexFunc(settings.MaintenanceWindows, func(window MaintenanceWindow) bool { return window.Name == name }); i >= 0 {
+			editing = settings.MaintenanceWindows[i]
+		}
+	}
+	now := time.Now()
+	open := make(map[string]bool)
+	for _, window := range settings.MaintenanceWindows {
+		open[window.Name] = window.open(now)
+	}
+	var held []Job
+	for _, job := range visibleJobs(r, jobsSnapshot()) {
+		if job.HeldBy != "" {
+			held = append(held, job)
+		}
+	}
+	servers := requestServers(r)
+	renderTemplate(w, r, "templates/maintenance.html", map[string]interface{}{
+		"Windows":  settings.MaintenanceWindows,
+		"Open":     open,
+		"Held":     held,
+		"Groups":   serverGroups(servers),
+		"Tags":     serverTags(servers),
+		"Kinds":    maintenanceKinds,
+		"Weekdays": weekdays,
+		"Editing":  editing,
+		"Zone":     now.Format("MST"),
+	})
+}
+
+// saveMaintenanceWindowHandler adds a maintenance window or replaces the one with the same
+// name; held jobs see the change within maintenanceRecheck
+func saveMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	window := MaintenanceWindow{
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		Block:   r.FormValue("mode") == "block",
+		Servers: splitList(r.FormValue("servers")),
+		Groups:  r.Form["group"],
+		Tags:    r.Form["tag"],
+		Kinds:   r.Form["kind"],
+		Days:    r.Form["days"],
+		Start:   strings.TrimSpace(r.FormValue("start")),
+		End:     strings.TrimSpace(r.FormValue("end")),
+	}
+	if err := validateMaintenanceWindow(window); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A window holds jobs on every server it covers, so a limited user may neither save
+	// one reaching outside their scope nor replace one that does
+	ips := window.servers()
+	if i := slices.IndexFunc(settings.MaintenanceWindows, func(existing MaintenanceWindow) bool { return existing.Name == window.Name }); i >= 0 {
+		ips = append(ips, settings.MaintenanceWindows[i].servers()...)
+	}
+	if !serversAllowed(w, r, ips) {
+		return
+	}
+	settings.MaintenanceWindows = slices.DeleteFunc(settings.MaintenanceWindows, func(existing MaintenanceWindow) bool { return existing.Name == window.Name })
+	settings.MaintenanceWindows = append(settings.MaintenanceWindows, window)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/maintenance-windows"), http.StatusSeeOther)
+}
+
+// deleteMaintenanceWindowHandler removes a maintenance window; jobs it held are released
+// within maintenanceRecheck unless another window holds them
+func deleteMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	i := slices.IndexFunc(settings.MaintenanceWindows, func(window MaintenanceWindow) bool { return window.Name == name })
+	if i < 0 {
+		http.Error(w, "Maintenance window not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, settings.MaintenanceWindows[i].servers()) {
+		return
+	}
+	settings.MaintenanceWindows = slices.DeleteFunc(settings.MaintenanceWindows, func(window MaintenanceWindow) bool { return window.Name == name })
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/maintenance-windows"), http.StatusSeeOther)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mirrorMarker prefixes each benchmark result line of the speed test script
+const mirrorMarker = "__ACCMGR_MIRROR__"
+
+// mirrorBackupDir is where the original repository files are copied before a mirror switch
+const mirrorBackupDir = "/var/backups/accmgr4"
+
+// defaultMirrors are the candidates benchmarked for each distribution, before any the
+// operator adds. The first entry is the distribution's default mirror.
+var defaultMirrors = map[string][]string{
+	"debian": {
+		"http://deb.debian.org/debian",
+		"http://ftp.us.debian.org/debian",
+		"http://ftp.de.debian.org/debian",
+		"http://ftp.uk.debian.org/debian",
+		"http://mirrors.edge.kernel.org/debian",
+	},
+	"ubuntu": {
+		"http://archive.ubuntu.com/ubuntu",
+		"http://us.archive.ubuntu.com/ubuntu",
+		"http://de.archive.ubuntu.com/ubuntu",
+		"http://gb.archive.ubuntu.com/ubuntu",
+		"http://mirrors.edge.kernel.org/ubuntu",
+	},
+	"alpine": {
+		"https://dl-cdn.alpinelinux.org/alpine",
+		"https://mirrors.edge.kernel.org/alpine",
+		"https://uk.alpinelinux.org/alpine",
+		"https://mirror.leaseweb.com/alpine",
+	},
+}
+
+// MirrorTarget is what the speed test needs to know about a server's distribution
+type MirrorTarget struct {
+	Distro  string
+	Manager PackageManager
+	// TestPath is the file fetched from every mirror, relative to the mirror URL
+	TestPath string
+}
+
+// MirrorResult is one mirror's benchmark from the target server
+type MirrorResult struct {
+	URL     string
+	Bytes   int64
+	Seconds float64
+	Error   string
+}
+
+// Speed is the download rate in KB/s, 0 for a failed mirror
+func (m MirrorResult) Speed() float64 {
+	if m.Error != "" || m.Seconds <= 0 {
+		return 0
+	}
+	return float64(m.Bytes) / 1024 / m.Seconds
+}
+
+// detectMirrorTarget reads /etc/os-release to choose the candidates and the file to time.
+// Only apt on Debian or Ubuntu and apk on Alpine are supported.
+func detectMirrorTarget(ip string, server ServerInfo) (MirrorTarget, error) {
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		return MirrorTarget{}, err
+	}
+	script := `. /etc/os-release && echo "$ID ${VERSION_CODENAME:-none} ${VERSION_ID:-none} $(apk --print-arch 2>/dev/null || echo none)"`
+	result, err := runProbeCommand(ip, server, script)
+	if err := commandError(result, err); err != nil {
+		return MirrorTarget{}, fmt.Errorf("reading /etc/os-release: %w", err)
+	}
+	fields := strings.Fields(result.Stdout)
+	if len(fields) < 4 {
+		return MirrorTarget{}, errors.New("unexpected /etc/os-release contents")
+	}
+	id, codename, version, arch := fields[0], fields[1], fields[2], fields[3]
+
+	target := MirrorTarget{Distro: id, Manager: manager}
+	switch {
+	case (id == "debian" || id == "ubuntu") && manager.Name() == "apt" && codename != "none":
+		target.TestPath = "dists/" + codename + "/InRelease"
+	case id == "alpine" && manager.Name() == "apk" && version != "none":
+		// VERSION_ID is the full release, e.g. 3.19.1, while repositories use v3.19
+		parts := strings.SplitN(version, ".", 3)
+		if len(parts) < 2 {
+			return target, fmt.Errorf("unexpected Alpine version %s", version)
+		}
+		target.TestPath = "v" + parts[0] + "." + parts[1] + "/main/" + arch + "/APKINDEX.tar.gz"
+	default:
+		return target, fmt.Errorf("mirror selection supports apt on Debian or Ubuntu and apk on Alpine, not %s with %s", id, manager.Name())
+	}
+	return target, nil
+}
+
+// parseMirrorList reads one mirror URL per line. URLs must be plain http or https, since
+// they end up in sed expressions and repository files.
+func parseMirrorList(text string) ([]string, error) {
+	var mirrors []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(strings.TrimSpace(line), "/")
+		if line == "" {
+			continue
+		}
+		parsed, err := url.Parse(line)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			parsed.RawQuery != "" || strings.ContainsAny(line, " #&\\'\"") {
+			return nil, fmt.Errorf("invalid mirror URL %q", line)
+		}
+		mirrors = append(mirrors, line)
+	}
+	return mirrors, nil
+}
+
+// mirrorCandidates merges the default mirrors of a distribution with extra ones, without
+// duplicates
+func mirrorCandidates(distro string, extra []string) []string {
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, mirror := range append(append([]string(nil), defaultMirrors[distro]...), extra...) {
+		if !seen[mirror] {
+			seen[mirror] = true
+			candidates = append(candidates, mirror)
+		}
+	}
+	return candidates
+}
+
+// speedTestScript downloads the test file from each mirror with curl, or wget where curl is
+// missing, timing it with /proc/uptime, which works with busybox as well
+func speedTestScript(mirrors []string, testPath string) string {
+	var script strings.Builder
+	script.WriteString("tmp=$(mktemp)\n")
+	script.WriteString("for mirror in")
+	for _, mirror := range mirrors {
+		script.WriteString(" " + shellQuote(mirror))
+	}
+	script.WriteString("; do\n")
+	script.WriteString("  : > \"$tmp\"\n")
+	script.WriteString("  start=$(cut -d' ' -f1 /proc/uptime)\n")
+	script.WriteString("  if command -v curl >/dev/null 2>&1; then\n")
+	script.WriteString("    curl -fsSL --max-time 20 -o \"$tmp\" \"$mirror/\"" + shellQuote(testPath) + "\n")
+	script.WriteString("  else\n")
+	script.WriteString("    wget -q -T 20 -O \"$tmp\" \"$mirror/\"" + shellQuote(testPath) + "\n")
+	script.WriteString("  fi\n")
+	script.WriteString("  status=$?\n")
+	script.WriteString("  end=$(cut -d' ' -f1 /proc/uptime)\n")
+	script.WriteString("  echo " + mirrorMarker + " \"$mirror\" $status $(wc -c < \"$tmp\") $start $end\n")
+	script.WriteString("done\n")
+	script.WriteString("rm -f \"$tmp\"\n")
+	return script.String()
+}
+
+// parseSpeedTest reads the marker lines of speedTestScript, fastest mirror first
+func parseSpeedTest(stdout string) []MirrorResult {
+	var results []MirrorResult
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 6 || fields[0] != mirrorMarker {
+			continue
+		}
+		result := MirrorResult{URL: fields[1]}
+		result.Bytes, _ = strconv.ParseInt(fields[3], 10, 64)
+		start, _ := strconv.ParseFloat(fields[4], 64)
+		end, _ := strconv.ParseFloat(fields[5], 64)
+		// /proc/uptime counts in hundredths, so round a faster download up to one tick
+		result.Seconds = max(end-start, 0.01)
+		if fields[2] != "0" {
+			result.Error = "download failed with exit status " + fields[2]
+		} else if result.Bytes == 0 {
+			result.Error = "empty response"
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Speed() > results[j].Speed() })
+	return results
+}
+
+// mirrorFiles are the repository files a mirror switch rewrites for each package manager
+func mirrorFiles(manager string) string {
+	if manager == "apk" {
+		return "/etc/apk/repositories"
+	}
+	return "/etc/apt/sources.list /etc/apt/sources.list.d/*.list /etc/apt/sources.list.d/*.sources"
+}
+
+// mirrorPattern matches the mirror part of repository URLs: on apt URLs ending in /debian
+// or /ubuntu, in one-line and deb822 entries alike, and on apk the part before
+// /alpine/<release>
+func mirrorPattern(manager string) string {
+	if manager == "apk" {
+		return `https?://[^ ]*/alpine/`
+	}
+	return `https?://[^ ]+/(debian|ubuntu)/?( |$)`
+}
+
+// mirrorSedExpression replaces the mirror in repository lines, leaving apt security
+// repositories alone since they are not mirrored
+func mirrorSedExpression(manager, mirror string) string {
+	if manager == "apk" {
+		return `s#` + mirrorPattern(manager) + `#` + mirror + `/#`
+	}
+	return `/security/! s#` + mirrorPattern(manager) + `#` + mirror + `\2#`
+}
+
+// switchMirrorScript backs up each repository file the switch changes, rewrites it and
+// refreshes the package index, restoring the backups if the refresh fails
+func switchMirrorScript(manager PackageManager, mirror, backup, verbosity string) string {
+	var script strings.Builder
+	script.WriteString("backup=" + shellQuote(backup) + "\n")
+	script.WriteString("changed=\n")
+	script.WriteString("for f in " + mirrorFiles(manager.Name()) + "; do\n")
+	script.WriteString("  [ -f \"$f\" ] && grep -v security \"$f\" | grep -qE " + shellQuote(mirrorPattern(manager.Name())) + " || continue\n")
+	script.WriteString("  mkdir -p \"$backup\" && cp -p \"$f\" \"$backup/$(basename \"$f\")\" || exit 1\n")
+	script.WriteString("  sed -i -E " + shellQuote(mirrorSedExpression(manager.Name(), mirror)) + " \"$f\" || exit 1\n")
+	script.WriteString("  echo \"Rewrote $f (original in $backup/$(basename \"$f\"))\"\n")
+	script.WriteString("  changed=\"$changed $f\"\n")
+	script.WriteString("done\n")
+	script.WriteString("if [ -z \"$changed\" ]; then echo 'No repository entries to rewrite' >&2; exit 1; fi\n")
+	script.WriteString(scriptStep(manager.Name()+" update") + "\n")
+	script.WriteString("if ! " + manager.Update(verbosity) + "; then\n")
+	script.WriteString("  echo 'Package index refresh failed; restoring the original repository files' >&2\n")
+	script.WriteString("  for f in $changed; do cp -p \"$backup/$(basename \"$f\")\" \"$f\"; done\n")
+	script.WriteString("  exit 1\n")
+	script.WriteString("fi\n")
+	return script.String()
+}
+
+// linuxServerIPs returns the sorted IPs of the Linux servers
+func linuxServerIPs(servers map[string]ServerInfo) []string {
+	var ips []string
+	for ip, server := range servers {
+		if !server.isWindows() {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// mirrorsHandler shows the speed test form
+func mirrorsHandler(w http.ResponseWriter, r *http.Request) {
+	servers := requestServers(r)
+	renderTemplate(w, r, "templates/mirrors.html", map[string]interface{}{
+		"IPs":      linuxServerIPs(servers),
+		"Servers":  servers,
+		"Selected": r.FormValue("ip"),
+	})
+}
+
+// mirrorSpeedTestHandler benchmarks the candidate mirrors from the selected server and
+// lists them fastest first, each with a button to switch to it
+func mirrorSpeedTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := serversSnapshot()[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "Mirror selection") {
+		return
+	}
+	extra, err := parseMirrorList(r.FormValue("mirrors"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	target, err := detectMirrorTarget(ip, server)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	candidates := mirrorCandidates(target.Distro, extra)
+	result, err := runProbeCommand(ip, server, speedTestScript(candidates, target.TestPath))
+	if err := commandError(result, err); err != nil {
+		http.Error(w, "❌ Speed test failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	servers := requestServers(r)
+	renderTemplate(w, r, "templates/mirrors.html", map[string]interface{}{
+		"IPs":      linuxServerIPs(servers),
+		"Servers":  servers,
+		"Selected": ip,
+		"Mirrors":  strings.Join(extra, "\n"),
+		"Target":   target,
+		"Results":  parseSpeedTest(result.Stdout),
+	})
+}
+
+// applyMirrorHandler points the server's repository files at the chosen mirror
+func applyMirrorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := serversSnapshot()[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "Mirror selection") {
+		return
+	}
+	mirrors, err := parseMirrorList(r.FormValue("mirror"))
+	if err != nil || len(mirrors) != 1 {
+		http.Error(w, "❌ Choose one valid mirror URL", http.StatusBadRequest)
+		return
+	}
+	mirror := mirrors[0]
+	operator := requestOperator(r)
+	if server, err = operatorServer(server, operator); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+		return
+	}
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if manager.Name() != "apt" && manager.Name() != "apk" {
+		http.Error(w, "❌ Mirror selection supports apt and apk, not "+manager.Name(), http.StatusBadRequest)
+		return
+	}
+	verbosity := parseVerbosity(r.FormValue("verbosity"))
+	backup := mirrorBackupDir + "/mirror-" + time.Now().Format("20060102-150405")
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("🌐 Switching %s to %s\n\n", ip, mirror))
+
+	job := startOperatorJob(operator, "mirror", ip, "Switch package mirror to "+mirror)
+	script := tracedScript(switchMirrorScript(manager, mirror, backup, verbosity), verbosity, false)
+	result, err := runPrivilegedCommandLive(job.context(), ip, server, operatorScript(server, script, operator, job.ID), nil)
+	job.finishCommand(result, err)
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	} else {
+		logBuilder.WriteString(verbosityOutput(result.Output(), verbosity, result.OK()))
+		if result.OK() {
+			logBuilder.WriteString(fmt.Sprintf("\n✅ %s now uses %s; the original files are in %s\n", ip, mirror, backup))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("\n❌ Mirror switch failed with %s; repository files are unchanged or restored from the backup\n", result.Status()))
+		}
+	}
+
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
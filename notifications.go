@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// When a finished job is notified about. A job may override the global setting, including
+// with notifyNever to silence one noisy job.
+const (
+	notifyAlways  = "always"
+	notifyFailure = "failure"
+	notifyNever   = "never"
+)
+
+// notificationTimeout bounds the delivery of one notification
+const notificationTimeout = 20 * time.Second
+
+// NotificationSettings sends a message when a job finishes, so nobody has to keep its page
+// open. When is "always", "failure" for failed jobs only, or empty for off.
+type NotificationSettings struct {
+	When  string            `json:"when,omitempty"`
+	Email EmailNotification `json:"email,omitempty"`
+	// SlackWebhook is a Slack incoming webhook URL
+	SlackWebhook string `json:"slack_webhook,omitempty"`
+	// Webhook receives the finished job as JSON
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// EmailNotification is the SMTP server and recipients of job emails. STARTTLS is used when
+// the server offers it.
+type EmailNotification struct {
+	Server   string   `json:"server,omitempty"` // host:port
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// enabled reports whether email is configured
+func (e EmailNotification) enabled() bool {
+	return e.Server != ""
+}
+
+// validate checks the settings before they are stored
+func (n NotificationSettings) validate() error {
+	switch n.When {
+	case "", notifyAlways, notifyFailure:
+	default:
+		return fmt.Errorf("invalid notification setting %q; use always or failure", n.When)
+	}
+	for _, hook := range []string{n.SlackWebhook, n.Webhook} {
+		if hook == "" {
+			continue
+		}
+		if parsed, err := url.Parse(hook); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q", hook)
+		}
+	}
+	if !n.Email.enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(n.Email.Server); err != nil {
+		return fmt.Errorf("invalid SMTP server %q; use host:port", n.Email.Server)
+	}
+	if _, err := mail.ParseAddress(n.Email.From); err != nil {
+		return fmt.Errorf("invalid sender address %q", n.Email.From)
+	}
+	if len(n.Email.To) == 0 {
+		return errors.New("email notifications need at least one recipient")
+	}
+	for _, to := range n.Email.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid recipient address %q", to)
+		}
+	}
+	return nil
+}
+
+// wants reports whether a finished job should be notified about
+func (n NotificationSettings) wants(job Job) bool {
+	when := job.Notify
+	if when == "" {
+		when = n.When
+	}
+	switch when {
+	case notifyAlways:
+		return true
+	case notifyFailure:
+		return job.Status == "failed"
+	}
+	return false
+}
+
+// notifyJobFinished sends the configured notifications for a finished job in the
+// background, so a slow mail server never holds up the job
+func notifyJobFinished(job Job) {
+	config := settings.Notifications
+	if !config.wants(job) {
+		return
+	}
+	go func() {
+		defer catchWorkerPanic("notifications")
+		deliverNotifications(config, job)
+	}()
+}
+
+// deliverNotifications sends a job's notification over every configured channel. A channel
+// that fails raises an alert, cleared by its next successful delivery.
+func deliverNotifications(config NotificationSettings, job Job) map[string]error {
+	subject, body := notificationText(job)
+	results := make(map[string]error)
+	if config.Email.enabled() {
+		results["email"] = sendNotificationEmail(config.Email, subject, body)
+	}
+	if config.SlackWebhook != "" {
+		results["slack"] = postNotification(config.SlackWebhook, map[string]string{"text": "*" + subject + "*\n" + body})
+	}
+	if config.Webhook != "" {
+		results["webhook"] = postNotification(config.Webhook, map[string]interface{}{
+			"event": "job.finished",
+			"job":   job,
+			"url":   jobURL(job.ID),
+		})
+	}
+	for channel, err := range results {
+		if err != nil {
+			fmt.Printf("⚠️ Notifying %s over %s failed: %v\n", job.ID, channel, err)
+			raiseAlert("notify:"+channel, "", "warning", "Job notifications over "+channel+" failed: "+err.Error())
+		} else {
+			clearAlert("notify:" + channel)
+		}
+	}
+	return results
+}
+
+// jobURL links to a job's page when the public URL is known
+func jobURL(id string) string {
+	if publicURL == "" {
+		return ""
+	}
+	return strings.TrimRight(publicURL, "/") + "/job?id=" + id
+}
+
+// notificationText is the subject and plain-text body describing a finished job
+func notificationText(job Job) (string, string) {
+	subject := fmt.Sprintf("%s %s: %s", job.ID, job.Status, job.Description)
+	if job.Server != "" {
+		subject += " on " + job.Server
+	}
+	var body strings.Builder
+	body.WriteString("Kind: " + job.Kind + "\n")
+	if job.Server != "" {
+		body.WriteString("Server: " + job.Server + "\n")
+	}
+	if job.Operator != "" {
+		body.WriteString("Operator: " + job.Operator + "\n")
+	}
+	body.WriteString("Status: " + job.Status)
+	if job.ExitCode != nil {
+		body.WriteString(fmt.Sprintf(" (exit code %d)", *job.ExitCode))
+	}
+	body.WriteString("\n")
+	if job.FinishedAt != nil {
+		body.WriteString(fmt.Sprintf("Finished: %s, after %s\n", job.FinishedAt.Format("2006-01-02 15:04:05"), job.FinishedAt.Sub(job.StartedAt).Round(time.Second)))
+	}
+	if job.Error != "" {
+		body.WriteString("Error: " + job.Error + "\n")
+	}
+	if link := jobURL(job.ID); link != "" {
+		body.WriteString(link + "\n")
+	}
+	return subject, body.String()
+}
+
+// postNotification posts a JSON payload to a webhook
+func postNotification(hook string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notificationTimeout}
+	resp, err := client.Post(hook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// sendNotificationEmail sends a plain-text email, upgrading to TLS when the server offers
+// STARTTLS
+func sendNotificationEmail(config EmailNotification, subject, body string) error {
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", config.Server, notificationTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(notificationTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.Username, config.Password, host)); err != nil {
+			return err
+		}
+	}
+	// The envelope takes bare addresses; the headers keep any display names
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range config.To {
+		recipient, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	message := "From: " + config.From + "\r\n" +
+		"To: " + strings.Join(config.To, ", ") + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	if _, err := writer.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// notificationsHandler shows the notification settings
+func notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, r, "templates/notifications.html", map[string]interface{}{
+		"Settings":  settings.Notifications,
+		"PublicURL": publicURL,
+	})
+}
+
+// saveNotificationsHandler stores the notification settings. An empty password keeps the
+// stored one, so the form never has to show it.
+func saveNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	config := NotificationSettings{
+		When:         r.FormValue("when"),
+		SlackWebhook: strings.TrimSpace(r.FormValue("slack_webhook")),
+		Webhook:      strings.TrimSpace(r.FormValue("webhook")),
+		Email: EmailNotification{
+			Server:   strings.TrimSpace(r.FormValue("smtp_server")),
+			Username: strings.TrimSpace(r.FormValue("smtp_username")),
+			Password: r.FormValue("smtp_password"),
+			From:     strings.TrimSpace(r.FormValue("from")),
+			To:       strings.FieldsFunc(r.FormValue("to"), func(c rune) bool { return c == ',' || c == ' ' || c == '\n' || c == '\r' }),
+		},
+	}
+	if config.Email.Password == "" && config.Email.Username == settings.Notifications.Email.Username {
+		config.Email.Password = settings.Notifications.Email.Password
+	}
+	if err := config.validate(); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.Notifications = config
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/notifications"), http.StatusSeeOther)
+}
+
+// testNotificationHandler sends a sample notification over every configured channel and
+// reports how each went
+func testNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now()
+	sample := Job{ID: "job-test", Kind: "test", Description: "Test notification from accmgr4", Operator: requestOperator(r), Status: "succeeded", StartedAt: now, FinishedAt: &now}
+	results := deliverNotifications(settings.Notifications, sample)
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString("🔔 Test notification\n\n")
+	if len(results) == 0 {
+		logBuilder.WriteString("⚠️ No channel is configured\n")
+	}
+	for _, channel := range []string{"email", "slack", "webhook"} {
+		err, ok := results[channel]
+		switch {
+		case !ok:
+		case err != nil:
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: %v\n", channel, err))
+		default:
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: sent\n", channel))
+		}
+	}
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
+
+// jobNotifyHandler overrides whether one queued or running job is notified about
+func jobNotifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	notify := r.FormValue("notify")
+	switch notify {
+	case "", notifyAlways, notifyFailure, notifyNever:
+	default:
+		http.Error(w, "Invalid notification setting", http.StatusBadRequest)
+		return
+	}
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	job, err := setJobNotify(r.FormValue("id"), notify)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+	default:
+		http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Users can sign in with the organisation's OpenID Connect provider, such as Keycloak,
+// Azure AD or Google, instead of a local password. The browser is sent to the provider with
+// the authorization code flow and PKCE, and comes back with a code the app trades for an ID
+// token. The token's groups claim decides the user's role through the group mappings admins
+// keep on the web UI users page, and is read again at every sign-in. Users signed in this
+// way are kept as web UI users without a password, so API tokens work for them as well.
+
+// oidcProvider marks web UI users that sign in with OpenID Connect
+const oidcProvider = "oidc"
+
+const (
+	// oidcStateCookie binds a sign-in to the browser that started it
+	oidcStateCookie = "accmgr_oidc"
+	// oidcLoginTTL is how long the provider may take to send the browser back
+	oidcLoginTTL = 10 * time.Minute
+	// oidcFetchTimeout limits calls to the provider
+	oidcFetchTimeout = 15 * time.Second
+)
+
+var (
+	// oidcIssuer is the provider's issuer URL, where its discovery document lives
+	oidcIssuer string
+	// oidcClientID and oidcClientSecret are the app's client registered with the provider
+	oidcClientID, oidcClientSecret string
+	// oidcScopes are the scopes asked for, space-separated
+	oidcScopes = "openid profile email"
+	// oidcGroupsClaim is the ID token claim listing the user's groups
+	oidcGroupsClaim = "groups"
+
+	oidcMu sync.Mutex
+	// oidcConfig is the provider's discovery document, once fetched
+	oidcConfig *oidcDiscovery
+	// oidcKeys are the provider's signing keys by key ID, once fetched
+	oidcKeys map[string]crypto.PublicKey
+	// oidcLogins are the sign-ins sent to the provider, by state
+	oidcLogins = make(map[string]oidcLogin)
+)
+
+// oidcDiscovery is the part of the provider's discovery document the app uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLogin is a sign-in waiting for the provider to send the browser back
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	next     string
+	expires  time.Time
+}
+
+// oidcEnabled reports whether users can sign in with OpenID Connect
+func oidcEnabled() bool {
+	return oidcIssuer != ""
+}
+
+// validateOIDCFlags checks the OpenID Connect flags before anything is served
+func validateOIDCFlags() error {
+	switch {
+	case (oidcIssuer == "") != (oidcClientID == ""):
+		return errors.New("-oidc-issuer and -oidc-client-id must be given together")
+	case oidcIssuer != "" && !strings.HasPrefix(oidcIssuer, "https://") && !strings.HasPrefix(oidcIssuer, "http://"):
+		return errors.New("-oidc-issuer must be an http(s) URL")
+	}
+	return nil
+}
+
+// fetchOIDCJSON GETs a JSON document from the provider
+func fetchOIDCJSON(target string, v interface{}) error {
+	client := &http.Client{Timeout: oidcFetchTimeout}
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// oidcDiscover returns the provider's discovery document, fetching it the first time
+func oidcDiscover() (*oidcDiscovery, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if oidcConfig != nil {
+		return oidcConfig, nil
+	}
+	var config oidcDiscovery
+	if err := fetchOIDCJSON(strings.TrimRight(oidcIssuer, "/")+"/.well-known/openid-configuration", &config); err != nil {
+		return nil, fmt.Errorf("reading the provider's discovery document: %w", err)
+	}
+	if config.Issuer != strings.TrimRight(oidcIssuer, "/") && config.Issuer != oidcIssuer {
+		return nil, fmt.Errorf("the provider calls itself %s, not %s", config.Issuer, oidcIssuer)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		return nil, errors.New("the provider's discovery document lacks an endpoint")
+	}
+	oidcConfig = &config
+	return oidcConfig, nil
+}
+
+// oidcKey returns the provider's signing key with the key ID, fetching the keys again when
+// it is new, e.g. after the provider rotated its keys
+func oidcKey(config *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if key, ok := oidcKeys[kid]; ok {
+		return key, nil
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := fetchOIDCJSON(config.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("reading the provider's signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if jwk.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	oidcKeys = keys
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("the provider has no signing key %q", kid)
+}
+
+// verifyIDToken checks an ID token's signature, issuer, audience, expiry and nonce, and
+// returns its claims
+func verifyIDToken(config *oidcDiscovery, token, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("the ID token is malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil {
+		return nil, errors.New("the ID token's header is malformed")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("the ID token's signature is malformed")
+	}
+	key, err := oidcKey(config, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errors.New("the ID token's signature does not verify")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 ||
+			!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return nil, errors.New("the ID token's signature does not verify")
+		}
+	}
+
+	var claims map[string]interface{}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return nil, errors.New("the ID token's claims are malformed")
+	}
+	var audience []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+	expires, _ := claims["exp"].(float64)
+	claimedNonce, _ := claims["nonce"].(string)
+	switch {
+	case claims["iss"] != config.Issuer:
+		return nil, fmt.Errorf("the ID token was issued by %v, not %s", claims["iss"], config.Issuer)
+	case !slices.Contains(audience, oidcClientID):
+		return nil, errors.New("the ID token is for another client")
+	case time.Now().After(time.Unix(int64(expires), 0).Add(time.Minute)):
+		return nil, errors.New("the ID token expired")
+	case subtle.ConstantTimeCompare([]byte(claimedNonce), []byte(nonce)) != 1:
+		return nil, errors.New("the ID token belongs to another sign-in")
+	}
+	return claims, nil
+}
+
+// oidcSubject returns the identity of the ID token's user, its issuer and subject, or ""
+// when it has no subject. Unlike user names and email addresses, the provider never gives
+// it to another user.
+func oidcSubject(claims map[string]interface{}) string {
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return ""
+	}
+	return issuer + " " + subject
+}
+
+// oidcUserName returns the web UI user name a new single sign-on user gets: the preferred
+// user name, else the email address when the provider verified it, else the subject
+func oidcUserName(claims map[string]interface{}) string {
+	candidates := []string{"preferred_username"}
+	if verified, _ := claims["email_verified"].(bool); verified {
+		candidates = append(candidates, "email")
+	}
+	for _, claim := range append(candidates, "sub") {
+		if name, ok := claims[claim].(string); ok && userNamePattern.MatchString(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// oidcAccount returns the name of the web UI user a single sign-on identity signs in as
+func oidcAccount(subject string) (string, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	i := slices.IndexFunc(settings.Users, func(user WebUser) bool {
+		return user.Provider == oidcProvider && user.Subject == subject
+	})
+	if i < 0 {
+		return "", false
+	}
+	return settings.Users[i].Name, true
+}
+
+// saveOIDCUser gives the web UI user of a single sign-on identity their role, adding them
+// as name at the identity's first sign-in. A name another user has is refused.
+func saveOIDCUser(subject, name, role string) error {
+	usersMu.Lock()
+	i := slices.IndexFunc(settings.Users, func(user WebUser) bool {
+		return user.Provider == oidcProvider && user.Subject == subject
+	})
+	switch {
+	case i >= 0 && settings.Users[i].Role == role:
+		usersMu.Unlock()
+		return nil
+	case i >= 0:
+		settings.Users[i].Role = role
+	case slices.ContainsFunc(settings.Users, func(user WebUser) bool { return user.Name == name }):
+		usersMu.Unlock()
+		return fmt.Errorf("%s is taken by another user", name)
+	default:
+		settings.Users = append(settings.Users, WebUser{Name: name, Role: role, Provider: oidcProvider, Subject: subject})
+	}
+	usersMu.Unlock()
+	return saveSettings()
+}
+
+// oidcRole returns the highest role the group mappings give the ID token's groups, or ""
+func oidcRole(claims map[string]interface{}) string {
+	var groups []string
+	switch claimed := claims[oidcGroupsClaim].(type) {
+	case string:
+		groups = []string{claimed}
+	case []interface{}:
+		for _, group := range claimed {
+			if s, ok := group.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	return groupRole(providerGroups(oidcProvider), groups, func(mapped, group string) bool { return mapped == group })
+}
+
+// oidcChallenge returns the PKCE code challenge of a verifier
+func oidcChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// oidcLoginHandler sends the browser to the provider to sign in
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !oidcEnabled() {
+		http.Error(w, "❌ Single sign-on is not configured; start the app with -oidc-issuer and -oidc-client-id", http.StatusNotFound)
+		return
+	}
+	config, err := oidcDiscover()
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	state := newSessionToken()
+	login := oidcLogin{
+		nonce:    newSessionToken(),
+		verifier: newSessionToken(),
+		next:     loginTarget(r.FormValue("next")),
+		expires:  time.Now().Add(oidcLoginTTL),
+	}
+	oidcMu.Lock()
+	for existing, pending := range oidcLogins {
+		if time.Now().After(pending.expires) {
+			delete(oidcLogins, existing)
+		}
+	}
+	oidcLogins[state] = login
+	oidcMu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     appPath(r, "/oidc/"),
+		MaxAge:   int(oidcLoginTTL / time.Second),
+		HttpOnly: true,
+		Secure:   requestSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {oidcClientID},
+		"redirect_uri":          {externalURL(r, "/oidc/callback")},
+		"scope":                 {oidcScopes},
+		"state":                 {state},
+		"nonce":                 {login.nonce},
+		"code_challenge":        {oidcChallenge(login.verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(config.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, config.AuthorizationEndpoint+separator+query.Encode(), http.StatusSeeOther)
+}
+
+// exchangeOIDCCode trades the code the provider sent the browser back with for an ID token
+func exchangeOIDCCode(r *http.Request, config *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {externalURL(r, "/oidc/callback")},
+		"client_id":     {oidcClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if oidcClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(oidcClientID), url.QueryEscape(oidcClientSecret))
+	}
+	client := &http.Client{Timeout: oidcFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("the provider's token endpoint returned %s", resp.Status)
+	}
+	switch {
+	case tokens.Error != "":
+		return "", fmt.Errorf("the provider refused the code: %s %s", tokens.Error, tokens.ErrorDescription)
+	case tokens.IDToken == "":
+		return "", errors.New("the provider returned no ID token; check that the openid scope is allowed")
+	}
+	return tokens.IDToken, nil
+}
+
+// oidcCallbackHandler signs in the user the provider sent back, as the web UI user of the
+// same name with the role their groups map to
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{"Next": "/", "SSO": oidcEnabled()}
+	var name string
+	fail := func(message string) {
+		fmt.Printf("🔒 Failed single sign-on from %s: %s\n", r.RemoteAddr, message)
+		recordAudit(r, "login.failed", name, "single sign-on: "+message)
+		data["Error"] = message
+		w.WriteHeader(http.StatusUnauthorized)
+		renderTemplate(w, r, "templates/login.html", data)
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: appPath(r, "/oidc/"), MaxAge: -1})
+	state := r.FormValue("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	oidcMu.Lock()
+	login, ok := oidcLogins[state]
+	delete(oidcLogins, state)
+	oidcMu.Unlock()
+	switch {
+	case !oidcEnabled():
+		http.Error(w, "❌ Single sign-on is not configured", http.StatusNotFound)
+		return
+	case r.FormValue("error") != "":
+		fail("The provider refused the sign-in: " + strings.TrimSpace(r.FormValue("error")+" "+r.FormValue("error_description")))
+		return
+	case !ok || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1:
+		fail("The sign-in was started in another browser or took too long; try again.")
+		return
+	case time.Now().After(login.expires):
+		fail("The sign-in took too long; try again.")
+		return
+	}
+	data["Next"] = login.next
+
+	config, err := oidcDiscover()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	idToken, err := exchangeOIDCCode(r, config, r.FormValue("code"), login.verifier)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	claims, err := verifyIDToken(config, idToken, login.nonce)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	subject := oidcSubject(claims)
+	if subject == "" {
+		fail("The provider sent no subject.")
+		return
+	}
+	name, known := oidcAccount(subject)
+	if !known {
+		name = oidcUserName(claims)
+	}
+	role := oidcRole(claims)
+	switch {
+	case name == "":
+		fail("The provider sent no usable user name.")
+		return
+	case loginLockedFor(r, name) > 0:
+		fail("Sign-ins as " + name + " are locked after too many failures; try again later or ask an admin to unlock them.")
+		return
+	case role == "":
+		fail(name + " is in no group that is given a role here; ask an admin to map one of your groups.")
+		return
+	}
+	if user, exists := webUser(name); exists && !known {
+		if user.Provider != oidcProvider {
+			fail(name + " is a local user; sign in with the password instead.")
+		} else {
+			fail(name + " belongs to another single sign-on identity; ask an admin to remove that user so your sign-in can add you.")
+		}
+		return
+	}
+	if err := saveOIDCUser(subject, name, role); err != nil {
+		fail("Saving settings: " + err.Error())
+		return
+	}
+	fmt.Printf("🔑 %s signed in with single sign-on as %s\n", name, role)
+	loginSucceeded(r, name, "single sign-on")
+	token, expires := startSession(name)
+	setSessionCookie(w, r, token, expires)
+	http.Redirect(w, r, appPath(r, login.next), http.StatusSeeOther)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// signTestIDToken signs claims as an ES256 ID token with key ID kid
+func signTestIDToken(t *testing.T, key *ecdsa.PrivateKey, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	savedKeys, savedClient := oidcKeys, oidcClientID
+	t.Cleanup(func() { oidcKeys, oidcClientID = savedKeys, savedClient })
+	oidcKeys = map[string]crypto.PublicKey{"k1": &key.PublicKey}
+	oidcClientID = "accmgr"
+	config := &oidcDiscovery{Issuer: "https://idp.example.com"}
+
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   "https://idp.example.com",
+			"aud":   "accmgr",
+			"sub":   "123",
+			"exp":   float64(time.Now().Add(time.Hour).Unix()),
+			"nonce": "n1",
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", signTestIDToken(t, key, "ES256", "k1", claims(nil)), true},
+		{"audience list", signTestIDToken(t, key, "ES256", "k1", claims(func(c map[string]interface{}) { c["aud"] = []interface{}{"other", "accmgr"} })), true},
+		{"other issuer", signTestIDToken(t, key, "ES256", "k1", claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" })), false},
+		{"other client", signTestIDToken(t, key, "ES256", "k1", claims(func(c map[string]interface{}) { c["aud"] = "other" })), false},
+		{"expired", signTestIDToken(t, key, "ES256", "k1", claims(func(c map[string]interface{}) { c["exp"] = float64(time.Now().Add(-time.Hour).Unix()) })), false},
+		{"no expiry", signTestIDToken(t, key, "ES256", "k1", claims(func(c map[string]interface{}) { delete(c, "exp") })), false},
+		{"other sign-in", signTestIDToken(t, key, "ES256", "k1", claims(func(c map[string]interface{}) { c["nonce"] = "n2" })), false},
+		{"other key", signTestIDToken(t, other, "ES256", "k1", claims(nil)), false},
+		{"algorithm does not fit the key", signTestIDToken(t, key, "RS256", "k1", claims(nil)), false},
+		{"malformed", "not.a-token", false},
+	}
+	for _, tt := range tests {
+		_, err := verifyIDToken(config, tt.token, "n1")
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: verifyIDToken error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestOIDCClaims(t *testing.T) {
+	tests := []struct {
+		name          string
+		claims        map[string]interface{}
+		subject, user string
+	}{
+		{"preferred user name", map[string]interface{}{"iss": "https://idp", "sub": "1", "preferred_username": "alice", "email": "a@example.com", "email_verified": true}, "https://idp 1", "alice"},
+		{"verified email", map[string]interface{}{"iss": "https://idp", "sub": "2", "email": "bob@example.com", "email_verified": true}, "https://idp 2", "bob@example.com"},
+		{"unverified email is not trusted", map[string]interface{}{"iss": "https://idp", "sub": "3", "email": "admin@example.com"}, "https://idp 3", "3"},
+		{"invalid user name falls back", map[string]interface{}{"iss": "https://idp", "sub": "4", "preferred_username": "bad name"}, "https://idp 4", "4"},
+		{"no subject", map[string]interface{}{"iss": "https://idp", "preferred_username": "eve"}, "", "eve"},
+	}
+	for _, tt := range tests {
+		if got := oidcSubject(tt.claims); got != tt.subject {
+			t.Errorf("%s: oidcSubject = %q, want %q", tt.name, got, tt.subject)
+		}
+		if got := oidcUserName(tt.claims); got != tt.user {
+			t.Errorf("%s: oidcUserName = %q, want %q", tt.name, got, tt.user)
+		}
+	}
+}
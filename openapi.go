@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// apiTypeName is the schema and client name for an API type, e.g. APIServer becomes Server
+func apiTypeName(t reflect.Type) string {
+	return strings.TrimPrefix(t.Name(), "API")
+}
+
+// apiField is one JSON field of an API struct
+type apiField struct {
+	GoName    string
+	JSONName  string
+	Type      reflect.Type
+	OmitEmpty bool
+}
+
+// apiFields lists the JSON fields of an API struct in declaration order
+func apiFields(t reflect.Type) []apiField {
+	var fields []apiField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, apiField{
+			GoName:    field.Name,
+			JSONName:  name,
+			Type:      field.Type,
+			OmitEmpty: strings.Contains(opts, "omitempty"),
+		})
+	}
+	return fields
+}
+
+// openAPISchema returns the JSON schema for a Go type, registering structs as components
+func openAPISchema(t reflect.Type, components map[string]any) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return openAPISchema(t.Elem(), components)
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": openAPISchema(t.Elem(), components)}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": openAPISchema(t.Elem(), components)}
+	case t.Kind() == reflect.Struct:
+		name := apiTypeName(t)
+		if _, ok := components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			components[name] = nil
+			properties := make(map[string]any)
+			var required []string
+			for _, field := range apiFields(t) {
+				properties[field.JSONName] = openAPISchema(field.Type, components)
+				if !field.OmitEmpty && field.Type.Kind() != reflect.Pointer {
+					required = append(required, field.JSONName)
+				}
+			}
+			schema := map[string]any{"type": "object", "properties": properties}
+			if len(required) > 0 {
+				schema["required"] = required
+			}
+			components[name] = schema
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// openAPIDocument builds the OpenAPI 3 document from the route registry
+func openAPIDocument() map[string]any {
+	components := make(map[string]any)
+	errorSchema := openAPISchema(reflect.TypeOf(APIError{}), components)
+	paths := make(map[string]any)
+
+	for _, route := range apiRoutes {
+		operation := map[string]any{
+			"operationId": route.OperationID,
+			"summary":     route.Summary,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content":     map[string]any{"application/json": map[string]any{"schema": openAPISchema(reflect.TypeOf(route.Response), components)}},
+				},
+				"default": map[string]any{
+					"description": "Error",
+					"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+				},
+			},
+		}
+
+		var params []any
+		for _, param := range route.Params {
+			params = append(params, map[string]any{
+				"name":        param.Name,
+				"in":          param.In,
+				"required":    param.In == "path",
+				"description": param.Description,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if route.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": openAPISchema(reflect.TypeOf(route.Request), components)}},
+			}
+		}
+
+		item, _ := paths[route.Path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "accmgr4 API",
+			"version":     "v1",
+			"description": "Fleet inventory and remote commands for the Bulk Account Manager.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"token": map[string]any{"type": "http", "scheme": "bearer", "description": "An API token from the API Tokens page"},
+				"basic": map[string]any{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []map[string]any{{"token": []string{}}, {"basic": []string{}}},
+	}
+}
+
+// openAPIHandler serves the generated OpenAPI document, pointing clients at this deployment
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc := openAPIDocument()
+	doc["servers"] = []map[string]any{{"url": externalURL(r, "")}}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// apiDocsHandler serves Swagger UI pointed at the OpenAPI document
+func apiDocsHandler(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, r, "templates/api_docs.html", nil)
+}
+
+// goTypeName renders a Go type for the generated client
+func goTypeName(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "time.Time"
+	case t.Kind() == reflect.Pointer:
+		return "*" + goTypeName(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return "[]" + goTypeName(t.Elem())
+	case t.Kind() == reflect.Map:
+		return "map[" + goTypeName(t.Key()) + "]" + goTypeName(t.Elem())
+	case t.Kind() == reflect.Struct:
+		return apiTypeName(t)
+	default:
+		return t.Kind().String()
+	}
+}
+
+// collectAPIStructs finds every struct type reachable from t
+func collectAPIStructs(t reflect.Type, seen map[string]reflect.Type) {
+	switch {
+	case t == timeType:
+	case t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map:
+		collectAPIStructs(t.Elem(), seen)
+	case t.Kind() == reflect.Struct:
+		if _, ok := seen[apiTypeName(t)]; ok {
+			return
+		}
+		seen[apiTypeName(t)] = t
+		for _, field := range apiFields(t) {
+			collectAPIStructs(field.Type, seen)
+		}
+	}
+}
+
+// generateAPIClient renders the Go client package source from the route registry
+func generateAPIClient() ([]byte, error) {
+	var src bytes.Buffer
+	src.WriteString(`// Code generated by "accountmanager -generate-client"; DO NOT EDIT.
+
+// Package client is a typed Go client for the accmgr4 /api/v1 endpoints.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client calls the accmgr4 API at BaseURL, e.g. "http://accmgr:8080", as the user of
+// Token, an API token
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the given base URL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+// do sends one request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr Error
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+`)
+
+	structs := make(map[string]reflect.Type)
+	collectAPIStructs(reflect.TypeOf(APIError{}), structs)
+	for _, route := range apiRoutes {
+		if route.Request != nil {
+			collectAPIStructs(reflect.TypeOf(route.Request), structs)
+		}
+		collectAPIStructs(reflect.TypeOf(route.Response), structs)
+	}
+	names := make([]string, 0, len(structs))
+	for name := range structs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(&src, "\n// %s mirrors the server's %s type\ntype %s struct {\n", name, structs[name].Name(), name)
+		for _, field := range apiFields(structs[name]) {
+			tag := field.JSONName
+			if field.OmitEmpty {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&src, "\t%s %s `json:%q`\n", field.GoName, goTypeName(field.Type), tag)
+		}
+		src.WriteString("}\n")
+	}
+
+	for _, route := range apiRoutes {
+		method := strings.ToUpper(route.OperationID[:1]) + route.OperationID[1:]
+		args := []string{"ctx context.Context"}
+		var queryLines []string
+		for _, param := range route.Params {
+			args = append(args, param.Name+" string")
+			if param.In == "query" {
+				queryLines = append(queryLines, fmt.Sprintf("\tif %s != \"\" {\n\t\tquery.Set(%q, %s)\n\t}\n", param.Name, param.Name, param.Name))
+			}
+		}
+		body := "nil"
+		if route.Request != nil {
+			args = append(args, "body "+goTypeName(reflect.TypeOf(route.Request)))
+			body = "body"
+		}
+
+		// Substitute path parameters, escaping each value
+		path := fmt.Sprintf("%q", route.Path)
+		for _, param := range route.Params {
+			if param.In == "path" {
+				path = strings.Replace(path, "{"+param.Name+"}", `" + url.PathEscape(`+param.Name+`) + "`, 1)
+			}
+		}
+		path = strings.TrimSuffix(strings.TrimPrefix(path, `"" + `), ` + ""`)
+
+		responseType := goTypeName(reflect.TypeOf(route.Response))
+		fmt.Fprintf(&src, "\n// %s calls %s %s: %s\n", method, route.Method, route.Path, route.Summary)
+		fmt.Fprintf(&src, "func (c *Client) %s(%s) (%s, error) {\n", method, strings.Join(args, ", "), responseType)
+		src.WriteString("\tquery := url.Values{}\n")
+		for _, line := range queryLines {
+			src.WriteString(line)
+		}
+		fmt.Fprintf(&src, "\tvar out %s\n", responseType)
+		fmt.Fprintf(&src, "\terr := c.do(ctx, %q, %s, query, %s, &out)\n", route.Method, path, body)
+		src.WriteString("\treturn out, err\n}\n")
+	}
+
+	return format.Source(src.Bytes())
+}
+
+// writeAPIClient regenerates the client package at path
+func writeAPIClient(path string) error {
+	src, err := generateAPIClient()
+	if err != nil {
+		return fmt.Errorf("formatting generated client: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, src, 0644)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Operator identity modes for commands an accmgr4 user starts
+const (
+	// identityShared runs everything through the server's stored admin account (the default)
+	identityShared = ""
+	// identityTagged keeps the shared account but exports the operator to the command and
+	// logs it to the remote authpriv syslog, so auth.log shows who ran each command
+	identityTagged = "tagged"
+	// identityAccounts logs in as the operator's own remote account, so sshd and sudo record
+	// the operator directly and sudo sets SUDO_USER to them. Operators without an account
+	// are refused rather than falling back to the shared one.
+	identityAccounts = "accounts"
+)
+
+// defaultOperatorHeader is where a trusted reverse proxy puts the authenticated user
+const defaultOperatorHeader = "X-Forwarded-User"
+
+var (
+	// proxyAuthCIDRs are the reverse proxies, comma-separated addresses and CIDR ranges, whose
+	// operator header signs users in; empty never reads the header
+	proxyAuthCIDRs string
+	// proxyAuthNetworks are proxyAuthCIDRs parsed
+	proxyAuthNetworks []netip.Prefix
+)
+
+// AccountabilitySettings controls how operator-initiated commands are attributed on servers
+type AccountabilitySettings struct {
+	Mode string `json:"mode,omitempty"`
+	// Header names the request header carrying the operator; it is only read from the
+	// proxies of -proxy-auth
+	Header string `json:"header,omitempty"`
+	// Accounts maps operator names to their remote accounts for the accounts mode
+	Accounts map[string]OperatorAccount `json:"accounts,omitempty"`
+}
+
+// OperatorAccount is an operator's personal login on managed servers
+type OperatorAccount struct {
+	Username string `json:"username"`
+	// Password answers sudo; leave it empty for NOPASSWD sudo with a key
+	Password string `json:"password,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+}
+
+// header returns the configured operator header, defaulting to X-Forwarded-User
+func (a AccountabilitySettings) header() string {
+	if a.Header == "" {
+		return defaultOperatorHeader
+	}
+	return a.Header
+}
+
+// requestOperator returns the user signed in to the request, or the operator a trusted proxy
+// authenticated for it, or ""
+func requestOperator(r *http.Request) string {
+	if user, ok := r.Context().Value(loginUserKey{}).(string); ok {
+		return user
+	}
+	return proxyUser(r)
+}
+
+// parseProxyAuth parses proxyAuthCIDRs before anything is served
+func parseProxyAuth() (err error) {
+	proxyAuthNetworks, err = parseNetworks("-proxy-auth", proxyAuthCIDRs)
+	return err
+}
+
+// proxyUser returns the operator a trusted proxy authenticated in the operator header, or "".
+// The header is only read from connections of the -proxy-auth proxies, by their own
+// address rather than X-Forwarded-For, since any client can send the header.
+func proxyUser(r *http.Request) string {
+	if len(proxyAuthNetworks) == 0 {
+		return ""
+	}
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !networksContain(proxyAuthNetworks, peer) {
+		return ""
+	}
+	value, _, _ := strings.Cut(r.Header.Get(settings.Accountability.header()), ",")
+	return strings.TrimSpace(value)
+}
+
+// grpcOperator is requestOperator for gRPC calls: the user of the API token the call sent
+func grpcOperator(ctx context.Context) string {
+	user, _ := ctx.Value(loginUserKey{}).(string)
+	return user
+}
+
+// operatorServer returns the server record an operator's command logs in with. In the
+// accounts mode it is the operator's own account; otherwise the record is unchanged.
+func operatorServer(server ServerInfo, operator string) (ServerInfo, error) {
+	if settings.Accountability.Mode != identityAccounts {
+		return server, nil
+	}
+	if operator == "" {
+		return server, fmt.Errorf("operator accounts are required but the request does not identify an operator (%s header)", settings.Accountability.header())
+	}
+	account, ok := settings.Accountability.Accounts[operator]
+	if !ok || account.Username == "" {
+		return server, fmt.Errorf("no remote account is configured for operator %s", operator)
+	}
+	login := server
+	login.RootUsername = account.Username
+	login.RootPassword = account.Password
+	login.KeyFile, login.CertFile = account.KeyFile, ""
+	login.UseAgent = false
+	login.RunAs = nil
+	return login, nil
+}
+
+// operatorScript tags a Linux script with the operator and job: both are exported as
+// ACCMGR_OPERATOR and ACCMGR_JOB, which also puts them in the command sudo logs, and a
+// line is sent to the authpriv syslog facility. Shared mode and Windows are unchanged.
+func operatorScript(server ServerInfo, script, operator, jobID string) string {
+	if settings.Accountability.Mode == identityShared || server.isWindows() {
+		return script
+	}
+	if operator == "" {
+		operator = "unknown"
+	}
+	tag := "operator=" + operator + " job=" + jobID
+	return "export ACCMGR_OPERATOR=" + shellQuote(operator) + " ACCMGR_JOB=" + shellQuote(jobID) + "\n" +
+		"logger -p authpriv.notice -t accmgr4 " + shellQuote(tag) + " 2>/dev/null || true\n" +
+		script
+}
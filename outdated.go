@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// securityMarker is printed by the outdated check with the number of pending security updates
+const securityMarker = "__ACCMGR_SECURITY__="
+
+// outdatedFile stores the latest pending update counts across restarts
+const outdatedFile = "outdated.json"
+
+// OutdatedPackages is the number of updates pending on a server when it was last checked
+type OutdatedPackages struct {
+	IP        string    `json:"ip"`
+	CheckedAt time.Time `json:"checked_at"`
+	Manager   string    `json:"manager,omitempty"`
+	Pending   int       `json:"pending"`
+	// Security is how many of the pending updates are security fixes, or -1 when the
+	// package manager does not say
+	Security int    `json:"security"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Critical reports whether security updates are outstanding
+func (o OutdatedPackages) Critical() bool {
+	return o.Error == "" && o.Security > 0
+}
+
+// Flagged reports whether the server has security updates or at least threshold pending
+func (o OutdatedPackages) Flagged(threshold int) bool {
+	return o.Critical() || (o.Error == "" && o.Pending >= threshold)
+}
+
+var (
+	outdatedMu     sync.RWMutex
+	outdatedReport = make(map[string]OutdatedPackages)
+	// lastOutdatedRun is when the check last finished a round
+	lastOutdatedRun time.Time
+)
+
+// outdatedCheckInterval returns how often pending updates are counted, defaulting to six hours
+func (h HealthSettings) outdatedCheckInterval() time.Duration {
+	if h.OutdatedCheckIntervalSeconds <= 0 {
+		return 6 * time.Hour
+	}
+	return time.Duration(h.OutdatedCheckIntervalSeconds) * time.Second
+}
+
+// outdatedThreshold returns how many pending updates flag a server, defaulting to 50
+func (h HealthSettings) outdatedThreshold() int {
+	if h.OutdatedThreshold <= 0 {
+		return 50
+	}
+	return h.OutdatedThreshold
+}
+
+// loadOutdated reads outdated.json; a missing file means no server was checked yet
+func loadOutdated() error {
+	file, err := os.Open(outdatedFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	outdatedMu.Lock()
+	defer outdatedMu.Unlock()
+	return json.NewDecoder(file).Decode(&outdatedReport)
+}
+
+// saveOutdated writes outdated.json; callers hold outdatedMu
+func saveOutdated() error {
+	file, err := os.Create(outdatedFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(outdatedReport)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+// checkOutdated counts the pending and security updates of a Linux server. The check runs
+// as the login user without refreshing the index, so the counts reflect the server's last
+// refresh, which the distributions' daily timers normally keep recent.
+func checkOutdated(ip string, server ServerInfo) OutdatedPackages {
+	outdated := OutdatedPackages{IP: ip, CheckedAt: time.Now(), Security: -1}
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		outdated.Error = err.Error()
+		return outdated
+	}
+	outdated.Manager = manager.Name()
+
+	script := "echo " + pendingMarker + "$(" + manager.Upgradable() + " | wc -l)"
+	if _, upgradable, err := securityCommands(manager, verbosityQuiet); err == nil {
+		script += "; echo " + securityMarker + "$(" + upgradable + " | wc -l)"
+	}
+	result, err := runProbeCommand(ip, server, script)
+	if err := commandError(result, err); err != nil {
+		outdated.Error = err.Error()
+		return outdated
+	}
+	outdated.Pending = -1
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if value, ok := strings.CutPrefix(line, pendingMarker); ok {
+			outdated.Pending, _ = strconv.Atoi(value)
+		}
+		if value, ok := strings.CutPrefix(line, securityMarker); ok {
+			outdated.Security, _ = strconv.Atoi(value)
+		}
+	}
+	if outdated.Pending < 0 {
+		outdated.Error = "unexpected output: " + strings.TrimSpace(result.Output())
+	}
+	return outdated
+}
+
+// runOutdatedCheck counts pending updates on every Linux server on the configured interval.
+// It runs under superviseWorker, which restarts it if it panics.
+func runOutdatedCheck() {
+	for {
+		reportOutdated()
+		time.Sleep(settings.Health.outdatedCheckInterval())
+	}
+}
+
+// reportOutdated checks every Linux server in parallel, stores the counts and alerts on
+// servers with security updates or more pending updates than the threshold
+func reportOutdated() {
+	threshold := settings.Health.outdatedThreshold()
+	servers := serversSnapshot()
+	fanOut(linuxServerIPs(servers), func(i int, ip string) {
+		defer catchWorkerPanic("outdated-packages")
+		outdated := checkOutdated(ip, servers[ip])
+
+		outdatedMu.Lock()
+		outdatedReport[ip] = outdated
+		outdatedMu.Unlock()
+
+		alertKey := "outdated:" + ip
+		switch {
+		case outdated.Critical():
+			raiseAlert(alertKey, ip, "critical", fmt.Sprintf("%d security updates outstanding (%d updates pending)", outdated.Security, outdated.Pending))
+		case outdated.Flagged(threshold):
+			raiseAlert(alertKey, ip, "warning", fmt.Sprintf("%d updates pending", outdated.Pending))
+		case outdated.Error == "":
+			clearAlert(alertKey)
+		}
+	})
+
+	outdatedMu.Lock()
+	lastOutdatedRun = time.Now()
+	if err := saveOutdated(); err != nil {
+		fmt.Println("❌ Saving outdated package report:", err)
+	}
+	outdatedMu.Unlock()
+}
+
+// outdatedPackagesHandler shows the latest counts, flagged servers first and then by the
+// number of pending updates
+func outdatedPackagesHandler(w http.ResponseWriter, r *http.Request) {
+	threshold := settings.Health.outdatedThreshold()
+	servers := requestServers(r)
+	outdatedMu.RLock()
+	report := make([]OutdatedPackages, 0, len(outdatedReport))
+	for ip, outdated := range outdatedReport {
+		if _, ok := servers[ip]; ok {
+			report = append(report, outdated)
+		}
+	}
+	ranAt := lastOutdatedRun
+	outdatedMu.RUnlock()
+
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a.Critical() != b.Critical() {
+			return a.Critical()
+		}
+		if a.Flagged(threshold) != b.Flagged(threshold) {
+			return a.Flagged(threshold)
+		}
+		if a.Pending != b.Pending {
+			return a.Pending > b.Pending
+		}
+		return a.IP < b.IP
+	})
+
+	renderTemplate(w, r, "templates/outdated.html", map[string]interface{}{
+		"Report":    report,
+		"RanAt":     ranAt,
+		"Threshold": threshold,
+	})
+}
+
+// runOutdatedReportHandler runs the check now instead of waiting for the next round
+func runOutdatedReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reportOutdated()
+	http.Redirect(w, r, appPath(r, "/outdated-packages"), http.StatusSeeOther)
+}
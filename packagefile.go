@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// backendURL installs a .deb or .rpm downloaded from the vendor, for software that is not
+// in any repository
+const backendURL = "url"
+
+// sha256Pattern matches a hex SHA-256 digest
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// packageFileType returns the package file format the manager installs, or "" for
+// managers without one accmgr4 supports
+func packageFileType(manager string) string {
+	switch manager {
+	case "apt":
+		return "deb"
+	case "dnf", "yum", "zypper":
+		return "rpm"
+	}
+	return ""
+}
+
+// validatePackageURL checks a package download URL and its SHA-256 digest. Both are
+// required: the digest is what makes a plain http download or a compromised mirror safe.
+func validatePackageURL(rawURL, sha256 string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("invalid package URL %q: use an http or https URL", rawURL)
+	}
+	if strings.ContainsAny(rawURL, " \t\r\n'\"`") {
+		return fmt.Errorf("invalid package URL %q", rawURL)
+	}
+	if !sha256Pattern.MatchString(sha256) {
+		return fmt.Errorf("the package at %s needs its SHA-256 checksum as 64 lowercase hex digits", rawURL)
+	}
+	return nil
+}
+
+// parsePackageURLSpec reads a custom "https://vendor/app.deb#sha256=<digest>" spec, the
+// form pip uses for hashed URLs. The file type comes from the URL's extension.
+func parsePackageURLSpec(spec string) (softwareSelection, error) {
+	rawURL, fragment, _ := strings.Cut(spec, "#")
+	sha256, ok := strings.CutPrefix(fragment, "sha256=")
+	if !ok {
+		return softwareSelection{}, fmt.Errorf("add the checksum to %s as #sha256=<digest>", rawURL)
+	}
+	sha256 = strings.ToLower(sha256)
+	if err := validatePackageURL(rawURL, sha256); err != nil {
+		return softwareSelection{}, err
+	}
+	parsed, _ := url.Parse(rawURL)
+	name := path.Base(parsed.Path)
+	selection := softwareSelection{Name: name, Backend: backendURL}
+	switch path.Ext(name) {
+	case ".deb":
+		selection.DebURL, selection.DebSHA256 = rawURL, sha256
+	case ".rpm":
+		selection.RpmURL, selection.RpmSHA256 = rawURL, sha256
+	default:
+		return softwareSelection{}, fmt.Errorf("%s does not end in .deb or .rpm", rawURL)
+	}
+	return selection, nil
+}
+
+// curlBootstrap installs curl when it is missing, for the package download; run Update first
+func curlBootstrap(manager PackageManager, verbosity string) string {
+	return "command -v curl >/dev/null 2>&1 || " + manager.Install([]string{"curl"}, verbosity)
+}
+
+// packageFileInstall downloads a selection's package file for the manager into a temporary
+// directory, checks its digest and installs it with the manager, which resolves its
+// dependencies from the configured repositories. The directory is removed either way.
+func packageFileInstall(manager PackageManager, selection softwareSelection, verbosity string) (string, error) {
+	fileType := packageFileType(manager.Name())
+	rawURL, sha256 := selection.DebURL, selection.DebSHA256
+	if fileType == "rpm" {
+		rawURL, sha256 = selection.RpmURL, selection.RpmSHA256
+	}
+	switch {
+	case fileType == "":
+		return "", fmt.Errorf("installing package files is not supported with %s", manager.Name())
+	case rawURL == "":
+		return "", fmt.Errorf("%s has no .%s download for %s", selection.Name, fileType, manager.Name())
+	}
+	file := `"$d/package.` + fileType + `"`
+	var install string
+	switch manager.Name() {
+	case "apt":
+		install = "DEBIAN_FRONTEND=noninteractive apt-get " + verbosityFlag(verbosity, "-qq", "") + "install -y " + file
+	case "zypper":
+		// Vendor packages are often signed with a key the server does not have; the
+		// checksum already vouches for the file
+		install = "zypper --non-interactive " + verbosityFlag(verbosity, "-q", "-v") + "install --allow-unsigned-rpm " + file
+	default:
+		install = manager.Name() + " " + verbosityFlag(verbosity, "-q", "-v") + "install -y " + file
+	}
+	return "( d=$(mktemp -d) && trap 'rm -rf \"$d\"' EXIT && " +
+		"curl -fsSL -o " + file + " " + shellQuote(rawURL) + " && " +
+		"echo " + shellQuote(sha256+"  ") + file + " | sha256sum -c - && " +
+		install + " )", nil
+}
+
+// errPackageFileRemove explains why packages installed from a URL are removed by name
+var errPackageFileRemove = errors.New("packages installed from a URL are removed by their package name: uninstall them as custom packages with the package manager")
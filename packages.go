@@ -0,0 +1,544 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PackageManager builds the shell commands for one Linux package manager. Package names
+// are shell-quoted by the implementation; verbosity is one of the verbosity levels.
+type PackageManager interface {
+	// Name is the manager's command, e.g. "apt" or "dnf"
+	Name() string
+	// Update refreshes the package index
+	Update(verbosity string) string
+	// Install installs packages without prompting
+	Install(packages []string, verbosity string) string
+	// Remove uninstalls packages without prompting; purge also deletes their configuration
+	// where the manager can
+	Remove(packages []string, purge bool, verbosity string) string
+	// Query exits 0 when the package is installed and prints nothing
+	Query(pkg string) string
+	// List prints the name of every installed package, one per line
+	List() string
+	// ListVersions prints "name version" for every installed package, one per line
+	ListVersions() string
+	// Upgrade upgrades every installed package without prompting; run Update first
+	Upgrade(verbosity string) string
+	// Upgradable prints one line per package with a pending upgrade; run Update first
+	Upgradable() string
+	// UpgradePackages upgrades installed packages to their newest version without
+	// prompting, leaving them alone when they are current; run Update first
+	UpgradePackages(packages []string, verbosity string) string
+	// Pin returns the install argument for a package at version, which may end in ".*" to
+	// accept any release with that prefix; see parsePackageSpec
+	Pin(name, version string) (string, error)
+}
+
+// packageManagers lists every supported manager in detection order
+var packageManagers = []PackageManager{aptManager{}, apkManager{}, dnfManager{}, yumManager{}, pacmanManager{}, zypperManager{}}
+
+// versionPattern matches the versions accepted in package specs: a Debian, RPM or Alpine
+// version, optionally ending in ".*" to match any release with that prefix
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+~:_-]*(\.\*)?$`)
+
+// parsePackageSpec splits "nginx=1.24.*" into its name and version; the version is empty
+// for an unpinned package
+func parsePackageSpec(spec string) (string, string, error) {
+	name, version, pinned := strings.Cut(spec, "=")
+	if name == "" {
+		return "", "", fmt.Errorf("invalid package %q", spec)
+	}
+	if pinned && !versionPattern.MatchString(version) {
+		return "", "", fmt.Errorf("invalid version %q for %s", version, name)
+	}
+	return name, version, nil
+}
+
+// wildcardVersion returns a version without its trailing ".*" and whether it had one
+func wildcardVersion(version string) (string, bool) {
+	prefix, found := strings.CutSuffix(version, ".*")
+	return prefix, found
+}
+
+// pinnedPackages translates package specs into install arguments for a manager
+func pinnedPackages(manager PackageManager, specs []string) ([]string, error) {
+	packages := make([]string, len(specs))
+	for i, spec := range specs {
+		name, version, err := parsePackageSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if version == "" {
+			packages[i] = name
+			continue
+		}
+		if packages[i], err = manager.Pin(name, version); err != nil {
+			return nil, err
+		}
+	}
+	return packages, nil
+}
+
+// quotedPackages shell-quotes a package list
+func quotedPackages(packages []string) string {
+	quoted := make([]string, len(packages))
+	for i, pkg := range packages {
+		quoted[i] = shellQuote(pkg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// verbosityFlag picks the quiet or debug flag for a manager; normal adds nothing
+func verbosityFlag(verbosity, quiet, debug string) string {
+	switch verbosity {
+	case verbosityQuiet:
+		return quiet + " "
+	case verbosityDebug:
+		if debug != "" {
+			return debug + " "
+		}
+	}
+	return ""
+}
+
+// aptManager drives apt-get on Debian and Ubuntu. apt-get is used rather than apt because
+// its command line is stable for scripts.
+type aptManager struct{}
+
+func (aptManager) Name() string { return "apt" }
+
+func (aptManager) Update(verbosity string) string {
+	return "apt-get " + verbosityFlag(verbosity, "-qq", "") + "update"
+}
+
+func (aptManager) Install(packages []string, verbosity string) string {
+	return "DEBIAN_FRONTEND=noninteractive apt-get " + verbosityFlag(verbosity, "-qq", "") + "install -y " + quotedPackages(packages)
+}
+
+func (aptManager) Remove(packages []string, purge bool, verbosity string) string {
+	action := "remove"
+	if purge {
+		action = "purge"
+	}
+	return "DEBIAN_FRONTEND=noninteractive apt-get " + verbosityFlag(verbosity, "-qq", "") + action + " -y " + quotedPackages(packages)
+}
+
+func (aptManager) Query(pkg string) string {
+	return "dpkg -s " + shellQuote(pkg) + " >/dev/null 2>&1"
+}
+
+func (aptManager) List() string {
+	return aptInstalled + ` | awk '{print $1}'`
+}
+
+func (aptManager) ListVersions() string {
+	return aptInstalled
+}
+
+func (aptManager) Upgrade(verbosity string) string {
+	return "DEBIAN_FRONTEND=noninteractive apt-get " + verbosityFlag(verbosity, "-qq", "") + "upgrade -y"
+}
+
+func (aptManager) Upgradable() string {
+	return "apt-get -s upgrade 2>/dev/null | grep '^Inst '"
+}
+
+func (aptManager) UpgradePackages(packages []string, verbosity string) string {
+	return "DEBIAN_FRONTEND=noninteractive apt-get " + verbosityFlag(verbosity, "-qq", "") + "install --only-upgrade -y " + quotedPackages(packages)
+}
+
+// Pin uses apt's own syntax, which already understands a trailing "*"
+func (aptManager) Pin(name, version string) (string, error) {
+	return name + "=" + version, nil
+}
+
+// aptInstalled prints "name version" for packages dpkg reports as installed, leaving out
+// removed packages whose configuration files remain
+const aptInstalled = `dpkg-query -W -f='${db:Status-Abbrev} ${Package} ${Version}\n' | awk '$1 == "ii" {print $2, $3}'`
+
+// apkManager drives apk on Alpine
+type apkManager struct{}
+
+func (apkManager) Name() string { return "apk" }
+
+func (apkManager) Update(verbosity string) string {
+	return "apk " + verbosityFlag(verbosity, "-q", "-v") + "update"
+}
+
+func (apkManager) Install(packages []string, verbosity string) string {
+	return "apk " + verbosityFlag(verbosity, "-q", "-v") + "add " + quotedPackages(packages)
+}
+
+func (apkManager) Remove(packages []string, purge bool, verbosity string) string {
+	flags := ""
+	if purge {
+		flags = "--purge "
+	}
+	return "apk " + verbosityFlag(verbosity, "-q", "-v") + "del " + flags + quotedPackages(packages)
+}
+
+func (apkManager) Query(pkg string) string {
+	return "apk info -e " + shellQuote(pkg) + " >/dev/null 2>&1"
+}
+
+func (apkManager) List() string {
+	return "apk info -q"
+}
+
+func (apkManager) ListVersions() string {
+	return `apk info -v 2>/dev/null | sed -E 's/^(.+)-([^-]+-r[0-9]+)$/\1 \2/'`
+}
+
+func (apkManager) Upgrade(verbosity string) string {
+	return "apk " + verbosityFlag(verbosity, "-q", "-v") + "upgrade"
+}
+
+func (apkManager) Upgradable() string {
+	return "apk version -l '<' 2>/dev/null | tail -n +2"
+}
+
+func (apkManager) UpgradePackages(packages []string, verbosity string) string {
+	return "apk " + verbosityFlag(verbosity, "-q", "-v") + "upgrade " + quotedPackages(packages)
+}
+
+// Pin uses "~" for wildcard versions, apk's prefix match
+func (apkManager) Pin(name, version string) (string, error) {
+	if prefix, wildcard := wildcardVersion(version); wildcard {
+		return name + "~" + prefix, nil
+	}
+	return name + "=" + version, nil
+}
+
+// dnfManager drives dnf on Fedora and current RHEL derivatives
+type dnfManager struct{}
+
+func (dnfManager) Name() string { return "dnf" }
+
+func (dnfManager) Update(verbosity string) string {
+	return "dnf " + verbosityFlag(verbosity, "-q", "-v") + "makecache"
+}
+
+func (dnfManager) Install(packages []string, verbosity string) string {
+	return "dnf " + verbosityFlag(verbosity, "-q", "-v") + "install -y " + quotedPackages(packages)
+}
+
+// Remove ignores purge: rpm already deletes unmodified configuration and keeps edited
+// files as .rpmsave
+func (dnfManager) Remove(packages []string, purge bool, verbosity string) string {
+	return "dnf " + verbosityFlag(verbosity, "-q", "-v") + "remove -y " + quotedPackages(packages)
+}
+
+func (dnfManager) Query(pkg string) string {
+	return "rpm -q " + shellQuote(pkg) + " >/dev/null 2>&1"
+}
+
+func (dnfManager) List() string {
+	return `rpm -qa --qf '%{NAME}\n'`
+}
+
+func (dnfManager) ListVersions() string {
+	return `rpm -qa --qf '%{NAME} %{VERSION}-%{RELEASE}\n'`
+}
+
+func (dnfManager) Upgrade(verbosity string) string {
+	return "dnf " + verbosityFlag(verbosity, "-q", "-v") + "upgrade -y"
+}
+
+func (dnfManager) Upgradable() string {
+	return "dnf -q list --upgrades 2>/dev/null | tail -n +2"
+}
+
+func (dnfManager) UpgradePackages(packages []string, verbosity string) string {
+	return "dnf " + verbosityFlag(verbosity, "-q", "-v") + "upgrade -y " + quotedPackages(packages)
+}
+
+// Pin uses a name-version glob, which dnf matches against available packages
+func (dnfManager) Pin(name, version string) (string, error) {
+	return name + "-" + version, nil
+}
+
+// yumManager drives yum on CentOS 7 and other hosts without dnf
+type yumManager struct{}
+
+func (yumManager) Name() string { return "yum" }
+
+func (yumManager) Update(verbosity string) string {
+	return "yum " + verbosityFlag(verbosity, "-q", "-v") + "makecache"
+}
+
+func (yumManager) Install(packages []string, verbosity string) string {
+	return "yum " + verbosityFlag(verbosity, "-q", "-v") + "install -y " + quotedPackages(packages)
+}
+
+// Remove ignores purge for the same reason as dnf
+func (yumManager) Remove(packages []string, purge bool, verbosity string) string {
+	return "yum " + verbosityFlag(verbosity, "-q", "-v") + "remove -y " + quotedPackages(packages)
+}
+
+func (yumManager) Query(pkg string) string {
+	return "rpm -q " + shellQuote(pkg) + " >/dev/null 2>&1"
+}
+
+func (yumManager) List() string {
+	return `rpm -qa --qf '%{NAME}\n'`
+}
+
+func (yumManager) ListVersions() string {
+	return `rpm -qa --qf '%{NAME} %{VERSION}-%{RELEASE}\n'`
+}
+
+func (yumManager) Upgrade(verbosity string) string {
+	return "yum " + verbosityFlag(verbosity, "-q", "-v") + "update -y"
+}
+
+func (yumManager) Upgradable() string {
+	return "yum -q list updates 2>/dev/null | tail -n +2"
+}
+
+func (yumManager) UpgradePackages(packages []string, verbosity string) string {
+	return "yum " + verbosityFlag(verbosity, "-q", "-v") + "update -y " + quotedPackages(packages)
+}
+
+func (yumManager) Pin(name, version string) (string, error) {
+	return name + "-" + version, nil
+}
+
+// pacmanManager drives pacman on Arch. Installs refresh the index in the same transaction,
+// since a partial upgrade against a stale index can break an Arch system.
+type pacmanManager struct{}
+
+func (pacmanManager) Name() string { return "pacman" }
+
+func (pacmanManager) Update(verbosity string) string {
+	return "pacman " + verbosityFlag(verbosity, "-q", "--debug") + "-Sy --noconfirm"
+}
+
+func (pacmanManager) Install(packages []string, verbosity string) string {
+	return "pacman " + verbosityFlag(verbosity, "-q", "--debug") + "-S --needed --noconfirm " + quotedPackages(packages)
+}
+
+// Remove with purge passes -n so pacman also deletes the packages' backed-up config files
+func (pacmanManager) Remove(packages []string, purge bool, verbosity string) string {
+	action := "-R"
+	if purge {
+		action = "-Rn"
+	}
+	return "pacman " + verbosityFlag(verbosity, "-q", "--debug") + action + " --noconfirm " + quotedPackages(packages)
+}
+
+func (pacmanManager) Query(pkg string) string {
+	return "pacman -Q " + shellQuote(pkg) + " >/dev/null 2>&1"
+}
+
+func (pacmanManager) List() string {
+	return "pacman -Qq"
+}
+
+func (pacmanManager) ListVersions() string {
+	return "pacman -Q"
+}
+
+func (pacmanManager) Upgrade(verbosity string) string {
+	return "pacman " + verbosityFlag(verbosity, "-q", "--debug") + "-Su --noconfirm"
+}
+
+func (pacmanManager) Upgradable() string {
+	return "pacman -Qu 2>/dev/null"
+}
+
+// UpgradePackages reinstalls from the repositories; --needed skips packages already current
+func (pacmanManager) UpgradePackages(packages []string, verbosity string) string {
+	return "pacman " + verbosityFlag(verbosity, "-q", "--debug") + "-S --needed --noconfirm " + quotedPackages(packages)
+}
+
+// Pin always fails: pacman installs only the version currently in the repositories
+func (pacmanManager) Pin(name, version string) (string, error) {
+	return "", fmt.Errorf("pacman cannot install %s=%s: only the repository's current version is available", name, version)
+}
+
+// zypperManager drives zypper on openSUSE and SLES
+type zypperManager struct{}
+
+func (zypperManager) Name() string { return "zypper" }
+
+func (zypperManager) Update(verbosity string) string {
+	return "zypper --non-interactive " + verbosityFlag(verbosity, "-q", "-v") + "refresh"
+}
+
+func (zypperManager) Install(packages []string, verbosity string) string {
+	return "zypper --non-interactive " + verbosityFlag(verbosity, "-q", "-v") + "install " + quotedPackages(packages)
+}
+
+// Remove ignores purge for the same reason as dnf
+func (zypperManager) Remove(packages []string, purge bool, verbosity string) string {
+	return "zypper --non-interactive " + verbosityFlag(verbosity, "-q", "-v") + "remove " + quotedPackages(packages)
+}
+
+func (zypperManager) Query(pkg string) string {
+	return "rpm -q " + shellQuote(pkg) + " >/dev/null 2>&1"
+}
+
+func (zypperManager) List() string {
+	return `rpm -qa --qf '%{NAME}\n'`
+}
+
+func (zypperManager) ListVersions() string {
+	return `rpm -qa --qf '%{NAME} %{VERSION}-%{RELEASE}\n'`
+}
+
+func (zypperManager) Upgrade(verbosity string) string {
+	return "zypper --non-interactive " + verbosityFlag(verbosity, "-q", "-v") + "update"
+}
+
+func (zypperManager) Upgradable() string {
+	return "zypper --non-interactive list-updates 2>/dev/null | grep '^v '"
+}
+
+func (zypperManager) UpgradePackages(packages []string, verbosity string) string {
+	return "zypper --non-interactive " + verbosityFlag(verbosity, "-q", "-v") + "update " + quotedPackages(packages)
+}
+
+// Pin accepts exact versions only; zypper has no wildcard version match
+func (zypperManager) Pin(name, version string) (string, error) {
+	if _, wildcard := wildcardVersion(version); wildcard {
+		return "", fmt.Errorf("zypper cannot install %s=%s: give an exact version", name, version)
+	}
+	return name + "=" + version, nil
+}
+
+// osPackageManagers maps /etc/os-release IDs, including ID_LIKE values, to the manager
+// their distribution ships. dnf hosts fall back to yum when dnf is not installed.
+var osPackageManagers = map[string]string{
+	"debian": "apt", "ubuntu": "apt", "raspbian": "apt", "linuxmint": "apt",
+	"alpine": "apk",
+	"fedora": "dnf", "rhel": "dnf", "centos": "dnf", "rocky": "dnf", "almalinux": "dnf", "ol": "dnf", "amzn": "dnf",
+	"arch": "pacman", "manjaro": "pacman", "endeavouros": "pacman",
+	"opensuse": "zypper", "opensuse-leap": "zypper", "opensuse-tumbleweed": "zypper", "sles": "zypper", "suse": "zypper",
+}
+
+// managerCommands are the binaries detection looks for, keyed by manager name
+var managerCommands = map[string]string{"apt": "apt-get", "apk": "apk", "dnf": "dnf", "yum": "yum", "pacman": "pacman", "zypper": "zypper"}
+
+// detectPackageManagerScript prints the os-release IDs and every manager binary present
+const detectPackageManagerScript = `. /etc/os-release 2>/dev/null
+echo "os=$ID $ID_LIKE"
+for m in apt-get apk dnf yum pacman zypper; do
+  command -v "$m" >/dev/null 2>&1 && echo "has=$m"
+done
+exit 0
+`
+
+// packageManagerTTL is how long a detected package manager is remembered per server
+const packageManagerTTL = time.Hour
+
+// detectedManager is a cached detection result
+type detectedManager struct {
+	manager    PackageManager
+	detectedAt time.Time
+}
+
+var (
+	detectedManagersMu sync.Mutex
+	detectedManagers   = make(map[string]detectedManager)
+)
+
+// packageManagerByName returns a supported manager, or nil
+func packageManagerByName(name string) PackageManager {
+	for _, manager := range packageManagers {
+		if manager.Name() == name {
+			return manager
+		}
+	}
+	return nil
+}
+
+// choosePackageManager picks the manager for a host from detectPackageManagerScript output:
+// the one its distribution ships, when installed, else the first installed one
+func choosePackageManager(output string) (PackageManager, error) {
+	var ids []string
+	installed := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "os":
+			ids = strings.Fields(value)
+		case "has":
+			installed[value] = true
+		}
+	}
+
+	for _, id := range ids {
+		name, ok := osPackageManagers[id]
+		if !ok {
+			continue
+		}
+		if name == "dnf" && !installed["dnf"] && installed["yum"] {
+			name = "yum"
+		}
+		if installed[managerCommands[name]] {
+			return packageManagerByName(name), nil
+		}
+	}
+	for _, manager := range packageManagers {
+		if installed[managerCommands[manager.Name()]] {
+			return manager, nil
+		}
+	}
+	if len(ids) > 0 {
+		return nil, fmt.Errorf("no supported package manager found on %s", strings.Join(ids, "/"))
+	}
+	return nil, errors.New("no supported package manager found")
+}
+
+// detectPackageManager returns the package manager for a Linux server, detecting it on
+// first use and caching it for packageManagerTTL
+func detectPackageManager(ip string, server ServerInfo) (PackageManager, error) {
+	detectedManagersMu.Lock()
+	cached, ok := detectedManagers[ip]
+	detectedManagersMu.Unlock()
+	if ok && time.Since(cached.detectedAt) < packageManagerTTL {
+		return cached.manager, nil
+	}
+
+	result, err := runProbeCommand(ip, server, detectPackageManagerScript)
+	if err := commandError(result, err); err != nil {
+		return nil, fmt.Errorf("detecting the package manager: %w", err)
+	}
+	manager, err := choosePackageManager(result.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	detectedManagersMu.Lock()
+	detectedManagers[ip] = detectedManager{manager: manager, detectedAt: time.Now()}
+	detectedManagersMu.Unlock()
+	return manager, nil
+}
+
+// missingPackagesScript prints one line per package that is not installed
+func missingPackagesScript(manager PackageManager, packages []string) string {
+	var script strings.Builder
+	for _, pkg := range packages {
+		script.WriteString(manager.Query(pkg) + " || echo " + shellQuote(pkg) + "\n")
+	}
+	script.WriteString("exit 0\n")
+	return script.String()
+}
+
+// missingPackages returns the packages that are not installed on a Linux server
+func missingPackages(ip string, server ServerInfo, packages []string) ([]string, error) {
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runProbeCommand(ip, server, missingPackagesScript(manager, packages))
+	if err := commandError(output, err); err != nil {
+		return nil, err
+	}
+	return strings.Fields(output.Stdout), nil
+}
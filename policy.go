@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OperationClass groups remote operations that share the same risk profile
+type OperationClass string
+
+const (
+	// OpDeleteUsers removes accounts together with their home directories
+	OpDeleteUsers OperationClass = "delete_users"
+	// OpApplySSHDConfig replaces sshd_config and restarts sshd
+	OpApplySSHDConfig OperationClass = "apply_sshd_config"
+	// OpPurgePackages uninstalls software together with its configuration files, or a
+	// Compose app with its volumes
+	OpPurgePackages OperationClass = "purge_packages"
+)
+
+// OperationPolicy describes the safeguards applied to an operation class
+type OperationPolicy struct {
+	// RequireTypedConfirmation forces the operator to type the server name before running
+	RequireTypedConfirmation bool `json:"require_typed_confirmation"`
+}
+
+// Policy maps operation classes to their safeguards
+type Policy struct {
+	Operations map[OperationClass]OperationPolicy `json:"operations"`
+}
+
+// defaultPolicy enables safe mode for every destructive operation class
+func defaultPolicy() Policy {
+	return Policy{
+		Operations: map[OperationClass]OperationPolicy{
+			OpDeleteUsers:     {RequireTypedConfirmation: true},
+			OpApplySSHDConfig: {RequireTypedConfirmation: true},
+			OpPurgePackages:   {RequireTypedConfirmation: true},
+		},
+	}
+}
+
+// forOperation returns the policy for an operation class, using the default when unset
+func (p Policy) forOperation(op OperationClass) OperationPolicy {
+	if policy, ok := p.Operations[op]; ok {
+		return policy
+	}
+	return defaultPolicy().Operations[op]
+}
+
+// serverDisplayName returns the name an operator must type to confirm an operation
+func serverDisplayName(ip string, server ServerInfo) string {
+	if server.Name != "" {
+		return server.Name
+	}
+	return ip
+}
+
+// checkConfirmation verifies the typed server name when the policy requires it
+func checkConfirmation(r *http.Request, op OperationClass, ip string, server ServerInfo) error {
+	if !settings.Policy.forOperation(op).RequireTypedConfirmation {
+		return nil
+	}
+
+	expected := serverDisplayName(ip, server)
+	typed := strings.TrimSpace(r.FormValue("confirm_name"))
+	if typed != expected {
+		return fmt.Errorf("confirmation failed: type the server name %q to confirm this operation", expected)
+	}
+	return nil
+}
+
+// checkGroupConfirmation verifies the typed group name of an operation on a whole group when
+// the policy requires it
+func checkGroupConfirmation(r *http.Request, op OperationClass, group string) error {
+	if !settings.Policy.forOperation(op).RequireTypedConfirmation {
+		return nil
+	}
+	if typed := strings.TrimSpace(r.FormValue("confirm_name")); typed != group {
+		return fmt.Errorf("confirmation failed: type the group name %q to confirm this operation", group)
+	}
+	return nil
+}
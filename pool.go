@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxPooledSessions caps concurrent sessions on one cached connection, below OpenSSH's
+// default MaxSessions of 10. Callers beyond it get a connection of their own.
+const maxPooledSessions = 8
+
+// poolIdleTimeout is how long an unused cached connection stays open; zero disables the cache
+var poolIdleTimeout = 90 * time.Second
+
+// pooledClient is one cached master connection that sessions are multiplexed over
+type pooledClient struct {
+	client   *ssh.Client
+	err      error
+	ready    chan struct{} // closed once the dial finishes
+	sessions int
+	lastUsed time.Time
+}
+
+var (
+	poolMu      sync.Mutex
+	poolClients = make(map[string]*pooledClient)
+	poolReaper  sync.Once
+)
+
+// poolStats counts cache outcomes for the diagnostics page
+var poolStats struct {
+	hits      atomic.Int64
+	misses    atomic.Int64
+	overflows atomic.Int64 // the cached connection was at maxPooledSessions
+	evictions atomic.Int64 // cached connections found dead or closed after idling
+}
+
+// poolKey identifies connections that can be shared: same host, same login and the same
+// credentials and SSH options, so a changed password or proxy never reuses a stale connection
+func poolKey(ip string, server ServerInfo) string {
+	identity, _ := json.Marshal(struct {
+		User, Password, KeyFile, CertFile string
+		UseAgent                          bool
+		Options                           SSHOptions
+	}{server.RootUsername, server.RootPassword, server.KeyFile, server.CertFile, server.UseAgent, effectiveSSHOptions(server)})
+	sum := sha256.Sum256(identity)
+	return ip + "/" + hex.EncodeToString(sum[:8])
+}
+
+// acquireClient returns a connection to the server, reusing a cached one when possible.
+// release must be called when the caller's session is done; broken evicts the connection.
+func acquireClient(ip string, server ServerInfo) (*ssh.Client, func(broken bool), error) {
+	if poolIdleTimeout <= 0 {
+		return dialUnpooled(ip, server)
+	}
+	poolReaper.Do(func() { go reapIdleClients() })
+	key := poolKey(ip, server)
+
+	poolMu.Lock()
+	entry, ok := poolClients[key]
+	if !ok {
+		entry = &pooledClient{ready: make(chan struct{}), sessions: 1}
+		poolClients[key] = entry
+		poolMu.Unlock()
+		poolStats.misses.Add(1)
+
+		client, err := dialServer(ip, server)
+		poolMu.Lock()
+		entry.client, entry.err = client, err
+		if err != nil {
+			delete(poolClients, key)
+		}
+		poolMu.Unlock()
+		close(entry.ready)
+		if err != nil {
+			return nil, nil, err
+		}
+		go func() {
+			client.Wait()
+			evictClient(key, entry)
+		}()
+		return client, releaseFunc(key, entry), nil
+	}
+	poolMu.Unlock()
+
+	// Another caller may still be dialing; share its result
+	<-entry.ready
+	if entry.err != nil {
+		return nil, nil, entry.err
+	}
+	poolMu.Lock()
+	if poolClients[key] == entry && entry.sessions < maxPooledSessions {
+		entry.sessions++
+		poolMu.Unlock()
+		poolStats.hits.Add(1)
+		return entry.client, releaseFunc(key, entry), nil
+	}
+	poolMu.Unlock()
+	poolStats.overflows.Add(1)
+	return dialUnpooled(ip, server)
+}
+
+// dialUnpooled opens a connection that is closed on release
+func dialUnpooled(ip string, server ServerInfo) (*ssh.Client, func(bool), error) {
+	client, err := dialServer(ip, server)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, func(bool) { client.Close() }, nil
+}
+
+// releaseFunc returns a pooled connection once its session is done
+func releaseFunc(key string, entry *pooledClient) func(bool) {
+	var once sync.Once
+	return func(broken bool) {
+		once.Do(func() {
+			poolMu.Lock()
+			entry.sessions--
+			entry.lastUsed = time.Now()
+			poolMu.Unlock()
+			if broken {
+				evictClient(key, entry)
+			}
+		})
+	}
+}
+
+// evictClient drops a cached connection and closes it
+func evictClient(key string, entry *pooledClient) {
+	poolMu.Lock()
+	if poolClients[key] == entry {
+		delete(poolClients, key)
+		poolStats.evictions.Add(1)
+	}
+	poolMu.Unlock()
+	entry.client.Close()
+}
+
+// reapIdleClients closes cached connections nobody has used for poolIdleTimeout
+func reapIdleClients() {
+	for {
+		time.Sleep(poolIdleTimeout / 2)
+		var idle []*pooledClient
+		poolMu.Lock()
+		for key, entry := range poolClients {
+			if entry.client != nil && entry.sessions == 0 && time.Since(entry.lastUsed) > poolIdleTimeout {
+				delete(poolClients, key)
+				poolStats.evictions.Add(1)
+				idle = append(idle, entry)
+			}
+		}
+		poolMu.Unlock()
+		for _, entry := range idle {
+			entry.client.Close()
+		}
+	}
+}
+
+// openSession starts a session on a cached connection. A cached connection can die between
+// uses without the keepalive noticing yet, so a failure there is retried once on a fresh one.
+// A server that refuses another channel, usually because of its MaxSessions limit, keeps the
+// shared connection and the caller gets a connection of its own.
+func openSession(ip string, server ServerInfo) (*ssh.Client, *ssh.Session, func(broken bool), error) {
+	for attempt := 0; ; attempt++ {
+		client, release, err := acquireClient(ip, server)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		session, err := client.NewSession()
+		if err == nil {
+			return client, session, release, nil
+		}
+		var refused *ssh.OpenChannelError
+		if errors.As(err, &refused) {
+			release(false)
+			poolStats.overflows.Add(1)
+			if client, release, err = dialUnpooled(ip, server); err != nil {
+				return nil, nil, nil, err
+			}
+			if session, err = client.NewSession(); err != nil {
+				release(true)
+				return nil, nil, nil, err
+			}
+			return client, session, release, nil
+		}
+		release(true)
+		if attempt > 0 {
+			return nil, nil, nil, err
+		}
+	}
+}
+
+// poolSize returns how many connections are cached and how many sessions they carry
+func poolSize() (connections, sessions int) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	for _, entry := range poolClients {
+		if entry.client != nil {
+			connections++
+			sessions += entry.sessions
+		}
+	}
+	return connections, sessions
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Job priorities, lowest first. An empty priority is normal.
+const (
+	priorityLow    = "low"
+	priorityNormal = "normal"
+	priorityUrgent = "urgent"
+)
+
+// jobPriorityAging is how long a waiting job takes to move up one priority level, so jobs
+// of low priority still run under a steady stream of urgent ones
+const jobPriorityAging = 10 * time.Minute
+
+// parseJobPriority reads a job's priority from a form or API request; empty and "normal"
+// both mean normal and are stored as empty
+func parseJobPriority(value string) (string, error) {
+	switch value {
+	case "", priorityNormal:
+		return "", nil
+	case priorityLow, priorityUrgent:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid priority %q; use low, normal or urgent", value)
+}
+
+// priorityRank orders priorities: 0 for low, 1 for normal and 2 for urgent
+func priorityRank(priority string) int {
+	switch priority {
+	case priorityLow:
+		return 0
+	case priorityUrgent:
+		return 2
+	}
+	return 1
+}
+
+// waitRank is the rank of a job of the given priority that has waited since since: its
+// priority's rank plus one level per jobPriorityAging waited
+func waitRank(priority string, since, now time.Time) int {
+	return priorityRank(priority) + int(now.Sub(since)/jobPriorityAging)
+}
+
+// waitsBefore reports whether a job waiting with priority a since sinceA goes before one
+// with priority b since sinceB: the higher rank first, then the longer wait
+func waitsBefore(a string, sinceA time.Time, b string, sinceB time.Time, now time.Time) bool {
+	if rankA, rankB := waitRank(a, sinceA, now), waitRank(b, sinceB, now); rankA != rankB {
+		return rankA > rankB
+	}
+	return sinceA.Before(sinceB)
+}
+
+// Waiting reports whether the job still waits for a worker, a maintenance window or its
+// server, where its priority matters
+func (j Job) Waiting() bool {
+	if j.Status == "queued" || j.Status == "pending" || j.HeldBy != "" {
+		return true
+	}
+	if j.Status != "running" || j.Server == "" {
+		return false
+	}
+	serverSlotsMu.Lock()
+	defer serverSlotsMu.Unlock()
+	for _, waiter := range serverWaiters[j.Server] {
+		if waiter.id == j.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// setJobPriority changes the priority of a job still waiting, for a worker or for its
+// server, and returns the updated job
+func setJobPriority(id, priority string) (Job, error) {
+	jobsMu.Lock()
+	var job *Job
+	for _, candidate := range jobs {
+		if candidate.ID == id {
+			job = candidate
+			break
+		}
+	}
+	if job == nil {
+		jobsMu.Unlock()
+		return Job{}, errJobNotFound
+	}
+	if job.Status != "running" && job.Status != "queued" && job.Status != "pending" {
+		jobsMu.Unlock()
+		return Job{}, errJobFinished
+	}
+	job.Priority = priority
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	reprioritizeQueuedJob(id, priority)
+	reprioritizeServerWaiter(id, priority)
+	publishEvent("job.progress", snapshot)
+	return snapshot, nil
+}
+
+// jobPriorityHandler changes the priority of a queued job or one waiting for its server
+func jobPriorityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	priority, err := parseJobPriority(r.FormValue("priority"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !jobAllowed(w, r, r.FormValue("id")) {
+		return
+	}
+	job, err := setJobPriority(r.FormValue("id"), priority)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+	default:
+		http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+	}
+}
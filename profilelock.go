@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProfileLock is the known-good state captured when a server passed verification
+type ProfileLock struct {
+	IP       string    `json:"ip"`
+	LockedAt time.Time `json:"locked_at"`
+	Content  string    `json:"content"`
+	Packages []string  `json:"packages,omitempty"`
+}
+
+// ProfileVerification is the result of checking a server against a profile or its lock
+type ProfileVerification struct {
+	IP              string
+	Passed          bool
+	FileStatus      string
+	MissingPackages []string
+	Error           string
+}
+
+// envProfilesMu guards settings.EnvProfiles against the background lock enforcer
+var envProfilesMu sync.RWMutex
+
+// envProfilesSnapshot returns a copy of the profiles that is safe to use without the lock
+func envProfilesSnapshot() []EnvProfile {
+	envProfilesMu.RLock()
+	defer envProfilesMu.RUnlock()
+	profiles := make([]EnvProfile, len(settings.EnvProfiles))
+	for i, profile := range settings.EnvProfiles {
+		profile.Locks = slices.Clone(profile.Locks)
+		profiles[i] = profile
+	}
+	return profiles
+}
+
+// lockFor returns the lock held on a server, if any
+func (p EnvProfile) lockFor(ip string) (ProfileLock, bool) {
+	for _, lock := range p.Locks {
+		if lock.IP == ip {
+			return lock, true
+		}
+	}
+	return ProfileLock{}, false
+}
+
+// verifyState compares a server with the expected file content and package list
+func verifyState(profile EnvProfile, ip string, server ServerInfo, expected string, packages []string) ProfileVerification {
+	result := ProfileVerification{IP: ip}
+
+	output, err := runProbeCommand(ip, server, profile.readScript())
+	if err := commandError(output, err); err != nil {
+		result.FileStatus = "error"
+		result.Error = err.Error()
+		return result
+	}
+	switch actual := strings.TrimSpace(output.Stdout); {
+	case actual == "__ACCMGR_MISSING__":
+		result.FileStatus = "missing"
+	case actual != expected:
+		result.FileStatus = "changed"
+	default:
+		result.FileStatus = "in-sync"
+	}
+
+	if len(packages) > 0 {
+		missing, err := missingPackages(ip, server, packages)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.MissingPackages = missing
+	}
+
+	result.Passed = result.FileStatus == "in-sync" && len(result.MissingPackages) == 0
+	return result
+}
+
+// verifyProfile checks a server against the profile's current template and packages
+func verifyProfile(profile EnvProfile, ip string, server ServerInfo) ProfileVerification {
+	expected, err := profile.render(ip, server)
+	if err != nil {
+		return ProfileVerification{IP: ip, FileStatus: "error", Error: err.Error()}
+	}
+	return verifyState(profile, ip, server, expected, profile.Packages)
+}
+
+// reapplyLock restores the locked file content and reinstalls missing packages
+func reapplyLock(profile EnvProfile, lock ProfileLock, server ServerInfo, missing []string) error {
+	if err := commandError(runPrivilegedCommand(lock.IP, server, profile.applyScript(lock.Content))); err != nil {
+		return fmt.Errorf("restoring %s: %w", profile.path(), err)
+	}
+	if len(missing) > 0 {
+		manager, err := detectPackageManager(lock.IP, server)
+		if err != nil {
+			return fmt.Errorf("reinstalling %s: %w", strings.Join(missing, ", "), err)
+		}
+		if err := commandError(runPrivilegedCommand(lock.IP, server, manager.Install(missing, verbosityNormal))); err != nil {
+			return fmt.Errorf("reinstalling %s: %w", strings.Join(missing, ", "), err)
+		}
+		recordManagedChange(lock.IP, "reinstalled locked packages for "+profile.Name)
+	}
+	return nil
+}
+
+// enforceProfileLocks re-verifies every locked server and raises critical alerts on drift
+func enforceProfileLocks() {
+	servers := serversSnapshot()
+	var profiles []EnvProfile
+	var locks []ProfileLock
+	var ips []string
+	for _, profile := range envProfilesSnapshot() {
+		for _, lock := range profile.Locks {
+			if _, ok := servers[lock.IP]; ok {
+				profiles, locks, ips = append(profiles, profile), append(locks, lock), append(ips, lock.IP)
+			}
+		}
+	}
+	fanOut(ips, func(i int, ip string) {
+		defer catchWorkerPanic("health-poller")
+		enforceLock(profiles[i], locks[i], servers[ip])
+	})
+}
+
+// enforceLock checks one locked server and optionally puts it back into its known-good state
+func enforceLock(profile EnvProfile, lock ProfileLock, server ServerInfo) {
+	result := verifyState(profile, lock.IP, server, lock.Content, lock.Packages)
+	if result.Error != "" {
+		// Unreachable servers are reported by the health poller, not as drift
+		return
+	}
+
+	autoReapply := profile.AutoReapply && featureEnabled("auto_remediation")
+	alertKey := "profile-lock:" + profile.Name + ":" + lock.IP
+	if result.Passed {
+		// After an automatic reapply the server passes again, so keep the alert until someone dismisses it
+		if !autoReapply {
+			clearAlert(alertKey)
+		}
+		return
+	}
+
+	var problems []string
+	if result.FileStatus != "in-sync" {
+		problems = append(problems, profile.path()+" "+result.FileStatus)
+	}
+	if len(result.MissingPackages) > 0 {
+		problems = append(problems, "packages removed: "+strings.Join(result.MissingPackages, ", "))
+	}
+	message := "Locked profile " + profile.Name + " drifted (" + strings.Join(problems, "; ") + ")"
+
+	if autoReapply {
+		if err := reapplyLock(profile, lock, server, result.MissingPackages); err != nil {
+			message += "; auto-reapply failed: " + err.Error()
+		} else {
+			fmt.Printf("🔒 Reapplied locked profile %s on %s\n", profile.Name, lock.IP)
+			message += "; reapplied automatically"
+		}
+	}
+	raiseAlert(alertKey, lock.IP, "critical", message)
+}
+
+// lockProfileHandler verifies a server and, if it passes, locks its current state
+func lockProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.FormValue("name")
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	profile, _, ok := findEnvProfile(name)
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	server, ok := lookupServer(ip)
+	if !ok || !profile.appliesTo(ip, server) {
+		http.Error(w, "Server is not targeted by this profile", http.StatusBadRequest)
+		return
+	}
+	if !serversAllowed(w, r, profileServers(profile)) {
+		return
+	}
+
+	result := verifyProfile(profile, ip, server)
+	if !result.Passed {
+		msg := "❌ " + ip + " did not pass verification (" + result.FileStatus
+		if len(result.MissingPackages) > 0 {
+			msg += ", missing packages: " + strings.Join(result.MissingPackages, ", ")
+		}
+		if result.Error != "" {
+			msg += ", " + result.Error
+		}
+		http.Error(w, msg+"); only a verified server can be locked", http.StatusConflict)
+		return
+	}
+
+	content, err := profile.render(ip, server)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	envProfilesMu.Lock()
+	_, i, ok := findEnvProfile(name)
+	if ok {
+		locks := settings.EnvProfiles[i].Locks
+		locks = slices.DeleteFunc(locks, func(l ProfileLock) bool { return l.IP == ip })
+		settings.EnvProfiles[i].Locks = append(locks, ProfileLock{
+			IP:       ip,
+			LockedAt: time.Now(),
+			Content:  content,
+			Packages: slices.Clone(profile.Packages),
+		})
+	}
+	envProfilesMu.Unlock()
+
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/env-drift?name="+name), http.StatusSeeOther)
+}
+
+// unlockProfileHandler releases a server so the profile can change it again
+func unlockProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.FormValue("name")
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if profile, _, ok := findEnvProfile(name); ok && !serversAllowed(w, r, profileServers(profile)) {
+		return
+	}
+
+	envProfilesMu.Lock()
+	_, i, ok := findEnvProfile(name)
+	if ok {
+		settings.EnvProfiles[i].Locks = slices.DeleteFunc(settings.EnvProfiles[i].Locks, func(l ProfileLock) bool { return l.IP == ip })
+	}
+	envProfilesMu.Unlock()
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	clearAlert("profile-lock:" + name + ":" + ip)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/env-drift?name="+name), http.StatusSeeOther)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// proxyDirect is the proxy value that bypasses a proxy configured at a broader scope
+const proxyDirect = "direct"
+
+// proxyURL parses the configured proxy, returning nil when connections go direct
+func (o SSHOptions) proxyURL() (*url.URL, error) {
+	if o.Proxy == "" || o.Proxy == proxyDirect {
+		return nil, nil
+	}
+	u, err := url.Parse(o.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use socks5://, socks5h:// or http://)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", o.Proxy)
+	}
+	return u, nil
+}
+
+// proxyLabel describes the proxy for logs and diagnostics without its credentials
+func (o SSHOptions) proxyLabel() string {
+	u, err := o.proxyURL()
+	if err != nil || u == nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// dialTCP connects to addr directly or through the configured SOCKS5 or HTTP CONNECT proxy
+func dialTCP(addr string, opts SSHOptions, timeout time.Duration) (net.Conn, error) {
+	u, err := opts.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+
+	forward := &net.Dialer{Timeout: timeout}
+	if u.Scheme == "http" {
+		return dialHTTPConnect(u, addr, forward, timeout)
+	}
+
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", u.Host, auth, forward)
+	if err != nil {
+		return nil, err
+	}
+
+	// The SOCKS handshake itself has no deadline, so bound the whole dial
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := dialer.Dial("tcp", addr)
+		done <- result{conn, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, fmt.Errorf("via proxy %s: %w", u.Host, res.err)
+		}
+		return res.conn, nil
+	case <-time.After(timeout):
+		go func() {
+			if res := <-done; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("via proxy %s: dial %s: i/o timeout", u.Host, addr)
+	}
+}
+
+// dialHTTPConnect opens a tunnel to addr with an HTTP CONNECT request
+func dialHTTPConnect(u *url.URL, addr string, forward *net.Dialer, timeout time.Duration) (net.Conn, error) {
+	conn, err := forward.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to proxy %s: %w", u.Host, err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("via proxy %s: %w", u.Host, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("via proxy %s: %w", u.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("via proxy %s: CONNECT %s: %s", u.Host, addr, resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	// sshd may send its banner straight away, so keep anything already buffered
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads through the buffer left over from the CONNECT response
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxQueuedJobs caps the jobs waiting for a worker
+const maxQueuedJobs = 100
+
+// jobWorkers is how many queued jobs run at once; -job-workers
+var jobWorkers = 4
+
+// errJobQueueFull is returned when maxQueuedJobs are already waiting
+var errJobQueueFull = errors.New("too many jobs are waiting; try again once some have finished")
+
+// queuedJob is a job waiting for a worker, with the work it runs. Its priority and queue
+// time are copied from the job so the queue is ordered without taking jobsMu.
+type queuedJob struct {
+	job      *Job
+	run      func(job *Job) jobResult
+	priority string
+	queuedAt time.Time
+	// targets are the servers the job changes; it stays queued while maintenance windows
+	// hold any of them
+	targets jobTargets
+}
+
+// jobResult is what a queued job produced. Log is the plain-text log the job and the API
+// show; Template and Data render the page the request would otherwise have returned.
+type jobResult struct {
+	Log      string
+	Err      error
+	Template string
+	Data     interface{}
+}
+
+var (
+	// jobQueue holds the jobs waiting for a worker; workers take the first in priority
+	// order, see waitsBefore
+	jobQueueMu    sync.Mutex
+	jobQueue      []queuedJob
+	jobQueueReady = sync.NewCond(&jobQueueMu)
+
+	jobResultsMu sync.Mutex
+	jobResults   = make(map[string]jobResult)
+)
+
+// queueOperatorJob registers a queued job of the given priority and hands it to the job
+// workers, so the request that queued it can return the job's ID straight away instead of
+// waiting for a long install behind a proxy's timeout. Workers pass it over while the
+// maintenance windows of its targets hold it.
+func queueOperatorJob(operator, kind, description, priority string, targets jobTargets, run func(job *Job) jobResult) (*Job, error) {
+	jobsMu.Lock()
+	job := registerJob(operator, kind, "", description, "queued")
+	job.Priority = priority
+	jobQueueMu.Lock()
+	if len(jobQueue) >= maxQueuedJobs {
+		jobQueueMu.Unlock()
+		jobs = jobs[:len(jobs)-1]
+		releaseJobContext(job.ID)
+		jobsMu.Unlock()
+		return nil, errJobQueueFull
+	}
+	jobQueue = append(jobQueue, queuedJob{job: job, run: run, priority: priority, queuedAt: *job.QueuedAt, targets: targets})
+	jobQueueReady.Signal()
+	jobQueueMu.Unlock()
+	snapshot := job.snapshot()
+	jobsMu.Unlock()
+
+	publishEvent("job.queued", snapshot)
+	markHeldQueuedJobs()
+	return job, nil
+}
+
+// runJobWorker runs queued jobs one at a time, dropping those cancelled while they waited
+func runJobWorker() {
+	for {
+		runQueuedJob(nextQueuedJob())
+	}
+}
+
+// nextQueuedJob waits for a queued job and takes the one to run next: the most urgent,
+// counting the time each waited, and of those the one queued first. Jobs held by
+// maintenance windows are passed over; runMaintenanceWatcher wakes the workers when
+// windows may have opened.
+func nextQueuedJob() queuedJob {
+	jobQueueMu.Lock()
+	defer jobQueueMu.Unlock()
+	for {
+		now := time.Now()
+		next := -1
+		for i, queued := range jobQueue {
+			if _, _, held := queued.targets.hold(now); held {
+				continue
+			}
+			if next < 0 || waitsBefore(queued.priority, queued.queuedAt, jobQueue[next].priority, jobQueue[next].queuedAt, now) {
+				next = i
+			}
+		}
+		if next >= 0 {
+			queued := jobQueue[next]
+			jobQueue = append(jobQueue[:next], jobQueue[next+1:]...)
+			return queued
+		}
+		jobQueueReady.Wait()
+	}
+}
+
+// reprioritizeQueuedJob changes the priority of a job waiting for a worker
+func reprioritizeQueuedJob(id, priority string) {
+	jobQueueMu.Lock()
+	defer jobQueueMu.Unlock()
+	for i := range jobQueue {
+		if jobQueue[i].job.ID == id {
+			jobQueue[i].priority = priority
+		}
+	}
+}
+
+// runQueuedJob runs one job and keeps its result. A job on one server, such as an approved
+// command, then waits for the server's maintenance windows and the server like any other;
+// its time limit starts once it holds it.
+// A panic fails the job before the worker's supervisor records it and restarts the worker.
+func runQueuedJob(queued queuedJob) {
+	job := queued.job
+	if !job.begin() {
+		return
+	}
+	if job.Server != "" {
+		job.awaitMaintenanceWindow()
+		job.claimServer()
+		jobsMu.Lock()
+		job.armTimeout()
+		jobsMu.Unlock()
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			job.finish(fmt.Errorf("internal error: %v", v))
+			panic(v)
+		}
+	}()
+
+	result := queued.run(job)
+	jobResultsMu.Lock()
+	jobResults[job.ID] = result
+	jobResultsMu.Unlock()
+	jobsMu.Lock()
+	job.Log = result.Log
+	jobsMu.Unlock()
+	job.finish(result.Err)
+}
+
+// dropJobResult forgets the result of a pruned job
+func dropJobResult(id string) {
+	jobResultsMu.Lock()
+	delete(jobResults, id)
+	jobResultsMu.Unlock()
+}
+
+// jobResultHandler shows the page a queued job produced
+func jobResultHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if !jobAllowed(w, r, id) {
+		return
+	}
+	jobResultsMu.Lock()
+	result, ok := jobResults[id]
+	jobResultsMu.Unlock()
+	if !ok {
+		http.Error(w, "The job has no result yet", http.StatusNotFound)
+		return
+	}
+	renderTemplate(w, r, result.Template, result.Data)
+}
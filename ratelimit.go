@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sign-ins and job submissions are rate limited, so a leaked password or a runaway script
+// cannot hammer the login page or flood the servers with jobs. Each IP address may try so
+// many sign-ins a minute, and each user and IP address submit so many jobs a minute.
+// Failed sign-ins in a row lock the account, and many more from one IP address lock the
+// address, for lockoutBase at first and twice as long with every further failure, up to
+// lockoutMax; admins unlock them sooner on the audit page. Every sign-in tried, lockouts
+// and throttled requests are written to the audit log.
+
+var (
+	// loginRate is how many sign-ins an IP address may try a minute; 0 for no limit
+	loginRate = 10
+	// jobRate is how many job submissions and other operator changes a user may make a
+	// minute, and three times as many an IP address; 0 for no limit
+	jobRate = 30
+	// lockoutAfter is how many failed sign-ins in a row lock an account, and four times as
+	// many an IP address; 0 never locks
+	lockoutAfter = 5
+	// lockoutBase is the first lockout; each further failure doubles it
+	lockoutBase = time.Minute
+	// lockoutMax is the longest lockout; a long one keeps accounts locked until an admin
+	// unlocks them
+	lockoutMax = time.Hour
+)
+
+const (
+	// failureWindow is how long failed sign-ins are remembered after the last one
+	failureWindow = 15 * time.Minute
+	// ipJobRateFactor lets users behind one VPN address submit jobs without sharing one
+	// user's budget
+	ipJobRateFactor = 3
+	// ipLockoutFactor is how many more failures than an account's lock an IP address
+	ipLockoutFactor = 4
+)
+
+// rateBucket is a token bucket: one token per allowed request, refilled evenly over a
+// minute
+type rateBucket struct {
+	tokens   float64
+	last     time.Time
+	reported bool
+}
+
+// rateLimit is the rate a user or IP address, who, is held to
+type rateLimit struct {
+	key       string
+	who       string
+	perMinute int
+}
+
+// rateLimiter keeps token buckets by key, such as "ip:10.0.0.5" or "user:alice"
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	pruned  time.Time
+}
+
+var (
+	loginLimiter = &rateLimiter{buckets: make(map[string]*rateBucket)}
+	jobLimiter   = &rateLimiter{buckets: make(map[string]*rateBucket)}
+)
+
+// allow takes a token from the key's bucket of perMinute tokens. When there is none it
+// returns how long until there is, and whether this is the first refusal since the last
+// allowed request, which is worth an audit entry.
+func (l *rateLimiter) allow(key string, perMinute int, now time.Time) (time.Duration, bool, bool) {
+	if perMinute <= 0 {
+		return 0, true, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.pruned) > time.Minute {
+		// a bucket idle for a minute is full again, the same as no bucket
+		for existing, bucket := range l.buckets {
+			if now.Sub(bucket.last) > time.Minute {
+				delete(l.buckets, existing)
+			}
+		}
+		l.pruned = now
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateBucket{tokens: float64(perMinute), last: now}
+		l.buckets[key] = bucket
+	}
+	perSecond := float64(perMinute) / 60
+	bucket.tokens = math.Min(float64(perMinute), bucket.tokens+now.Sub(bucket.last).Seconds()*perSecond)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.reported = false
+		return 0, true, false
+	}
+	wait := time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	first := !bucket.reported
+	bucket.reported = true
+	return wait, false, first
+}
+
+// loginFailures counts the failed sign-ins in a row of an account or IP address
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+var (
+	loginFailuresMu sync.Mutex
+	// failedLogins are keyed like the rate limiters' buckets
+	failedLogins = make(map[string]*loginFailures)
+)
+
+// loginLockedFor returns how long sign-ins as name or from the request's IP address stay
+// locked, or 0
+func loginLockedFor(r *http.Request, name string) time.Duration {
+	now := time.Now()
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+	var wait time.Duration
+	for _, key := range []string{"user:" + name, "ip:" + clientIP(r)} {
+		if failures, ok := failedLogins[key]; ok && failures.lockedUntil.After(now) {
+			wait = max(wait, failures.lockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// refuseLocked reports whether sign-ins as name or from the request's IP address are
+// locked, and how long for, writing the refused sign-in to the audit log
+func refuseLocked(r *http.Request, name string) (time.Duration, bool) {
+	wait := loginLockedFor(r, name)
+	if wait > 0 {
+		recordAudit(r, "login.failed", name, "locked for another "+wait.Round(time.Second).String())
+	}
+	return wait, wait > 0
+}
+
+// loginAllowed reports whether a sign-in as name may be tried now from the login page or
+// with HTTP Basic authentication, or how long to wait: the IP address must be within loginRate, and neither it nor the
+// account locked
+func loginAllowed(r *http.Request, name string) (time.Duration, bool) {
+	if wait, locked := refuseLocked(r, name); locked {
+		return wait, false
+	}
+	wait, ok, first := loginLimiter.allow("ip:"+clientIP(r), loginRate, time.Now())
+	if !ok && first {
+		recordAudit(r, "login.throttled", name, fmt.Sprintf("more than %d sign-ins a minute from %s", loginRate, clientIP(r)))
+	}
+	return wait, ok
+}
+
+// loginFailed writes a failed sign-in as name to the audit log with the reason, and counts
+// it, locking the account or the IP address when it failed too often
+func loginFailed(r *http.Request, name, reason string) {
+	recordAudit(r, "login.failed", name, reason)
+	if lockoutAfter <= 0 {
+		return
+	}
+	now := time.Now()
+	ip := clientIP(r)
+	limits := []struct {
+		key, what string
+		limit     int
+	}{
+		{"user:" + name, "account " + name, lockoutAfter},
+		{"ip:" + ip, "address " + ip, lockoutAfter * ipLockoutFactor},
+	}
+	loginFailuresMu.Lock()
+	var locked []string
+	for _, l := range limits {
+		failures, ok := failedLogins[l.key]
+		if !ok || now.Sub(failures.last) > failureWindow {
+			failures = &loginFailures{}
+			failedLogins[l.key] = failures
+		}
+		failures.count++
+		failures.last = now
+		if failures.count < l.limit {
+			continue
+		}
+		lockout := lockoutBase
+		for doublings := failures.count - l.limit; doublings > 0 && lockout < lockoutMax; doublings-- {
+			lockout *= 2
+		}
+		lockout = min(lockout, lockoutMax)
+		failures.lockedUntil = now.Add(lockout)
+		locked = append(locked, fmt.Sprintf("%s locked for %s after %d failed sign-ins", l.what, lockout, failures.count))
+	}
+	for key, failures := range failedLogins {
+		if now.Sub(failures.last) > failureWindow && now.After(failures.lockedUntil) {
+			delete(failedLogins, key)
+		}
+	}
+	loginFailuresMu.Unlock()
+	for _, detail := range locked {
+		fmt.Println("🔒", detail)
+		recordAudit(r, "login.locked", name, detail)
+	}
+}
+
+// loginSucceeded writes a sign-in as name to the audit log with how they signed in, and
+// forgets the account's failed sign-ins
+func loginSucceeded(r *http.Request, name, method string) {
+	recordAudit(r, "login.succeeded", name, method)
+	forgetLoginFailures(name)
+}
+
+// forgetLoginFailures forgets the account's failed sign-ins. HTTP Basic authentication,
+// which API clients send with every request, only does this, so they do not fill the audit
+// log.
+func forgetLoginFailures(name string) {
+	loginFailuresMu.Lock()
+	delete(failedLogins, "user:"+name)
+	loginFailuresMu.Unlock()
+}
+
+// Lockout is a locked account or IP address, as the audit page lists it
+type Lockout struct {
+	// Key is the key of failedLogins, such as "user:alice"
+	Key      string
+	What     string
+	Failures int
+	Until    time.Time
+}
+
+// lockouts returns the accounts and IP addresses locked now, those locked longest first
+func lockouts() []Lockout {
+	now := time.Now()
+	loginFailuresMu.Lock()
+	var locked []Lockout
+	for key, failures := range failedLogins {
+		if failures.lockedUntil.After(now) {
+			kind, who, _ := strings.Cut(key, ":")
+			what := "account " + who
+			if kind == "ip" {
+				what = "address " + who
+			}
+			locked = append(locked, Lockout{Key: key, What: what, Failures: failures.count, Until: failures.lockedUntil})
+		}
+	}
+	loginFailuresMu.Unlock()
+	sort.Slice(locked, func(i, j int) bool { return locked[i].Until.After(locked[j].Until) })
+	return locked
+}
+
+// unlockLoginHandler lets an admin unlock an account or IP address before its lockout ends,
+// forgetting its failed sign-ins
+func unlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.FormValue("key")
+	loginFailuresMu.Lock()
+	failures, ok := failedLogins[key]
+	locked := ok && failures.lockedUntil.After(time.Now())
+	delete(failedLogins, key)
+	loginFailuresMu.Unlock()
+	if !locked {
+		http.Error(w, "Not locked", http.StatusNotFound)
+		return
+	}
+	kind, who, _ := strings.Cut(key, ":")
+	fmt.Printf("🔓 %s unlocked %s\n", requestOperator(r), key)
+	if kind == "user" {
+		recordAudit(r, "login.unlocked", who, "account unlocked by "+requestOperator(r))
+	} else {
+		recordAudit(r, "login.unlocked", "", "address "+who+" unlocked by "+requestOperator(r))
+	}
+	http.Redirect(w, r, appPath(r, "/audit"), http.StatusSeeOther)
+}
+
+// validateLockoutFlags checks the lockout durations before anything is served
+func validateLockoutFlags() error {
+	if lockoutBase <= 0 || lockoutMax < lockoutBase {
+		return fmt.Errorf("-lockout-duration must be positive and -lockout-max at least as long")
+	}
+	return nil
+}
+
+// writeTooManyRequests refuses a request that has to wait, telling the client how long
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, message string, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	message += "; try again in " + wait.Round(time.Second).String()
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/graphql" {
+		writeAPIError(w, http.StatusTooManyRequests, message)
+	} else {
+		http.Error(w, "❌ "+message, http.StatusTooManyRequests)
+	}
+}
+
+// limitJobSubmissions throttles what operators submit: jobs, and the other changes that
+// need the operator role. Reading, and what viewers may do, is not limited.
+func limitJobSubmissions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || requiredRole(r) != roleOperator {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		operator := requestOperator(r)
+		var limits []rateLimit
+		if operator != "" {
+			limits = append(limits, rateLimit{"user:" + operator, operator, jobRate})
+		}
+		limits = append(limits, rateLimit{"ip:" + clientIP(r), clientIP(r), jobRate * ipJobRateFactor})
+		for _, limit := range limits {
+			wait, ok, first := jobLimiter.allow(limit.key, limit.perMinute, now)
+			if ok {
+				continue
+			}
+			if first {
+				recordAudit(r, "jobs.throttled", operator, fmt.Sprintf("more than %d submissions a minute by %s", limit.perMinute, limit.who))
+			}
+			writeTooManyRequests(w, r, "Too many submissions", wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
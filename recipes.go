@@ -0,0 +1,637 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Recipe step types
+const (
+	recipeStepPackages = "packages"
+	recipeStepFile     = "file"
+	recipeStepService  = "service"
+	recipeStepCommand  = "command"
+)
+
+// Recipe step conditions on earlier failures
+const (
+	recipeWhenSuccess = "success"
+	recipeWhenFailure = "failure"
+	recipeWhenAlways  = "always"
+)
+
+// maxRecipeSteps caps the steps of one recipe
+const maxRecipeSteps = 100
+
+// Recipe is an ordered list of steps that sets up a whole stack, e.g. LEMP or monitoring,
+// run on a server as one job. Steps run in order and the first failure stops the recipe,
+// apart from steps that run after a failure, such as cleanup.
+type Recipe struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Steps       []RecipeStep `json:"steps"`
+	// ContinueOnFailure keeps running the remaining steps after one fails; the recipe
+	// still fails
+	ContinueOnFailure bool `json:"continue_on_failure,omitempty"`
+	// Artifacts are remote paths or glob patterns collected after every run, e.g. the
+	// config the recipe wrote
+	Artifacts []string `json:"artifacts,omitempty"`
+}
+
+// RecipeStep is one step of a recipe; Type selects which of the other fields apply
+type RecipeStep struct {
+	Type string `json:"type"`
+	// Packages are package specs installed with the server's package manager
+	Packages []string `json:"packages,omitempty"`
+	// Path, Content and Mode write a file. Content is a template rendered with {{.IP}},
+	// {{.Name}} and {{.Group}} of the server; Mode defaults to 0644.
+	Path    string `json:"path,omitempty"`
+	Content string `json:"content,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	// Service and Action manage a service: start, stop, restart, reload or enable
+	Service string `json:"service,omitempty"`
+	Action  string `json:"action,omitempty"`
+	// Command is a shell command run as root
+	Command string `json:"command,omitempty"`
+
+	// When runs the step only while no step has failed ("success", the default), only once
+	// one has ("failure") or either way ("always")
+	When string `json:"when,omitempty"`
+	// IfStep and IfExit also require an earlier step, numbered from 1, to have run and
+	// exited with one of the codes in IfExit: "0" (the default), "1,2" or "!0" for any other
+	IfStep int    `json:"if_step,omitempty"`
+	IfExit string `json:"if_exit,omitempty"`
+	// IgnoreFailure keeps a failing step from failing the recipe, e.g. a check whose exit
+	// code only decides which later steps run
+	IgnoreFailure bool `json:"ignore_failure,omitempty"`
+}
+
+// builtinRecipes are always available; a recipe saved in settings with the same name
+// replaces the built-in one
+var builtinRecipes = []Recipe{
+	{
+		Name:        "lemp",
+		Description: "nginx, MariaDB and PHP-FPM on Debian or Ubuntu",
+		Steps: []RecipeStep{
+			{Type: recipeStepPackages, Packages: []string{"nginx", "mariadb-server", "php-fpm", "php-mysql"}},
+			{Type: recipeStepFile, Path: "/etc/nginx/conf.d/php-fpm.conf", Content: "upstream php-fpm {\n    server unix:/run/php/php-fpm.sock;\n}\n"},
+			{Type: recipeStepFile, Path: "/var/www/html/info.php", Content: "<?php echo 'LEMP on {{.Name}}';\n"},
+			{Type: recipeStepService, Service: "mariadb", Action: "enable"},
+			{Type: recipeStepService, Service: "nginx", Action: "enable"},
+			{Type: recipeStepCommand, Command: "nginx -t"},
+			{Type: recipeStepService, Service: "nginx", Action: "reload"},
+		},
+	},
+	{
+		Name:        "node-exporter",
+		Description: "Prometheus node exporter on port 9100",
+		Steps: []RecipeStep{
+			{Type: recipeStepPackages, Packages: []string{"prometheus-node-exporter"}},
+			{Type: recipeStepService, Service: "prometheus-node-exporter", Action: "enable"},
+			{Type: recipeStepCommand, Command: "sleep 2 && curl -fsS -o /dev/null http://localhost:9100/metrics"},
+		},
+	},
+}
+
+var (
+	// recipeNamePattern matches recipe names
+	recipeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	// serviceNamePattern matches systemd and OpenRC service names
+	serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._-]*$`)
+	// fileModePattern matches octal file modes such as 0644 or 755
+	fileModePattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+	// exitCodesPattern matches the exit codes of a step condition such as "0", "1,2" or "!0"
+	exitCodesPattern = regexp.MustCompile(`^!?[0-9]{1,3}(,[0-9]{1,3})*$`)
+)
+
+// recipeServiceActions are the actions a service step may take
+var recipeServiceActions = []string{"start", "stop", "restart", "reload", "enable"}
+
+// recipes returns the built-in recipes with those from settings, sorted by name
+func recipes() []Recipe {
+	all := slices.Clone(builtinRecipes)
+	for _, recipe := range settings.Recipes {
+		i := slices.IndexFunc(all, func(r Recipe) bool { return r.Name == recipe.Name })
+		if i >= 0 {
+			all[i] = recipe
+		} else {
+			all = append(all, recipe)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// findRecipe returns the recipe with the given name
+func findRecipe(name string) (Recipe, bool) {
+	for _, recipe := range recipes() {
+		if recipe.Name == name {
+			return recipe, true
+		}
+	}
+	return Recipe{}, false
+}
+
+// Label describes the step in logs, e.g. "restart nginx"
+func (s RecipeStep) Label() string {
+	switch s.Type {
+	case recipeStepPackages:
+		return "install " + strings.Join(s.Packages, " ")
+	case recipeStepFile:
+		return "write " + s.Path
+	case recipeStepService:
+		return s.Action + " " + s.Service
+	}
+	return "run " + s.Command
+}
+
+// exitCodes returns the exit codes IfExit accepts
+func (s RecipeStep) exitCodes() string {
+	if s.IfExit == "" {
+		return "0"
+	}
+	return s.IfExit
+}
+
+// Condition describes when the step runs, e.g. "if step 1 exited !0", or "" for a step that
+// runs while the recipe succeeds
+func (s RecipeStep) Condition() string {
+	var parts []string
+	switch s.When {
+	case recipeWhenFailure:
+		parts = append(parts, "after a failure")
+	case recipeWhenAlways:
+		parts = append(parts, "always")
+	}
+	if s.IfStep > 0 {
+		parts = append(parts, fmt.Sprintf("if step %d exited %s", s.IfStep, s.exitCodes()))
+	}
+	if s.IgnoreFailure {
+		parts = append(parts, "failure ignored")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// validateRecipe checks a recipe before it is stored
+func validateRecipe(recipe Recipe) error {
+	if !recipeNamePattern.MatchString(recipe.Name) {
+		return fmt.Errorf("invalid recipe name %q; use lowercase letters, digits and dashes", recipe.Name)
+	}
+	if len(recipe.Steps) == 0 || len(recipe.Steps) > maxRecipeSteps {
+		return fmt.Errorf("a recipe needs between 1 and %d steps", maxRecipeSteps)
+	}
+	for i, step := range recipe.Steps {
+		if err := validateRecipeStep(step); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if err := validateRecipeCondition(step, i); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateRecipeStep checks the fields of one step for its type
+func validateRecipeStep(step RecipeStep) error {
+	switch step.Type {
+	case recipeStepPackages:
+		if len(step.Packages) == 0 {
+			return errors.New("a packages step needs at least one package")
+		}
+		for _, spec := range step.Packages {
+			if sanitizePackageName(spec) != spec {
+				return fmt.Errorf("invalid package name %q", spec)
+			}
+			if _, _, err := parsePackageSpec(spec); err != nil {
+				return err
+			}
+		}
+	case recipeStepFile:
+		if !path.IsAbs(step.Path) || path.Clean(step.Path) != step.Path || strings.ContainsAny(step.Path, "\n'\"$`\\") {
+			return fmt.Errorf("invalid file path %q; use a clean absolute path", step.Path)
+		}
+		if step.Mode != "" && !fileModePattern.MatchString(step.Mode) {
+			return fmt.Errorf("invalid file mode %q", step.Mode)
+		}
+		if _, err := texttemplate.New(step.Path).Parse(step.Content); err != nil {
+			return fmt.Errorf("parsing the template for %s: %w", step.Path, err)
+		}
+	case recipeStepService:
+		if !serviceNamePattern.MatchString(step.Service) {
+			return fmt.Errorf("invalid service name %q", step.Service)
+		}
+		if !slices.Contains(recipeServiceActions, step.Action) {
+			return fmt.Errorf("invalid service action %q; use %s", step.Action, strings.Join(recipeServiceActions, ", "))
+		}
+	case recipeStepCommand:
+		if strings.TrimSpace(step.Command) == "" {
+			return errors.New("a command step needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown step type %q; use packages, file, service or command", step.Type)
+	}
+	return nil
+}
+
+// validateRecipeCondition checks the condition of step number i, counted from 0
+func validateRecipeCondition(step RecipeStep, i int) error {
+	switch step.When {
+	case "", recipeWhenSuccess, recipeWhenFailure, recipeWhenAlways:
+	default:
+		return fmt.Errorf("invalid condition %q; use success, failure or always", step.When)
+	}
+	if step.IfStep < 0 || step.IfStep > i {
+		return fmt.Errorf("if_step %d is not an earlier step", step.IfStep)
+	}
+	if step.IfExit != "" {
+		if step.IfStep == 0 {
+			return errors.New("if_exit needs if_step")
+		}
+		if !exitCodesPattern.MatchString(step.IfExit) {
+			return fmt.Errorf("invalid exit codes %q; use e.g. 0, 1,2 or !0", step.IfExit)
+		}
+	}
+	return nil
+}
+
+// serviceCommand manages a service with systemctl, or OpenRC where systemd is missing
+func serviceCommand(service, action string) string {
+	systemd := "systemctl " + action + " " + service
+	openrc := "rc-service " + service + " " + action
+	if action == "enable" {
+		systemd = "systemctl enable --now " + service
+		openrc = "rc-update add " + service + " default && rc-service " + service + " start"
+	}
+	return "if command -v systemctl >/dev/null 2>&1; then " + systemd + "; else " + openrc + "; fi"
+}
+
+// recipeCommand returns the shell command of one step on the given server
+func recipeCommand(step RecipeStep, manager PackageManager, ip string, server ServerInfo, verbosity string) (string, error) {
+	switch step.Type {
+	case recipeStepPackages:
+		pinnedArgs, err := pinnedPackages(manager, step.Packages)
+		if err != nil {
+			return "", err
+		}
+		return manager.Update(verbosity) + " && " + manager.Install(pinnedArgs, verbosity), nil
+	case recipeStepFile:
+		tmpl, err := texttemplate.New(step.Path).Option("missingkey=error").Parse(step.Content)
+		if err != nil {
+			return "", err
+		}
+		var content bytes.Buffer
+		data := map[string]string{"IP": ip, "Name": serverDisplayName(ip, server), "Group": server.Group}
+		if err := tmpl.Execute(&content, data); err != nil {
+			return "", fmt.Errorf("rendering %s: %w", step.Path, err)
+		}
+		mode := step.Mode
+		if mode == "" {
+			mode = "0644"
+		}
+		return "install -d " + shellQuote(path.Dir(step.Path)) + " && " +
+			"printf '%s' " + shellQuote(content.String()) + " > " + shellQuote(step.Path) + " && " +
+			"chmod " + mode + " " + shellQuote(step.Path), nil
+	case recipeStepService:
+		return serviceCommand(step.Service, step.Action), nil
+	}
+	return step.Command, nil
+}
+
+// recipeMarker prefixes the lines recipeScript prints for steps that failed or were skipped
+const recipeMarker = "__ACCMGR_RECIPE__"
+
+// recipeCondition returns the shell test deciding whether a step runs
+func recipeCondition(step RecipeStep, continueOnFailure bool) string {
+	var tests []string
+	switch step.When {
+	case recipeWhenFailure:
+		tests = append(tests, `[ "$failed" -ne 0 ]`)
+	case recipeWhenAlways:
+	default:
+		if !continueOnFailure {
+			tests = append(tests, `[ "$failed" -eq 0 ]`)
+		}
+	}
+	if step.IfStep > 0 {
+		rc := fmt.Sprintf("$rc_%d", step.IfStep-1)
+		codes, negate := strings.CutPrefix(step.exitCodes(), "!")
+		var matches []string
+		for _, code := range strings.Split(codes, ",") {
+			matches = append(matches, fmt.Sprintf(`[ "%s" -eq %s ]`, rc, code))
+		}
+		match := "{ " + strings.Join(matches, " || ") + "; }"
+		if negate {
+			match = "! " + match
+		}
+		tests = append(tests, fmt.Sprintf(`[ -n "%s" ]`, rc), match)
+	}
+	if len(tests) == 0 {
+		return "true"
+	}
+	return strings.Join(tests, " && ")
+}
+
+// recipeScript runs each step's command when its condition holds. A step that ran leaves
+// its exit code in rc_<i>, and the script exits with the first failure not ignored.
+func recipeScript(recipe Recipe, commands []string) string {
+	var script strings.Builder
+	script.WriteString("failed=0\n")
+	for i, step := range recipe.Steps {
+		fail := fmt.Sprintf(`[ "$failed" -ne 0 ] || failed=$rc_%d`, i)
+		if step.IgnoreFailure {
+			fail = ":"
+		}
+		script.WriteString(fmt.Sprintf("if %s; then\n", recipeCondition(step, recipe.ContinueOnFailure)))
+		script.WriteString(fmt.Sprintf("  %s; rc_%d=$?\n", commands[i], i))
+		script.WriteString(fmt.Sprintf("  if [ $rc_%d -ne 0 ]; then echo %s exit %d $rc_%d; %s; fi\n", i, recipeMarker, i, i, fail))
+		script.WriteString(fmt.Sprintf("else\n  echo %s skip %d\nfi\n", recipeMarker, i))
+	}
+	script.WriteString(`exit "$failed"`)
+	return script.String()
+}
+
+// recipeOutcome is what recipeScript reported about a step: its exit code when it failed,
+// or -1, and whether its condition skipped it
+type recipeOutcome struct {
+	Exit    int
+	Skipped bool
+}
+
+// parseRecipeOutput removes the marker lines of recipeScript from stdout and returns the
+// outcome of each of the count steps
+func parseRecipeOutput(stdout string, count int) (string, []recipeOutcome) {
+	outcomes := make([]recipeOutcome, count)
+	for i := range outcomes {
+		outcomes[i].Exit = -1
+	}
+	if !strings.Contains(stdout, recipeMarker) {
+		return stdout, outcomes
+	}
+	var clean strings.Builder
+	for _, line := range strings.SplitAfter(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != recipeMarker {
+			clean.WriteString(line)
+			continue
+		}
+		i, err := strconv.Atoi(fields[2])
+		if err != nil || i < 0 || i >= count {
+			continue
+		}
+		switch {
+		case fields[1] == "skip":
+			outcomes[i].Skipped = true
+		case fields[1] == "exit" && len(fields) == 4:
+			outcomes[i].Exit, _ = strconv.Atoi(fields[3])
+		}
+	}
+	return clean.String(), outcomes
+}
+
+// recipeStepLog is the log line of step number i, counted from 0
+func recipeStepLog(i int, step RecipeStep, status stepStatus, outcome recipeOutcome) string {
+	marker := status.Marker()
+	var notes []string
+	if outcome.Skipped {
+		notes = append(notes, "skipped")
+	}
+	if outcome.Exit >= 0 {
+		notes = append(notes, fmt.Sprintf("exit %d", outcome.Exit))
+	}
+	if status == stepFailed && step.IgnoreFailure {
+		marker = "⚠️"
+		notes = append(notes, "ignored")
+	}
+	line := fmt.Sprintf("%s %d. %s", marker, i+1, step.Label())
+	if len(notes) > 0 {
+		line += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return line + "\n"
+}
+
+// recipesHandler lists the recipes with a form to run one and a form to add or edit one
+func recipesHandler(w http.ResponseWriter, r *http.Request) {
+	var editing Recipe
+	steps := "[]"
+	if name := r.FormValue("edit"); name != "" {
+		editing, _ = findRecipe(name)
+		if data, err := json.MarshalIndent(editing.Steps, "", "  "); err == nil {
+			steps = string(data)
+		}
+	}
+	var builtIn []string
+	for _, recipe := range builtinRecipes {
+		builtIn = append(builtIn, recipe.Name)
+	}
+	renderTemplate(w, r, "templates/recipes.html", map[string]interface{}{
+		"Recipes": recipes(),
+		"BuiltIn": builtIn,
+		"Editing": editing,
+		"Steps":   steps,
+		"IPs":     linuxServerIPs(requestServers(r)),
+		"Servers": requestServers(r),
+	})
+}
+
+// saveRecipeHandler adds a recipe or replaces the one with the same name. Steps are given
+// as a JSON array of RecipeStep.
+func saveRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	recipe := Recipe{
+		Name:              strings.TrimSpace(r.FormValue("name")),
+		Description:       strings.TrimSpace(r.FormValue("description")),
+		ContinueOnFailure: r.FormValue("continue_on_failure") == "on",
+		Artifacts:         parseArtifactPatterns(r.FormValue("artifacts")),
+	}
+	decoder := json.NewDecoder(strings.NewReader(r.FormValue("steps")))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&recipe.Steps); err != nil {
+		http.Error(w, "❌ Reading the steps: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateRecipe(recipe); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.Recipes = slices.DeleteFunc(settings.Recipes, func(r Recipe) bool { return r.Name == recipe.Name })
+	settings.Recipes = append(settings.Recipes, recipe)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/recipes"), http.StatusSeeOther)
+}
+
+// deleteRecipeHandler removes a recipe from settings; a built-in one reverts to its
+// shipped form
+func deleteRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	settings.Recipes = slices.DeleteFunc(settings.Recipes, func(r Recipe) bool { return r.Name == name })
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/recipes"), http.StatusSeeOther)
+}
+
+// runRecipeHandler runs every step of a recipe on a server as one job and reports the
+// status of each step
+func runRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := serversSnapshot()[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "Recipes") {
+		return
+	}
+	recipe, ok := findRecipe(r.FormValue("recipe"))
+	if !ok {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	operator := requestOperator(r)
+	var err error
+	if server, err = operatorServer(server, operator); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+		return
+	}
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	verbosity := parseVerbosity(r.FormValue("verbosity"))
+	rollback := r.FormValue("rollback") == "on"
+	timeout, err := parseJobTimeout(r.FormValue("timeout"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	priority, err := parseJobPriority(r.FormValue("priority"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var before map[string]string
+	if rollback {
+		if before, err = installedVersions(ip, server, manager); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	var commands []string
+	for i, step := range recipe.Steps {
+		command, err := recipeCommand(step, manager, ip, server, verbosity)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("❌ Step %d (%s): %v", i+1, step.Label(), err), http.StatusBadRequest)
+			return
+		}
+		commands = append(commands, numberedStep(i, len(recipe.Steps), step.Label())+" && "+trackedCommand(i, command))
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("🧪 Recipe %s on %s\n\n", recipe.Name, ip))
+
+	// run runs the recipe as job, straight away or once an approval rule let it through
+	ctx, form, jobURL := r.Context(), r.PostForm, appPath(r, "/job?id=")
+	run := func(job *Job) jobResult {
+		job.setRerun(ctx, "/run-recipe", form)
+		job.setTimeout(timeout)
+		script := tracedScript(recipeScript(recipe, commands), verbosity, false)
+		result, err := runPrivilegedCommandLive(job.context(), ip, server, operatorScript(server, script, operator, job.ID), job.output)
+		var statuses []stepStatus
+		var outcomes []recipeOutcome
+		result.Stdout, outcomes = parseRecipeOutput(result.Stdout, len(recipe.Steps))
+		result.Stdout, statuses = parseTrackedOutput(result.Stdout, len(recipe.Steps))
+		var rolledBack []string
+		var rollbackErr error
+		rollingBack := rollback && err == nil && !result.OK()
+		if rollingBack {
+			rolledBack, rollbackErr = rollbackPackages(job, ip, server, manager, before, operator, verbosity)
+		}
+		var artifacts []JobArtifact
+		if err == nil && len(recipe.Artifacts) > 0 {
+			artifacts = collectArtifacts(job, ip, server, recipe.Artifacts)
+		}
+		jobErr := job.commandOutcome(result, err)
+		writeRecipeLog(&logBuilder, recipe, statuses, outcomes, result, err)
+		if rollingBack {
+			writeRollbackLog(&logBuilder, rolledBack, rollbackErr)
+		}
+		if err == nil {
+			logBuilder.WriteString("Output:\n" + verbosityOutput(result.Output(), verbosity, result.OK()))
+		}
+		if len(artifacts) > 0 {
+			writeArtifactLog(&logBuilder, jobURL+job.ID, artifacts)
+		}
+		return jobResult{Log: logBuilder.String(), Err: jobErr, Template: "templates/logs.html", Data: logBuilder.String()}
+	}
+	held := Job{Kind: "recipe", Server: ip, Description: "Recipe " + recipe.Name, Priority: priority}
+	if holdForApproval(w, r, held, jobTargets{"recipe", map[string]ServerInfo{ip: server}}, strings.Join(commands, "\n"), func(job *Job) jobResult {
+		// Roll back to the versions installed when the approved recipe runs, not when it was
+		// requested
+		if rollback {
+			var err error
+			if before, err = installedVersions(ip, server, manager); err != nil {
+				logBuilder.WriteString(fmt.Sprintf("❌ Reading the installed versions to roll back to: %v\n", err))
+				return jobResult{Log: logBuilder.String(), Err: err, Template: "templates/logs.html", Data: logBuilder.String()}
+			}
+		}
+		return run(job)
+	}) {
+		return
+	}
+
+	job := startPriorityJob(operator, "recipe", ip, "Recipe "+recipe.Name, priority)
+	submittedJob(r, job)
+	result := run(job)
+	job.finish(result.Err)
+	renderTemplate(w, r, result.Template, result.Data)
+}
+
+// writeRecipeLog writes the status of every step of a recipe run and its outcome
+func writeRecipeLog(logBuilder *strings.Builder, recipe Recipe, statuses []stepStatus, outcomes []recipeOutcome, result CommandResult, err error) {
+	ran := 0
+	for i, step := range recipe.Steps {
+		logBuilder.WriteString(recipeStepLog(i, step, statuses[i], outcomes[i]))
+		if statuses[i] != stepNotRun {
+			ran++
+		}
+	}
+	logBuilder.WriteString("\n")
+	switch {
+	case err != nil:
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	case !result.OK():
+		logBuilder.WriteString(fmt.Sprintf("❌ Recipe failed with %s\n\n", result.Status()))
+	default:
+		logBuilder.WriteString(fmt.Sprintf("✅ Recipe finished, %d of %d steps ran\n\n", ran, len(recipe.Steps)))
+	}
+}
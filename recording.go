@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// recordingsDir holds session recordings in asciicast v2 format, replayable with asciinema
+// or the built-in player
+const recordingsDir = "recordings"
+
+// recordingTimeFormat starts every recording file name, so names sort by start time
+const recordingTimeFormat = "20060102T150405.000000"
+
+// castHeader is the first line of an asciicast v2 file
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// sessionRecorder appends timed output events to one recording. Writes never fail, so a
+// full disk cannot break the session being recorded; the first error is logged instead.
+type sessionRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	out     *bufio.Writer
+	start   time.Time
+	crlf    bool   // translate bare newlines so scripted output replays like a terminal
+	pending []byte // trailing bytes of an incomplete UTF-8 sequence, or line when masking
+	// clean, when set, masks each line of output before it is recorded, so output is
+	// recorded a line at a time; a line it empties is dropped
+	clean  func(string) string
+	failed bool
+}
+
+// startRecording creates a recording for a session of the given kind ("terminal" or
+// "command"). It returns nil, after logging why, when the file cannot be created.
+func startRecording(kind, ip, title string, cols, rows int, crlf bool) *sessionRecorder {
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s-%s.cast", start.Format(recordingTimeFormat), kind, strings.ReplaceAll(ip, ":", "_"))
+	if err := os.MkdirAll(recordingsDir, 0750); err != nil {
+		fmt.Printf("⚠️ Session recording disabled: %v\n", err)
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(recordingsDir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		fmt.Printf("⚠️ Session recording disabled: %v\n", err)
+		return nil
+	}
+
+	r := &sessionRecorder{file: file, out: bufio.NewWriter(file), start: start, crlf: crlf}
+	r.writeJSON(castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	return r
+}
+
+// startCommandRecording records a scripted command; the script itself is the first event
+func startCommandRecording(ip string, server ServerInfo, script string) *sessionRecorder {
+	r := startRecording("command", ip, server.RootUsername+"@"+ip+": "+firstLine(script), 200, 40, true)
+	if r != nil {
+		r.event("i", script)
+	}
+	return r
+}
+
+// mask has the recorder pass every line of output through clean, such as the sudo
+// responder's, which hides the password the same way the job log does
+func (r *sessionRecorder) mask(clean func(string) string) {
+	if r != nil {
+		r.mu.Lock()
+		r.clean = clean
+		r.mu.Unlock()
+	}
+}
+
+// Write records output from the session
+func (r *sessionRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+	if r.clean != nil {
+		cut := bytes.LastIndexByte(data, '\n') + 1
+		r.pending = append([]byte(nil), data[cut:]...)
+		if cut > 0 {
+			r.eventLocked("o", r.cleanLines(string(data[:cut])))
+		}
+		return len(p), nil
+	}
+	// Hold back a multi-byte character split across writes so it is not mangled
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.eventLocked("o", string(data[:cut]))
+	}
+	return len(p), nil
+}
+
+// tee returns w with the recorder attached, or w alone when nothing is being recorded
+func (r *sessionRecorder) tee(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return multiWriter{w, r}
+}
+
+// resize records a terminal size change
+func (r *sessionRecorder) resize(cols, rows int) {
+	if r != nil {
+		r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+	}
+}
+
+// event appends one event at the current offset
+func (r *sessionRecorder) event(code, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.eventLocked(code, data)
+}
+
+// cleanLines masks each line of output with clean, when it is set
+func (r *sessionRecorder) cleanLines(output string) string {
+	if r.clean == nil {
+		return output
+	}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(output, "\n") {
+		text, newline := strings.CutSuffix(line, "\n")
+		text = strings.TrimSuffix(text, "\r")
+		cleaned := r.clean(text)
+		if cleaned == "" && text != "" {
+			continue
+		}
+		b.WriteString(cleaned)
+		if newline {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func (r *sessionRecorder) eventLocked(code, data string) {
+	if data == "" {
+		return
+	}
+	if r.crlf && code == "o" {
+		data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\n", "\r\n")
+	}
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	r.writeJSON([]any{elapsed, code, data})
+}
+
+// writeJSON appends one line; HTML escaping is off so recorded shell text stays readable
+func (r *sessionRecorder) writeJSON(v any) {
+	if r.failed {
+		return
+	}
+	enc := json.NewEncoder(r.out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		r.failed = true
+		fmt.Printf("⚠️ Session recording %s stopped: %v\n", r.file.Name(), err)
+	}
+}
+
+// close marks how the session ended and closes the file
+func (r *sessionRecorder) close(ending string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		r.eventLocked("o", r.cleanLines(string(r.pending)))
+		r.pending = nil
+	}
+	r.eventLocked("m", ending)
+	if err := r.out.Flush(); err != nil && !r.failed {
+		fmt.Printf("⚠️ Session recording %s stopped: %v\n", r.file.Name(), err)
+	}
+	r.file.Close()
+}
+
+// multiWriter writes to every writer, ignoring the recorder's result, unlike io.MultiWriter
+// which stops at the first error
+type multiWriter struct {
+	w io.Writer
+	r *sessionRecorder
+}
+
+func (m multiWriter) Write(p []byte) (int, error) {
+	m.r.Write(p)
+	return m.w.Write(p)
+}
+
+// Recording is one stored session as listed on the recordings page
+type Recording struct {
+	Name      string
+	Kind      string
+	Server    string
+	Title     string
+	StartedAt time.Time
+	Duration  time.Duration
+	Size      int64
+}
+
+// listRecordings returns stored recordings newest first, optionally only for one server
+func listRecordings(server string) ([]Recording, error) {
+	entries, err := os.ReadDir(recordingsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recordings []Recording
+	for _, entry := range entries {
+		recording, ok := parseRecordingName(entry.Name())
+		if !ok || (server != "" && recording.Server != server) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			recording.Size = info.Size()
+			recording.Duration = info.ModTime().Sub(recording.StartedAt).Round(time.Second)
+		}
+		recording.Title = recordingTitle(recording.Name)
+		recordings = append(recordings, recording)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].Name > recordings[j].Name })
+	return recordings, nil
+}
+
+// parseRecordingName splits "<time>-<kind>-<ip>.cast"; anything else is not a recording
+func parseRecordingName(name string) (Recording, bool) {
+	if filepath.Base(name) != name || !strings.HasSuffix(name, ".cast") {
+		return Recording{}, false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(name, ".cast"), "-", 3)
+	if len(parts) != 3 {
+		return Recording{}, false
+	}
+	started, err := time.ParseInLocation(recordingTimeFormat, parts[0], time.Local)
+	if err != nil {
+		return Recording{}, false
+	}
+	return Recording{Name: name, Kind: parts[1], Server: strings.ReplaceAll(parts[2], "_", ":"), StartedAt: started}, true
+}
+
+// recordingTitle reads the title from a recording's header line
+func recordingTitle(name string) string {
+	file, err := os.Open(filepath.Join(recordingsDir, name))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	line, _ := bufio.NewReader(file).ReadBytes('\n')
+	var header castHeader
+	json.Unmarshal(line, &header)
+	return header.Title
+}
+
+// maxTranscriptBytes caps the text transcript shown on the replay page
+const maxTranscriptBytes = 1 << 20
+
+// terminalEscape matches the CSI, OSC and charset escape sequences a transcript drops
+var terminalEscape = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[()][0-9A-Za-z]|[=>78])`)
+
+// plainTerminalText turns terminal output into plain text: escape sequences are removed,
+// backspaces erase the character before them and carriage returns are dropped
+func plainTerminalText(output string) string {
+	output = terminalEscape.ReplaceAllString(output, "")
+	var text []rune
+	for _, char := range output {
+		switch {
+		case char == '\b':
+			if len(text) > 0 && text[len(text)-1] != '\n' {
+				text = text[:len(text)-1]
+			}
+		case char == '\r', char == '\a':
+		default:
+			text = append(text, char)
+		}
+	}
+	return string(text)
+}
+
+// recordingTranscript returns a recording as plain text for readers that cannot use the
+// terminal player: the script sent to the server, if any, and the output with session
+// markers on their own lines
+func recordingTranscript(name string) (input, output string, err error) {
+	file, err := os.Open(filepath.Join(recordingsDir, name))
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	var in, out strings.Builder
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	scanner.Scan() // header
+	for scanner.Scan() && out.Len() < maxTranscriptBytes {
+		var event []any
+		if json.Unmarshal(scanner.Bytes(), &event) != nil || len(event) != 3 {
+			continue
+		}
+		code, _ := event[1].(string)
+		data, _ := event[2].(string)
+		switch code {
+		case "i":
+			in.WriteString(data)
+		case "o":
+			out.WriteString(data)
+		case "m":
+			out.WriteString("\n[" + data + "]\n")
+		}
+	}
+	output = plainTerminalText(out.String())
+	if out.Len() >= maxTranscriptBytes {
+		output += "\n[transcript truncated; download the recording for the rest]\n"
+	}
+	return in.String(), output, scanner.Err()
+}
+
+// recordingsHandler lists recordings for compliance review
+func recordingsHandler(w http.ResponseWriter, r *http.Request) {
+	server := strings.TrimSpace(r.FormValue("server"))
+	recordings, err := listRecordings(server)
+	if err != nil {
+		http.Error(w, "❌ Reading recordings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if scope := requestScope(r); len(scope) > 0 {
+		servers := serversSnapshot()
+		recordings = slices.DeleteFunc(recordings, func(recording Recording) bool { return !serverInScope(scope, servers, recording.Server) })
+	}
+
+	data := map[string]interface{}{
+		"Server":     server,
+		"Recordings": recordings,
+	}
+	renderTemplate(w, r, "templates/recordings.html", data)
+}
+
+// recordingHandler shows the replay page for one recording
+func recordingHandler(w http.ResponseWriter, r *http.Request) {
+	recording, ok := parseRecordingName(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	recording.Title = recordingTitle(recording.Name)
+	input, transcript, err := recordingTranscript(recording.Name)
+	if err != nil {
+		transcript = "Could not read the recording: " + err.Error()
+	}
+
+	renderTemplate(w, r, "templates/recording_replay.html", map[string]interface{}{
+		"Recording":  recording,
+		"Input":      input,
+		"Transcript": transcript,
+	})
+}
+
+// recordingFileHandler downloads a recording in asciicast format
+func recordingFileHandler(w http.ResponseWriter, r *http.Request) {
+	recording, ok := parseRecordingName(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", "attachment; filename="+recording.Name)
+	http.ServeFile(w, r, filepath.Join(recordingsDir, recording.Name))
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// aptKeyringDir holds the dearmored keys that apt repositories are signed-by
+	aptKeyringDir = "/etc/apt/keyrings"
+	// repositoryFilePrefix names the files this tool writes, so they are easy to find on a server
+	repositoryFilePrefix = "accmgr4-"
+)
+
+// PackageRepository is a third-party package repository and the key its packages are signed
+// with, added to a server before installing software that is not in the distribution, e.g.
+// Docker CE or current Node.js releases.
+//
+// In Apt and Yum, {distro} and {codename} stand for ID and VERSION_CODENAME from the server's
+// /etc/os-release. dnf and yum expand $releasever and $basearch themselves.
+type PackageRepository struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Apt is the source after "deb", e.g. "https://download.docker.com/linux/{distro} {codename} stable"
+	Apt    string `json:"apt,omitempty"`
+	AptKey string `json:"apt_key,omitempty"`
+	// Yum is the baseurl of the repository, e.g. "https://rpm.nodesource.com/pub_22.x/nodistro/$basearch"
+	Yum    string `json:"yum,omitempty"`
+	YumKey string `json:"yum_key,omitempty"`
+}
+
+// builtinRepositories are always available; a repository saved in settings with the same
+// name replaces the built-in one
+var builtinRepositories = []PackageRepository{
+	{
+		Name:        "docker",
+		Description: "Docker CE from download.docker.com",
+		Apt:         "https://download.docker.com/linux/{distro} {codename} stable",
+		AptKey:      "https://download.docker.com/linux/{distro}/gpg",
+		Yum:         "https://download.docker.com/linux/centos/$releasever/$basearch/stable",
+		YumKey:      "https://download.docker.com/linux/centos/gpg",
+	},
+	{
+		Name:        "nodesource",
+		Description: "Node.js 22 LTS from NodeSource",
+		Apt:         "https://deb.nodesource.com/node_22.x nodistro main",
+		AptKey:      "https://deb.nodesource.com/gpgkey/nodesource-repo.gpg.key",
+		Yum:         "https://rpm.nodesource.com/pub_22.x/nodistro/$basearch",
+		YumKey:      "https://rpm.nodesource.com/gpgkey/ns-operations-public.key",
+	},
+}
+
+var (
+	// repositoryNamePattern matches repository names, which also name the files on servers
+	repositoryNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	// repositoryWordPattern matches the suite and components of an apt source
+	repositoryWordPattern = regexp.MustCompile(`^[A-Za-z0-9{}][A-Za-z0-9._/{}-]*$`)
+	// repositoryPlaceholders maps placeholders to the os-release variables they stand for
+	repositoryPlaceholders = map[string]string{"{distro}": "ID", "{codename}": "VERSION_CODENAME"}
+)
+
+// packageRepositories returns the built-in repositories with those from settings, sorted
+func packageRepositories() []PackageRepository {
+	repositories := slices.Clone(builtinRepositories)
+	for _, repository := range settings.Repositories {
+		i := slices.IndexFunc(repositories, func(r PackageRepository) bool { return r.Name == repository.Name })
+		if i >= 0 {
+			repositories[i] = repository
+		} else {
+			repositories = append(repositories, repository)
+		}
+	}
+	sort.Slice(repositories, func(i, j int) bool { return repositories[i].Name < repositories[j].Name })
+	return repositories
+}
+
+// findRepository returns the repository with the given name
+func findRepository(name string) (PackageRepository, bool) {
+	for _, repository := range packageRepositories() {
+		if repository.Name == name {
+			return repository, true
+		}
+	}
+	return PackageRepository{}, false
+}
+
+// validateRepositoryURL checks a key or repository URL. URLs end up in shell commands and
+// repository files, so only plain http and https without quotes or spaces are accepted.
+func validateRepositoryURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		strings.ContainsAny(raw, " #&\\'\"`;|<>()") {
+		return fmt.Errorf("invalid repository URL %q", raw)
+	}
+	return nil
+}
+
+// validateRepository checks a repository before it is stored
+func validateRepository(repository PackageRepository) error {
+	if !repositoryNamePattern.MatchString(repository.Name) {
+		return fmt.Errorf("invalid repository name %q; use lowercase letters, digits and dashes", repository.Name)
+	}
+	if repository.Apt == "" && repository.Yum == "" {
+		return errors.New("an apt source or a yum baseurl is required")
+	}
+	if (repository.Apt == "") != (repository.AptKey == "") || (repository.Yum == "") != (repository.YumKey == "") {
+		return errors.New("each repository needs the URL of its signing key")
+	}
+	if repository.Apt != "" {
+		fields := strings.Fields(repository.Apt)
+		if len(fields) < 2 {
+			return errors.New("the apt source needs a URL and a suite, e.g. https://example.com/apt stable main")
+		}
+		if err := validateRepositoryURL(fields[0]); err != nil {
+			return err
+		}
+		for _, word := range fields[1:] {
+			if !repositoryWordPattern.MatchString(word) {
+				return fmt.Errorf("invalid apt suite or component %q", word)
+			}
+		}
+	}
+	for _, raw := range []string{repository.AptKey, repository.Yum, repository.YumKey} {
+		if raw == "" {
+			continue
+		}
+		if err := validateRepositoryURL(strings.NewReplacer("$releasever", "releasever", "$basearch", "basearch").Replace(raw)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repositoryWord quotes s for the shell, expanding {distro} and {codename} from the
+// variables /etc/os-release sets and leaving everything else literal
+func repositoryWord(s string) string {
+	var word strings.Builder
+	for s != "" {
+		start := strings.IndexByte(s, '{')
+		end := strings.IndexByte(s, '}')
+		if start < 0 || end < start {
+			word.WriteString(shellQuote(s))
+			break
+		}
+		variable, ok := repositoryPlaceholders[s[start:end+1]]
+		if !ok {
+			word.WriteString(shellQuote(s[:end+1]))
+			s = s[end+1:]
+			continue
+		}
+		if start > 0 {
+			word.WriteString(shellQuote(s[:start]))
+		}
+		word.WriteString(`"${` + variable + `}"`)
+		s = s[end+1:]
+	}
+	return word.String()
+}
+
+// repositoryFamily returns "apt" or "yum" for the managers that can add repositories
+func repositoryFamily(manager PackageManager) (string, error) {
+	switch manager.Name() {
+	case "apt":
+		return "apt", nil
+	case "dnf", "yum":
+		return "yum", nil
+	}
+	return "", fmt.Errorf("third-party repositories support apt, dnf and yum, not %s", manager.Name())
+}
+
+// addRepositoryScript installs the repository's key and writes its source file, replacing
+// earlier versions of both. curl and gpg are installed first when missing; armored keys are
+// dearmored for apt and binary ones copied as they are.
+func addRepositoryScript(manager PackageManager, repository PackageRepository, verbosity string) (string, error) {
+	family, err := repositoryFamily(manager)
+	if err != nil {
+		return "", err
+	}
+	name := repositoryFilePrefix + repository.Name
+	description := repository.Description
+	if description == "" {
+		description = repository.Name
+	}
+	switch {
+	case family == "apt" && repository.Apt != "":
+		keyring := aptKeyringDir + "/" + name + ".gpg"
+		fields := strings.Fields(repository.Apt)
+		source := `"deb [signed-by=` + keyring + `]"`
+		for _, field := range fields {
+			source += `" "` + repositoryWord(field)
+		}
+		return ". /etc/os-release && " +
+			"{ command -v curl >/dev/null 2>&1 && command -v gpg >/dev/null 2>&1 || { " +
+			manager.Update(verbosity) + " && " + manager.Install([]string{"curl", "gnupg", "ca-certificates"}, verbosity) + "; }; } && " +
+			"install -d -m 0755 " + aptKeyringDir + " && " +
+			"curl -fsSL " + repositoryWord(repository.AptKey) + " -o /tmp/" + name + ".key && " +
+			"if grep -q 'BEGIN PGP' /tmp/" + name + ".key; then gpg --dearmor --yes -o " + keyring + " /tmp/" + name + ".key; " +
+			"else cp /tmp/" + name + ".key " + keyring + "; fi && " +
+			"chmod 0644 " + keyring + " && rm -f /tmp/" + name + ".key && " +
+			"echo " + source + " > /etc/apt/sources.list.d/" + name + ".list", nil
+	case family == "yum" && repository.Yum != "":
+		return ". /etc/os-release && " +
+			"rpm --import " + repositoryWord(repository.YumKey) + " && " +
+			"printf '%s\\n' " + shellQuote("["+name+"]") + " " + shellQuote("name="+description) + " " +
+			"'baseurl='" + repositoryWord(repository.Yum) + " 'enabled=1' 'gpgcheck=1' " +
+			"'gpgkey='" + repositoryWord(repository.YumKey) + " > /etc/yum.repos.d/" + name + ".repo", nil
+	}
+	return "", fmt.Errorf("repository %s has no %s source", repository.Name, family)
+}
+
+// removeRepositoryScript deletes the repository's source file and key
+func removeRepositoryScript(manager PackageManager, repository PackageRepository) (string, error) {
+	family, err := repositoryFamily(manager)
+	if err != nil {
+		return "", err
+	}
+	name := repositoryFilePrefix + repository.Name
+	if family == "apt" {
+		return "rm -f /etc/apt/sources.list.d/" + name + ".list " + aptKeyringDir + "/" + name + ".gpg", nil
+	}
+	return "rm -f /etc/yum.repos.d/" + name + ".repo", nil
+}
+
+// repositoriesHandler lists the repositories with a form to add or edit one and to add
+// or remove them on a server
+func repositoriesHandler(w http.ResponseWriter, r *http.Request) {
+	var editing PackageRepository
+	if name := r.FormValue("edit"); name != "" {
+		editing, _ = findRepository(name)
+	}
+	var builtIn []string
+	for _, repository := range builtinRepositories {
+		builtIn = append(builtIn, repository.Name)
+	}
+	renderTemplate(w, r, "templates/repositories.html", map[string]interface{}{
+		"Repositories": packageRepositories(),
+		"BuiltIn":      builtIn,
+		"Editing":      editing,
+		"IPs":          linuxServerIPs(requestServers(r)),
+		"Servers":      requestServers(r),
+	})
+}
+
+// saveRepositoryHandler adds a repository or replaces the one with the same name
+func saveRepositoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	repository := PackageRepository{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Apt:         strings.Join(strings.Fields(r.FormValue("apt")), " "),
+		AptKey:      strings.TrimSpace(r.FormValue("apt_key")),
+		Yum:         strings.TrimSpace(r.FormValue("yum")),
+		YumKey:      strings.TrimSpace(r.FormValue("yum_key")),
+	}
+	if err := validateRepository(repository); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.Repositories = slices.DeleteFunc(settings.Repositories, func(r PackageRepository) bool { return r.Name == repository.Name })
+	settings.Repositories = append(settings.Repositories, repository)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/repositories"), http.StatusSeeOther)
+}
+
+// deleteRepositoryHandler removes a repository from settings; a built-in one reverts to
+// its shipped form. Servers keep the repository until it is removed from them.
+func deleteRepositoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	settings.Repositories = slices.DeleteFunc(settings.Repositories, func(r PackageRepository) bool { return r.Name == name })
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/repositories"), http.StatusSeeOther)
+}
+
+// applyRepositoryHandler adds a repository to a server, or removes it, and refreshes the
+// package index so its packages can be installed right away
+func applyRepositoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := serversSnapshot()[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "Repository management") {
+		return
+	}
+	repository, ok := findRepository(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	operator := requestOperator(r)
+	var err error
+	if server, err = operatorServer(server, operator); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+		return
+	}
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	verbosity := parseVerbosity(r.FormValue("verbosity"))
+	remove := r.FormValue("operation") == "remove"
+	var command string
+	if remove {
+		command, err = removeRepositoryScript(manager, repository)
+	} else {
+		command, err = addRepositoryScript(manager, repository, verbosity)
+	}
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	action, verb, done := "Adding", "add", "added to"
+	if remove {
+		action, verb, done = "Removing", "remove", "removed from"
+	}
+	script := scriptStep(verb+" repository "+repository.Name) + " && " + command + " && " +
+		scriptStep(manager.Name()+" update") + " && " + manager.Update(verbosity)
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("📚 %s repository %s on %s\n\n", action, repository.Name, ip))
+
+	job := startOperatorJob(operator, "repository", ip, fmt.Sprintf("%s repository %s", action, repository.Name))
+	result, err := runPrivilegedCommandLive(job.context(), ip, server, operatorScript(server, tracedScript(script, verbosity, false), operator, job.ID), nil)
+	job.finishCommand(result, err)
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	} else {
+		logBuilder.WriteString(verbosityOutput(result.Output(), verbosity, result.OK()))
+		if result.OK() {
+			logBuilder.WriteString(fmt.Sprintf("\n✅ Repository %s %s %s\n", repository.Name, done, ip))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("\n❌ Repository %s failed with %s\n", strings.ToLower(action), result.Status()))
+		}
+	}
+
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
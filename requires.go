@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// resolveRequires expands the named catalog entries with the entries they require, directly
+// or through other entries, ordered so every entry comes after its prerequisites. It also
+// returns, for each entry added as a prerequisite, the entry that first required it.
+func resolveRequires(catalog []Software, names []string) ([]string, map[string]string, error) {
+	entries := make(map[string]Software, len(catalog))
+	for _, entry := range catalog {
+		entries[entry.Name] = entry
+	}
+	var order []string
+	requiredBy := make(map[string]string)
+	// visiting holds the chain being resolved, to report a cycle with its path
+	var visiting []string
+	var visit func(name, parent string) error
+	visit = func(name, parent string) error {
+		if i := slices.Index(visiting, name); i >= 0 {
+			return fmt.Errorf("catalog entries require each other: %s", strings.Join(append(visiting[i:], name), " → "))
+		}
+		if slices.Contains(order, name) {
+			return nil
+		}
+		entry, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("%s requires %s, which is not in the catalog", parent, name)
+		}
+		visiting = append(visiting, name)
+		for _, required := range entry.Requires {
+			if err := visit(required, name); err != nil {
+				return err
+			}
+		}
+		visiting = visiting[:len(visiting)-1]
+		order = append(order, name)
+		if parent != "" && !slices.Contains(names, name) {
+			if _, ok := requiredBy[name]; !ok {
+				requiredBy[name] = parent
+			}
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	return order, requiredBy, nil
+}
+
+// writePrerequisitesLog lists the entries a job added because selected entries require them
+func writePrerequisitesLog(logBuilder *strings.Builder, selections []softwareSelection) {
+	var added []string
+	for _, selection := range selections {
+		if selection.RequiredBy != "" {
+			added = append(added, selection.Name+" (for "+selection.RequiredBy+")")
+		}
+	}
+	if len(added) > 0 {
+		logBuilder.WriteString("Prerequisites: " + strings.Join(added, ", ") + "\n")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Every user has a role. Viewers see the inventory, jobs and their logs; operators also run
+// jobs and change what they run, such as recipes and schedules; admins also manage the web
+// UI users, the servers' credentials and the app's own settings. requireLogin refuses what
+// the request's role does not allow.
+const (
+	roleViewer   = "viewer"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+// roles are the roles from least to most allowed; each allows what the ones before it do
+var roles = []string{roleViewer, roleOperator, roleAdmin}
+
+// viewerPaths are the pages viewers may open. They only read, so they stay read-only even
+// for handlers that do not check the method.
+var viewerPaths = map[string]bool{
+	"/": true, "/inventory": true, "/jobs": true, "/job": true, "/job-summary": true,
+	"/job-log": true, "/job-result": true, "/job-stream": true, "/job-artifact": true,
+	"/job-history": true, "/events": true, "/recordings": true, "/recording": true,
+	"/recording-file": true, "/unmanaged-changes": true, "/outdated-packages": true,
+	"/approvals": true, "/maintenance-windows": true, "/schedules": true, "/schedule-run": true,
+	"/cron-jobs": true, "/catalog": true, "/recipes": true, "/command-templates": true,
+	"/repositories": true, "/environment": true, "/api/docs": true, "/api/openapi.json": true,
+}
+
+// selfServicePaths are what every user may do to their own sign-in and API tokens
+var selfServicePaths = map[string]bool{
+	"/logout": true, "/api-tokens": true, "/create-api-token": true, "/revoke-api-token": true,
+	"/two-factor": true, "/enable-two-factor": true, "/disable-two-factor": true,
+	"/regenerate-recovery-codes": true,
+}
+
+// twoFactorPaths are all a user whose role requires a second factor may open before they
+// enrolled one
+var twoFactorPaths = map[string]bool{"/two-factor": true, "/enable-two-factor": true, "/logout": true}
+
+// adminPaths are the pages that manage users, credentials and the app's settings, or show
+// passwords, and those that change what limits operators, such as approval rules,
+// maintenance windows and the keys library bundles must be signed with
+var adminPaths = map[string]bool{
+	"/web-users": true, "/save-web-user": true, "/delete-web-user": true,
+	"/credentials": true, "/update-credentials": true, "/add-ip": true,
+	"/download-users": true, "/download-all-users": true,
+	"/features": true, "/update-features": true, "/ssh-settings": true,
+	"/update-ssh-settings": true, "/admin/diagnostics": true,
+	"/reset-two-factor": true, "/save-two-factor-policy": true,
+	"/save-group-role": true, "/delete-group-role": true, "/save-user-servers": true,
+	"/audit": true, "/unlock-login": true,
+	"/save-approval-rule": true, "/delete-approval-rule": true,
+	"/save-maintenance-window": true, "/delete-maintenance-window": true,
+	"/save-notifications": true, "/update-library-settings": true, "/update-catalog-sync": true,
+	"/save-job-log-settings": true, "/save-sshd-template": true,
+	"/lock-env-profile": true, "/unlock-env-profile": true,
+}
+
+// requiredRole returns the least role that may make the request. Reading the API and
+// querying GraphQL, which has no mutations, is open to viewers.
+func requiredRole(r *http.Request) string {
+	path := r.URL.Path
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	switch {
+	case selfServicePaths[path]:
+		return roleViewer
+	case adminPaths[path]:
+		return roleAdmin
+	case path == "/graphql", read && (viewerPaths[path] || strings.HasPrefix(path, "/api/v1/")):
+		return roleViewer
+	}
+	return roleOperator
+}
+
+// roleAllows reports whether role may do what required allows
+func roleAllows(role, required string) bool {
+	return slices.Index(roles, role) >= slices.Index(roles, required)
+}
+
+// userRole returns the role of a web UI user. Users from before roles are admins, and
+// users a trusted proxy identified without a web UI user of the same name are viewers
+// until an admin adds one with another role.
+func userRole(name string) string {
+	user, ok := webUser(name)
+	switch {
+	case !ok:
+		return roleViewer
+	case user.Role == "":
+		return roleAdmin
+	}
+	return user.Role
+}
+
+// requestRole returns the role of the request's operator, limited to the scope of the API
+// token it used
+func requestRole(r *http.Request) string {
+	return tokenRole(r.Context(), userRole(requestOperator(r)))
+}
+
+// contextRole is requestRole for the user a request context carries
+func contextRole(ctx context.Context) string {
+	name, _ := ctx.Value(loginUserKey{}).(string)
+	return tokenRole(ctx, userRole(name))
+}
+
+// tokenRole limits a role to the scope of the API token a request context used
+func tokenRole(ctx context.Context, role string) string {
+	if scope, ok := ctx.Value(tokenScopeKey{}).(string); ok && !roleAllows(scope, role) {
+		return scope
+	}
+	return role
+}
+
+// GroupRole gives the members of a single sign-on or directory group a role
+type GroupRole struct {
+	// Group names the group the way its provider does, or is anyGroup
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// anyGroup in a group mapping matches every user its provider signs in
+const anyGroup = "*"
+
+// groupRole returns the highest role the mappings give any of a user's groups, or "" when
+// none does; matches reports whether a mapped group names one of the user's
+func groupRole(mappings []GroupRole, groups []string, matches func(mapped, group string) bool) string {
+	role := ""
+	for _, mapping := range mappings {
+		if mapping.Group != anyGroup && !slices.ContainsFunc(groups, func(group string) bool { return matches(mapping.Group, group) }) {
+			continue
+		}
+		if role == "" || roleAllows(mapping.Role, role) {
+			role = mapping.Role
+		}
+	}
+	return role
+}
+
+// groupMappings returns where the group mappings of a sign-in provider are kept; callers
+// hold usersMu
+func groupMappings(provider string) (*[]GroupRole, bool) {
+	switch provider {
+	case oidcProvider:
+		return &settings.OIDCGroups, true
+	case ldapProvider:
+		return &settings.LDAPGroups, true
+	}
+	return nil, false
+}
+
+// providerGroups returns the group mappings of a sign-in provider
+func providerGroups(provider string) []GroupRole {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	if mappings, ok := groupMappings(provider); ok {
+		return *mappings
+	}
+	return nil
+}
+
+// groupProviders returns the enabled sign-in providers with their group mappings, for the
+// web UI users page
+func groupProviders(r *http.Request) []map[string]interface{} {
+	var providers []map[string]interface{}
+	if oidcEnabled() {
+		providers = append(providers, map[string]interface{}{
+			"Provider": oidcProvider,
+			"Title":    "Single sign-on groups",
+			"Groups":   providerGroups(oidcProvider),
+			"Hint":     "As the provider lists it in the ID token's " + oidcGroupsClaim + " claim; Azure AD lists group object IDs.",
+			"Note":     "Register " + externalURL(r, "/oidc/callback") + " as the client's redirect URI with the provider.",
+		})
+	}
+	if ldapEnabled() {
+		providers = append(providers, map[string]interface{}{
+			"Provider": ldapProvider,
+			"Title":    "Directory groups",
+			"Groups":   providerGroups(ldapProvider),
+			"Hint":     "The group's DN, or just its name, the value of the DN's first component such as the cn.",
+			"Note":     "Users without a local password sign in with their directory password at " + ldapURL + ".",
+		})
+	}
+	return providers
+}
+
+// saveGroupRoleHandler maps a provider's group to a role, replacing its mapping if it has
+// one
+func saveGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	provider := r.FormValue("provider")
+	_, known := groupMappings(provider)
+	mapping := GroupRole{Group: strings.TrimSpace(r.FormValue("group")), Role: r.FormValue("role")}
+	switch {
+	case !known:
+		http.Error(w, "❌ Unknown sign-in provider "+r.FormValue("provider"), http.StatusBadRequest)
+		return
+	case mapping.Group == "":
+		http.Error(w, "❌ A group is required", http.StatusBadRequest)
+		return
+	case !slices.Contains(roles, mapping.Role):
+		http.Error(w, "❌ Unknown role "+mapping.Role, http.StatusBadRequest)
+		return
+	}
+	usersMu.Lock()
+	mappings, _ := groupMappings(provider)
+	*mappings = append(slices.DeleteFunc(slices.Clone(*mappings), func(existing GroupRole) bool { return existing.Group == mapping.Group }), mapping)
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/web-users"), http.StatusSeeOther)
+}
+
+// deleteGroupRoleHandler removes a group's mapping; its members lose the role at their next
+// sign-in
+func deleteGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	provider := r.FormValue("provider")
+	if _, known := groupMappings(provider); !known {
+		http.Error(w, "❌ Unknown sign-in provider "+provider, http.StatusBadRequest)
+		return
+	}
+	group := r.FormValue("group")
+	usersMu.Lock()
+	mappings, _ := groupMappings(provider)
+	*mappings = slices.DeleteFunc(slices.Clone(*mappings), func(existing GroupRole) bool { return existing.Group == group })
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/web-users"), http.StatusSeeOther)
+}
+
+// admins counts the users with the admin role
+func admins(users []WebUser) int {
+	count := 0
+	for _, user := range users {
+		if user.Role == "" || user.Role == roleAdmin {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/", roleViewer},
+		{"GET", "/jobs", roleViewer},
+		{"GET", "/api/v1/servers", roleViewer},
+		{"POST", "/graphql", roleViewer},
+		{"POST", "/logout", roleViewer},
+		{"POST", "/create-api-token", roleViewer},
+		// Viewer pages only read; posting to them needs an operator
+		{"POST", "/jobs", roleOperator},
+		{"POST", "/api/v1/servers/10.0.0.1/commands", roleOperator},
+		{"POST", "/execute-command", roleOperator},
+		{"POST", "/approve-job", roleOperator},
+		{"GET", "/web-users", roleAdmin},
+		{"POST", "/save-web-user", roleAdmin},
+		{"POST", "/save-approval-rule", roleAdmin},
+		{"POST", "/delete-approval-rule", roleAdmin},
+		{"POST", "/save-maintenance-window", roleAdmin},
+		{"POST", "/update-library-settings", roleAdmin},
+		{"POST", "/lock-env-profile", roleAdmin},
+		{"GET", "/audit", roleAdmin},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredRole(r); got != tt.want {
+			t.Errorf("requiredRole(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUserRole(t *testing.T) {
+	saved := settings.Users
+	t.Cleanup(func() { settings.Users = saved })
+	settings.Users = []WebUser{{Name: "legacy"}, {Name: "ops", Role: roleOperator}}
+
+	tests := []struct {
+		name, want string
+	}{
+		{"legacy", roleAdmin},
+		{"ops", roleOperator},
+		// Users only a trusted proxy knows get no more than viewing
+		{"stranger", roleViewer},
+	}
+	for _, tt := range tests {
+		if got := userRole(tt.name); got != tt.want {
+			t.Errorf("userRole(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// addedPackages returns the packages in after that were not in before, sorted by name
+func addedPackages(before, after map[string]string) []string {
+	var added []string
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	return added
+}
+
+// rollbackPackages removes the packages a failed job installed on a Linux server, comparing
+// the server's package list with the one taken before the job. Dependencies pulled in by the
+// job are new packages too, so they are removed with it; upgrades of packages that were
+// already installed are kept. It returns the packages it tried to remove.
+func rollbackPackages(job *Job, ip string, server ServerInfo, manager PackageManager, before map[string]string, operator, verbosity string) ([]string, error) {
+	job.progress("rolling back packages installed by the job")
+	after, err := installedVersions(ip, server, manager)
+	if err != nil {
+		return nil, err
+	}
+	added := addedPackages(before, after)
+	if len(added) == 0 {
+		return nil, nil
+	}
+	script := tracedScript(manager.Remove(added, false, verbosity), verbosity, false)
+	result, err := runPrivilegedCommandLive(job.context(), ip, server, operatorScript(server, script, operator, job.ID), job.output)
+	return added, commandError(result, err)
+}
+
+// writeRollbackLog reports what a rollback removed
+func writeRollbackLog(logBuilder *strings.Builder, added []string, err error) {
+	logBuilder.WriteString("Rollback:\n")
+	switch {
+	case err != nil && len(added) == 0:
+		logBuilder.WriteString(fmt.Sprintf("❌ Could not list the packages installed by the job: %v\n\n", err))
+	case err != nil:
+		logBuilder.WriteString(fmt.Sprintf("❌ Removing %s failed: %v\n\n", strings.Join(added, " "), err))
+	case len(added) == 0:
+		logBuilder.WriteString("⏭️ The job installed no packages before it failed; nothing to remove\n\n")
+	default:
+		logBuilder.WriteString(fmt.Sprintf("✅ Removed %d packages the job had installed: %s\n\n", len(added), strings.Join(added, " ")))
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RunAsUser is an unprivileged service account that everyday logins use instead of the admin account
+type RunAsUser struct {
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	// Escalation is "sudo" to elevate through this user's own sudo rights, or "admin"
+	// (the default) to log in with the stored admin account for privileged work
+	Escalation string `json:"escalation,omitempty"`
+}
+
+// loginAccount returns the server record to log in with for unprivileged work
+func loginAccount(server ServerInfo) ServerInfo {
+	if server.RunAs == nil || server.RunAs.Username == "" {
+		return server
+	}
+	login := server
+	login.RootUsername = server.RunAs.Username
+	login.RootPassword = server.RunAs.Password
+	// The key file and certificate belong to the admin account
+	login.KeyFile, login.CertFile = "", ""
+	login.RunAs = nil
+	return login
+}
+
+// escalationAccount returns the server record that privileged work logs in with
+func escalationAccount(server ServerInfo) ServerInfo {
+	if server.RunAs != nil && server.RunAs.Escalation == "sudo" {
+		return loginAccount(server)
+	}
+	admin := server
+	admin.RunAs = nil
+	return admin
+}
+
+// runCommandHandler shows the ad-hoc command form
+func runCommandHandler(w http.ResponseWriter, r *http.Request) {
+	servers := requestServers(r)
+	var ips []string
+	for ip := range servers {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	data := map[string]interface{}{
+		"IPs":      ips,
+		"Servers":  servers,
+		"Selected": r.FormValue("ip"),
+	}
+
+	renderTemplate(w, r, "templates/run_command.html", data)
+}
+
+// adHocOptions controls how runAdHocCommand runs a command
+type adHocOptions struct {
+	Escalate bool
+	// Upload sends the command as a script file over SFTP instead of on stdin
+	Upload bool
+	// Env is exported for this command only, on top of the global, group and server variables
+	Env map[string]string
+}
+
+// runAdHocCommand runs a user-supplied command as the login user or as root, either inline
+// or uploaded as a script file. live, when set, receives the output as it arrives, and
+// cancelling ctx interrupts the command.
+func runAdHocCommand(ctx context.Context, ip string, server ServerInfo, command string, opts adHocOptions, live liveOutput) (CommandResult, error) {
+	switch {
+	case opts.Upload:
+		return runUploadedScript(ctx, ip, server, command, opts.Escalate, opts.Env, live)
+	case opts.Escalate:
+		return runPrivilegedCommandLive(ctx, ip, server, withServerEnv(server, command, opts.Env), live)
+	default:
+		return runRemoteCommandLive(ctx, ip, server, withServerEnv(server, command, opts.Env), live)
+	}
+}
+
+// executeCommandHandler runs an ad-hoc command as the login user, escalating only when asked
+func executeCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	command := strings.ReplaceAll(r.FormValue("command"), "\r\n", "\n")
+	if strings.TrimSpace(command) == "" {
+		http.Error(w, "Command is required", http.StatusBadRequest)
+		return
+	}
+
+	opts := adHocOptions{
+		Escalate: r.FormValue("escalate") == "on",
+		Upload:   r.FormValue("mode") == "upload",
+	}
+	env, err := parseEnvAssignments(r.FormValue("env"))
+	if err != nil {
+		http.Error(w, "❌ Environment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Env = env
+	timeout, err := parseJobTimeout(r.FormValue("timeout"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	priority, err := parseJobPriority(r.FormValue("priority"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	operator := requestOperator(r)
+	if server, err = operatorServer(server, operator); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var logBuilder strings.Builder
+	if opts.Escalate && server.isWindows() {
+		logBuilder.WriteString(fmt.Sprintf("⚡ Running on %s as %s (elevated)", ip, escalationAccount(server).RootUsername))
+	} else if opts.Escalate {
+		logBuilder.WriteString(fmt.Sprintf("⚡ Running on %s as root (via %s)", ip, escalationAccount(server).RootUsername))
+	} else {
+		logBuilder.WriteString(fmt.Sprintf("▶️ Running on %s as %s", ip, loginAccount(server).RootUsername))
+	}
+	if opts.Upload {
+		logBuilder.WriteString(" from an uploaded script")
+	}
+	if operator != "" {
+		logBuilder.WriteString(" for " + operator)
+	}
+	logBuilder.WriteString("\n\n")
+
+	if r.FormValue("dry_run") == "on" {
+		plan, err := planAdHocCommand(server, operatorScript(server, command, operator, "dry-run"), opts)
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeDryRunLog(&logBuilder, plan, checkLogin(ip, plan))
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
+	}
+
+	// run runs the command as job, straight away or once an approval rule let it through
+	ctx, form, jobURL := r.Context(), r.PostForm, appPath(r, "/job?id=")
+	patterns := parseArtifactPatterns(r.FormValue("artifacts"))
+	run := func(job *Job) jobResult {
+		job.setRerun(ctx, "/execute-command", form)
+		job.setTimeout(timeout)
+		result, err := runAdHocCommand(job.context(), ip, server, operatorScript(server, command, operator, job.ID), opts, job.output)
+		var artifacts []JobArtifact
+		if err == nil && len(patterns) > 0 {
+			artifacts = collectArtifacts(job, ip, server, patterns)
+		}
+		jobErr := job.commandOutcome(result, err)
+		if writeCommandLog(&logBuilder, result, err) && len(artifacts) > 0 {
+			writeArtifactLog(&logBuilder, jobURL+job.ID, artifacts)
+		}
+		return jobResult{Log: logBuilder.String(), Err: jobErr, Template: "templates/logs.html", Data: logBuilder.String()}
+	}
+	held := Job{Kind: "command", Server: ip, Description: firstLine(command), Priority: priority}
+	if holdForApproval(w, r, held, jobTargets{"command", map[string]ServerInfo{ip: server}}, command, run) {
+		return
+	}
+
+	job := startPriorityJob(operator, "command", ip, firstLine(command), priority)
+	submittedJob(r, job)
+	result := run(job)
+	job.finish(result.Err)
+	renderTemplate(w, r, result.Template, result.Data)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UpdateSchedule upgrades the packages of a group at a fixed time on chosen weekdays, e.g.
+// the web group every Sunday at 03:00
+type UpdateSchedule struct {
+	Name  string `json:"name"`
+	Group string `json:"group"`
+	// Security applies only security updates instead of upgrading every package
+	Security bool `json:"security,omitempty"`
+	// Days are the lowercase weekdays it runs on, e.g. "sunday"; none means every day
+	Days []string `json:"days,omitempty"`
+	// Time is when it starts, as 15:04 on the management host's clock
+	Time      string `json:"time"`
+	Verbosity string `json:"verbosity,omitempty"`
+	Paused    bool   `json:"paused,omitempty"`
+	// Operator created the schedule; its runs are attributed to them
+	Operator string `json:"operator,omitempty"`
+}
+
+// ScheduleRun is one run of a schedule, kept in the run history
+type ScheduleRun struct {
+	ID         string    `json:"id"`
+	Schedule   string    `json:"schedule"`
+	Group      string    `json:"group"`
+	Manual     bool      `json:"manual,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Servers    int       `json:"servers"`
+	Failed     int       `json:"failed"`
+	Skipped    int       `json:"skipped"`
+	Upgraded   int       `json:"upgraded"`
+	Error      string    `json:"error,omitempty"`
+	Log        string    `json:"log,omitempty"`
+}
+
+// OK reports whether every server of the run upgraded
+func (s ScheduleRun) OK() bool {
+	return s.Error == "" && s.Failed == 0
+}
+
+// Summary describes the run in one line
+func (s ScheduleRun) Summary() string {
+	if s.Error != "" {
+		return s.Error
+	}
+	summary := fmt.Sprintf("%d packages upgraded on %d of %d servers", s.Upgraded, s.Servers-s.Failed, s.Servers)
+	if s.Skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", s.Skipped)
+	}
+	return summary
+}
+
+// Duration is how long the run took, to the second
+func (s ScheduleRun) Duration() time.Duration {
+	return s.FinishedAt.Sub(s.StartedAt).Round(time.Second)
+}
+
+// scheduleRunsFile stores the run history across restarts
+const scheduleRunsFile = "schedule_runs.json"
+
+// maxScheduleRuns is how many runs the history keeps, newest first
+const maxScheduleRuns = 200
+
+// scheduleNamePattern matches schedule names
+var scheduleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// weekdays are the day names schedules use, indexed by time.Weekday
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+var (
+	scheduleRunsMu sync.Mutex
+	scheduleRuns   []ScheduleRun
+	// runningSchedules holds the schedules with a run in progress, so a slow run is not
+	// started again on top of itself
+	runningSchedules = make(map[string]bool)
+)
+
+// validateSchedule checks a schedule before it is stored
+func validateSchedule(schedule UpdateSchedule) error {
+	if !scheduleNamePattern.MatchString(schedule.Name) {
+		return fmt.Errorf("invalid schedule name %q; use lowercase letters, digits and dashes", schedule.Name)
+	}
+	if schedule.Group == "" {
+		return errors.New("choose the group the schedule upgrades")
+	}
+	if _, err := time.Parse("15:04", schedule.Time); err != nil {
+		return fmt.Errorf("invalid time %q; use HH:MM", schedule.Time)
+	}
+	for _, day := range schedule.Days {
+		if !slices.Contains(weekdays, day) {
+			return fmt.Errorf("invalid weekday %q", day)
+		}
+	}
+	return nil
+}
+
+// due reports whether the schedule starts in the minute of now
+func (s UpdateSchedule) due(now time.Time) bool {
+	if s.Paused || now.Format("15:04") != s.Time {
+		return false
+	}
+	return len(s.Days) == 0 || slices.Contains(s.Days, weekdays[now.Weekday()])
+}
+
+// When describes when the schedule runs, e.g. "sunday at 03:00"
+func (s UpdateSchedule) When() string {
+	days := "every day"
+	if len(s.Days) > 0 {
+		days = strings.Join(s.Days, ", ")
+	}
+	return days + " at " + s.Time
+}
+
+// findSchedule looks a schedule up by name
+func findSchedule(name string) (UpdateSchedule, bool) {
+	i := slices.IndexFunc(settings.Schedules, func(s UpdateSchedule) bool { return s.Name == name })
+	if i < 0 {
+		return UpdateSchedule{}, false
+	}
+	return settings.Schedules[i], true
+}
+
+// servers returns the IP addresses of the servers a schedule upgrades
+func (s UpdateSchedule) servers() []string {
+	return slices.Collect(maps.Keys(upgradeTargets("", s.Group)))
+}
+
+// loadScheduleRuns reads schedule_runs.json; a missing file means nothing has run yet
+func loadScheduleRuns() error {
+	file, err := os.Open(scheduleRunsFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	scheduleRunsMu.Lock()
+	defer scheduleRunsMu.Unlock()
+	return json.NewDecoder(file).Decode(&scheduleRuns)
+}
+
+// saveScheduleRuns writes schedule_runs.json; callers hold scheduleRunsMu
+func saveScheduleRuns() error {
+	file, err := os.Create(scheduleRunsFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(scheduleRuns)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+// runUpdateScheduler starts the schedules that are due at the top of every minute.
+// It runs under superviseWorker, which restarts it if it panics.
+func runUpdateScheduler() {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		now = time.Now().Truncate(time.Minute)
+		for _, schedule := range slices.Clone(settings.Schedules) {
+			if schedule.due(now) {
+				go func(schedule UpdateSchedule) {
+					defer catchWorkerPanic("update-scheduler")
+					runSchedule(schedule, false)
+				}(schedule)
+			}
+		}
+	}
+}
+
+// runSchedule upgrades the schedule's group, records the run and raises an alert when any
+// server failed, clearing it once a run succeeds. It does nothing while the schedule's
+// previous run is still going.
+func runSchedule(schedule UpdateSchedule, manual bool) {
+	scheduleRunsMu.Lock()
+	if runningSchedules[schedule.Name] {
+		scheduleRunsMu.Unlock()
+		fmt.Printf("⚠️ Schedule %s is still running; skipping this run\n", schedule.Name)
+		return
+	}
+	runningSchedules[schedule.Name] = true
+	scheduleRunsMu.Unlock()
+
+	run := ScheduleRun{Schedule: schedule.Name, Group: schedule.Group, Manual: manual, StartedAt: time.Now()}
+	run.ID = strconv.FormatInt(run.StartedAt.UnixNano(), 10)
+	targets := upgradeTargets("", schedule.Group)
+	if len(targets) == 0 {
+		run.Error = "no servers in group " + schedule.Group
+	} else {
+		report := upgradeTargetsReport("", schedule.Group, targets, schedule.Security, parseVerbosity(schedule.Verbosity), schedule.Operator, 0, "")
+		run.Servers, run.Failed, run.Skipped, run.Upgraded, run.Log = report.Servers, report.Failed, report.Skipped, report.Upgraded, report.Log
+	}
+	run.FinishedAt = time.Now()
+
+	scheduleRunsMu.Lock()
+	delete(runningSchedules, schedule.Name)
+	scheduleRuns = append([]ScheduleRun{run}, scheduleRuns...)
+	if len(scheduleRuns) > maxScheduleRuns {
+		scheduleRuns = scheduleRuns[:maxScheduleRuns]
+	}
+	if err := saveScheduleRuns(); err != nil {
+		fmt.Println("❌ Saving schedule runs:", err)
+	}
+	scheduleRunsMu.Unlock()
+
+	alertKey := "schedule:" + schedule.Name
+	if run.OK() {
+		clearAlert(alertKey)
+	} else {
+		raiseAlert(alertKey, "group "+schedule.Group, "warning", "Scheduled update "+schedule.Name+" failed: "+run.Summary())
+	}
+	summary := run
+	summary.Log = ""
+	publishEvent("schedule.finished", summary)
+}
+
+// schedulesHandler lists the schedules with their recent runs and a form to add one
+func schedulesHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleRunsMu.Lock()
+	runs := slices.Clone(scheduleRuns)
+	running := make([]string, 0, len(runningSchedules))
+	for name := range runningSchedules {
+		running = append(running, name)
+	}
+	scheduleRunsMu.Unlock()
+
+	// Limited users see only the schedules of groups in their scope
+	scope, servers := requestScope(r), serversSnapshot()
+	schedules := slices.DeleteFunc(slices.Clone(settings.Schedules), func(s UpdateSchedule) bool {
+		return !setInScope(scope, servers, groupScope, s.Group)
+	})
+	runs = slices.DeleteFunc(runs, func(run ScheduleRun) bool { return !setInScope(scope, servers, groupScope, run.Group) })
+
+	var editing UpdateSchedule
+	if name := r.FormValue("edit"); name != "" {
+		editing, _ = findSchedule(name)
+		if !setInScope(scope, servers, groupScope, editing.Group) {
+			editing = UpdateSchedule{}
+		}
+	}
+	renderTemplate(w, r, "templates/schedules.html", map[string]interface{}{
+		"Schedules": schedules,
+		"Runs":      runs,
+		"Running":   running,
+		"Groups":    serverGroups(requestServers(r)),
+		"Weekdays":  weekdays,
+		"Editing":   editing,
+		"Zone":      time.Now().Format("MST"),
+	})
+}
+
+// saveScheduleHandler adds a schedule or replaces the one with the same name
+func saveScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedule := UpdateSchedule{
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		Group:     strings.TrimSpace(r.FormValue("group")),
+		Security:  r.FormValue("action") == "security",
+		Days:      r.Form["days"],
+		Time:      strings.TrimSpace(r.FormValue("time")),
+		Verbosity: parseVerbosity(r.FormValue("verbosity")),
+		Paused:    r.FormValue("paused") == "on",
+		Operator:  requestOperator(r),
+	}
+	if err := validateSchedule(schedule); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A limited user may neither point a schedule outside their scope nor take over one
+	// that reaches outside it
+	ips := schedule.servers()
+	if existing, ok := findSchedule(schedule.Name); ok {
+		ips = append(ips, existing.servers()...)
+	}
+	if !serversAllowed(w, r, ips) {
+		return
+	}
+	settings.Schedules = slices.DeleteFunc(settings.Schedules, func(s UpdateSchedule) bool { return s.Name == schedule.Name })
+	settings.Schedules = append(settings.Schedules, schedule)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/schedules"), http.StatusSeeOther)
+}
+
+// deleteScheduleHandler removes a schedule; its past runs stay in the history
+func deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if existing, ok := findSchedule(name); ok && !serversAllowed(w, r, existing.servers()) {
+		return
+	}
+	settings.Schedules = slices.DeleteFunc(settings.Schedules, func(s UpdateSchedule) bool { return s.Name == name })
+	clearAlert("schedule:" + name)
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/schedules"), http.StatusSeeOther)
+}
+
+// runScheduleHandler starts a schedule now in the background; the run appears in the
+// history when it finishes
+func runScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	schedule, ok := findSchedule(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, schedule.servers()) {
+		return
+	}
+	go func() {
+		defer catchWorkerPanic("update-scheduler")
+		runSchedule(schedule, true)
+	}()
+	http.Redirect(w, r, appPath(r, "/schedules"), http.StatusSeeOther)
+}
+
+// scheduleRunHandler shows the log of one run
+func scheduleRunHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	scheduleRunsMu.Lock()
+	i := slices.IndexFunc(scheduleRuns, func(run ScheduleRun) bool { return run.ID == id })
+	var run ScheduleRun
+	if i >= 0 {
+		run = scheduleRuns[i]
+	}
+	scheduleRunsMu.Unlock()
+	if i < 0 {
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+	if !setInScope(requestScope(r), serversSnapshot(), groupScope, run.Group) {
+		refuseOutOfScope(w, r, "group "+run.Group)
+		return
+	}
+	log := run.Log
+	if run.Error != "" {
+		log = "❌ " + run.Error + "\n"
+	}
+	renderTemplate(w, r, "templates/logs.html", log)
+}
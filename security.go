@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// securityCommands returns the command applying only security updates with manager and the
+// command listing the security updates still pending, one line each; run Update first.
+// apk and pacman publish no security metadata, so they are refused rather than fully
+// upgraded.
+func securityCommands(manager PackageManager, verbosity string) (string, string, error) {
+	switch manager.Name() {
+	case "apt":
+		// unattended-upgrade installs from the security origins its stock configuration
+		// allows; it is installed first on servers that lack it
+		bootstrap := "command -v unattended-upgrade >/dev/null 2>&1 || " + manager.Install([]string{"unattended-upgrades"}, verbosity)
+		upgrade := bootstrap + " && unattended-upgrade -v"
+		if verbosity == verbosityDebug {
+			upgrade += " -d"
+		}
+		return upgrade, "apt-get -s upgrade 2>/dev/null | grep '^Inst ' | grep -i security", nil
+	case "dnf":
+		return "dnf " + verbosityFlag(verbosity, "-q", "-v") + "upgrade -y --security",
+			"dnf -q list --upgrades --security 2>/dev/null | tail -n +2", nil
+	case "yum":
+		return "yum " + verbosityFlag(verbosity, "-q", "-v") + "update -y --security",
+			"yum -q list updates --security 2>/dev/null | tail -n +2", nil
+	case "zypper":
+		// zypper exits 102 when a patch needs a reboot, which still means it was applied
+		return "{ zypper --non-interactive " + verbosityFlag(verbosity, "-q", "-v") + "patch --category security || [ $? -eq 102 ]; }",
+			"zypper -q list-patches --category security 2>/dev/null | grep ' | ' | tail -n +2", nil
+	}
+	return "", "", fmt.Errorf("%s has no security update metadata; use Upgrade All instead", manager.Name())
+}
+
+// securityUpdatesHandler applies only security updates on one server or on every server in
+// a group, leaving other pending upgrades for a full upgrade
+func securityUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	runUpgrades(w, r, true)
+}
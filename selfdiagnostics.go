@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// startedAt is when this process started, for uptime and poller checks
+var startedAt = time.Now()
+
+// uploadsWarnBytes is the size of uploads/ that triggers a warning
+const uploadsWarnBytes = 1 << 30
+
+// staleJobAge is how long a job may run before the diagnostics page flags it
+const staleJobAge = time.Hour
+
+var (
+	selfChecksMu  sync.Mutex
+	selfChecks    []DiagnosticStage
+	selfChecksRun time.Time
+)
+
+// selfCheck is one diagnostics page check; run returns "ok", "warning", "failed" or "skipped"
+// with details and a hint, like a connection diagnosis stage
+type selfCheck struct {
+	name string
+	run  func() (status, detail, hint string)
+}
+
+// runSelfChecks checks accmgr4 itself: its stores, background work and configuration
+func runSelfChecks() []DiagnosticStage {
+	checks := []selfCheck{
+		{"Store: ipmap.json", func() (string, string, string) { return checkStoreFile("ipmap.json", "no servers have been added yet") }},
+		{"Store: settings.json", func() (string, string, string) {
+			return checkStoreFile("settings.json", "defaults are in use until settings are saved")
+		}},
+		{"Store: working directory writable", checkWorkingDirWritable},
+		{"Worker: health-poller rounds", checkHealthPoller},
+	}
+	for _, worker := range workersSnapshot() {
+		checks = append(checks, selfCheck{"Worker: " + worker.Name + " supervisor", func() (string, string, string) { return checkWorker(worker) }})
+	}
+	checks = append(checks, []selfCheck{
+		{"Job queue", checkJobQueue},
+		{"Worker pool", checkWorkerPool},
+		{"Event stream", checkEventStream},
+		{"SSH connections", checkSSHConnections},
+		{"Last backup", func() (string, string, string) {
+			return "skipped", "No backup job is configured; ipmap.json and settings.json hold all persistent state",
+				"Copy both files off the host on a schedule, for example from cron."
+		}},
+		{"Upload and log storage", checkUploadStorage},
+		{"Config: SSH options", checkSSHOptionsConfig},
+		{"Config: servers", checkServersConfig},
+		{"Config: environment profiles", checkEnvProfilesConfig},
+	}...)
+
+	var results []DiagnosticStage
+	for _, check := range checks {
+		start := time.Now()
+		status, detail, hint := check.run()
+		results = append(results, DiagnosticStage{
+			Name:     check.name,
+			Status:   status,
+			Detail:   detail,
+			Hint:     hint,
+			Duration: time.Since(start).Round(time.Microsecond),
+		})
+	}
+
+	selfChecksMu.Lock()
+	selfChecks = results
+	selfChecksRun = time.Now()
+	selfChecksMu.Unlock()
+	return results
+}
+
+// checkStoreFile confirms a JSON store exists, parses and reports its size and age
+func checkStoreFile(path, missing string) (string, string, string) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "warning", "Not created yet; " + missing, ""
+	}
+	if err != nil {
+		return "failed", err.Error(), "Check the file permissions in the working directory."
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "failed", err.Error(), "Check the file permissions in the working directory."
+	}
+	if !json.Valid(data) {
+		return "failed", fmt.Sprintf("%s is not valid JSON (%d bytes)", path, len(data)),
+			"The file was probably truncated or edited by hand. Restore it from a copy; saving from the UI overwrites it with the in-memory state."
+	}
+	return "ok", fmt.Sprintf("%d bytes, last written %s", info.Size(), info.ModTime().Format(time.RFC3339)), ""
+}
+
+// checkWorkingDirWritable creates and removes a scratch file next to the stores
+func checkWorkingDirWritable() (string, string, string) {
+	f, err := os.CreateTemp(".", ".accmgr-write-check-*")
+	if err != nil {
+		return "failed", err.Error(), "Saves will fail. Check free space and permissions on the working directory."
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return "ok", "Stores can be written", ""
+}
+
+// checkHealthPoller flags a poller that has not finished a round for several intervals
+func checkHealthPoller() (string, string, string) {
+	healthMu.RLock()
+	last, took := lastPollRound, lastPollDuration
+	healthMu.RUnlock()
+
+	interval := settings.Health.pollInterval()
+	// A round can take up to a full connect timeout on top of the interval
+	limit := 2*interval + effectiveSSHOptions(ServerInfo{}).connectTimeout()
+	if last.IsZero() {
+		if time.Since(startedAt) > limit {
+			return "failed", fmt.Sprintf("No round has finished since startup %s ago", time.Since(startedAt).Round(time.Second)),
+				"A poll may be stuck on an unresponsive server; restart accmgr4 and check the connect timeout on the SSH settings page."
+		}
+		return "ok", "First round in progress", ""
+	}
+	age := time.Since(last).Round(time.Second)
+	detail := fmt.Sprintf("Last round finished %s ago and took %s; interval %s", age, took.Round(time.Millisecond), interval)
+	if time.Since(last) > limit {
+		return "failed", detail, "The poller appears stuck; restart accmgr4 and check the connect timeout on the SSH settings page."
+	}
+	return "ok", detail, ""
+}
+
+// checkWorker reports a supervised worker's restarts and most recent panic with its stack
+func checkWorker(worker WorkerStatus) (string, string, string) {
+	detail := fmt.Sprintf("%s, last started %s, %d restarts", worker.Status, worker.StartedAt.Format(time.RFC3339), worker.Restarts)
+	if worker.LastExit != "" {
+		detail += "; last exit: " + worker.LastExit
+	}
+	if len(worker.Panics) == 0 {
+		if worker.Status != "running" {
+			return "warning", detail, "The worker stopped and is waiting to restart."
+		}
+		return "ok", detail, ""
+	}
+	last := worker.Panics[len(worker.Panics)-1]
+	detail += fmt.Sprintf("\n%d recent panics; last at %s: %s\n\n%s", len(worker.Panics), last.Time.Format(time.RFC3339), last.Value, last.Stack)
+	return "warning", detail, "Recovered panics are bugs; report the stack above. The process log has every panic."
+}
+
+// checkJobQueue reports queued and running jobs and flags any that have run unusually long
+func checkJobQueue() (string, string, string) {
+	var pending, queued, running, stale int
+	all := jobsSnapshot()
+	for _, job := range all {
+		switch job.Status {
+		case "pending":
+			pending++
+		case "queued":
+			queued++
+		}
+		if job.Status != "running" {
+			continue
+		}
+		running++
+		if time.Since(job.StartedAt) > staleJobAge {
+			stale++
+		}
+	}
+	detail := fmt.Sprintf("%d running, %d queued, %d waiting for approval, %d retained in history", running, queued, pending, len(all))
+	if stale > 0 {
+		return "warning", detail + fmt.Sprintf("; %d running for over %s", stale, staleJobAge),
+			"Long-running jobs usually wait on a remote command; check them on the jobs API."
+	}
+	return "ok", detail, ""
+}
+
+// checkEventStream reports subscribers and retained events
+func checkEventStream() (string, string, string) {
+	if !featureEnabled("events") {
+		return "skipped", "The events feature flag is off", ""
+	}
+	eventsMu.Lock()
+	subscribers, retained, last := len(eventClients), len(eventHistory), lastEventID
+	eventsMu.Unlock()
+	return "ok", fmt.Sprintf("%d subscribers, %d of %d events retained, last ID %d", subscribers, retained, maxEventHistory, last), ""
+}
+
+// checkSSHConnections reports connection counters and how well the connection cache is reused
+func checkSSHConnections() (string, string, string) {
+	dials, failures, open := sshStats.dials.Load(), sshStats.failures.Load(), sshStats.open.Load()
+	detail := fmt.Sprintf("%d open, %d dialed since startup, %d failed", open, dials, failures)
+	if dials >= 10 && failures*2 > dials {
+		return "warning", detail, "More than half of all connections fail; see the dashboard health column and run connection diagnostics."
+	}
+	if poolIdleTimeout <= 0 {
+		return "ok", detail + "; connection reuse is disabled (-ssh-pool-idle 0)", ""
+	}
+
+	hits, misses := poolStats.hits.Load(), poolStats.misses.Load()
+	cached, sessions := poolSize()
+	detail += fmt.Sprintf("; cache: %d connections carrying %d sessions, %d hits, %d misses, %d overflows, %d evictions (idle timeout %s)",
+		cached, sessions, hits, misses, poolStats.overflows.Load(), poolStats.evictions.Load(), poolIdleTimeout)
+	if hits+misses >= 20 && hits < misses {
+		return "warning", detail, "Most commands open a new connection; raise -ssh-pool-idle if jobs on the same host are spaced further apart than it."
+	}
+	return "ok", detail, ""
+}
+
+// checkUploadStorage measures uploads/, recordings/ and job_logs/. Job logs expire under
+// their retention policy, so only the other two can grow without bound.
+func checkUploadStorage() (string, string, string) {
+	files, size, err := dirUsage("uploads")
+	if err != nil {
+		return "failed", err.Error(), "Uploads will fail until uploads/ is readable and writable."
+	}
+	recordings, recordingSize, err := dirUsage(recordingsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "failed", err.Error(), "Sessions are not recorded until recordings/ is readable and writable."
+	}
+	logs, logSize, err := dirUsage(jobLogsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "failed", err.Error(), "Job output is kept only in memory until job_logs/ is readable and writable."
+	}
+	detail := fmt.Sprintf("uploads/ holds %d files, %.1f MB; recordings/ holds %d sessions, %.1f MB; job_logs/ holds %d logs, %.1f MB",
+		files, float64(size)/(1<<20), recordings, float64(recordingSize)/(1<<20), logs, float64(logSize)/(1<<20))
+	switch {
+	case size > uploadsWarnBytes:
+		return "warning", detail, "Remove old CSV and Excel uploads; they are not needed after users are created."
+	case recordingSize > uploadsWarnBytes:
+		return "warning", detail, "Archive recordings past your compliance retention period and remove them from recordings/."
+	}
+	return "ok", detail, ""
+}
+
+// dirUsage counts the regular files under dir and their total size
+func dirUsage(dir string) (files int, size int64, err error) {
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size, err
+}
+
+// checkSSHOptionsConfig validates the global, group and per-server SSH options
+func checkSSHOptionsConfig() (string, string, string) {
+	var problems []string
+	if err := settings.SSH.validate(); err != nil {
+		problems = append(problems, "global: "+err.Error())
+	}
+	for _, name := range slices.Sorted(maps.Keys(settings.Groups)) {
+		if group := settings.Groups[name]; group.SSH != nil {
+			if err := group.SSH.validate(); err != nil {
+				problems = append(problems, "group "+name+": "+err.Error())
+			}
+		}
+	}
+	servers := serversSnapshot()
+	for _, ip := range slices.Sorted(maps.Keys(servers)) {
+		if opts := servers[ip].SSH; opts != nil {
+			if err := opts.validate(); err != nil {
+				problems = append(problems, ip+": "+err.Error())
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return "failed", strings.Join(problems, "\n"), "Fix these on the SSH settings page; affected servers cannot connect."
+	}
+	return "ok", "Global, group and server options are valid", ""
+}
+
+// checkServersConfig flags server records that cannot authenticate
+func checkServersConfig() (string, string, string) {
+	servers := serversSnapshot()
+	var problems []string
+	for _, ip := range slices.Sorted(maps.Keys(servers)) {
+		server := servers[ip]
+		if server.RootUsername == "" {
+			problems = append(problems, ip+": no login user")
+		} else if server.RootPassword == "" && !server.UseAgent && server.KeyFile == "" {
+			problems = append(problems, ip+": no password, key file or ssh-agent")
+		}
+		if server.KeyFile != "" {
+			if _, err := keyFileSigner(server); err != nil {
+				problems = append(problems, ip+": "+err.Error())
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return "warning", strings.Join(problems, "\n"), "Re-add these servers with working credentials."
+	}
+	return "ok", fmt.Sprintf("%d servers have credentials", len(servers)), ""
+}
+
+// checkEnvProfilesConfig renders every environment profile for its targets
+func checkEnvProfilesConfig() (string, string, string) {
+	profiles := envProfilesSnapshot()
+	var problems []string
+	for _, profile := range profiles {
+		ips, servers := profileTargets(profile)
+		if len(ips) == 0 {
+			problems = append(problems, profile.Name+": targets no known server")
+			continue
+		}
+		for _, ip := range ips {
+			if _, err := profile.render(ip, servers[ip]); err != nil {
+				problems = append(problems, profile.Name+" on "+ip+": "+err.Error())
+				break
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return "warning", strings.Join(problems, "\n"), "Edit these profiles on the environment page before applying them."
+	}
+	return "ok", fmt.Sprintf("%d profiles render for all their targets", len(profiles)), ""
+}
+
+// selfDiagnosticsHandler shows the latest self-check results; POST runs the checks again
+func selfDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		runSelfChecks()
+		http.Redirect(w, r, appPath(r, "/admin/diagnostics"), http.StatusSeeOther)
+		return
+	}
+
+	selfChecksMu.Lock()
+	results, ranAt := selfChecks, selfChecksRun
+	selfChecksMu.Unlock()
+	if results == nil {
+		results = runSelfChecks()
+		ranAt = time.Now()
+	}
+
+	failed, warnings := 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case "failed":
+			failed++
+		case "warning":
+			warnings++
+		}
+	}
+	summary := "✅ All checks passed"
+	if failed > 0 || warnings > 0 {
+		summary = fmt.Sprintf("%d failed, %d warnings", failed, warnings)
+	}
+
+	renderTemplate(w, r, "templates/admin_diagnostics.html", map[string]interface{}{
+		"Checks":  results,
+		"Summary": summary,
+		"RanAt":   ranAt.Format("2006-01-02 15:04:05"),
+		"Uptime":  time.Since(startedAt).Round(time.Second),
+	})
+}
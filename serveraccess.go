@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Users can be limited to some servers, such as contractors to the machines of their
+// project. A user's Servers lists what they may see and operate on: IP addresses,
+// group:NAME for the servers of a group and tag:NAME for the servers carrying a tag. Pages,
+// the API and GraphQL show them only those servers, the jobs on them and the jobs they
+// started. restrictServers refuses any form that names another server, a group or tag with
+// servers outside their scope, or a job they cannot see, and the handlers check again where
+// they resolve servers and jobs, since JSON bodies, gRPC calls and saved objects such as
+// environment profiles name them elsewhere. Admins, and users without a web UI user, see
+// every server.
+
+const (
+	// groupScope and tagScope prefix the groups and tags in a user's Servers
+	groupScope = "group:"
+	tagScope   = "tag:"
+)
+
+// serverFields are the form fields that name one server, and serverListFields those that
+// name several
+var (
+	serverFields     = []string{"server_ip", "ip", "server"}
+	serverListFields = []string{"servers", "ips"}
+)
+
+// jobPaths are the pages whose id field names a job
+var jobPaths = map[string]bool{
+	"/job": true, "/job-summary": true, "/job-artifact": true, "/job-log": true,
+	"/job-stream": true, "/job-result": true, "/cancel-job": true, "/approve-job": true, "/job-notify": true,
+	"/job-priority": true, "/job-history": true, "/rerun-job": true, "/retry-failed": true,
+}
+
+// parseServerScope checks and normalizes the entries of a user's Servers
+func parseServerScope(value string) ([]string, error) {
+	var scope []string
+	for _, entry := range splitList(value) {
+		switch {
+		case strings.HasPrefix(entry, groupScope) && len(entry) > len(groupScope),
+			strings.HasPrefix(entry, tagScope) && len(entry) > len(tagScope):
+		default:
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q is neither a server IP address, %sNAME nor %sNAME", entry, groupScope, tagScope)
+			}
+			entry = addr.String()
+		}
+		if !slices.Contains(scope, entry) {
+			scope = append(scope, entry)
+		}
+	}
+	return scope, nil
+}
+
+// serverScope returns the servers a user is limited to, or nil when they see every server
+func serverScope(name string) []string {
+	user, ok := webUser(name)
+	if !ok || userRole(name) == roleAdmin {
+		return nil
+	}
+	return user.Servers
+}
+
+// contextScope is serverScope for the user a request context carries
+func contextScope(ctx context.Context) []string {
+	name, _ := ctx.Value(loginUserKey{}).(string)
+	if name == "" {
+		return nil
+	}
+	return serverScope(name)
+}
+
+// requestScope is serverScope for the request's user
+func requestScope(r *http.Request) []string {
+	return contextScope(r.Context())
+}
+
+// inScope reports whether a scope includes a server
+func inScope(scope []string, ip string, server ServerInfo) bool {
+	if len(scope) == 0 {
+		return true
+	}
+	for _, entry := range scope {
+		switch {
+		case entry == ip:
+			return true
+		case strings.HasPrefix(entry, groupScope) && server.Group == strings.TrimPrefix(entry, groupScope):
+			return true
+		case strings.HasPrefix(entry, tagScope) && server.hasTag(strings.TrimPrefix(entry, tagScope)):
+			return true
+		}
+	}
+	return false
+}
+
+// scopedServers returns the servers of a scope
+func scopedServers(scope []string) map[string]ServerInfo {
+	servers := serversSnapshot()
+	for ip, server := range servers {
+		if !inScope(scope, ip, server) {
+			delete(servers, ip)
+		}
+	}
+	return servers
+}
+
+// requestServers returns the servers the request's user may see
+func requestServers(r *http.Request) map[string]ServerInfo {
+	return scopedServers(requestScope(r))
+}
+
+// serverInScope reports whether a scope includes the server with an IP address; unknown
+// servers are only in an unlimited scope
+func serverInScope(scope []string, servers map[string]ServerInfo, ip string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+	server, ok := servers[ip]
+	return ok && inScope(scope, ip, server)
+}
+
+// setInScope reports whether a scope includes the group or tag (prefix groupScope or
+// tagScope) name: it names it, or it includes each of its servers and there is one
+func setInScope(scope []string, servers map[string]ServerInfo, prefix, name string) bool {
+	if len(scope) == 0 || slices.Contains(scope, prefix+name) {
+		return true
+	}
+	members := 0
+	for ip, server := range servers {
+		if (prefix == groupScope && server.Group == name) || (prefix == tagScope && server.hasTag(name)) {
+			if !inScope(scope, ip, server) {
+				return false
+			}
+			members++
+		}
+	}
+	return members > 0
+}
+
+// jobInScope reports whether a scope's user, name, may see a job: they started it, or it
+// runs on servers in the scope
+func jobInScope(scope []string, servers map[string]ServerInfo, name string, job Job) bool {
+	switch {
+	case len(scope) == 0, job.Operator != "" && job.Operator == name:
+		return true
+	case job.Server != "":
+		return serverInScope(scope, servers, job.Server)
+	case len(job.Targets) > 0:
+		return !slices.ContainsFunc(job.Targets, func(ip string) bool { return !serverInScope(scope, servers, ip) })
+	}
+	return false
+}
+
+// jobVisible reports whether the user a request context carries may see a job
+func jobVisible(ctx context.Context, job Job) bool {
+	name, _ := ctx.Value(loginUserKey{}).(string)
+	return jobInScope(contextScope(ctx), serversSnapshot(), name, job)
+}
+
+// visibleJobs returns the jobs the request's user may see
+func visibleJobs(r *http.Request, jobs []Job) []Job {
+	scope := requestScope(r)
+	if len(scope) == 0 {
+		return jobs
+	}
+	servers, name := serversSnapshot(), requestOperator(r)
+	return slices.DeleteFunc(jobs, func(job Job) bool { return !jobInScope(scope, servers, name, job) })
+}
+
+// eventVisible reports whether the user a request context carries may see an event: only
+// admins see the audit log, and limited users see the jobs and alerts of their servers
+func eventVisible(ctx context.Context, event Event) bool {
+	if _, ok := event.Data.(AuditEntry); ok {
+		return contextRole(ctx) == roleAdmin
+	}
+	scope := contextScope(ctx)
+	if len(scope) == 0 {
+		return true
+	}
+	name, _ := ctx.Value(loginUserKey{}).(string)
+	switch data := event.Data.(type) {
+	case Job:
+		return jobInScope(scope, serversSnapshot(), name, data)
+	case Alert:
+		return data.Server == "" || serverInScope(scope, serversSnapshot(), data.Server)
+	case map[string]interface{}:
+		if id, ok := data["job"].(string); ok {
+			job, found := lookupJob(id)
+			return found && jobInScope(scope, serversSnapshot(), name, job)
+		}
+	}
+	return true
+}
+
+// visibleAlerts returns the alerts of the servers the user a request context carries may see
+func visibleAlerts(ctx context.Context, alerts []Alert) []Alert {
+	scope := contextScope(ctx)
+	if len(scope) == 0 {
+		return alerts
+	}
+	servers := serversSnapshot()
+	return slices.DeleteFunc(alerts, func(alert Alert) bool {
+		return alert.Server != "" && !serverInScope(scope, servers, alert.Server)
+	})
+}
+
+// lookupJob finds a live job or, failing that, one in the history
+func lookupJob(id string) (Job, bool) {
+	if job, ok := findJob(id); ok {
+		return job, true
+	}
+	record, ok := findJobRecord(id)
+	return record.Job, ok
+}
+
+// serversAllowed refuses a request whose user may not touch every one of ips, such as the
+// servers a saved profile or schedule targets, and reports whether it may go on
+func serversAllowed(w http.ResponseWriter, r *http.Request, ips []string) bool {
+	scope := requestScope(r)
+	servers := serversSnapshot()
+	for _, ip := range ips {
+		if !serverInScope(scope, servers, ip) {
+			refuseOutOfScope(w, r, "server "+ip)
+			return false
+		}
+	}
+	return true
+}
+
+// jobAllowed refuses a request whose user may not see the job with an ID, and reports
+// whether it may go on; unknown jobs are left to the handler
+func jobAllowed(w http.ResponseWriter, r *http.Request, id string) bool {
+	if job, ok := lookupJob(id); ok && !jobVisible(r.Context(), job) {
+		refuseOutOfScope(w, r, "job "+id)
+		return false
+	}
+	return true
+}
+
+// formAllowed refuses a request whose user may not touch what a saved form for path names,
+// and reports whether it may go on
+func formAllowed(w http.ResponseWriter, r *http.Request, path string, form url.Values) bool {
+	scope := requestScope(r)
+	if len(scope) == 0 {
+		return true
+	}
+	if what := formOutOfScope(scope, requestOperator(r), path, form); what != "" {
+		refuseOutOfScope(w, r, what)
+		return false
+	}
+	return true
+}
+
+// refuseOutOfScope refuses a request that reaches outside the user's servers
+func refuseOutOfScope(w http.ResponseWriter, r *http.Request, what string) {
+	message := requestOperator(r) + " may not access " + what
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/graphql" {
+		writeAPIError(w, http.StatusForbidden, message)
+	} else {
+		http.Error(w, "❌ "+message, http.StatusForbidden)
+	}
+}
+
+// outOfScope returns what a request names outside the user's scope, or ""
+func outOfScope(r *http.Request, scope []string) string {
+	// ParseMultipartForm parses other forms too, and leaves a parsed form as it is
+	r.ParseMultipartForm(32 << 20)
+	return formOutOfScope(scope, requestOperator(r), r.URL.Path, r.Form)
+}
+
+// formOutOfScope returns what a form for path names outside the scope of its user, name,
+// or "". Besides requests it checks saved forms, such as the request a cron job replays.
+func formOutOfScope(scope []string, name, path string, form url.Values) string {
+	servers := serversSnapshot()
+	var ips []string
+	for _, field := range serverFields {
+		ips = append(ips, form[field]...)
+	}
+	for _, field := range serverListFields {
+		for _, value := range form[field] {
+			ips = append(ips, splitList(value)...)
+		}
+	}
+	var id string
+	if rest, ok := strings.CutPrefix(path, "/api/v1/servers/"); ok {
+		ip, _, _ := strings.Cut(rest, "/")
+		ips = append(ips, ip)
+	} else if rest, ok := strings.CutPrefix(path, "/api/v1/jobs/"); ok {
+		id, _, _ = strings.Cut(rest, "/")
+	} else if jobPaths[path] {
+		id = form.Get("id")
+	} else if path == "/recording" || path == "/recording-file" {
+		if recording, ok := parseRecordingName(form.Get("name")); ok {
+			ips = append(ips, recording.Server)
+		}
+	}
+	for _, ip := range ips {
+		if ip = strings.TrimSpace(ip); ip != "" && !serverInScope(scope, servers, ip) {
+			return "server " + ip
+		}
+	}
+	for _, group := range append(slices.Clone(form["group"]), splitList(form.Get("groups"))...) {
+		if group = strings.TrimSpace(group); group != "" && !setInScope(scope, servers, groupScope, group) {
+			return "group " + group
+		}
+	}
+	for _, tag := range append(slices.Clone(form["tag"]), splitList(form.Get("tags"))...) {
+		if tag = strings.TrimSpace(tag); tag != "" && !setInScope(scope, servers, tagScope, tag) {
+			return "tag " + tag
+		}
+	}
+	for _, id := range []string{id, form.Get("job")} {
+		if job, ok := lookupJob(id); ok && id != "" && !jobInScope(scope, servers, name, job) {
+			return "job " + id
+		}
+	}
+	return ""
+}
+
+// restrictServers refuses requests of limited users that name servers, groups, tags or
+// jobs outside their scope
+func restrictServers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scope := requestScope(r); len(scope) > 0 {
+			if what := outOfScope(r, scope); what != "" {
+				refuseOutOfScope(w, r, what)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// saveUserServersHandler limits a user to some servers, or with none lets them see every
+// server again
+func saveUserServersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	scope, err := parseServerScope(r.FormValue("servers"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = updateWebUser(name, func(user *WebUser) { user.Servers = scope })
+	if errors.Is(err, errUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/web-users"), http.StatusSeeOther)
+}
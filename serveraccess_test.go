@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFormOutOfScope(t *testing.T) {
+	savedServers, savedJobs := ipMap, jobs
+	t.Cleanup(func() { ipMap, jobs = savedServers, savedJobs })
+	ipMap = map[string]ServerInfo{
+		"10.0.0.1": {Group: "web", Tags: []string{"frontend"}},
+		"10.0.0.2": {Group: "web", Tags: []string{"frontend"}},
+		"10.0.0.3": {Group: "db", Tags: []string{"frontend"}},
+	}
+	jobs = []*Job{
+		{ID: "own", Operator: "contractor", Server: "10.0.0.3"},
+		{ID: "web", Operator: "alice", Server: "10.0.0.1"},
+		{ID: "db", Operator: "alice", Server: "10.0.0.3"},
+		{ID: "batch", Operator: "alice", Targets: []string{"10.0.0.1", "10.0.0.3"}},
+	}
+	scope := []string{"group:web"}
+
+	tests := []struct {
+		path string
+		form url.Values
+		want string
+	}{
+		{"/execute-command", url.Values{"server_ip": {"10.0.0.1"}}, ""},
+		{"/execute-command", url.Values{"server_ip": {"10.0.0.3"}}, "server 10.0.0.3"},
+		{"/execute-command", url.Values{"server_ip": {"10.9.9.9"}}, "server 10.9.9.9"},
+		{"/bulk", url.Values{"servers": {"10.0.0.1, 10.0.0.3"}}, "server 10.0.0.3"},
+		{"/bulk", url.Values{"ips": {"10.0.0.1,10.0.0.2"}}, ""},
+		{"/upgrade", url.Values{"group": {"web"}}, ""},
+		{"/upgrade", url.Values{"group": {"db"}}, "group db"},
+		{"/upgrade", url.Values{"groups": {"web,db"}}, "group db"},
+		// The tag is on a server outside the scope too
+		{"/upgrade", url.Values{"tag": {"frontend"}}, "tag frontend"},
+		{"/api/v1/servers/10.0.0.1", nil, ""},
+		{"/api/v1/servers/10.0.0.3/commands", nil, "server 10.0.0.3"},
+		{"/api/v1/jobs/db", nil, "job db"},
+		{"/job", url.Values{"id": {"web"}}, ""},
+		{"/job", url.Values{"id": {"own"}}, ""},
+		{"/job", url.Values{"id": {"db"}}, "job db"},
+		{"/job", url.Values{"id": {"batch"}}, "job batch"},
+		{"/save-cron-job", url.Values{"job": {"db"}}, "job db"},
+		{"/job", url.Values{"id": {"unknown"}}, ""},
+	}
+	for _, tt := range tests {
+		if got := formOutOfScope(scope, "contractor", tt.path, tt.form); got != tt.want {
+			t.Errorf("formOutOfScope(%s, %v) = %q, want %q", tt.path, tt.form, got, tt.want)
+		}
+	}
+	if got := formOutOfScope(nil, "admin", "/execute-command", url.Values{"server_ip": {"10.0.0.3"}}); got != "" {
+		t.Errorf("an unlimited scope refused %s", got)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// serverSlot is held by the one job running on a server. Jobs on other servers run in
+// parallel; a second job on the same server waits, so two package managers never fight
+// over a lock such as dpkg's.
+type serverSlot struct {
+	holder string
+}
+
+// serverWaiter is a job waiting for a server's slot. A freed slot goes to the waiter that
+// waitsBefore the others, so an urgent job runs before a queue of upgrades on its server.
+type serverWaiter struct {
+	id       string
+	priority string
+	since    time.Time
+}
+
+var (
+	serverSlotsMu sync.Mutex
+	serverSlots   = make(map[string]*serverSlot)
+	serverWaiters = make(map[string][]serverWaiter)
+	// serverSlotsChanged is closed, and replaced, whenever a slot is released or the
+	// waiters change, so waiters check whether it is their turn
+	serverSlotsChanged = make(chan struct{})
+)
+
+// signalServerSlots wakes every waiter; callers hold serverSlotsMu
+func signalServerSlots() {
+	close(serverSlotsChanged)
+	serverSlotsChanged = make(chan struct{})
+}
+
+// nextServerWaiter returns the ID of the job whose turn it is on server; callers hold
+// serverSlotsMu
+func nextServerWaiter(server string) string {
+	now := time.Now()
+	var next *serverWaiter
+	for i, waiter := range serverWaiters[server] {
+		if next == nil || waitsBefore(waiter.priority, waiter.since, next.priority, next.since, now) {
+			next = &serverWaiters[server][i]
+		}
+	}
+	if next == nil {
+		return ""
+	}
+	return next.id
+}
+
+// removeServerWaiter forgets a waiter; callers hold serverSlotsMu
+func removeServerWaiter(server, id string) {
+	waiters := serverWaiters[server]
+	for i, waiter := range waiters {
+		if waiter.id == id {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(serverWaiters, server)
+	} else {
+		serverWaiters[server] = waiters
+	}
+}
+
+// claimServer waits until no other job runs on the job's server, and no job waiting there
+// goes before it, then takes its slot. A job cancelled while it waits stops waiting; its
+// commands then refuse to start, so it finishes as cancelled without touching the server.
+func (j *Job) claimServer() {
+	ctx := j.context()
+	jobsMu.Lock()
+	priority := j.Priority
+	jobsMu.Unlock()
+
+	serverSlotsMu.Lock()
+	serverWaiters[j.Server] = append(serverWaiters[j.Server], serverWaiter{id: j.ID, priority: priority, since: time.Now()})
+	waiting := ""
+	for {
+		slot, busy := serverSlots[j.Server]
+		next := nextServerWaiter(j.Server)
+		if !busy && next == j.ID {
+			serverSlots[j.Server] = &serverSlot{holder: j.ID}
+			removeServerWaiter(j.Server, j.ID)
+			signalServerSlots()
+			serverSlotsMu.Unlock()
+			if waiting != "" {
+				j.progress("")
+			}
+			return
+		}
+		changed := serverSlotsChanged
+		serverSlotsMu.Unlock()
+
+		message := "waiting for " + next + " to run first on this server"
+		if busy {
+			message = "waiting for " + slot.holder + " to finish on this server"
+		}
+		if message != waiting {
+			waiting = message
+			j.progress(message)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			serverSlotsMu.Lock()
+			removeServerWaiter(j.Server, j.ID)
+			signalServerSlots()
+			serverSlotsMu.Unlock()
+			return
+		}
+		serverSlotsMu.Lock()
+	}
+}
+
+// reprioritizeServerWaiter changes the priority of a job waiting for its server
+func reprioritizeServerWaiter(id, priority string) {
+	serverSlotsMu.Lock()
+	defer serverSlotsMu.Unlock()
+	for _, waiters := range serverWaiters {
+		for i := range waiters {
+			if waiters[i].id == id {
+				waiters[i].priority = priority
+				signalServerSlots()
+			}
+		}
+	}
+}
+
+// releaseServer frees the server's slot if the job holds it
+func releaseServer(id, server string) {
+	serverSlotsMu.Lock()
+	defer serverSlotsMu.Unlock()
+	if slot, ok := serverSlots[server]; ok && slot.holder == id {
+		delete(serverSlots, server)
+		signalServerSlots()
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Settings holds application-wide configuration persisted in settings.json
+type Settings struct {
+	Policy Policy                   `json:"policy"`
+	SSH    SSHOptions               `json:"ssh"`
+	Groups map[string]GroupSettings `json:"groups,omitempty"`
+	Health HealthSettings           `json:"health"`
+
+	EnvProfiles []EnvProfile `json:"env_profiles,omitempty"`
+	SSHD        SSHDSettings `json:"sshd"`
+
+	// Features overrides feature flag defaults; see featureFlags
+	Features map[string]bool `json:"features,omitempty"`
+
+	// Accountability attributes operator-initiated commands on the servers
+	Accountability AccountabilitySettings `json:"accountability,omitempty"`
+
+	// Catalog adds software to the built-in list, usually imported from a library bundle
+	Catalog []Software      `json:"catalog,omitempty"`
+	Library LibrarySettings `json:"library,omitempty"`
+
+	// Repositories adds third-party package repositories to the built-in ones
+	Repositories []PackageRepository `json:"repositories,omitempty"`
+	// Recipes adds multi-step installation recipes to the built-in ones
+	Recipes []Recipe `json:"recipes,omitempty"`
+	// Schedules upgrade groups of servers on a weekly timetable
+	Schedules []UpdateSchedule `json:"schedules,omitempty"`
+	// CronJobs run recorded jobs again on cron schedules
+	CronJobs []CronJob `json:"cron_jobs,omitempty"`
+	// CommandTemplates are saved ad-hoc commands with parameters
+	CommandTemplates []CommandTemplate `json:"command_templates,omitempty"`
+	// Notifications tell operators about finished jobs
+	Notifications NotificationSettings `json:"notifications,omitempty"`
+	// JobLogs is the retention policy of the job logs on disk
+	JobLogs JobLogSettings `json:"job_logs,omitempty"`
+	// ApprovalRules hold back matching jobs until a second operator approves them
+	ApprovalRules []ApprovalRule `json:"approval_rules,omitempty"`
+	// MaintenanceWindows limit when disruptive jobs may run on servers
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows,omitempty"`
+	// Users can sign in to the web UI and the API
+	Users []WebUser `json:"users,omitempty"`
+	// APITokens let scripts call the API as one of the users
+	APITokens []APIToken `json:"api_tokens,omitempty"`
+	// TwoFactorRoles are the roles whose users must sign in with a second factor
+	TwoFactorRoles []string `json:"two_factor_roles,omitempty"`
+	// OIDCGroups give the groups of single sign-on users their roles
+	OIDCGroups []GroupRole `json:"oidc_groups,omitempty"`
+	// LDAPGroups give the groups of directory users their roles
+	LDAPGroups []GroupRole `json:"ldap_groups,omitempty"`
+}
+
+var (
+	settings Settings
+	// settingsFileMu serializes writes of settings.json
+	settingsFileMu sync.Mutex
+)
+
+// loadSettings reads settings.json, falling back to defaults when it is missing
+func loadSettings() error {
+	settings = Settings{Policy: defaultPolicy()}
+	file, err := os.Open("settings.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&settings); err != nil {
+		return fmt.Errorf("settings.json: %w", err)
+	}
+	return nil
+}
+
+// saveSettings writes the current settings to settings.json, readable only by the app since
+// it holds password hashes and secrets. The settings go to a temporary file first that is
+// renamed into place, so a crash never leaves a half-written settings.json behind.
+func saveSettings() error {
+	settingsFileMu.Lock()
+	defer settingsFileMu.Unlock()
+	usersMu.RLock()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	usersMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(".", ".settings-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), "settings.json")
+}
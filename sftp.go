@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// withSFTP opens an SFTP session on the server and passes it to fn
+func withSFTP(ip string, server ServerInfo, fn func(*sftp.Client) error) error {
+	login := loginAccount(server)
+	for attempt := 0; ; attempt++ {
+		client, release, err := acquireClient(ip, login)
+		if err != nil {
+			return err
+		}
+		sftpClient, err := sftp.NewClient(client)
+		if err != nil {
+			// A cached connection may have died since its last use; retry once on a fresh one
+			release(true)
+			if attempt > 0 {
+				return fmt.Errorf("starting sftp subsystem: %w", err)
+			}
+			continue
+		}
+		err = fn(sftpClient)
+		sftpClient.Close()
+		release(false)
+		return err
+	}
+}
+
+// uploadFile writes src to remotePath on the server, creating parent directories as needed
+func uploadFile(ip string, server ServerInfo, remotePath string, src io.Reader, mode os.FileMode) (int64, error) {
+	var written int64
+	err := withSFTP(ip, server, func(client *sftp.Client) error {
+		if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+			return fmt.Errorf("creating %s: %w", path.Dir(remotePath), err)
+		}
+
+		dst, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", remotePath, err)
+		}
+		defer dst.Close()
+
+		written, err = io.Copy(dst, src)
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", remotePath, err)
+		}
+		return dst.Chmod(mode)
+	})
+	return written, err
+}
+
+// errUploadWindows rejects upload mode on Windows servers
+var errUploadWindows = errors.New("upload mode is not available for Windows servers; multi-line PowerShell runs as written in the normal mode")
+
+// runUploadedScript uploads a script over SFTP, runs it with env exported and removes it again.
+// Multi-line scripts run as written with no extra quoting, and a "#!" line picks the
+// interpreter. Privileged runs go through runPrivilegedCommand like any other root script.
+func runUploadedScript(ctx context.Context, ip string, server ServerInfo, script string, privileged bool, env map[string]string, live liveOutput) (CommandResult, error) {
+	if server.isWindows() {
+		return CommandResult{ExitCode: -1}, errUploadWindows
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	remotePath := "/tmp/.accmgr-" + hex.EncodeToString(suffix) + ".sh"
+
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	if _, err := uploadFile(ip, server, remotePath, strings.NewReader(script), 0700); err != nil {
+		return CommandResult{ExitCode: -1}, fmt.Errorf("uploading script: %w", err)
+	}
+
+	wrapper := uploadWrapper(remotePath, script, env)
+
+	var result CommandResult
+	var err error
+	if privileged {
+		result, err = runPrivilegedCommandLive(ctx, ip, server, wrapper, live)
+	} else {
+		result, err = runRemoteCommandLive(ctx, ip, server, wrapper, live)
+	}
+	if err != nil {
+		// The wrapper may not have reached its cleanup; remove the script directly
+		withSFTP(ip, server, func(client *sftp.Client) error {
+			return client.Remove(remotePath)
+		})
+	}
+	return result, err
+}
+
+// uploadWrapper runs an uploaded script and removes it. Exports go in the wrapper so they
+// cannot displace the script's own "#!" line.
+func uploadWrapper(remotePath, script string, env map[string]string) string {
+	run := "sh " + shellQuote(remotePath)
+	if strings.HasPrefix(script, "#!") {
+		run = shellQuote(remotePath)
+	}
+	return withEnv(run+" </dev/null\nstatus=$?\nrm -f "+shellQuote(remotePath)+"\nexit $status\n", env)
+}
+
+// downloadFile copies remotePath from the server into dst
+func downloadFile(ip string, server ServerInfo, remotePath string, dst io.Writer) (int64, error) {
+	var copied int64
+	err := withSFTP(ip, server, func(client *sftp.Client) error {
+		src, err := client.Open(remotePath)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", remotePath, err)
+		}
+		defer src.Close()
+
+		copied, err = io.Copy(dst, src)
+		return err
+	})
+	return copied, err
+}
+
+// filesHandler displays the SFTP upload and download forms
+func filesHandler(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, r, "templates/files.html", requestServers(r))
+}
+
+// sftpUploadHandler pushes an uploaded file to the selected server
+func sftpUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Error reading file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	remotePath := strings.TrimSpace(r.FormValue("remote_path"))
+	if remotePath == "" {
+		http.Error(w, "Remote path is required", http.StatusBadRequest)
+		return
+	}
+	// A trailing slash means "into this directory" using the uploaded file name
+	if strings.HasSuffix(remotePath, "/") {
+		remotePath += path.Base(handler.Filename)
+	}
+
+	mode := os.FileMode(0644)
+	if r.FormValue("executable") == "on" {
+		mode = 0755
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString("📤 SFTP Upload\n\n")
+	logBuilder.WriteString("Server: " + ip + "\n")
+	logBuilder.WriteString("Remote path: " + remotePath + "\n\n")
+
+	written, err := uploadFile(ip, server, remotePath, file, mode)
+	if err != nil {
+		logBuilder.WriteString("❌ Upload failed: " + err.Error() + "\n")
+	} else {
+		logBuilder.WriteString(fmt.Sprintf("✅ Uploaded %d bytes (mode %o)\n", written, mode))
+	}
+
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
+
+// sftpDownloadHandler streams a remote file back to the browser
+func sftpDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+
+	remotePath := strings.TrimSpace(r.FormValue("remote_path"))
+	if remotePath == "" {
+		http.Error(w, "Remote path is required", http.StatusBadRequest)
+		return
+	}
+
+	err := withSFTP(ip, server, func(client *sftp.Client) error {
+		src, err := client.Open(remotePath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		// Headers are only written once the file is known to exist
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(remotePath)))
+		_, err = io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		http.Error(w, "❌ Download failed: "+err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webHostTag marks servers whose site is fetched by the site monitor
+const webHostTag = "web"
+
+const (
+	// siteFetchTimeout bounds one site fetch, including reading the body
+	siteFetchTimeout = 15 * time.Second
+	// maxSiteBody is how much of a page is read when looking for its title
+	maxSiteBody = 256 << 10
+	// siteExcerptLength is how much visible page text is kept for the dashboard card
+	siteExcerptLength = 160
+)
+
+// SiteSnapshot is the latest fetch of a web host's site
+type SiteSnapshot struct {
+	URL        string
+	CheckedAt  time.Time
+	StatusCode int
+	Title      string
+	Excerpt    string
+	Elapsed    time.Duration
+	Error      string
+	// BaselineTitle is the first title seen for the URL; TitleChanged flags a page that no
+	// longer carries it, which is how a defaced site usually shows up
+	BaselineTitle string
+	TitleChanged  bool
+}
+
+// Healthy reports whether the site answered without an error status or a changed title
+func (s SiteSnapshot) Healthy() bool {
+	return s.Error == "" && s.StatusCode < 400 && !s.TitleChanged
+}
+
+var (
+	sitesMu       sync.RWMutex
+	siteSnapshots = make(map[string]SiteSnapshot)
+
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	// scriptPattern and tagPattern strip markup when building the text excerpt
+	scriptPattern = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	tagPattern    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// siteCheckInterval returns how often web hosts are fetched, defaulting to five minutes
+func (h HealthSettings) siteCheckInterval() time.Duration {
+	if h.SiteCheckIntervalSeconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(h.SiteCheckIntervalSeconds) * time.Second
+}
+
+// siteURL returns the URL the site monitor fetches for a server, or "" when it is not a
+// web host. Web hosts without a configured URL are fetched at http://<ip>/.
+func (s ServerInfo) siteURL(ip string) string {
+	if !s.hasTag(webHostTag) {
+		return ""
+	}
+	if s.SiteURL != "" {
+		return s.SiteURL
+	}
+	return "http://" + ip + "/"
+}
+
+// runSiteMonitor fetches every web host's site on the configured interval.
+// It runs under superviseWorker, which restarts it if it panics.
+func runSiteMonitor() {
+	client := &http.Client{Timeout: siteFetchTimeout}
+	for {
+		var ips, urls []string
+		for ip, server := range serversSnapshot() {
+			if url := server.siteURL(ip); url != "" {
+				ips, urls = append(ips, ip), append(urls, url)
+			}
+		}
+		fanOut(ips, func(i int, ip string) {
+			defer catchWorkerPanic("site-monitor")
+			checkSite(client, ip, urls[i])
+		})
+		time.Sleep(settings.Health.siteCheckInterval())
+	}
+}
+
+// checkSite fetches one site, records the snapshot and raises an alert when it errors or
+// its title changes
+func checkSite(client *http.Client, ip, url string) {
+	snapshot := fetchSite(client, url)
+
+	sitesMu.Lock()
+	if previous, ok := siteSnapshots[ip]; ok && previous.URL == url {
+		snapshot.BaselineTitle = previous.BaselineTitle
+	}
+	if snapshot.BaselineTitle == "" && snapshot.Error == "" && snapshot.StatusCode < 400 {
+		snapshot.BaselineTitle = snapshot.Title
+	}
+	snapshot.TitleChanged = snapshot.Error == "" && snapshot.BaselineTitle != "" && snapshot.Title != snapshot.BaselineTitle
+	siteSnapshots[ip] = snapshot
+	sitesMu.Unlock()
+
+	alertKey := "site:" + ip
+	switch {
+	case snapshot.Error != "":
+		raiseAlert(alertKey, ip, "warning", "Site "+url+" could not be fetched: "+snapshot.Error)
+	case snapshot.StatusCode >= 400:
+		raiseAlert(alertKey, ip, "warning", fmt.Sprintf("Site %s returned HTTP %d", url, snapshot.StatusCode))
+	case snapshot.TitleChanged:
+		raiseAlert(alertKey, ip, "critical", fmt.Sprintf("Site %s title changed from %q to %q", url, snapshot.BaselineTitle, snapshot.Title))
+	default:
+		clearAlert(alertKey)
+	}
+}
+
+// fetchSite performs a plain GET and extracts the page title and a short text excerpt
+func fetchSite(client *http.Client, url string) SiteSnapshot {
+	snapshot := SiteSnapshot{URL: url, CheckedAt: time.Now()}
+	resp, err := client.Get(url)
+	if err != nil {
+		snapshot.Error = err.Error()
+		return snapshot
+	}
+	defer resp.Body.Close()
+	snapshot.StatusCode = resp.StatusCode
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSiteBody))
+	snapshot.Elapsed = time.Since(snapshot.CheckedAt)
+	if err != nil {
+		snapshot.Error = "reading body: " + err.Error()
+		return snapshot
+	}
+	page := string(body)
+	if match := titlePattern.FindStringSubmatch(page); match != nil {
+		snapshot.Title = pageText(match[1])
+	}
+	snapshot.Excerpt = pageText(tagPattern.ReplaceAllString(scriptPattern.ReplaceAllString(page, " "), " "))
+	if len([]rune(snapshot.Excerpt)) > siteExcerptLength {
+		snapshot.Excerpt = string([]rune(snapshot.Excerpt)[:siteExcerptLength]) + "…"
+	}
+	return snapshot
+}
+
+// pageText unescapes HTML entities and collapses whitespace
+func pageText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// sitesSnapshot returns a copy of the latest site fetches, keyed by server IP
+func sitesSnapshot() map[string]SiteSnapshot {
+	sitesMu.RLock()
+	defer sitesMu.RUnlock()
+	snapshot := make(map[string]SiteSnapshot, len(siteSnapshots))
+	for ip, site := range siteSnapshots {
+		snapshot[ip] = site
+	}
+	return snapshot
+}
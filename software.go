@@ -1,45 +1,93 @@
 package main
 
 import (
-	"html/template"
+	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Software represents a software package to be installed
 type Software struct {
-	Name        string
-	Description string
-	Command     string
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Category groups entries on the software page, e.g. "Databases"
+	Category string `json:"category,omitempty"`
+	// Packages are the Linux package names, installed with the server's package manager
+	Packages []string `json:"packages"`
+	// Repositories name the third-party repositories the packages come from; they are
+	// added to the server before installing
+	Repositories []string `json:"repositories,omitempty"`
+	// Snap and Flatpak install the software as a snap or a Flathub application instead,
+	// for tools that only ship that way. SnapClassic installs with classic confinement.
+	Snap        string `json:"snap,omitempty"`
+	SnapClassic bool   `json:"snap_classic,omitempty"`
+	Flatpak     string `json:"flatpak,omitempty"`
+	// Pip, Npm and Gem install a tool with the language's package manager, for tools
+	// published to PyPI, npm or RubyGems rather than the distribution
+	Pip string `json:"pip,omitempty"`
+	Npm string `json:"npm,omitempty"`
+	Gem string `json:"gem,omitempty"`
+	// Compose is a docker-compose file; an entry with one is an app deployed as a Compose
+	// stack, e.g. Portainer, rather than an OS package
+	Compose string `json:"compose,omitempty"`
+	// DebURL and RpmURL download the vendor's package file for apt or for dnf, yum and
+	// zypper, checked against DebSHA256 and RpmSHA256, for software in no repository
+	DebURL    string `json:"deb_url,omitempty"`
+	DebSHA256 string `json:"deb_sha256,omitempty"`
+	RpmURL    string `json:"rpm_url,omitempty"`
+	RpmSHA256 string `json:"rpm_sha256,omitempty"`
+	// PreInstall and PostInstall are shell commands run on Linux servers before and after
+	// the install, e.g. to open a firewall port, enable a service or check that it answers
+	PreInstall  []string `json:"pre_install,omitempty"`
+	PostInstall []string `json:"post_install,omitempty"`
+	// Verify is a shell command run on Linux servers after the post-install hooks, e.g.
+	// nginx -v or systemctl is-active postgresql; the install only succeeds when it does
+	Verify string `json:"verify,omitempty"`
+	// Winget is the winget package ID and Choco the Chocolatey package used on Windows
+	// servers; empty when that manager has no package for it
+	Winget string `json:"winget,omitempty"`
+	Choco  string `json:"choco,omitempty"`
+	// Requires names other catalog entries installed first, e.g. nginx for certbot
+	Requires []string `json:"requires,omitempty"`
+	// Hidden removes the built-in entry with the same name from the catalog
+	Hidden bool `json:"hidden,omitempty"`
 }
 
-// Common software packages for Ubuntu
+// Common software packages for Linux, with their Windows equivalents
 var commonSoftware = []Software{
-	{Name: "nginx", Description: "Web server", Command: "apt install -y nginx"},
-	{Name: "python3", Description: "Python programming language", Command: "apt install -y python3"},
-	{Name: "nodejs", Description: "JavaScript runtime", Command: "apt install -y nodejs npm"},
-	{Name: "git", Description: "Version control system", Command: "apt install -y git"},
-	{Name: "docker", Description: "Container platform", Command: "apt install -y docker.io"},
-	{Name: "postgresql", Description: "SQL database", Command: "apt install -y postgresql postgresql-contrib"},
-	{Name: "mysql", Description: "MySQL database", Command: "apt install -y mysql-server mysql-client"},
-	{Name: "vim", Description: "Text editor", Command: "apt install -y vim"},
-	{Name: "curl", Description: "Command line tool for transferring data", Command: "apt install -y curl"},
-	{Name: "wget", Description: "Command line tool for retrieving files", Command: "apt install -y wget"},
+	{Name: "nginx", Description: "Web server", Category: "Web servers", Packages: []string{"nginx"}, Choco: "nginx"},
+	{Name: "python3", Description: "Python programming language", Category: "Languages", Packages: []string{"python3"}, Winget: "Python.Python.3.12", Choco: "python"},
+	{Name: "nodejs", Description: "JavaScript runtime", Category: "Languages", Packages: []string{"nodejs", "npm"}, Winget: "OpenJS.NodeJS.LTS", Choco: "nodejs-lts"},
+	{Name: "nodejs-lts", Description: "Node.js LTS from NodeSource", Category: "Languages", Packages: []string{"nodejs"}, Repositories: []string{"nodesource"}, Winget: "OpenJS.NodeJS.LTS", Choco: "nodejs-lts"},
+	{Name: "git", Description: "Version control system", Category: "Developer tools", Packages: []string{"git"}, Winget: "Git.Git", Choco: "git"},
+	{Name: "docker", Description: "Container platform", Category: "Containers", Packages: []string{"docker.io"}, Choco: "docker-engine"},
+	{Name: "docker-ce", Description: "Docker CE from Docker's repository", Category: "Containers", Packages: []string{"docker-ce", "docker-ce-cli", "containerd.io", "docker-buildx-plugin", "docker-compose-plugin"}, Repositories: []string{"docker"}},
+	{Name: "postgresql", Description: "SQL database", Category: "Databases", Packages: []string{"postgresql", "postgresql-contrib"}, Winget: "PostgreSQL.PostgreSQL.16", Choco: "postgresql"},
+	{Name: "mysql", Description: "MySQL database", Category: "Databases", Packages: []string{"mysql-server", "mysql-client"}, Winget: "Oracle.MySQL", Choco: "mysql"},
+	{Name: "vim", Description: "Text editor", Category: "Developer tools", Packages: []string{"vim"}, Winget: "vim.vim", Choco: "vim"},
+	{Name: "curl", Description: "Command line tool for transferring data", Category: "Network tools", Packages: []string{"curl"}, Winget: "cURL.cURL", Choco: "curl"},
+	{Name: "wget", Description: "Command line tool for retrieving files", Category: "Network tools", Packages: []string{"wget"}, Winget: "JernejSimoncic.Wget", Choco: "wget"},
+	{Name: "portainer", Description: "Web UI for managing Docker", Category: "Apps", Compose: portainerCompose},
+	{Name: "uptime-kuma", Description: "Self-hosted uptime monitoring", Category: "Apps", Compose: uptimeKumaCompose},
 }
 
 // softwareHandler displays the software installation page
 func softwareHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/software.html"))
-
 	data := map[string]interface{}{
-		"Servers":  ipMap,
-		"Software": commonSoftware,
+		"Servers":  requestServers(r),
+		"Groups":   serverGroups(requestServers(r)),
+		"Software": softwareCatalog(),
 	}
 
-	tmpl.Execute(w, data)
+	renderTemplate(w, r, "templates/software.html", data)
 }
 
-// installSoftwareHandler installs software on the selected server
+// installSoftwareHandler installs or, when operation is "uninstall", removes software on
+// the selected server, or on every server in the selected group
 func installSoftwareHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -53,96 +101,660 @@ func installSoftwareHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get server IP
+	// Get the server IP or the group
 	serverIP := r.FormValue("server_ip")
-	if serverIP == "" {
-		http.Error(w, "Server IP is required", http.StatusBadRequest)
+	group := strings.TrimSpace(r.FormValue("group"))
+	if (serverIP == "") == (group == "") {
+		http.Error(w, "Choose either a server or a group", http.StatusBadRequest)
 		return
 	}
 
 	// Get server info
-	server, ok := ipMap[serverIP]
-	if !ok {
+	server, ok := lookupServer(serverIP)
+	if !ok && group == "" {
 		http.Error(w, "Server not found", http.StatusNotFound)
 		return
 	}
+	if group == "" && !serversAllowed(w, r, []string{serverIP}) {
+		return
+	}
 
-	// Get software selection or custom command
-	softwareType := r.FormValue("software_type")
-	var installCommand string
+	selections, err := parseSoftwareSelection(r)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	options := parseSoftwareOptions(r)
+	if options.Timeout, err = parseJobTimeout(r.FormValue("timeout")); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if options.Priority, err = parseJobPriority(r.FormValue("priority")); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if group != "" {
+		bulkSoftwareHandler(w, r, group, selections, options)
+		return
+	}
+	if err := windowsSelectionError(server, selections, options); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if softwareType == "common" {
-		// Get selected common software
-		softwareName := r.FormValue("common_software")
-		found := false
-		for _, s := range commonSoftware {
-			if s.Name == softwareName {
-				installCommand = s.Command
-				found = true
-				break
-			}
-		}
+	if server, err = operatorServer(server, options.Operator); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+		return
+	}
 
-		if !found {
-			http.Error(w, "Selected software not found", http.StatusBadRequest)
+	// Previews and dry runs only probe the server, so they answer directly
+	if options.Preview || options.DryRun {
+		outcome := runSoftware(serverIP, server, selections, options)
+		if outcome.Status == softwarePreviewed {
+			renderSoftwarePreview(w, r, "", selections, options, []bulkSoftwareRow{{IP: serverIP, Name: server.Name, softwareOutcome: outcome}})
 			return
 		}
-	} else if softwareType == "custom" {
-		// Get custom software name
-		customSoftware := strings.TrimSpace(r.FormValue("custom_software"))
-		if customSoftware == "" {
-			http.Error(w, "Custom software name is required", http.StatusBadRequest)
+		renderTemplate(w, r, "templates/logs.html", outcome.Log)
+		return
+	}
+
+	if options.Purge {
+		record, _ := lookupServer(serverIP)
+		if err := checkConfirmation(r, OpPurgePackages, serverIP, record); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Sanitize input to prevent command injection
-		customSoftware = sanitizePackageName(customSoftware)
-		installCommand = "apt install -y " + customSoftware
-	} else {
-		http.Error(w, "Invalid software type", http.StatusBadRequest)
+	// The install runs as a queued job; its page shows the progress and then the log
+	form, ctx := maps.Clone(r.PostForm), r.Context()
+	description := softwareJobDescription(selections, options, serverIP)
+	run := func(job *Job) jobResult {
+		job.setRerun(ctx, "/install-software", form)
+		job.setTimeout(options.Timeout)
+		options.Live, options.Parent = job.output, job
+		outcome := runSoftware(serverIP, server, selections, options)
+		return jobResult{Log: outcome.Log, Err: outcome.err(), Template: "templates/logs.html", Data: outcome.Log}
+	}
+	// The install's own job claims the server, so the held job names none
+	held := Job{Kind: "software", Description: description, Priority: options.Priority}
+	targets := jobTargets{options.jobKind(), map[string]ServerInfo{serverIP: server}}
+	if holdForApproval(w, r, held, targets, description, run) {
 		return
 	}
+	job, err := queueOperatorJob(options.Operator, "software", description, options.Priority, targets, run)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	submittedJob(r, job)
+	http.Redirect(w, r, appPath(r, "/job?id="+job.ID), http.StatusSeeOther)
+}
+
+// softwareJobDescription describes a queued software job, e.g. "Install git, curl on web"
+func softwareJobDescription(selections []softwareSelection, options softwareOptions, target string) string {
+	var names []string
+	for _, selection := range selections {
+		names = append(names, selection.Name)
+	}
+	action := "Install"
+	if options.Uninstall {
+		action = "Uninstall"
+	}
+	return action + " " + strings.Join(names, ", ") + " on " + target
+}
+
+// softwareOptions are the choices of the software form that apply to every server
+type softwareOptions struct {
+	// Backend is the backend chosen in the form, empty for the catalog's preference
+	Backend     string
+	Uninstall   bool
+	Purge       bool
+	IfInstalled string
+	// Rollback removes the packages a failed Linux install added
+	Rollback bool
+	DryRun   bool
+	// Preview shows what would run, after OS translation and sudo wrapping, for the operator
+	// to confirm; nothing runs on the servers and the login is not checked
+	Preview   bool
+	Verbosity string
+	Operator  string
+	// Live also receives the output as it arrives, e.g. for the queued job of the request
+	Live liveOutput
+	// Parent is the queued job of the request; cancelling it cancels the install's own job
+	Parent *Job
+	// Timeout is the time limit of the request's jobs, zero for the default
+	Timeout time.Duration
+	// Priority orders the request's jobs among those waiting; see parseJobPriority
+	Priority string
+}
+
+// parseSoftwareOptions reads the software form's options
+// jobKind is the kind of the jobs that install or remove the software on each server
+func (o softwareOptions) jobKind() string {
+	if o.Uninstall {
+		return "uninstall"
+	}
+	return "install"
+}
+
+func parseSoftwareOptions(r *http.Request) softwareOptions {
+	uninstall := r.FormValue("operation") == "uninstall"
+	dryRun := r.FormValue("dry_run") == "on"
+	return softwareOptions{
+		Backend:     r.FormValue("backend"),
+		Uninstall:   uninstall,
+		Purge:       uninstall && r.FormValue("purge") == "on",
+		IfInstalled: parseIfInstalled(r.FormValue("if_installed")),
+		Rollback:    !uninstall && r.FormValue("rollback") == "on",
+		DryRun:      dryRun,
+		Preview:     !dryRun && r.FormValue("confirmed") != "on",
+		Verbosity:   parseVerbosity(r.FormValue("verbosity")),
+		Operator:    requestOperator(r),
+	}
+}
+
+// windowsSelectionError reports selections a Windows server cannot install: Linux-only
+// backends, Compose apps and wildcard versions. It returns nil for Linux servers.
+func windowsSelectionError(server ServerInfo, selections []softwareSelection, options softwareOptions) error {
+	if !server.isWindows() {
+		return nil
+	}
+	if backend := options.Backend; backend == backendSnap || backend == backendFlatpak || backend == backendURL || isLanguageBackend(backend) {
+		return errors.New(backend + " is only available on Linux servers")
+	}
+	for _, selection := range selections {
+		if selection.Backend == backendCompose {
+			return errors.New(selection.Name + " is a Docker Compose app and runs on Linux servers only")
+		}
+	}
+	if !options.Uninstall {
+		for _, selection := range selections {
+			if _, wildcard := wildcardVersion(selection.Version); wildcard {
+				return errors.New("winget and choco need an exact version, not " + selection.Version)
+			}
+		}
+	}
+	return nil
+}
+
+// Outcomes of installing or removing software on one server
+const (
+	softwareSucceeded = "success"
+	softwareFailed    = "failed"
+	// softwareSkipped means nothing ran: everything was installed already or the server
+	// cannot take the selection
+	softwareSkipped = "skipped"
+	// softwarePlanned is a dry run that only checked the login
+	softwarePlanned = "dry run"
+	// softwarePreviewed is a preview awaiting confirmation
+	softwarePreviewed = "preview"
+)
+
+// softwareOutcome is the result of installing or removing software on one server
+type softwareOutcome struct {
+	Status string
+	// Summary is the outcome in one line and Log the full job log
+	Summary  string
+	Log      string
+	Duration time.Duration
+	// Manager, Command and Plan describe what a preview would run: the package manager the
+	// server uses, the commands that change software and the exec request
+	Manager string
+	Command string
+	Plan    *CommandPlan
+}
+
+// err is the outcome as a job error: nil unless it failed
+func (o softwareOutcome) err() error {
+	if o.Status == softwareFailed {
+		return errors.New(o.Summary)
+	}
+	return nil
+}
 
-	// Build the full installation script
+// runSoftware installs or removes the selections on one server as a job and returns its log;
+// for a preview it returns what the job would run instead
+func runSoftware(serverIP string, server ServerInfo, selections []softwareSelection, options softwareOptions) softwareOutcome {
+	start := time.Now()
+	var names []string
+	for _, selection := range selections {
+		names = append(names, selection.Name)
+	}
+	packageName := strings.Join(names, ", ")
+
+	verbosity := options.Verbosity
+	uninstall, purge, ifInstalled := options.Uninstall, options.Purge, options.IfInstalled
+	jobKind, title, noun := "install", "📦 Software Installation Log", "Installation"
+	if uninstall {
+		jobKind, title, noun = "uninstall", "🗑️ Software Removal Log", "Removal"
+	}
+	failed := func(err error) softwareOutcome {
+		return softwareOutcome{
+			Status:   softwareFailed,
+			Summary:  err.Error(),
+			Log:      title + "\n\nServer: " + serverIP + "\n\n❌ " + err.Error() + "\n",
+			Duration: time.Since(start),
+		}
+	}
+
+	var alreadyInstalled []InstalledPackage
+	// A failed Linux install with rollback removes the packages missing from before
+	rollback := options.Rollback
+	var linuxManager PackageManager
+	var before map[string]string
+
+	// Build the full script
 	var script strings.Builder
-	if server.RootUsername == "root" {
-		// Running as root, no need for sudo - use apk for Alpine
-		script.WriteString("apk update && ")
-		// Convert apt commands to apk commands for Alpine
-		installCommand = strings.ReplaceAll(installCommand, "apt install -y", "apk add")
-		script.WriteString(installCommand)
+	var installCommand, managerName string
+	if server.isWindows() {
+		// Windows servers use winget where it is available and Chocolatey otherwise. Neither
+		// has multi-package transactions, so selections run one after another and the
+		// script stops at the first failure.
+		var labels []string
+		for _, selection := range selections {
+			label := selection.Name
+			if uninstall {
+				script.WriteString(windowsUninstallScript(selection.WingetArgs, selection.Choco, verbosity))
+			} else {
+				script.WriteString(windowsInstallScript(selection.WingetArgs, selection.Choco, selection.Version, verbosity))
+				if selection.Version != "" {
+					label += " " + selection.Version
+				}
+			}
+			script.WriteString("if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }\n")
+			labels = append(labels, label)
+		}
+		installCommand = "winget or choco " + jobKind + " " + strings.Join(labels, ", ")
+		managerName = "winget or choco"
 	} else {
-		// Not running as root, use sudo with apt for Ubuntu
-		script.WriteString("echo '")
-		script.WriteString(server.RootPassword)
-		script.WriteString("' | sudo -S apt update && echo '")
-		script.WriteString(server.RootPassword)
-		script.WriteString("' | sudo -S ")
-		// Convert apk commands to apt commands
-		installCommand = strings.ReplaceAll(installCommand, "apk add", "apt install -y")
-		script.WriteString(installCommand)
+		manager, err := detectPackageManager(serverIP, server)
+		if err != nil {
+			return failed(err)
+		}
+		managerName = manager.Name()
+		// Packages already present are skipped, upgraded or installed again as the form asks
+		if !uninstall {
+			versions, err := installedVersions(serverIP, server, manager)
+			if err != nil {
+				return failed(err)
+			}
+			selections, alreadyInstalled = applyInstalled(selections, versions, ifInstalled)
+			linuxManager, before = manager, versions
+			if len(selections) == 0 {
+				var logBuilder strings.Builder
+				logBuilder.WriteString(title + "\n\nServer: " + serverIP + "\nSoftware: " + packageName + "\n\n")
+				writeInstalledLog(&logBuilder, alreadyInstalled, ifInstalled)
+				logBuilder.WriteString("\n⏭️ Everything selected is already installed; nothing to do\n")
+				return softwareOutcome{Status: softwareSkipped, Summary: "already installed", Log: logBuilder.String(), Duration: time.Since(start)}
+			}
+		}
+		steps, err := linuxSoftwareSteps(manager, selections, uninstall, purge, verbosity)
+		if err != nil {
+			return failed(err)
+		}
+		var commands []string
+		for i, step := range steps {
+			if i > 0 {
+				script.WriteString(" && ")
+			}
+			script.WriteString(numberedStep(i, len(steps), step.Name) + " && " + step.Command)
+			if step.Name == step.Command {
+				commands = append(commands, step.Command)
+			}
+		}
+		// The log and job show the commands that change software, not the bootstrap steps
+		installCommand = strings.Join(commands, " && ")
 	}
 
-	// Execute the command on the remote server
-	output, err := runRemoteCommand(serverIP, server.RootUsername, server.RootPassword, script.String())
+	fullScript := tracedScript(script.String(), verbosity, server.isWindows())
 
-	// Prepare log output
 	var logBuilder strings.Builder
-	logBuilder.WriteString("📦 Software Installation Log\n\n")
+	logBuilder.WriteString(title + "\n\n")
 	logBuilder.WriteString("Server: " + serverIP + "\n")
-	logBuilder.WriteString("Command: " + installCommand + "\n\n")
+	logBuilder.WriteString("Software: " + packageName + "\n")
+	writePrerequisitesLog(&logBuilder, selections)
+	logBuilder.WriteString("Command: " + installCommand + "\n")
+	writeInstalledLog(&logBuilder, alreadyInstalled, ifInstalled)
+	if purge && server.isWindows() {
+		logBuilder.WriteString("Purge: not supported by winget or choco; configuration is kept\n")
+	}
+	var hooks []softwareHook
+	if !uninstall {
+		hooks = softwareHooks(selections)
+	}
+	if len(hooks) > 0 && server.isWindows() {
+		logBuilder.WriteString("Hooks: not run on Windows servers\n")
+		hooks = nil
+	}
+	logBuilder.WriteString("Verbosity: " + verbosity + "\n\n")
+
+	operator := options.Operator
+	if options.Preview {
+		// The job ID is only known once the job starts
+		plan := planPrivilegedCommand(server, operatorScript(server, fullScript, operator, "<job ID>"))
+		return softwareOutcome{
+			Status:   softwarePreviewed,
+			Summary:  "awaiting confirmation",
+			Log:      logBuilder.String(),
+			Duration: time.Since(start),
+			Manager:  managerName,
+			Command:  installCommand,
+			Plan:     &plan,
+		}
+	}
+	if options.DryRun {
+		plan := planPrivilegedCommand(server, operatorScript(server, fullScript, operator, "dry-run"))
+		writeDryRunLog(&logBuilder, plan, checkLogin(serverIP, plan))
+		return softwareOutcome{Status: softwarePlanned, Summary: "dry run", Log: logBuilder.String(), Duration: time.Since(start)}
+	}
+
+	if options.Parent != nil && options.Parent.context().Err() != nil {
+		// Later servers of a cancelled group run are not started
+		logBuilder.WriteString("🛑 Not started: the job was cancelled\n")
+		return softwareOutcome{Status: softwareFailed, Summary: "cancelled", Log: logBuilder.String(), Duration: time.Since(start)}
+	}
+
+	// Execute the command on the remote server
+	job := startPriorityJob(operator, jobKind, serverIP, installCommand, options.Priority)
+	job.setTimeout(options.Timeout)
+	if options.Parent != nil {
+		job.setParent(options.Parent)
+		defer job.followCancel(options.Parent)()
+	}
+	result, err := runPrivilegedCommandLive(job.context(), serverIP, server, operatorScript(server, fullScript, operator, job.ID), job.teeOutput(options.Live))
+	var hookStatuses []stepStatus
+	result.Stdout, hookStatuses = parseTrackedOutput(result.Stdout, len(hooks))
+	var rolledBack []string
+	var rollbackErr error
+	// A lost connection may leave the install running, so only a finished failure rolls back
+	rollback = rollback && err == nil && !result.OK() && linuxManager != nil
+	if rollback {
+		rolledBack, rollbackErr = rollbackPackages(job, serverIP, server, linuxManager, before, operator, verbosity)
+	}
+	job.finishCommand(result, err)
+
+	outcome := softwareOutcome{Status: softwareFailed}
+	switch {
+	case err != nil:
+		outcome.Summary = err.Error()
+		logBuilder.WriteString("❌ " + noun + " failed: " + err.Error() + "\n\n")
+	case !result.OK():
+		outcome.Summary = "failed with " + result.Status()
+		if failed := failedVerifications(hooks, hookStatuses); len(failed) > 0 {
+			// Everything installed, but the software does not work
+			outcome.Summary = "verification failed for " + strings.Join(failed, ", ")
+		}
+		logBuilder.WriteString("❌ " + noun + " " + outcome.Summary + "\n\n")
+	default:
+		outcome.Status, outcome.Summary = softwareSucceeded, "finished with "+result.Status()
+		logBuilder.WriteString("✅ " + noun + " finished with " + result.Status() + "\n\n")
+	}
+	if len(hooks) > 0 {
+		writeHookLog(&logBuilder, hooks, hookStatuses)
+	}
+	if rollback {
+		writeRollbackLog(&logBuilder, rolledBack, rollbackErr)
+		if rollbackErr == nil {
+			outcome.Summary += ", rolled back"
+		}
+	}
+
+	logBuilder.WriteString("Output:\n" + verbosityOutput(result.Output(), verbosity, err == nil && result.OK()))
+	outcome.Log, outcome.Duration = logBuilder.String(), time.Since(start)
+	return outcome
+}
+
+// maxSoftwarePerJob caps how many catalog entries or custom packages one job installs
+const maxSoftwarePerJob = 50
+
+// softwareSelection is one catalog entry or custom package chosen on the software page
+type softwareSelection struct {
+	Name string
+	// Backend is how the selection installs on Linux, e.g. backendNative, backendSnap or
+	// backendURL
+	Backend string
+	// Packages are the native package specs, the first optionally pinned with name=version
+	Packages []string
+	// Upgrades are native packages already installed that the job upgrades instead
+	Upgrades []string
+	// Repositories are added before the native packages are installed
+	Repositories []string
+	// RequiredBy names the selected entry this one was added for as a prerequisite
+	RequiredBy  string
+	Snap        string
+	SnapClassic bool
+	Flatpak     string
+	// LanguagePackage is the package installed with pip, npm or gem
+	LanguagePackage string
+	Compose         string
+	// DebURL and RpmURL are the package files installed with backendURL
+	DebURL    string
+	DebSHA256 string
+	RpmURL    string
+	RpmSHA256 string
+	// PreInstall and PostInstall are the catalog entry's hooks
+	PreInstall  []string
+	PostInstall []string
+	// Verify is the catalog entry's verification command
+	Verify string
+	// Version is the pinned version of the main package, or the snap channel
+	Version string
+	// WingetArgs and Choco select the package on Windows servers
+	WingetArgs string
+	Choco      string
+}
+
+// languagePackage returns the entry's package for a pip, npm or gem backend
+func (s Software) languagePackage(backend string) string {
+	return map[string]string{backendPip: s.Pip, backendNpm: s.Npm, backendGem: s.Gem}[backend]
+}
+
+// selectionFromCatalog resolves a catalog entry for the requested backend. With no backend
+// requested, native packages are preferred, then the snap, the flatpak, the pip, npm or
+// gem package, the Compose stack and finally the package download.
+func selectionFromCatalog(entry Software, backend string) (softwareSelection, error) {
+	selection := softwareSelection{
+		Name:         entry.Name,
+		Packages:     slices.Clone(entry.Packages),
+		Repositories: entry.Repositories,
+		Snap:         entry.Snap,
+		SnapClassic:  entry.SnapClassic,
+		Flatpak:      entry.Flatpak,
+		Compose:      entry.Compose,
+		DebURL:       entry.DebURL,
+		DebSHA256:    entry.DebSHA256,
+		RpmURL:       entry.RpmURL,
+		RpmSHA256:    entry.RpmSHA256,
+		PreInstall:   entry.PreInstall,
+		PostInstall:  entry.PostInstall,
+		Verify:       entry.Verify,
+		Choco:        entry.Choco,
+	}
+	if entry.Winget != "" {
+		selection.WingetArgs = "--id " + powerShellQuote(entry.Winget) + " --exact"
+	}
+	if backend == "" {
+		switch {
+		case len(entry.Packages) > 0:
+			backend = backendNative
+		case entry.Snap != "":
+			backend = backendSnap
+		case entry.Flatpak != "":
+			backend = backendFlatpak
+		case entry.languagePackage(backendPip) != "":
+			backend = backendPip
+		case entry.languagePackage(backendNpm) != "":
+			backend = backendNpm
+		case entry.languagePackage(backendGem) != "":
+			backend = backendGem
+		case entry.Compose != "":
+			backend = backendCompose
+		case entry.DebURL != "" || entry.RpmURL != "":
+			backend = backendURL
+		default:
+			backend = backendNative
+		}
+	}
+	selection.Backend = backend
+	switch {
+	case backend == backendSnap && entry.Snap == "":
+		return selection, fmt.Errorf("%s has no snap in the catalog", entry.Name)
+	case backend == backendFlatpak && entry.Flatpak == "":
+		return selection, fmt.Errorf("%s has no flatpak in the catalog", entry.Name)
+	case backend == backendURL && entry.DebURL == "" && entry.RpmURL == "":
+		return selection, fmt.Errorf("%s has no package download URL in the catalog", entry.Name)
+	case isLanguageBackend(backend):
+		selection.LanguagePackage = entry.languagePackage(backend)
+		if selection.LanguagePackage == "" {
+			return selection, fmt.Errorf("%s has no %s package in the catalog", entry.Name, backend)
+		}
+	case backend == backendNative && len(entry.Packages) > 0:
+		_, selection.Version, _ = parsePackageSpec(entry.Packages[0])
+	}
+	return selection, nil
+}
 
+// customSelection parses one custom name for the requested backend: a package spec, a
+// snap with an optional =channel, or a flatpak application ID
+func customSelection(spec, backend string, classic bool) (softwareSelection, error) {
+	if backend == backendURL {
+		return parsePackageURLSpec(spec)
+	}
+	if sanitizePackageName(spec) != spec {
+		return softwareSelection{}, fmt.Errorf("invalid package name %q", spec)
+	}
+	switch backend {
+	case backendSnap:
+		name, channel, err := parseSnapSpec(spec)
+		if err != nil {
+			return softwareSelection{}, err
+		}
+		return softwareSelection{Name: name, Backend: backendSnap, Snap: name, SnapClassic: classic, Version: channel}, nil
+	case backendFlatpak:
+		if err := validateFlatpakID(spec); err != nil {
+			return softwareSelection{}, err
+		}
+		return softwareSelection{Name: spec, Backend: backendFlatpak, Flatpak: spec}, nil
+	case backendPip, backendNpm, backendGem:
+		name, version, err := parseLanguageSpec(backend, spec)
+		if err != nil {
+			return softwareSelection{}, err
+		}
+		return softwareSelection{Name: name, Backend: backend, LanguagePackage: name, Version: version}, nil
+	}
+	name, version, err := parsePackageSpec(spec)
 	if err != nil {
-		logBuilder.WriteString("❌ Installation failed: " + err.Error() + "\n\n")
-	} else {
-		logBuilder.WriteString("✅ Installation command executed successfully\n\n")
+		return softwareSelection{}, err
 	}
+	return softwareSelection{
+		Name:       name,
+		Backend:    backendNative,
+		Packages:   []string{spec},
+		Version:    version,
+		WingetArgs: "--query " + powerShellQuote(name),
+		Choco:      name,
+	}, nil
+}
 
-	logBuilder.WriteString("Output:\n" + output)
+// parseSoftwareSelection reads the catalog entries or the space-separated custom packages
+// chosen in the form, for the backend chosen in it. Custom names are validated rather than
+// cleaned up, so a typo cannot silently install something else. The version field pins the
+// main package, or picks the snap channel, and therefore needs exactly one selection;
+// custom packages can pin their own with name=version or name=channel.
+func parseSoftwareSelection(r *http.Request) ([]softwareSelection, error) {
+	backend := r.FormValue("backend")
+	if backend != "" && backend != backendNative && backend != backendSnap && backend != backendFlatpak && backend != backendURL && !isLanguageBackend(backend) {
+		return nil, fmt.Errorf("invalid backend %q", backend)
+	}
+	var selections []softwareSelection
+	switch r.FormValue("software_type") {
+	case "common":
+		catalog := softwareCatalog()
+		chosen := r.Form["common_software"]
+		for _, name := range chosen {
+			if !slices.ContainsFunc(catalog, func(s Software) bool { return s.Name == name }) {
+				return nil, fmt.Errorf("selected software %q not found", name)
+			}
+		}
+		// Installs add the entries the chosen ones require, first; removals leave them, as
+		// other software may still need them
+		names, requiredBy := chosen, map[string]string{}
+		if r.FormValue("operation") != "uninstall" {
+			var err error
+			if names, requiredBy, err = resolveRequires(catalog, chosen); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range names {
+			i := slices.IndexFunc(catalog, func(s Software) bool { return s.Name == name })
+			// Prerequisites install the way their entry prefers, not with the chosen backend
+			entryBackend := backend
+			if requiredBy[name] != "" {
+				entryBackend = ""
+			}
+			selection, err := selectionFromCatalog(catalog[i], entryBackend)
+			if err != nil {
+				return nil, err
+			}
+			selection.RequiredBy = requiredBy[name]
+			selections = append(selections, selection)
+		}
+	case "custom":
+		classic := r.FormValue("snap_classic") == "on"
+		for _, spec := range strings.Fields(strings.ReplaceAll(r.FormValue("custom_software"), ",", " ")) {
+			selection, err := customSelection(spec, backend, classic)
+			if err != nil {
+				return nil, err
+			}
+			selections = append(selections, selection)
+		}
+	default:
+		return nil, errors.New("invalid software type")
+	}
+	switch {
+	case len(selections) == 0:
+		return nil, errors.New("select at least one package")
+	case len(selections) > maxSoftwarePerJob:
+		return nil, fmt.Errorf("at most %d packages can be installed in one job", maxSoftwarePerJob)
+	}
 
-	// Display the results
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
+	// A version typed into the form overrides one pinned in the catalog or the custom name
+	if version := strings.TrimSpace(r.FormValue("version")); version != "" {
+		if len(selections) != 1 {
+			return nil, errors.New("the version field pins a single package; pin each custom package with name=version instead")
+		}
+		selection := &selections[0]
+		switch {
+		case selection.Backend == backendSnap:
+			if _, _, err := parseSnapSpec(selection.Snap + "=" + version); err != nil {
+				return nil, err
+			}
+		case selection.Backend == backendFlatpak:
+			return nil, errors.New("flatpak installs cannot pin a version")
+		case selection.Backend == backendCompose:
+			return nil, errors.New("compose apps take their versions from the image tags in the compose file")
+		case selection.Backend == backendURL:
+			return nil, errors.New("packages installed from a URL are pinned by the file the URL points to")
+		case isLanguageBackend(selection.Backend):
+			if _, _, err := parseLanguageSpec(selection.Backend, selection.LanguagePackage+"="+version); err != nil {
+				return nil, err
+			}
+		case len(selection.Packages) > 0:
+			name, _, _ := parsePackageSpec(selection.Packages[0])
+			if _, _, err := parsePackageSpec(name + "=" + version); err != nil {
+				return nil, err
+			}
+			selection.Packages[0] = name + "=" + version
+		}
+		selection.Version = version
+	}
+	for i := range selections {
+		if err := applyVariables(&selections[i], r); err != nil {
+			return nil, err
+		}
+	}
+	return selections, nil
 }
 
 // sanitizePackageName removes potentially dangerous characters from package names
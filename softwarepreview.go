@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// renderSoftwarePreview shows, for each server, the package manager, the commands that
+// change software and the exact exec request, and a form that submits the same request
+// again with confirmed set. Servers that cannot run the selection show why.
+func renderSoftwarePreview(w http.ResponseWriter, r *http.Request, group string, selections []softwareSelection, options softwareOptions, rows []bulkSoftwareRow) {
+	var names []string
+	for _, selection := range selections {
+		names = append(names, selection.Name)
+	}
+	ready := 0
+	for _, row := range rows {
+		if row.Status == softwarePreviewed {
+			ready++
+		}
+	}
+	action := "Install"
+	if options.Uninstall {
+		action = "Uninstall"
+	}
+	// A purge asks for the server or group name to be typed, when the policy says so
+	confirmName := ""
+	if options.Purge && settings.Policy.forOperation(OpPurgePackages).RequireTypedConfirmation {
+		confirmName = group
+		if group == "" && len(rows) > 0 {
+			server, _ := lookupServer(rows[0].IP)
+			confirmName = serverDisplayName(rows[0].IP, server)
+		}
+	}
+	form := r.PostForm
+	form.Del("confirmed")
+	form.Del("confirm_name")
+	// The confirmation is a submission of its own, with a fresh idempotency key
+	form.Del(idempotencyKeyField)
+	renderTemplate(w, r, "templates/softwarepreview.html", map[string]interface{}{
+		"Action":   action,
+		"Group":    group,
+		"Software": strings.Join(names, ", "),
+		"Rows":     rows,
+		"Ready":    ready,
+		"Form":     form,
+		"Confirm":  confirmName,
+	})
+}
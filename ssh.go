@@ -0,0 +1,1016 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshClientConfig builds the client configuration for a server, honoring its SSH options
+func sshClientConfig(server ServerInfo) *ssh.ClientConfig {
+	opts := effectiveSSHOptions(server)
+
+	config := &ssh.ClientConfig{
+		User:              server.RootUsername,
+		HostKeyCallback:   ssh.InsecureIgnoreHostKey(),
+		HostKeyAlgorithms: opts.HostKeyAlgorithms,
+	}
+	// Agent-only servers may have no stored password at all
+	if server.RootPassword != "" {
+		config.Auth = []ssh.AuthMethod{ssh.Password(server.RootPassword)}
+	}
+	config.Ciphers = opts.Ciphers
+	config.MACs = opts.MACs
+	config.KeyExchanges = opts.KeyExchanges
+
+	// Legacy mode keeps the modern defaults but also offers the insecure algorithms
+	// that old appliances still require. Explicit lists always win.
+	if opts.legacyEnabled() {
+		supported := ssh.SupportedAlgorithms()
+		insecure := ssh.InsecureAlgorithms()
+		if len(config.Ciphers) == 0 {
+			config.Ciphers = append(supported.Ciphers, insecure.Ciphers...)
+		}
+		if len(config.MACs) == 0 {
+			config.MACs = append(supported.MACs, insecure.MACs...)
+		}
+		if len(config.KeyExchanges) == 0 {
+			config.KeyExchanges = append(supported.KeyExchanges, insecure.KeyExchanges...)
+		}
+		if len(config.HostKeyAlgorithms) == 0 {
+			config.HostKeyAlgorithms = append(supported.HostKeys, insecure.HostKeys...)
+		}
+	}
+
+	return config
+}
+
+// sshStats counts SSH connections since startup for the diagnostics page
+var sshStats struct {
+	dials    atomic.Int64
+	failures atomic.Int64
+	open     atomic.Int64
+}
+
+// dialServer opens an authenticated SSH connection to the server
+func dialServer(ip string, server ServerInfo) (client *ssh.Client, err error) {
+	sshStats.dials.Add(1)
+	defer func() {
+		if err != nil {
+			sshStats.failures.Add(1)
+		}
+	}()
+	config := sshClientConfig(server)
+
+	// Keys are offered before the password: the key file first, then the agent
+	var keyAuth []ssh.AuthMethod
+	var keyErr error
+	if server.KeyFile != "" {
+		signer, err := keyFileSigner(server)
+		if err != nil && server.RootPassword == "" && !server.UseAgent {
+			return nil, err
+		}
+		if err == nil {
+			keyAuth = append(keyAuth, ssh.PublicKeys(signer))
+		}
+		keyErr = err
+	}
+
+	if server.UseAgent {
+		// The agent connection only has to live until authentication completes
+		conn, err := dialAgent()
+		if err != nil && server.RootPassword == "" && len(keyAuth) == 0 {
+			return nil, errors.Join(keyErr, err)
+		}
+		if err == nil {
+			defer conn.Close()
+			keyAuth = append(keyAuth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	config.Auth = append(keyAuth, config.Auth...)
+
+	opts := effectiveSSHOptions(server)
+	addr := net.JoinHostPort(ip, "22")
+	conn, err := dialTCP(addr, opts, opts.connectTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	// The deadline covers the banner exchange, key exchange and authentication
+	conn.SetDeadline(time.Now().Add(opts.bannerTimeout()))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	client = ssh.NewClient(sshConn, chans, reqs)
+	sshStats.open.Add(1)
+	go func() {
+		client.Wait()
+		sshStats.open.Add(-1)
+	}()
+	if interval := opts.keepaliveInterval(); interval > 0 {
+		go sendKeepalives(client, interval)
+	}
+	return client, nil
+}
+
+// keepaliveMaxMissed is how many unanswered keepalives in a row drop the connection
+const keepaliveMaxMissed = 3
+
+// keepaliveFailures records why sendKeepalives closed a client, so the command that was
+// running on it can report the cause instead of a bare EOF
+var keepaliveFailures sync.Map // *ssh.Client -> error
+
+// sendKeepalives pings the server until the connection closes. A failed ping, or
+// keepaliveMaxMissed pings without a reply, closes the connection so blocked reads return.
+func sendKeepalives(client *ssh.Client, interval time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(done)
+	}()
+
+	fail := func(err error) {
+		keepaliveFailures.Store(client, err)
+		time.AfterFunc(time.Minute, func() { keepaliveFailures.Delete(client) })
+		client.Close()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+		select {
+		case <-done:
+			return
+		case err := <-reply:
+			if err != nil {
+				fail(fmt.Errorf("keepalive failed: %w", err))
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			missed++
+			if missed >= keepaliveMaxMissed {
+				fail(fmt.Errorf("no keepalive reply for %s", time.Duration(missed)*interval))
+				return
+			}
+		}
+	}
+}
+
+// ConnectionLostError reports an SSH connection that dropped while a command was running
+type ConnectionLostError struct {
+	// Step is the last step the script announced before the connection dropped, if any
+	Step  string
+	After time.Duration
+	Err   error
+}
+
+func (e *ConnectionLostError) Error() string {
+	if e.Step != "" {
+		return fmt.Sprintf("connection lost at step %q after %s: %v", e.Step, e.After.Round(time.Second), e.Err)
+	}
+	return fmt.Sprintf("connection lost after %s: %v", e.After.Round(time.Second), e.Err)
+}
+
+func (e *ConnectionLostError) Unwrap() error {
+	return e.Err
+}
+
+// Errors returned for the commands of a cancelled job
+var (
+	errCommandCancelled   = errors.New("cancelled before the command started")
+	errCommandInterrupted = errors.New("cancelled; the command was killed before it finished")
+)
+
+// interruptGrace is how long a cancelled command gets to exit after SIGINT before it is killed
+const interruptGrace = 5 * time.Second
+
+// interruptOnCancel interrupts the session's command once ctx is cancelled: SIGINT first,
+// then SIGKILL and closing the session if it is still running after interruptGrace. Call
+// the returned stop once the command finished.
+func interruptOnCancel(ctx context.Context, session *ssh.Session) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		session.Signal(ssh.SIGINT)
+		select {
+		case <-done:
+		case <-time.After(interruptGrace):
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+		}
+	}()
+	return func() { close(done) }
+}
+
+// connectionLost wraps a mid-command transport error, preferring the keepalive's explanation
+func connectionLost(client *ssh.Client, step string, after time.Duration, err error) error {
+	if reason, ok := keepaliveFailures.LoadAndDelete(client); ok {
+		err = reason.(error)
+	}
+	return &ConnectionLostError{Step: step, After: after, Err: err}
+}
+
+// stepMarker prefixes the lines scripts print to announce their progress
+const stepMarker = "::accmgr-step::"
+
+// scriptStep returns a shell command announcing the next step of a script, so a dropped
+// connection can be reported as "connection lost at step X"
+func scriptStep(name string) string {
+	return "echo " + shellQuote(stepMarker+" "+name)
+}
+
+// numberedStep is scriptStep for step i, counted from 0, of a script with count steps, so
+// the job running it can report e.g. "step 3/7: apt-get install postgresql"
+func numberedStep(i, count int, name string) string {
+	return scriptStep(fmt.Sprintf("[%d/%d] %s", i+1, count, name))
+}
+
+// parseNumberedStep reads the position and name from a step line of numberedStep
+func parseNumberedStep(text string) (step, count int, name string, ok bool) {
+	position, name, found := strings.Cut(text, "] ")
+	if !found || !strings.HasPrefix(position, "[") {
+		return 0, 0, "", false
+	}
+	if _, err := fmt.Sscanf(position, "[%d/%d", &step, &count); err != nil || step < 1 || step > count {
+		return 0, 0, "", false
+	}
+	return step, count, name, true
+}
+
+// splitSteps removes step markers from output and returns the last step reached
+func splitSteps(output string) (string, string) {
+	if !strings.Contains(output, stepMarker) {
+		return output, ""
+	}
+	var clean strings.Builder
+	last := ""
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, stepMarker) {
+			last = strings.TrimSpace(strings.TrimPrefix(trimmed, stepMarker))
+			continue
+		}
+		clean.WriteString(line)
+	}
+	return clean.String(), last
+}
+
+// trackedMarker prefixes the lines tracked steps print when they start and finish
+const trackedMarker = "__ACCMGR_TRACKED__"
+
+// stepStatus is how far a tracked step got: not run, started but failed, or succeeded
+type stepStatus int
+
+const (
+	stepNotRun stepStatus = iota
+	stepFailed
+	stepPassed
+)
+
+// Marker returns the log status emoji for the step
+func (s stepStatus) Marker() string {
+	switch s {
+	case stepPassed:
+		return "✅"
+	case stepFailed:
+		return "❌"
+	}
+	return "⏭️"
+}
+
+// trackedCommand runs command number i of a script in a subshell between marker lines, so
+// parseTrackedOutput can tell which steps passed, which failed and which never ran
+func trackedCommand(i int, command string) string {
+	index := strconv.Itoa(i)
+	return "echo " + trackedMarker + " start " + index + " && ( " + command + " ) && echo " + trackedMarker + " ok " + index
+}
+
+// parseTrackedOutput removes the marker lines of trackedCommand from stdout and returns
+// the status of each of the count tracked steps
+func parseTrackedOutput(stdout string, count int) (string, []stepStatus) {
+	statuses := make([]stepStatus, count)
+	if !strings.Contains(stdout, trackedMarker) {
+		return stdout, statuses
+	}
+	var clean strings.Builder
+	for _, line := range strings.SplitAfter(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != trackedMarker {
+			clean.WriteString(line)
+			continue
+		}
+		i, err := strconv.Atoi(fields[2])
+		if err != nil || i < 0 || i >= count {
+			continue
+		}
+		if fields[1] == "ok" {
+			statuses[i] = stepPassed
+		} else if statuses[i] == stepNotRun {
+			statuses[i] = stepFailed
+		}
+	}
+	return clean.String(), statuses
+}
+
+// OutputLine is one line of live command output. Stream is "stdout", "stderr" or "step";
+// step lines carry the name a script announced with scriptStep.
+type OutputLine struct {
+	Stream string
+	Text   string
+}
+
+// liveOutput receives command output line by line while the command is still running
+type liveOutput func(OutputLine)
+
+// lineWriter splits a stream into lines for a liveOutput. clean, when set, tidies each line
+// first; a line it empties is dropped.
+type lineWriter struct {
+	mu      sync.Mutex
+	stream  string
+	live    liveOutput
+	clean   func(string) string
+	partial []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		l.emit(string(l.partial[:i]))
+		l.partial = l.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush emits a final line that had no trailing newline
+func (l *lineWriter) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.partial) > 0 {
+		l.emit(string(l.partial))
+		l.partial = nil
+	}
+}
+
+func (l *lineWriter) emit(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	if l.clean != nil {
+		cleaned := l.clean(line)
+		if cleaned == "" && line != "" {
+			return
+		}
+		line = cleaned
+	}
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, stepMarker) {
+		l.live(OutputLine{Stream: "step", Text: strings.TrimSpace(strings.TrimPrefix(trimmed, stepMarker))})
+		return
+	}
+	l.live(OutputLine{Stream: l.stream, Text: line})
+}
+
+// dialAgent connects to the local ssh-agent advertised by SSH_AUTH_SOCK
+func dialAgent() (net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("ssh-agent unavailable: SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent unavailable: %w", err)
+	}
+	return conn, nil
+}
+
+// keyFileSigner loads a server's private key, wrapped in its certificate when one is set.
+// An expired or not-yet-valid certificate is reported here rather than as a bare auth failure.
+func keyFileSigner(server ServerInfo) (ssh.Signer, error) {
+	pemBytes, err := os.ReadFile(server.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("key file %s is passphrase-protected; load it into ssh-agent instead", server.KeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing key file %s: %w", server.KeyFile, err)
+	}
+	if server.CertFile == "" {
+		return signer, nil
+	}
+
+	certBytes, err := os.ReadFile(server.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading certificate: %w", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate %s: %w", server.CertFile, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is a public key, not a certificate", server.CertFile)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%s is a host certificate, not a user certificate", server.CertFile)
+	}
+	now := uint64(time.Now().Unix())
+	if now < cert.ValidAfter {
+		return nil, fmt.Errorf("certificate %s is not valid until %s", server.CertFile, time.Unix(int64(cert.ValidAfter), 0).Format(time.RFC3339))
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore {
+		return nil, fmt.Errorf("certificate %s expired at %s", server.CertFile, time.Unix(int64(cert.ValidBefore), 0).Format(time.RFC3339))
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s was not issued for %s", server.CertFile, server.KeyFile)
+	}
+	return certSigner, nil
+}
+
+// maxCommandOutput caps each captured stream so a runaway command cannot exhaust memory
+const maxCommandOutput = 1 << 20
+
+// CommandResult is the outcome of a remote command that ran to completion
+type CommandResult struct {
+	ExitCode int
+	Duration time.Duration
+	Stdout   string
+	Stderr   string
+	// Truncated is set when a stream hit maxCommandOutput and the rest was dropped
+	Truncated bool
+}
+
+// OK reports whether the command exited with status 0
+func (r CommandResult) OK() bool {
+	return r.ExitCode == 0
+}
+
+// stderrPrefix marks stderr lines in combined output; the log page renders them distinctly
+const stderrPrefix = "[stderr] "
+
+// Output returns stdout followed by stderr, with each stderr line marked by stderrPrefix,
+// for log pages that show both together
+func (r CommandResult) Output() string {
+	out := r.Stdout
+	if r.Stderr != "" {
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(r.Stderr, "\n"), "\n") {
+			out += stderrPrefix + strings.TrimSuffix(line, "\n") + "\n"
+		}
+	}
+	if r.Truncated {
+		out += "\n[output truncated]\n"
+	}
+	return out
+}
+
+// Status describes the exit code and duration, e.g. "exit code 0 after 1.204s"
+func (r CommandResult) Status() string {
+	return fmt.Sprintf("exit code %d after %s", r.ExitCode, r.Duration.Round(time.Millisecond))
+}
+
+// commandError folds a transport failure or a non-zero exit into one error that carries the output
+func commandError(result CommandResult, err error) error {
+	output := strings.TrimSpace(strings.TrimSpace(result.Stdout) + "\n" + result.Stderr)
+	switch {
+	case err != nil && output != "":
+		return fmt.Errorf("%w: %s", err, output)
+	case err != nil:
+		return err
+	case !result.OK() && output != "":
+		return fmt.Errorf("%s: %s", result.Status(), output)
+	case !result.OK():
+		return errors.New(result.Status())
+	}
+	return nil
+}
+
+// writeCommandLog appends a command's output and outcome to a log page. It returns false
+// when the command never ran, so callers can skip updating local state.
+func writeCommandLog(logBuilder *strings.Builder, result CommandResult, err error) bool {
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+		logBuilder.WriteString(result.Output())
+		return false
+	}
+	logBuilder.WriteString(result.Output())
+	if result.OK() {
+		logBuilder.WriteString(fmt.Sprintf("\n✅ Script finished with %s\n", result.Status()))
+	} else {
+		logBuilder.WriteString(fmt.Sprintf("\n⚠️ Script finished with %s\n", result.Status()))
+	}
+	return true
+}
+
+// logLine is one line of a log page
+type logLine struct {
+	Text   string
+	Stderr bool
+	// Indent, Marker, Status and Label describe a leading status emoji such as ✅, so the
+	// page can style it and give screen readers a word instead of the emoji
+	Indent string
+	Marker string
+	Status string
+	Label  string
+}
+
+// logStatusMarkers are the status emoji log lines start with, and what they mean
+var logStatusMarkers = []struct {
+	marker, status, label string
+}{
+	{"✅", "success", "Success"},
+	{"❌", "error", "Error"},
+	{"⚠️", "warning", "Warning"},
+	{"⏭️", "skipped", "Skipped"},
+}
+
+// logLines splits log text into lines so the log page can style stderr apart from stdout
+// and label status markers
+func logLines(text string) []logLine {
+	var lines []logLine
+	for _, line := range strings.SplitAfter(text, "\n") {
+		var entry logLine
+		if rest, ok := strings.CutPrefix(line, stderrPrefix); ok {
+			entry = logLine{Text: rest, Stderr: true}
+		} else if line != "" {
+			entry = logLine{Text: line}
+		} else {
+			continue
+		}
+		trimmed := strings.TrimLeft(entry.Text, " ")
+		for _, status := range logStatusMarkers {
+			if rest, ok := strings.CutPrefix(trimmed, status.marker); ok {
+				entry.Indent = entry.Text[:len(entry.Text)-len(trimmed)]
+				entry.Marker, entry.Status, entry.Label = status.marker, status.status, status.label
+				entry.Text = rest
+				break
+			}
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+// cappedBuffer collects output up to a limit and silently drops the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.limit - c.buf.Len(); room < len(p) {
+		c.truncated = true
+		if room > 0 {
+			c.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+// exitCode separates a command's own exit status from transport failures
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	return -1, err
+}
+
+// runRemoteCommand executes a script on the server through "sh -s". It runs as the service
+// user when one is configured. The error is only set when the command could not run to
+// completion; a non-zero exit is reported in the result.
+func runRemoteCommand(ip string, server ServerInfo, script string) (CommandResult, error) {
+	return runRemoteCommandLive(context.Background(), ip, server, script, nil)
+}
+
+// runRemoteCommandLive is runRemoteCommand that also hands each output line to live as it
+// arrives. Cancelling ctx interrupts the command, e.g. when its job is cancelled.
+func runRemoteCommandLive(ctx context.Context, ip string, server ServerInfo, script string, live liveOutput) (CommandResult, error) {
+	return runLoginCommand(ctx, ip, server, script, live, true)
+}
+
+// runProbeCommand is runRemoteCommand without a session recording, for read-only checks
+// that background workers repeat on a schedule, such as health polls and drift detection
+func runProbeCommand(ip string, server ServerInfo, script string) (CommandResult, error) {
+	return runLoginCommand(context.Background(), ip, server, script, nil, false)
+}
+
+// runLoginCommand runs a script as the login user, recording the session when record is set
+func runLoginCommand(ctx context.Context, ip string, server ServerInfo, script string, live liveOutput, record bool) (CommandResult, error) {
+	if ctx.Err() != nil {
+		return CommandResult{ExitCode: -1}, errCommandCancelled
+	}
+	start := time.Now()
+	client, session, release, err := openSession(ip, loginAccount(server))
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	broken := false
+	defer func() { release(broken) }()
+	defer session.Close()
+
+	stdout := &cappedBuffer{limit: maxCommandOutput}
+	stderr := &cappedBuffer{limit: maxCommandOutput}
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if live != nil {
+		stdoutLines := &lineWriter{stream: "stdout", live: live}
+		stderrLines := &lineWriter{stream: "stderr", live: live}
+		session.Stdout = io.MultiWriter(stdout, stdoutLines)
+		session.Stderr = io.MultiWriter(stderr, stderrLines)
+		defer stdoutLines.flush()
+		defer stderrLines.flush()
+	}
+	var rec *sessionRecorder
+	if record {
+		rec = startCommandRecording(ip, loginAccount(server), script)
+		session.Stdout, session.Stderr = rec.tee(session.Stdout), rec.tee(session.Stderr)
+	}
+	session.Stdin = strings.NewReader(withServerEnv(server, script, effectiveSSHOptions(server).Env))
+	runErr := session.Start(loginShellCommand(server))
+	if runErr == nil {
+		stop := interruptOnCancel(ctx, session)
+		runErr = session.Wait()
+		stop()
+	}
+
+	result := CommandResult{
+		Duration:  time.Since(start),
+		Stderr:    stderr.buf.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	var step string
+	result.Stdout, step = splitSteps(stdout.buf.String())
+	if result.ExitCode, err = exitCode(runErr); err != nil {
+		if ctx.Err() != nil {
+			// The session was closed on purpose; the connection itself is fine
+			err = errCommandInterrupted
+		} else {
+			err = connectionLost(client, step, result.Duration, err)
+			broken = true
+		}
+	}
+	rec.close(recordingEnding(result, err))
+	return result, err
+}
+
+// loginShellCommand is the exec request that reads a script from stdin on the server
+func loginShellCommand(server ServerInfo) string {
+	if server.isWindows() {
+		return powerShellCommand
+	}
+	return "sh -s"
+}
+
+// recordingEnding is the final marker of a command recording
+func recordingEnding(result CommandResult, err error) string {
+	if err != nil {
+		return "connection lost: " + err.Error()
+	}
+	return fmt.Sprintf("exit %d", result.ExitCode)
+}
+
+// sudoPrompt is passed to sudo -p so the responder can tell the prompt apart from command output
+const sudoPrompt = "[accmgr-sudo-password]:"
+
+// sudoReady is printed by the shell sudo starts, so the responder knows sudo is done with
+// stdin and the script can follow
+const sudoReady = "[accmgr-sudo-ready]"
+
+// sudoShell is the command sudo runs: it announces itself and then reads the script from
+// stdin, so the script never shows up in the process list
+var sudoShell = "sh -c " + shellQuote("printf '%s\\n' '"+sudoReady+"' >&2; exec sh -s")
+
+// runPrivilegedCommand executes a script with root privileges. Root logins run it directly;
+// anyone else goes through sudo and the password is typed at sudo's prompt, so it never
+// appears in the command line, the process list or the log output.
+func runPrivilegedCommand(ip string, server ServerInfo, script string) (CommandResult, error) {
+	return runPrivilegedCommandLive(context.Background(), ip, server, script, nil)
+}
+
+// runPrivilegedCommandLive is runPrivilegedCommand that also hands each output line to live
+// as it arrives. Cancelling ctx interrupts the command, e.g. when its job is cancelled.
+func runPrivilegedCommandLive(ctx context.Context, ip string, server ServerInfo, script string, live liveOutput) (CommandResult, error) {
+	server = escalationAccount(server)
+	// OpenSSH for Windows gives administrator logins an elevated token, so there is no sudo step
+	if server.RootUsername == "root" || server.isWindows() {
+		return runRemoteCommandLive(ctx, ip, server, script, live)
+	}
+	if ctx.Err() != nil {
+		return CommandResult{ExitCode: -1}, errCommandCancelled
+	}
+
+	result, err := runSudo(ctx, ip, server, script, live)
+	if err == nil && !result.OK() && sudoNeedsTTY(result.Stderr) && ctx.Err() == nil {
+		// Hosts with "Defaults requiretty" refuse sudo without a terminal
+		return runSudoPTY(ctx, ip, server, script, live)
+	}
+	return result, err
+}
+
+// sudoNeedsTTY recognises sudo refusing to run without a terminal
+func sudoNeedsTTY(stderr string) bool {
+	return strings.Contains(stderr, "must have a tty") || strings.Contains(stderr, "a terminal is required")
+}
+
+// runSudo runs a script under "sudo -S" with separate stdout and stderr. sudo reads the
+// password from stdin at its prompt, and the script follows on stdin only once the shell
+// sudo started reports it is ready, so sudo never reads script lines as passwords and a
+// rejected password hits EOF.
+func runSudo(ctx context.Context, ip string, server ServerInfo, script string, live liveOutput) (CommandResult, error) {
+	start := time.Now()
+	client, session, release, err := openSession(ip, server)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	broken := false
+	defer func() { release(broken) }()
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	stdout := &cappedBuffer{limit: maxCommandOutput}
+	input := withEnv(script, effectiveSSHOptions(server).Env)
+	responder := &sudoResponder{password: server.RootPassword, stdin: stdin, script: input}
+	session.Stdout = stdout
+	session.Stderr = responder
+	if live != nil {
+		stdoutLines := &lineWriter{stream: "stdout", live: live}
+		stderrLines := &lineWriter{stream: "stderr", live: live, clean: responder.clean}
+		session.Stdout = io.MultiWriter(stdout, stdoutLines)
+		session.Stderr = io.MultiWriter(responder, stderrLines)
+		defer stdoutLines.flush()
+		defer stderrLines.flush()
+	}
+	rec := startCommandRecording(ip, server, script)
+	rec.mask(responder.clean)
+	session.Stdout, session.Stderr = rec.tee(session.Stdout), rec.tee(session.Stderr)
+
+	runErr := session.Start(sudoCommand())
+	if runErr == nil {
+		stop := interruptOnCancel(ctx, session)
+		runErr = session.Wait()
+		stop()
+	}
+
+	result := CommandResult{
+		Duration:  time.Since(start),
+		Stderr:    responder.output(),
+		Truncated: stdout.truncated,
+	}
+	if len(result.Stderr) > maxCommandOutput {
+		result.Stderr = result.Stderr[:maxCommandOutput]
+		result.Truncated = true
+	}
+	var step string
+	result.Stdout, step = splitSteps(stdout.buf.String())
+	if result.ExitCode, err = exitCode(runErr); err != nil {
+		if ctx.Err() != nil {
+			// The session was closed on purpose; the connection itself is fine
+			err = errCommandInterrupted
+		} else {
+			err = connectionLost(client, step, result.Duration, err)
+			broken = true
+		}
+	}
+	rec.close(recordingEnding(result, err))
+	return result, err
+}
+
+// sudoCommand is the exec request runSudo sends; sudo reads the password from stdin
+func sudoCommand() string {
+	return "sudo -S -p " + shellQuote(sudoPrompt) + " -- " + sudoShell
+}
+
+// sudoPTYCommand is the exec request runSudoPTY sends; sudo reads the password from the terminal
+func sudoPTYCommand() string {
+	return "sudo -p " + shellQuote(sudoPrompt) + " -- " + sudoShell
+}
+
+// runSudoPTY runs a script under sudo on a PTY for hosts that require a terminal. The script
+// is typed into the terminal once the password is answered and ends with an end-of-file.
+// The PTY merges both streams, so everything is reported as stdout.
+func runSudoPTY(ctx context.Context, ip string, server ServerInfo, script string, live liveOutput) (CommandResult, error) {
+	start := time.Now()
+	client, session, release, err := openSession(ip, server)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	broken := false
+	defer func() { release(broken) }()
+	defer session.Close()
+
+	// Echo is disabled so the typed password is not reflected back into the output
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("dumb", 40, 200, modes); err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	input := withEnv(script, effectiveSSHOptions(server).Env)
+	if !strings.HasSuffix(input, "\n") {
+		// The end-of-file only ends the input at the start of a line
+		input += "\n"
+	}
+	responder := &sudoResponder{password: server.RootPassword, stdin: stdin, script: input, terminal: true}
+	session.Stdout = responder
+	session.Stderr = responder
+	if live != nil {
+		lines := &lineWriter{stream: "stdout", live: live, clean: responder.clean}
+		session.Stdout = io.MultiWriter(responder, lines)
+		session.Stderr = session.Stdout
+		defer lines.flush()
+	}
+	rec := startCommandRecording(ip, server, script)
+	rec.mask(responder.clean)
+	session.Stdout = rec.tee(session.Stdout)
+	session.Stderr = session.Stdout
+
+	runErr := session.Start(sudoPTYCommand())
+	if runErr == nil {
+		stop := interruptOnCancel(ctx, session)
+		runErr = session.Wait()
+		stop()
+	}
+
+	result := CommandResult{Duration: time.Since(start)}
+	var step string
+	result.Stdout, step = splitSteps(responder.output())
+	if len(result.Stdout) > maxCommandOutput {
+		result.Stdout = result.Stdout[:maxCommandOutput]
+		result.Truncated = true
+	}
+	if result.ExitCode, err = exitCode(runErr); err != nil {
+		if ctx.Err() != nil {
+			// The session was closed on purpose; the connection itself is fine
+			err = errCommandInterrupted
+		} else {
+			err = connectionLost(client, step, result.Duration, err)
+			broken = true
+		}
+	}
+	rec.close(recordingEnding(result, err))
+	return result, err
+}
+
+// sudoResponder watches sudo's prompt stream, answers the password prompt once and sends
+// the script when the shell sudo started reports it is ready. A second prompt means the
+// password was rejected, so it ends stdin, after a Ctrl-C on a terminal, instead of letting
+// sudo wait for input forever.
+type sudoResponder struct {
+	mu       sync.Mutex
+	password string
+	script   string
+	terminal bool
+	stdin    interface {
+		Write([]byte) (int, error)
+		Close() error
+	}
+	buf      bytes.Buffer
+	scanned  int
+	answered bool
+	ready    bool
+}
+
+func (s *sudoResponder) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Write(p)
+	// Everything after the ready marker is the script's own output
+	for !s.ready {
+		rest := s.buf.Bytes()[s.scanned:]
+		prompt := bytes.Index(rest, []byte(sudoPrompt))
+		ready := bytes.Index(rest, []byte(sudoReady))
+		switch {
+		case ready >= 0 && (prompt < 0 || ready < prompt):
+			s.scanned += ready + len(sudoReady)
+			s.ready = true
+			s.sendScript()
+		case prompt >= 0:
+			s.scanned += prompt + len(sudoPrompt)
+			s.answer()
+		default:
+			// Keep enough overlap to catch a marker split across writes
+			s.scanned = max(s.scanned, s.buf.Len()-len(sudoPrompt)+1)
+			return len(p), nil
+		}
+	}
+	return len(p), nil
+}
+
+// answer types the password at the first prompt and gives up at the next
+func (s *sudoResponder) answer() {
+	if !s.answered {
+		s.answered = true
+		s.stdin.Write([]byte(s.password + "\n"))
+		return
+	}
+	if s.terminal {
+		s.stdin.Write([]byte{0x03})
+	}
+	s.stdin.Close()
+}
+
+// sendScript writes the script to stdin and ends it. It writes in the background, since the
+// script's output is read by the goroutine that called Write and a long script would
+// otherwise stall on its own output.
+func (s *sudoResponder) sendScript() {
+	stdin, script, terminal := s.stdin, s.script, s.terminal
+	go func() {
+		stdin.Write([]byte(script))
+		if terminal {
+			// Ctrl-D at the start of a line ends the terminal's input
+			stdin.Write([]byte{0x04})
+			return
+		}
+		stdin.Close()
+	}()
+}
+
+// clean removes the sudo prompt and ready marker and masks the password in one line of
+// output
+func (s *sudoResponder) clean(line string) string {
+	line = strings.ReplaceAll(strings.ReplaceAll(line, sudoPrompt, ""), sudoReady, "")
+	if s.password != "" {
+		line = strings.ReplaceAll(line, s.password, "********")
+	}
+	return line
+}
+
+// output returns everything written to the prompt stream, without sudo prompts, the ready
+// marker or PTY carriage returns. The password is masked in case the remote terminal
+// ignored the request to disable echo.
+func (s *sudoResponder) output() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := strings.ReplaceAll(s.buf.String(), "\r\n", "\n")
+	out = strings.Replace(out, sudoReady+"\n", "", 1)
+	out = strings.ReplaceAll(out, sudoPrompt, "")
+	if s.password != "" {
+		out = strings.ReplaceAll(out, s.password, "********")
+	}
+	return out
+}
+
+// shellQuote wraps a value in single quotes for safe use in a POSIX shell command
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
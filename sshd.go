@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// sshdRollbackWindow is how long the remote watchdog waits for us to reconnect before restoring the backup
+const sshdRollbackWindow = 60 * time.Second
+
+// SSHDSettings holds the fleet-wide sshd_config template and per-server overrides
+type SSHDSettings struct {
+	// Template is rendered with {{.IP}}, {{.Name}} and {{.Group}}
+	Template string `json:"template,omitempty"`
+	// Overrides maps a server IP to extra "Keyword value" directives that win over the template
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// renderSSHDConfig renders the template for a server and applies its overrides.
+// sshd uses the first value it reads for a keyword, so overrides go at the top and
+// the template's own copies of those keywords are dropped (outside Match blocks).
+func renderSSHDConfig(ip string, server ServerInfo) (string, error) {
+	if strings.TrimSpace(settings.SSHD.Template) == "" {
+		return "", fmt.Errorf("no sshd_config template configured")
+	}
+
+	tmpl, err := texttemplate.New("sshd_config").Option("missingkey=error").Parse(settings.SSHD.Template)
+	if err != nil {
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+	var rendered bytes.Buffer
+	data := map[string]string{"IP": ip, "Name": serverDisplayName(ip, server), "Group": server.Group}
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("rendering template: %w", err)
+	}
+
+	overridden := make(map[string]bool)
+	var overrideLines []string
+	for _, line := range strings.Split(settings.SSHD.Overrides[ip], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		overridden[strings.ToLower(strings.Fields(line)[0])] = true
+		overrideLines = append(overrideLines, line)
+	}
+
+	var out strings.Builder
+	out.WriteString("# Managed by accmgr4 - local edits will be overwritten\n")
+	if len(overrideLines) > 0 {
+		out.WriteString("# Overrides for " + ip + "\n")
+		out.WriteString(strings.Join(overrideLines, "\n") + "\n\n")
+	}
+
+	inMatch := false
+	for _, line := range strings.Split(rendered.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			keyword := strings.ToLower(fields[0])
+			if keyword == "match" {
+				inMatch = true
+			}
+			if !inMatch && overridden[keyword] {
+				continue
+			}
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String(), nil
+}
+
+// sshdApplyScript validates and installs the new config, arms the rollback watchdog and restarts sshd
+func sshdApplyScript(config, token string) string {
+	confirmFile := "/etc/ssh/.accmgr4-confirm-" + token
+	restart := "systemctl restart ssh 2>/dev/null || systemctl restart sshd 2>/dev/null || rc-service sshd restart 2>/dev/null || service ssh restart"
+
+	return fmt.Sprintf(`set -e
+SSHD=$(command -v sshd || echo /usr/sbin/sshd)
+cat > /etc/ssh/sshd_config.accmgr4-new <<'ACCMGR_EOF'
+%sACCMGR_EOF
+echo "Validating new configuration with sshd -t"
+"$SSHD" -t -f /etc/ssh/sshd_config.accmgr4-new || { rm -f /etc/ssh/sshd_config.accmgr4-new; exit 1; }
+cp -p /etc/ssh/sshd_config /etc/ssh/sshd_config.accmgr4-backup
+cat /etc/ssh/sshd_config.accmgr4-new > /etc/ssh/sshd_config
+rm -f /etc/ssh/sshd_config.accmgr4-new %s
+echo "Arming %d second rollback watchdog"
+nohup sh -c 'sleep %d; if [ ! -f %s ]; then cat /etc/ssh/sshd_config.accmgr4-backup > /etc/ssh/sshd_config; %s; fi; rm -f %s' >/dev/null 2>&1 &
+echo "Restarting sshd"
+%s
+`, config, confirmFile, int(sshdRollbackWindow.Seconds()), int(sshdRollbackWindow.Seconds()), confirmFile, restart, confirmFile, restart)
+}
+
+// confirmSSHDConfig reconnects through the new sshd and disarms the watchdog
+func confirmSSHDConfig(ip string, server ServerInfo, token string) error {
+	confirmFile := "/etc/ssh/.accmgr4-confirm-" + token
+	deadline := time.Now().Add(sshdRollbackWindow - 15*time.Second)
+
+	var lastErr error
+	for time.Now().Before(deadline) {
+		time.Sleep(3 * time.Second)
+		err := commandError(runPrivilegedCommand(ip, server, "touch "+confirmFile))
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// sshdHandler shows the fleet template and per-server overrides
+func sshdHandler(w http.ResponseWriter, r *http.Request) {
+	servers := requestServers(r)
+	var ips []string
+	for ip := range servers {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	data := map[string]interface{}{
+		"Template":  settings.SSHD.Template,
+		"Overrides": settings.SSHD.Overrides,
+		"IPs":       ips,
+		"Servers":   servers,
+	}
+
+	renderTemplate(w, r, "templates/sshd.html", data)
+}
+
+// saveSSHDTemplateHandler stores the fleet template or a server override
+func saveSSHDTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := strings.ReplaceAll(r.FormValue("content"), "\r\n", "\n")
+	if ip := strings.TrimSpace(r.FormValue("server_ip")); ip != "" {
+		if _, ok := lookupServer(ip); !ok {
+			http.Error(w, "Server not found", http.StatusNotFound)
+			return
+		}
+		if !serversAllowed(w, r, []string{ip}) {
+			return
+		}
+		if settings.SSHD.Overrides == nil {
+			settings.SSHD.Overrides = make(map[string]string)
+		}
+		if strings.TrimSpace(content) == "" {
+			delete(settings.SSHD.Overrides, ip)
+		} else {
+			settings.SSHD.Overrides[ip] = content
+		}
+	} else {
+		if _, err := texttemplate.New("sshd_config").Parse(content); err != nil {
+			http.Error(w, "❌ Invalid template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		settings.SSHD.Template = content
+	}
+
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/sshd"), http.StatusSeeOther)
+}
+
+// sshdPreviewHandler shows the rendered config for a server without touching it
+func sshdPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+
+	config, err := renderSSHDConfig(ip, server)
+	if err != nil {
+		config = "❌ " + err.Error()
+	}
+
+	renderTemplate(w, r, "templates/logs.html", "🔍 Rendered sshd_config for "+ip+"\n\n"+config)
+}
+
+// applySSHDConfigHandler deploys the rendered config with validation and automatic rollback
+func applySSHDConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "sshd_config management") {
+		return
+	}
+
+	if err := checkConfirmation(r, OpApplySSHDConfig, ip, server); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config, err := renderSSHDConfig(ip, server)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokenBytes := make([]byte, 8)
+	rand.Read(tokenBytes)
+	token := hex.EncodeToString(tokenBytes)
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString("🔐 Applying sshd_config to " + ip + "\n\n")
+
+	result, err := runPrivilegedCommand(ip, server, sshdApplyScript(config, token))
+	output := result.Output()
+	logBuilder.WriteString(output)
+	restarted := strings.Contains(output, "Restarting sshd")
+	switch {
+	case err == nil && !result.OK() && !restarted:
+		logBuilder.WriteString(fmt.Sprintf("\n❌ Validation or install failed with %s, nothing was changed\n", result.Status()))
+	case err != nil && !restarted:
+		logBuilder.WriteString(fmt.Sprintf("\n❌ Could not run the install script, nothing was changed: %v\n", err))
+	case err != nil:
+		// A restart can drop our own session, which is expected here
+		logBuilder.WriteString(fmt.Sprintf("\n⚠️ Session ended during restart: %v\n", err))
+	case !result.OK():
+		logBuilder.WriteString(fmt.Sprintf("\n⚠️ sshd restart reported %s\n", result.Status()))
+	}
+	if !restarted {
+		renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+		return
+	}
+
+	logBuilder.WriteString("\nReconnecting through the new sshd...\n")
+	if err := confirmSSHDConfig(ip, server, token); err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Could not reconnect: %v\n", err))
+		logBuilder.WriteString(fmt.Sprintf("⏪ The server will restore its previous sshd_config automatically %d seconds after the restart.\n", int(sshdRollbackWindow.Seconds())))
+	} else {
+		logBuilder.WriteString("✅ Reconnected; rollback watchdog disarmed. Backup kept at /etc/ssh/sshd_config.accmgr4-backup\n")
+	}
+
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
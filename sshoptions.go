@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHOptions overrides the algorithms and timeouts used with a server. Empty lists keep
+// the x/crypto defaults, zero durations inherit, and a nil EnableLegacy inherits from
+// the broader scope.
+type SSHOptions struct {
+	Ciphers           []string `json:"ciphers,omitempty"`
+	MACs              []string `json:"macs,omitempty"`
+	KeyExchanges      []string `json:"key_exchanges,omitempty"`
+	HostKeyAlgorithms []string `json:"host_key_algorithms,omitempty"`
+	EnableLegacy      *bool    `json:"enable_legacy,omitempty"`
+
+	// ConnectTimeoutSeconds bounds the TCP connect
+	ConnectTimeoutSeconds int `json:"connect_timeout_seconds,omitempty"`
+	// BannerTimeoutSeconds bounds the wait for the server banner and the rest of the handshake
+	BannerTimeoutSeconds int `json:"banner_timeout_seconds,omitempty"`
+	// KeepaliveIntervalSeconds sends keepalive@openssh.com requests on open connections.
+	// 0 inherits (default 15s) and keepaliveDisabled turns them off.
+	KeepaliveIntervalSeconds int `json:"keepalive_interval_seconds,omitempty"`
+
+	// Proxy is a socks5://, socks5h:// or http:// URL to tunnel through, or "direct" to bypass one
+	Proxy string `json:"proxy,omitempty"`
+
+	// Env is exported before every remote command. Narrower scopes override individual variables.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+const (
+	defaultConnectTimeout    = 10 * time.Second
+	defaultBannerTimeout     = 30 * time.Second
+	defaultKeepaliveInterval = 15 * time.Second
+
+	// keepaliveDisabled is stored when an operator enters 0 for the keepalive interval
+	keepaliveDisabled = -1
+)
+
+// connectTimeout returns the TCP connect timeout
+func (o SSHOptions) connectTimeout() time.Duration {
+	if o.ConnectTimeoutSeconds <= 0 {
+		return defaultConnectTimeout
+	}
+	return time.Duration(o.ConnectTimeoutSeconds) * time.Second
+}
+
+// bannerTimeout returns the handshake timeout
+func (o SSHOptions) bannerTimeout() time.Duration {
+	if o.BannerTimeoutSeconds <= 0 {
+		return defaultBannerTimeout
+	}
+	return time.Duration(o.BannerTimeoutSeconds) * time.Second
+}
+
+// keepaliveInterval returns the keepalive interval, or zero when keepalives are off
+func (o SSHOptions) keepaliveInterval() time.Duration {
+	if o.KeepaliveIntervalSeconds == keepaliveDisabled {
+		return 0
+	}
+	if o.KeepaliveIntervalSeconds <= 0 {
+		return defaultKeepaliveInterval
+	}
+	return time.Duration(o.KeepaliveIntervalSeconds) * time.Second
+}
+
+// GroupSettings holds configuration shared by every server in a group
+type GroupSettings struct {
+	SSH *SSHOptions `json:"ssh,omitempty"`
+}
+
+// legacyEnabled reports whether insecure algorithms should be offered
+func (o SSHOptions) legacyEnabled() bool {
+	return o.EnableLegacy != nil && *o.EnableLegacy
+}
+
+// merge layers a narrower scope on top of the receiver
+func (o SSHOptions) merge(override *SSHOptions) SSHOptions {
+	if override == nil {
+		return o
+	}
+	if len(override.Ciphers) > 0 {
+		o.Ciphers = override.Ciphers
+	}
+	if len(override.MACs) > 0 {
+		o.MACs = override.MACs
+	}
+	if len(override.KeyExchanges) > 0 {
+		o.KeyExchanges = override.KeyExchanges
+	}
+	if len(override.HostKeyAlgorithms) > 0 {
+		o.HostKeyAlgorithms = override.HostKeyAlgorithms
+	}
+	if override.EnableLegacy != nil {
+		o.EnableLegacy = override.EnableLegacy
+	}
+	if override.ConnectTimeoutSeconds > 0 {
+		o.ConnectTimeoutSeconds = override.ConnectTimeoutSeconds
+	}
+	if override.BannerTimeoutSeconds > 0 {
+		o.BannerTimeoutSeconds = override.BannerTimeoutSeconds
+	}
+	if override.KeepaliveIntervalSeconds != 0 {
+		o.KeepaliveIntervalSeconds = override.KeepaliveIntervalSeconds
+	}
+	if override.Proxy != "" {
+		o.Proxy = override.Proxy
+	}
+	o.Env = mergeEnv(o.Env, override.Env)
+	return o
+}
+
+// effectiveSSHOptions resolves global, group and server options in that order
+func effectiveSSHOptions(server ServerInfo) SSHOptions {
+	opts := settings.SSH
+	if group, ok := settings.Groups[server.Group]; ok && server.Group != "" {
+		opts = opts.merge(group.SSH)
+	}
+	return opts.merge(server.SSH)
+}
+
+// validate rejects algorithm names the SSH client does not implement
+func (o SSHOptions) validate() error {
+	supported := ssh.SupportedAlgorithms()
+	insecure := ssh.InsecureAlgorithms()
+
+	checks := []struct {
+		kind  string
+		names []string
+		known []string
+	}{
+		{"cipher", o.Ciphers, append(supported.Ciphers, insecure.Ciphers...)},
+		{"MAC", o.MACs, append(supported.MACs, insecure.MACs...)},
+		{"key exchange", o.KeyExchanges, append(supported.KeyExchanges, insecure.KeyExchanges...)},
+		{"host key algorithm", o.HostKeyAlgorithms, append(supported.HostKeys, insecure.HostKeys...)},
+	}
+	for _, check := range checks {
+		for _, name := range check.names {
+			if !slices.Contains(check.known, name) {
+				return fmt.Errorf("unsupported %s: %s", check.kind, name)
+			}
+		}
+	}
+	_, err := o.proxyURL()
+	return err
+}
+
+// splitList splits a comma or whitespace separated list of names. A blank value
+// returns nil, which x/crypto treats as "use the defaults" where an empty slice
+// would offer no algorithms at all.
+func splitList(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// sshScopeView is the form state for one scope on the SSH settings page
+type sshScopeView struct {
+	Scope             string
+	Target            string
+	Title             string
+	Ciphers           string
+	MACs              string
+	KeyExchanges      string
+	HostKeyAlgorithms string
+	Legacy            string
+	UseAgent          bool
+	KeyFile           string
+	CertFile          string
+	Platform          string
+	Tags              string
+	RunAsUser         string
+	RunAsEscalation   string
+	RunAsHasPassword  bool
+	ConnectTimeout    string
+	BannerTimeout     string
+	KeepaliveInterval string
+	Proxy             string
+	Env               string
+}
+
+// newSSHScopeView flattens SSH options into form values
+func newSSHScopeView(scope, target, title string, opts *SSHOptions) sshScopeView {
+	view := sshScopeView{Scope: scope, Target: target, Title: title, Legacy: "inherit"}
+	if opts == nil {
+		return view
+	}
+	view.Ciphers = strings.Join(opts.Ciphers, ", ")
+	view.MACs = strings.Join(opts.MACs, ", ")
+	view.KeyExchanges = strings.Join(opts.KeyExchanges, ", ")
+	view.HostKeyAlgorithms = strings.Join(opts.HostKeyAlgorithms, ", ")
+	view.ConnectTimeout = secondsField(opts.ConnectTimeoutSeconds)
+	view.BannerTimeout = secondsField(opts.BannerTimeoutSeconds)
+	view.KeepaliveInterval = secondsField(opts.KeepaliveIntervalSeconds)
+	if opts.KeepaliveIntervalSeconds == keepaliveDisabled {
+		view.KeepaliveInterval = "0"
+	}
+	view.Proxy = opts.Proxy
+	view.Env = formatEnvAssignments(opts.Env)
+	if opts.EnableLegacy != nil {
+		if *opts.EnableLegacy {
+			view.Legacy = "on"
+		} else {
+			view.Legacy = "off"
+		}
+	}
+	return view
+}
+
+// secondsField renders a duration setting, leaving inherited values blank
+func secondsField(seconds int) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return strconv.Itoa(seconds)
+}
+
+// parseSecondsField reads a duration setting; blank means inherit
+func parseSecondsField(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid number of seconds: %q", value)
+	}
+	return seconds, nil
+}
+
+// sshSettingsHandler displays SSH options for every scope
+func sshSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	groupNames := make(map[string]bool)
+	for name := range settings.Groups {
+		groupNames[name] = true
+	}
+	// Groups referenced by servers but not yet configured are listed too
+	snapshot := serversSnapshot()
+	for _, server := range snapshot {
+		if server.Group != "" {
+			groupNames[server.Group] = true
+		}
+	}
+
+	var groups []sshScopeView
+	for _, name := range slices.Sorted(maps.Keys(groupNames)) {
+		groups = append(groups, newSSHScopeView("group", name, name, settings.Groups[name].SSH))
+	}
+
+	var servers []sshScopeView
+	for _, ip := range slices.Sorted(maps.Keys(snapshot)) {
+		server := snapshot[ip]
+		title := ip
+		if server.Name != "" {
+			title += " (" + server.Name + ")"
+		}
+		if server.Group != "" {
+			title += " — group " + server.Group
+		}
+		view := newSSHScopeView("server", ip, title, server.SSH)
+		view.UseAgent = server.UseAgent
+		view.KeyFile = server.KeyFile
+		view.CertFile = server.CertFile
+		view.Platform = server.Platform
+		view.Tags = strings.Join(server.Tags, ", ")
+		if server.RunAs != nil {
+			view.RunAsUser = server.RunAs.Username
+			view.RunAsEscalation = server.RunAs.Escalation
+			view.RunAsHasPassword = server.RunAs.Password != ""
+		}
+		servers = append(servers, view)
+	}
+
+	global := settings.SSH
+	data := map[string]interface{}{
+		"Global":    newSSHScopeView("global", "", "Global", &global),
+		"Groups":    groups,
+		"Servers":   servers,
+		"Supported": ssh.SupportedAlgorithms(),
+		"Insecure":  ssh.InsecureAlgorithms(),
+	}
+
+	renderTemplate(w, r, "templates/ssh_settings.html", data)
+}
+
+// updateSSHSettingsHandler saves SSH options for the global, group or server scope
+func updateSSHSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts := SSHOptions{
+		Ciphers:           splitList(r.FormValue("ciphers")),
+		MACs:              splitList(r.FormValue("macs")),
+		KeyExchanges:      splitList(r.FormValue("key_exchanges")),
+		HostKeyAlgorithms: splitList(r.FormValue("host_key_algorithms")),
+		Proxy:             strings.TrimSpace(r.FormValue("proxy")),
+	}
+	switch r.FormValue("legacy") {
+	case "on":
+		enabled := true
+		opts.EnableLegacy = &enabled
+	case "off":
+		disabled := false
+		opts.EnableLegacy = &disabled
+	}
+
+	var err error
+	if opts.ConnectTimeoutSeconds, err = parseSecondsField(r.FormValue("connect_timeout")); err != nil {
+		http.Error(w, "❌ Connect timeout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.BannerTimeoutSeconds, err = parseSecondsField(r.FormValue("banner_timeout")); err != nil {
+		http.Error(w, "❌ Banner timeout: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Env, err = parseEnvAssignments(r.FormValue("env")); err != nil {
+		http.Error(w, "❌ Environment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.KeepaliveIntervalSeconds, err = parseSecondsField(r.FormValue("keepalive_interval")); err != nil {
+		http.Error(w, "❌ Keepalive interval: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(r.FormValue("keepalive_interval")) == "0" {
+		opts.KeepaliveIntervalSeconds = keepaliveDisabled
+	}
+
+	if err := opts.validate(); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scope := strings.TrimSpace(r.FormValue("scope"))
+	target := strings.TrimSpace(r.FormValue("target"))
+
+	switch scope {
+	case "global":
+		settings.SSH = opts
+	case "group":
+		if target == "" {
+			http.Error(w, "Group name is required", http.StatusBadRequest)
+			return
+		}
+		if settings.Groups == nil {
+			settings.Groups = make(map[string]GroupSettings)
+		}
+		group := settings.Groups[target]
+		group.SSH = &opts
+		settings.Groups[target] = group
+	case "server":
+		server, ok := lookupServer(target)
+		if !ok {
+			http.Error(w, "Server not found", http.StatusNotFound)
+			return
+		}
+		if !serversAllowed(w, r, []string{target}) {
+			return
+		}
+		server.SSH = &opts
+		server.UseAgent = r.FormValue("use_agent") == "on"
+		server.KeyFile = strings.TrimSpace(r.FormValue("key_file"))
+		server.CertFile = strings.TrimSpace(r.FormValue("cert_file"))
+		server.Tags = splitList(r.FormValue("tags"))
+		server.Platform = ""
+		if r.FormValue("platform") == platformWindows {
+			server.Platform = platformWindows
+		}
+		if server.CertFile != "" && server.KeyFile == "" {
+			http.Error(w, "❌ A certificate needs the private key file it was issued for", http.StatusBadRequest)
+			return
+		}
+		if username := strings.TrimSpace(r.FormValue("run_as_user")); username == "" {
+			server.RunAs = nil
+		} else {
+			runAs := RunAsUser{Username: username, Escalation: r.FormValue("run_as_escalation")}
+			// A blank password keeps the stored one for the same user
+			if password := r.FormValue("run_as_password"); password != "" {
+				runAs.Password = password
+			} else if server.RunAs != nil && server.RunAs.Username == username {
+				runAs.Password = server.RunAs.Password
+			}
+			if runAs.Escalation != "sudo" {
+				runAs.Escalation = "admin"
+			}
+			server.RunAs = &runAs
+		}
+		setServer(target, server)
+	default:
+		http.Error(w, "Invalid scope", http.StatusBadRequest)
+		return
+	}
+
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/ssh-settings"), http.StatusSeeOther)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// syncRoot is the local directory syncs push from; their local directories are relative to it
+var syncRoot = "sync"
+
+// SyncResult lists what a directory sync changed, by path relative to the sync root
+type SyncResult struct {
+	Uploaded  []string
+	Deleted   []string
+	Unchanged int
+	Skipped   []string // local entries that are not regular files, such as symlinks
+	Bytes     int64
+}
+
+// localSyncFile is a regular file found under the local sync root
+type localSyncFile struct {
+	path   string
+	mode   os.FileMode
+	sha256 string
+}
+
+// scanLocalTree hashes every regular file under root, keyed by slash-separated relative path
+func scanLocalTree(root string) (map[string]localSyncFile, []string, error) {
+	files := make(map[string]localSyncFile)
+	var skipped []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			skipped = append(skipped, rel)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		files[rel] = localSyncFile{path: p, mode: info.Mode().Perm(), sha256: sum}
+		return nil
+	})
+	return files, skipped, err
+}
+
+// fileSHA256 returns the hex SHA-256 of a local file
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// remoteChecksums hashes every regular file under remoteDir on the server in one command.
+// A missing directory is an empty tree, since the sync will create it.
+func remoteChecksums(ip string, server ServerInfo, remoteDir string) (map[string]string, error) {
+	script := "[ -d " + shellQuote(remoteDir) + " ] || exit 0\n" +
+		"cd " + shellQuote(remoteDir) + " && find . -type f -exec sha256sum {} +\n"
+	result, err := runRemoteCommand(ip, server, script)
+	if err := commandError(result, err); err != nil {
+		return nil, fmt.Errorf("listing %s: %w", remoteDir, err)
+	}
+
+	sums := make(map[string]string)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		sum, name, ok := strings.Cut(strings.TrimSpace(line), "  ")
+		if !ok {
+			continue
+		}
+		sums[strings.TrimPrefix(name, "./")] = sum
+	}
+	return sums, nil
+}
+
+// syncDirectory pushes localDir to remoteDir over SFTP, uploading only files whose checksum
+// differs. With deleteExtraneous, remote files that no longer exist locally are removed too.
+// progress, when set, is told about each file as it is transferred.
+func syncDirectory(ip string, server ServerInfo, localDir, remoteDir string, deleteExtraneous bool, progress func(string)) (SyncResult, error) {
+	var result SyncResult
+	local, skipped, err := scanLocalTree(localDir)
+	if err != nil {
+		return result, fmt.Errorf("reading %s: %w", localDir, err)
+	}
+	result.Skipped = skipped
+
+	remote, err := remoteChecksums(ip, server, remoteDir)
+	if err != nil {
+		return result, err
+	}
+
+	var uploads []string
+	for rel, file := range local {
+		if remote[rel] == file.sha256 {
+			result.Unchanged++
+			continue
+		}
+		uploads = append(uploads, rel)
+	}
+	sort.Strings(uploads)
+
+	var deletes []string
+	if deleteExtraneous {
+		for rel := range remote {
+			if _, ok := local[rel]; !ok {
+				deletes = append(deletes, rel)
+			}
+		}
+		sort.Strings(deletes)
+	}
+
+	err = withSFTP(ip, server, func(client *sftp.Client) error {
+		if err := client.MkdirAll(remoteDir); err != nil {
+			return fmt.Errorf("creating %s: %w", remoteDir, err)
+		}
+		for _, rel := range uploads {
+			if progress != nil {
+				progress("upload " + rel)
+			}
+			written, err := syncUpload(client, local[rel], path.Join(remoteDir, rel))
+			if err != nil {
+				return err
+			}
+			result.Uploaded = append(result.Uploaded, rel)
+			result.Bytes += written
+		}
+
+		emptied := make(map[string]bool)
+		for _, rel := range deletes {
+			if progress != nil {
+				progress("delete " + rel)
+			}
+			if err := client.Remove(path.Join(remoteDir, rel)); err != nil {
+				return fmt.Errorf("deleting %s: %w", rel, err)
+			}
+			result.Deleted = append(result.Deleted, rel)
+			for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+				emptied[dir] = true
+			}
+		}
+		// Deepest first; directories that still hold files refuse removal, which is fine
+		dirs := slices.Sorted(maps.Keys(emptied))
+		slices.Reverse(dirs)
+		for _, dir := range dirs {
+			client.RemoveDirectory(path.Join(remoteDir, dir))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// syncUpload writes one local file to remotePath with the local permission bits
+func syncUpload(client *sftp.Client, file localSyncFile, remotePath string) (int64, error) {
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return 0, fmt.Errorf("creating %s: %w", path.Dir(remotePath), err)
+	}
+	src, err := os.Open(file.path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, fmt.Errorf("opening %s: %w", remotePath, err)
+	}
+	defer dst.Close()
+
+	written, err := io.Copy(dst, src)
+	if err != nil {
+		return written, fmt.Errorf("writing %s: %w", remotePath, err)
+	}
+	return written, dst.Chmod(file.mode)
+}
+
+// syncLocalDir resolves the local directory of a sync, a path relative to syncRoot, and
+// refuses one leaving the root with .. or through a symlink
+func syncLocalDir(dir string) (string, error) {
+	if filepath.IsAbs(dir) {
+		return "", fmt.Errorf("local directory %s must be relative to the sync root", dir)
+	}
+	root, err := filepath.Abs(syncRoot)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", fmt.Errorf("sync root %s: %w", syncRoot, err)
+	}
+	target := filepath.Join(root, dir)
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("local directory %s is outside the sync root", dir)
+	}
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return "", fmt.Errorf("local directory not found: %s", dir)
+	}
+	if resolved != target {
+		return "", fmt.Errorf("local directory %s goes through a symlink", dir)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("local directory not found: %s", dir)
+	}
+	return resolved, nil
+}
+
+// syncDirectoryHandler runs a directory sync from the file transfer page
+func syncDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+	if !linuxOnly(w, server, "Directory sync") {
+		return
+	}
+	localDir := strings.TrimSpace(r.FormValue("local_dir"))
+	remoteDir := strings.TrimRight(strings.TrimSpace(r.FormValue("remote_dir")), "/")
+	if localDir == "" || remoteDir == "" {
+		http.Error(w, "Local and remote directories are required", http.StatusBadRequest)
+		return
+	}
+	if !path.IsAbs(remoteDir) {
+		http.Error(w, "Remote directory must be an absolute path", http.StatusBadRequest)
+		return
+	}
+	localPath, err := syncLocalDir(localDir)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	deleteExtraneous := r.FormValue("delete_extraneous") == "on"
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString("🔄 Directory Sync\n\n")
+	logBuilder.WriteString("Server: " + ip + "\n")
+	logBuilder.WriteString("Local: " + localDir + "\n")
+	logBuilder.WriteString("Remote: " + remoteDir + "\n")
+	if deleteExtraneous {
+		logBuilder.WriteString("Extraneous remote files will be deleted\n")
+	}
+	logBuilder.WriteString("\n")
+
+	job := startJob("sync", ip, "Sync "+localDir+" to "+remoteDir)
+	result, err := syncDirectory(ip, server, localPath, remoteDir, deleteExtraneous, job.progress)
+	job.finish(err)
+
+	for _, rel := range result.Uploaded {
+		logBuilder.WriteString("⬆️ " + rel + "\n")
+	}
+	for _, rel := range result.Deleted {
+		logBuilder.WriteString("🗑️ " + rel + "\n")
+	}
+	for _, rel := range result.Skipped {
+		logBuilder.WriteString("⏭️ " + rel + " (not a regular file)\n")
+	}
+	if err != nil {
+		logBuilder.WriteString("\n❌ Sync failed: " + err.Error() + "\n")
+	} else {
+		logBuilder.WriteString(fmt.Sprintf("\n✅ %d uploaded (%d bytes), %d deleted, %d unchanged\n",
+			len(result.Uploaded), result.Bytes, len(result.Deleted), result.Unchanged))
+	}
+
+	renderTemplate(w, r, "templates/logs.html", logBuilder.String())
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/websocket"
+)
+
+// terminalMessage is a control or input frame sent by the browser terminal
+type terminalMessage struct {
+	Type string `json:"type"` // "input" or "resize"
+	Data string `json:"data,omitempty"`
+	Cols int    `json:"cols,omitempty"`
+	Rows int    `json:"rows,omitempty"`
+}
+
+// terminalHandler renders the browser terminal page for a server
+func terminalHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.FormValue("ip"))
+	server, ok := lookupServer(ip)
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, []string{ip}) {
+		return
+	}
+
+	data := map[string]interface{}{
+		"IP":   ip,
+		"Name": serverDisplayName(ip, server),
+		"User": server.RootUsername,
+	}
+
+	renderTemplate(w, r, "templates/terminal.html", data)
+}
+
+// terminalSocket bridges a browser WebSocket to an interactive PTY shell on the server
+var terminalSocket = websocket.Server{
+	// Only accept connections opened by our own pages, since this hands out a shell
+	Handshake: func(config *websocket.Config, r *http.Request) error {
+		origin, err := url.Parse(r.Header.Get("Origin"))
+		if err != nil || origin.Host != r.Host {
+			return fmt.Errorf("cross-origin terminal request rejected")
+		}
+		return nil
+	},
+	Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		ip := strings.TrimSpace(ws.Request().FormValue("ip"))
+		server, ok := lookupServer(ip)
+		if !ok {
+			websocket.Message.Send(ws, "❌ Server not found\r\n")
+			return
+		}
+		if !serverInScope(requestScope(ws.Request()), serversSnapshot(), ip) {
+			websocket.Message.Send(ws, "❌ "+requestOperator(ws.Request())+" may not access server "+ip+"\r\n")
+			return
+		}
+
+		if err := runTerminalSession(ws, ip, server); err != nil {
+			websocket.Message.Send(ws, fmt.Sprintf("\r\n❌ %v\r\n", err))
+		}
+	},
+}
+
+// runTerminalSession opens the PTY shell and copies data in both directions until either side closes
+func runTerminalSession(ws *websocket.Conn, ip string, server ServerInfo) error {
+	client, err := dialServer(ip, loginAccount(server))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	// Only output is recorded: keystrokes include passwords typed at prompts that do not echo
+	rec := startRecording("terminal", ip, loginAccount(server).RootUsername+"@"+ip+": interactive shell", 80, 24, false)
+	defer rec.close("session closed")
+	output := rec.tee(websocketWriter{ws})
+	session.Stdout = output
+	session.Stderr = output
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm-256color", 24, 80, modes); err != nil {
+		return fmt.Errorf("requesting pty: %w", err)
+	}
+	if err := session.Shell(); err != nil {
+		return fmt.Errorf("starting shell: %w", err)
+	}
+
+	// Browser → shell; closing the socket ends the session
+	go func() {
+		defer session.Close()
+		for {
+			var raw string
+			if err := websocket.Message.Receive(ws, &raw); err != nil {
+				return
+			}
+			var msg terminalMessage
+			if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				stdin.Write([]byte(msg.Data))
+			case "resize":
+				if msg.Cols > 0 && msg.Rows > 0 {
+					session.WindowChange(msg.Rows, msg.Cols)
+					rec.resize(msg.Cols, msg.Rows)
+				}
+			}
+		}
+	}()
+
+	session.Wait()
+	return nil
+}
+
+// websocketWriter sends shell output to the browser as binary frames
+type websocketWriter struct {
+	ws *websocket.Conn
+}
+
+func (w websocketWriter) Write(p []byte) (int, error) {
+	if err := websocket.Message.Send(w.ws, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
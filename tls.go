@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// The web UI carries the servers' credentials, so it can serve HTTPS itself: with a
+// certificate and key from files, or with certificates Let's Encrypt issues and renews for
+// the configured hostnames over ACME. A second, plain HTTP listener can send browsers on to
+// HTTPS; with ACME it also answers the HTTP-01 challenges.
+
+var (
+	// listenAddr is where the web UI and the API are served
+	listenAddr = ":8080"
+	// tlsCertFile and tlsKeyFile are a PEM certificate, with any intermediates, and its key
+	tlsCertFile, tlsKeyFile string
+	// acmeHosts are the hostnames to get certificates for from Let's Encrypt, comma-separated
+	acmeHosts string
+	// acmeEmail is the contact address given to Let's Encrypt for expiry notices
+	acmeEmail string
+	// acmeCache is the directory the ACME account key and certificates are kept in
+	acmeCache = "acme-cache"
+	// redirectAddr, when set, serves plain HTTP that redirects to the HTTPS listener
+	redirectAddr string
+)
+
+// hstsMaxAge is how long browsers keep to HTTPS once they saw it, in seconds
+const hstsMaxAge = 180 * 24 * 60 * 60
+
+// tlsEnabled reports whether the web UI is served over HTTPS
+func tlsEnabled() bool {
+	return tlsCertFile != "" || acmeHosts != ""
+}
+
+// validateTLSFlags checks the HTTPS flags before anything is served
+func validateTLSFlags() error {
+	switch {
+	case (tlsCertFile == "") != (tlsKeyFile == ""):
+		return errors.New("-tls-cert and -tls-key must be given together")
+	case tlsCertFile != "" && acmeHosts != "":
+		return errors.New("use either -tls-cert and -tls-key or -acme-host, not both")
+	case redirectAddr != "" && !tlsEnabled():
+		return errors.New("-http-redirect needs HTTPS; set -tls-cert and -tls-key or -acme-host")
+	}
+	if tlsCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile); err != nil {
+			return fmt.Errorf("loading the TLS certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// serveWeb serves the web UI on listenAddr, over HTTPS when it is configured, and returns
+// once the listener fails
+func serveWeb(handler http.Handler) error {
+	if !tlsEnabled() {
+		return http.ListenAndServe(listenAddr, handler)
+	}
+	server := &http.Server{Addr: listenAddr, Handler: withHSTS(handler)}
+	redirect := withIPAllowlist(redirectToHTTPS())
+	if acmeHosts != "" {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(splitList(acmeHosts)...),
+			Cache:      autocert.DirCache(acmeCache),
+			Email:      acmeEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		// ACME challenges come from Let's Encrypt, so they are answered before the allowlist
+		redirect = manager.HTTPHandler(redirect)
+	}
+	if redirectAddr != "" {
+		superviseWorker("http-redirect", func() {
+			if err := http.ListenAndServe(redirectAddr, redirect); err != nil {
+				fmt.Println("❌ HTTP redirect listener:", err)
+			}
+		})
+	}
+	return server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+}
+
+// withHSTS tells browsers to use HTTPS for the app's host from now on
+func withHSTS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", hstsMaxAge))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same path on the HTTPS listener
+func redirectToHTTPS() http.Handler {
+	_, port, _ := net.SplitHostPort(listenAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && port != "443" {
+			host += ":" + port
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
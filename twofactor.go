@@ -0,0 +1,375 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Users can add a second factor to their password: a TOTP authenticator app, enrolled by
+// scanning a QR code, with single-use recovery codes for a lost phone. Signing in then asks
+// for a code after the password. Admins can require it for roles; users of those roles who
+// have not enrolled can only enroll until they do. HTTP Basic authentication cannot carry a
+// code, so users with a second factor use API tokens for scripts instead.
+
+const (
+	// totpStep is how long a TOTP code is valid, and totpSkew how many steps either side of
+	// the current one are accepted for clock drift
+	totpStep = 30 * time.Second
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+	// loginChallengeTTL is how long the code may take after the password was accepted
+	loginChallengeTTL = 5 * time.Minute
+)
+
+// loginChallenge is a sign-in whose password was accepted and that waits for a code
+type loginChallenge struct {
+	user    string
+	next    string
+	expires time.Time
+}
+
+var (
+	totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	twoFactorMu sync.Mutex
+	// loginChallenges maps challenge tokens to the sign-ins waiting for a code
+	loginChallenges = make(map[string]loginChallenge)
+	// pendingTOTP are the secrets shown for enrollment, until the user confirms a code
+	pendingTOTP = make(map[string]string)
+	// lastTOTPStep is the step of each user's last accepted code, so a code works once
+	lastTOTPStep = make(map[string]int64)
+)
+
+// totpCode returns the TOTP code of the secret for a time step (RFC 6238, SHA-1, 6 digits)
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
+
+// checkTOTP reports whether code is the secret's code at now, give or take totpSkew steps,
+// and returns its step
+func checkTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	current := now.Unix() / int64(totpStep/time.Second)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newTOTPSecret returns a random 160-bit TOTP secret in base32
+func newTOTPSecret() string {
+	key := make([]byte, 20)
+	rand.Read(key)
+	return totpEncoding.EncodeToString(key)
+}
+
+// newRecoveryCodes returns fresh recovery codes and the hashes they are kept as
+func newRecoveryCodes() ([]string, []string) {
+	var codes, hashes []string
+	for range recoveryCodeCount {
+		raw := make([]byte, 5)
+		rand.Read(raw)
+		code := hex.EncodeToString(raw)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// hashRecoveryCode returns the hash a recovery code is kept as
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// twoFactorEnabled reports whether the user signs in with a second factor
+func twoFactorEnabled(name string) bool {
+	user, ok := webUser(name)
+	return ok && user.TOTPSecret != ""
+}
+
+// twoFactorRequired reports whether the user's role must sign in with a second factor.
+// Single sign-on users get theirs from the provider.
+func twoFactorRequired(name string) bool {
+	if user, ok := webUser(name); ok && user.Provider == oidcProvider {
+		return false
+	}
+	return slices.Contains(twoFactorRoles(), userRole(name))
+}
+
+// twoFactorRoles returns the roles that must sign in with a second factor
+func twoFactorRoles() []string {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return settings.TwoFactorRoles
+}
+
+// verifySecondFactor checks a TOTP or recovery code of the user, using up the code. A
+// recovery code is removed from the user's, which saves the settings.
+func verifySecondFactor(name, code string) bool {
+	user, ok := webUser(name)
+	if !ok || user.TOTPSecret == "" {
+		return false
+	}
+	if step, ok := checkTOTP(user.TOTPSecret, code, time.Now()); ok {
+		twoFactorMu.Lock()
+		defer twoFactorMu.Unlock()
+		if step <= lastTOTPStep[name] {
+			return false
+		}
+		lastTOTPStep[name] = step
+		return true
+	}
+	hash := hashRecoveryCode(code)
+	if !slices.Contains(user.RecoveryCodes, hash) {
+		return false
+	}
+	used, left := false, 0
+	updateWebUser(name, func(user *WebUser) {
+		if i := slices.Index(user.RecoveryCodes, hash); i >= 0 {
+			user.RecoveryCodes = slices.Delete(slices.Clone(user.RecoveryCodes), i, i+1)
+			used, left = true, len(user.RecoveryCodes)
+		}
+	})
+	if used {
+		fmt.Printf("🔑 %s signed in with a recovery code; %d left\n", name, left)
+	}
+	return used
+}
+
+// startLoginChallenge holds a sign-in whose password was accepted until its code arrives
+func startLoginChallenge(user, next string) string {
+	token := newSessionToken()
+	now := time.Now()
+	twoFactorMu.Lock()
+	for existing, challenge := range loginChallenges {
+		if now.After(challenge.expires) {
+			delete(loginChallenges, existing)
+		}
+	}
+	loginChallenges[token] = loginChallenge{user: user, next: next, expires: now.Add(loginChallengeTTL)}
+	twoFactorMu.Unlock()
+	return token
+}
+
+// takeLoginChallenge returns the sign-in waiting under token, keeping it for another try
+func takeLoginChallenge(token string) (loginChallenge, bool) {
+	twoFactorMu.Lock()
+	defer twoFactorMu.Unlock()
+	challenge, ok := loginChallenges[token]
+	if !ok || time.Now().After(challenge.expires) {
+		delete(loginChallenges, token)
+		return loginChallenge{}, false
+	}
+	return challenge, true
+}
+
+// endLoginChallenge forgets a sign-in that got its code
+func endLoginChallenge(token string) {
+	twoFactorMu.Lock()
+	delete(loginChallenges, token)
+	twoFactorMu.Unlock()
+}
+
+// twoFactorHandler shows the signed-in user's second factor, or the QR code to enroll one
+func twoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	renderTwoFactor(w, r, nil)
+}
+
+// renderTwoFactor renders the second factor page, with just generated recovery codes shown
+// once
+func renderTwoFactor(w http.ResponseWriter, r *http.Request, recoveryCodes []string) {
+	name := requestOperator(r)
+	user, ok := webUser(name)
+	if !ok {
+		http.Error(w, "❌ A second factor belongs to a web UI user; sign in as one", http.StatusForbidden)
+		return
+	}
+	if user.Provider == oidcProvider {
+		http.Error(w, "❌ You sign in with single sign-on; set up a second factor with the provider", http.StatusConflict)
+		return
+	}
+	data := map[string]interface{}{
+		"User":          name,
+		"Enabled":       user.TOTPSecret != "",
+		"Required":      twoFactorRequired(name),
+		"RecoveryLeft":  len(user.RecoveryCodes),
+		"RecoveryCodes": recoveryCodes,
+	}
+	if user.TOTPSecret == "" {
+		twoFactorMu.Lock()
+		secret, ok := pendingTOTP[name]
+		if !ok {
+			secret = newTOTPSecret()
+			pendingTOTP[name] = secret
+		}
+		twoFactorMu.Unlock()
+		data["Secret"] = secret
+		data["URI"] = "otpauth://totp/" + url.PathEscape("accmgr4:"+name) + "?" + url.Values{
+			"secret": {secret}, "issuer": {"accmgr4"}, "period": {"30"}, "digits": {"6"},
+		}.Encode()
+	}
+	renderTemplate(w, r, "templates/twofactor.html", data)
+}
+
+// enableTwoFactorHandler enrolls the secret shown to the user once they confirm a code from
+// it, and shows their recovery codes
+func enableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := requestOperator(r)
+	user, ok := webUser(name)
+	twoFactorMu.Lock()
+	secret := pendingTOTP[name]
+	twoFactorMu.Unlock()
+	switch {
+	case !ok:
+		http.Error(w, "❌ A second factor belongs to a web UI user; sign in as one", http.StatusForbidden)
+		return
+	case user.TOTPSecret != "":
+		http.Error(w, "❌ A second factor is already enrolled", http.StatusConflict)
+		return
+	case secret == "":
+		http.Error(w, "❌ Open the two-factor page again to get a secret", http.StatusConflict)
+		return
+	}
+	step, valid := checkTOTP(secret, r.FormValue("code"), time.Now())
+	if !valid {
+		http.Error(w, "❌ The code does not match; check the authenticator app's clock and try again", http.StatusBadRequest)
+		return
+	}
+	codes, hashes := newRecoveryCodes()
+	if err := updateWebUser(name, func(user *WebUser) { user.TOTPSecret, user.RecoveryCodes = secret, hashes }); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	twoFactorMu.Lock()
+	delete(pendingTOTP, name)
+	lastTOTPStep[name] = step
+	twoFactorMu.Unlock()
+	fmt.Printf("🔑 %s enrolled a second factor\n", name)
+	renderTwoFactor(w, r, codes)
+}
+
+// disableTwoFactorHandler removes the user's second factor after a current code, unless
+// their role requires one
+func disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := requestOperator(r)
+	if twoFactorRequired(name) {
+		http.Error(w, "❌ Your role requires a second factor", http.StatusForbidden)
+		return
+	}
+	if !verifySecondFactor(name, r.FormValue("code")) {
+		http.Error(w, "❌ The code does not match", http.StatusBadRequest)
+		return
+	}
+	if err := updateWebUser(name, func(user *WebUser) { user.TOTPSecret, user.RecoveryCodes = "", nil }); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("🔑 %s removed their second factor\n", name)
+	http.Redirect(w, r, appPath(r, "/two-factor"), http.StatusSeeOther)
+}
+
+// regenerateRecoveryCodesHandler replaces the user's recovery codes after a current code
+func regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := requestOperator(r)
+	if !verifySecondFactor(name, r.FormValue("code")) {
+		http.Error(w, "❌ The code does not match", http.StatusBadRequest)
+		return
+	}
+	codes, hashes := newRecoveryCodes()
+	if err := updateWebUser(name, func(user *WebUser) { user.RecoveryCodes = hashes }); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderTwoFactor(w, r, codes)
+}
+
+// resetTwoFactorHandler removes a user's second factor for an admin, e.g. after a lost
+// phone with no recovery codes left; the user enrolls again at the next sign-in when their
+// role requires it
+func resetTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.FormValue("name")
+	err := updateWebUser(name, func(user *WebUser) { user.TOTPSecret, user.RecoveryCodes = "", nil })
+	if errors.Is(err, errUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	endSessions(name)
+	fmt.Printf("🔑 %s reset the second factor of %s\n", requestOperator(r), name)
+	http.Redirect(w, r, appPath(r, "/web-users"), http.StatusSeeOther)
+}
+
+// saveTwoFactorPolicyHandler sets the roles that must sign in with a second factor
+func saveTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	var required []string
+	for _, role := range r.Form["role"] {
+		if !slices.Contains(roles, role) {
+			http.Error(w, "❌ Unknown role "+role, http.StatusBadRequest)
+			return
+		}
+		required = append(required, role)
+	}
+	usersMu.Lock()
+	settings.TwoFactorRoles = required
+	usersMu.Unlock()
+	if err := saveSettings(); err != nil {
+		http.Error(w, "❌ Saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, appPath(r, "/web-users"), http.StatusSeeOther)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Linux installation backends for software selections
+const (
+	// backendNative installs with the server's package manager
+	backendNative = "native"
+	// backendSnap and backendFlatpak install universal packages, bootstrapping snapd or
+	// flatpak with the package manager first when they are missing
+	backendSnap    = "snap"
+	backendFlatpak = "flatpak"
+)
+
+// flathubRepo is the remote flatpak installs from, added when missing
+const flathubRepo = "https://dl.flathub.org/repo/flathub.flatpakrepo"
+
+var (
+	// snapNamePattern matches snap names such as code or kubectl
+	snapNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	// snapChannelPattern matches channels such as stable, 1.30/stable or latest/edge
+	snapChannelPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	// flatpakIDPattern matches reverse-DNS application IDs such as org.gimp.GIMP
+	flatpakIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)+$`)
+)
+
+// parseSnapSpec splits "name" or "name=channel" and validates both parts
+func parseSnapSpec(spec string) (string, string, error) {
+	name, channel, _ := strings.Cut(spec, "=")
+	if !snapNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid snap name %q", name)
+	}
+	if channel != "" && !snapChannelPattern.MatchString(channel) {
+		return "", "", fmt.Errorf("invalid snap channel %q", channel)
+	}
+	return name, channel, nil
+}
+
+// validateFlatpakID checks a flatpak application ID
+func validateFlatpakID(id string) error {
+	if !flatpakIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid flatpak application ID %q", id)
+	}
+	return nil
+}
+
+// snapBootstrap installs and starts snapd when the snap command is missing, then waits
+// until snapd can install snaps. The /snap link lets classic snaps run on Fedora and RHEL.
+func snapBootstrap(manager PackageManager, verbosity string) string {
+	return "if ! command -v snap >/dev/null 2>&1; then " +
+		manager.Update(verbosity) + " && " + manager.Install([]string{"snapd"}, verbosity) + " && " +
+		"{ systemctl enable --now snapd.socket || true; } && " +
+		"{ [ -e /snap ] || ln -s /var/lib/snapd/snap /snap; }; fi && " +
+		"snap wait system seed.loaded"
+}
+
+// flatpakBootstrap installs flatpak when it is missing and adds the Flathub remote
+func flatpakBootstrap(manager PackageManager, verbosity string) string {
+	return "if ! command -v flatpak >/dev/null 2>&1; then " +
+		manager.Update(verbosity) + " && " + manager.Install([]string{"flatpak"}, verbosity) + "; fi && " +
+		"flatpak remote-add --if-not-exists flathub " + flathubRepo
+}
+
+// snapInstall installs one snap; the channel, when set, pins its track and risk
+func snapInstall(selection softwareSelection) string {
+	command := "snap install " + shellQuote(selection.Snap)
+	if selection.SnapClassic {
+		command += " --classic"
+	}
+	if selection.Version != "" {
+		command += " --channel=" + shellQuote(selection.Version)
+	}
+	return command
+}
+
+// snapRemove removes snaps; purge skips the snapshot snapd otherwise keeps of their data
+func snapRemove(names []string, purge bool) string {
+	command := "snap remove"
+	if purge {
+		command += " --purge"
+	}
+	return command + " " + quotedPackages(names)
+}
+
+// flatpakVerbosity returns flatpak's flag for the verbosity; it has no quiet mode
+func flatpakVerbosity(verbosity string) string {
+	if verbosity == verbosityDebug {
+		return "-v "
+	}
+	return ""
+}
+
+// flatpakInstall installs applications from Flathub system-wide
+func flatpakInstall(ids []string, verbosity string) string {
+	return "flatpak install -y --noninteractive " + flatpakVerbosity(verbosity) + "flathub " + quotedPackages(ids)
+}
+
+// flatpakRemove uninstalls applications; purge also deletes their user data
+func flatpakRemove(ids []string, purge bool, verbosity string) string {
+	command := "flatpak uninstall -y --noninteractive " + flatpakVerbosity(verbosity)
+	if purge {
+		command += "--delete-data "
+	}
+	return command + quotedPackages(ids)
+}
+
+// softwareStep is one command of an install or removal and the step name the log shows
+type softwareStep struct {
+	Name    string
+	Command string
+}
+
+// linuxSoftwareSteps returns the steps that install or remove the selections on a Linux
+// server: one package manager transaction for native packages, then package files from
+// URLs, snaps, flatpaks, pip, npm and gem packages and Compose apps, bootstrapping their tooling first for installs
+func linuxSoftwareSteps(manager PackageManager, selections []softwareSelection, uninstall, purge bool, verbosity string) ([]softwareStep, error) {
+	var native, upgrades, repositories, snaps, flatpaks []string
+	var snapSelections, apps, files []softwareSelection
+	language := make(map[string][]softwareSelection)
+	for _, selection := range selections {
+		switch selection.Backend {
+		case backendPip, backendNpm, backendGem:
+			language[selection.Backend] = append(language[selection.Backend], selection)
+		case backendCompose:
+			apps = append(apps, selection)
+		case backendURL:
+			files = append(files, selection)
+		case backendSnap:
+			snaps = append(snaps, selection.Snap)
+			snapSelections = append(snapSelections, selection)
+		case backendFlatpak:
+			flatpaks = append(flatpaks, selection.Flatpak)
+		default:
+			for _, spec := range selection.Packages {
+				if !slices.Contains(native, spec) {
+					native = append(native, spec)
+				}
+			}
+			for _, name := range selection.Upgrades {
+				if !slices.Contains(upgrades, name) {
+					upgrades = append(upgrades, name)
+				}
+			}
+			for _, name := range selection.Repositories {
+				if !slices.Contains(repositories, name) {
+					repositories = append(repositories, name)
+				}
+			}
+		}
+	}
+	if len(native)+len(upgrades)+len(snaps)+len(flatpaks)+len(language)+len(apps)+len(files) == 0 {
+		return nil, errors.New("the selected software has no Linux package, snap, flatpak, language package, compose file or package URL")
+	}
+	if len(files) > 0 && uninstall {
+		return nil, errPackageFileRemove
+	}
+
+	var steps []softwareStep
+	add := func(name, command string) {
+		if name == "" {
+			name = command
+		}
+		steps = append(steps, softwareStep{Name: name, Command: command})
+	}
+	// Hooks only run for installs; pre-install hooks go before any repository is added
+	var hooks []softwareHook
+	if !uninstall {
+		hooks = softwareHooks(selections)
+	}
+	for i, hook := range hooks {
+		if hook.Stage == "pre-install" {
+			steps = append(steps, hookStep(i, hook))
+		}
+	}
+	if len(native) > 0 || len(upgrades) > 0 {
+		// Removal ignores versions; installs translate them for the manager
+		if uninstall {
+			names := make([]string, len(native))
+			for i, spec := range native {
+				names[i], _, _ = strings.Cut(spec, "=")
+			}
+			add("", manager.Remove(names, purge, verbosity))
+		} else {
+			pinnedArgs, err := pinnedPackages(manager, native)
+			if err != nil {
+				return nil, err
+			}
+			// Third-party repositories come first so the update below indexes them
+			for _, name := range repositories {
+				repository, ok := findRepository(name)
+				if !ok {
+					return nil, fmt.Errorf("repository %s not found; add it on the repositories page", name)
+				}
+				command, err := addRepositoryScript(manager, repository, verbosity)
+				if err != nil {
+					return nil, err
+				}
+				add("add repository "+name, command)
+			}
+			add(manager.Name()+" update", manager.Update(verbosity))
+			if len(native) > 0 {
+				add("", manager.Install(pinnedArgs, verbosity))
+			}
+			if len(upgrades) > 0 {
+				add("", manager.UpgradePackages(upgrades, verbosity))
+			}
+		}
+	}
+	if len(files) > 0 {
+		// The files' dependencies come from the repositories, so the index must be current
+		if len(native) == 0 && len(upgrades) == 0 {
+			add(manager.Name()+" update", manager.Update(verbosity))
+		}
+		add("ensure curl is installed", curlBootstrap(manager, verbosity))
+		for _, selection := range files {
+			command, err := packageFileInstall(manager, selection, verbosity)
+			if err != nil {
+				return nil, err
+			}
+			add("download and install "+selection.Name, command)
+		}
+	}
+	if len(snaps) > 0 {
+		if uninstall {
+			add("", snapRemove(snaps, purge))
+		} else {
+			add("ensure snapd is installed", snapBootstrap(manager, verbosity))
+			for _, selection := range snapSelections {
+				add("", snapInstall(selection))
+			}
+		}
+	}
+	if len(flatpaks) > 0 {
+		if uninstall {
+			add("", flatpakRemove(flatpaks, purge, verbosity))
+		} else {
+			add("ensure flatpak and Flathub are set up", flatpakBootstrap(manager, verbosity))
+			add("", flatpakInstall(flatpaks, verbosity))
+		}
+	}
+	for _, backend := range languageBackends {
+		packages := language[backend]
+		if len(packages) == 0 {
+			continue
+		}
+		if uninstall {
+			var names []string
+			for _, selection := range packages {
+				names = append(names, selection.LanguagePackage)
+			}
+			add("", languageRemove(backend, names, verbosity))
+			continue
+		}
+		bootstrap, err := languageBootstrap(backend, manager, verbosity)
+		if err != nil {
+			return nil, err
+		}
+		add("ensure "+languageCommands[backend]+" is installed", bootstrap)
+		for _, selection := range packages {
+			add("", languageInstall(selection, verbosity))
+		}
+	}
+	if len(apps) > 0 {
+		if uninstall {
+			for _, app := range apps {
+				add("", composeDown(app, purge))
+			}
+		} else {
+			bootstrap, err := composeBootstrap(manager, verbosity)
+			if err != nil {
+				return nil, err
+			}
+			add("ensure Docker Compose is installed", bootstrap)
+			for _, app := range apps {
+				add("write "+composeDir(app.Name)+"/compose.yaml", composeWrite(app))
+				add("", composeUp(app))
+			}
+		}
+	}
+	for i, hook := range hooks {
+		if hook.Stage == "post-install" || hook.Stage == "verify" {
+			steps = append(steps, hookStep(i, hook))
+		}
+	}
+	return steps, nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerState is the package set and enabled services of a server at one point in time
+type ServerState struct {
+	CapturedAt time.Time `json:"captured_at"`
+	Packages   []string  `json:"packages"`
+	Services   []string  `json:"services"`
+}
+
+// ManagedBaseline is a server's state right after the last change accmgr4 made to it
+type ManagedBaseline struct {
+	ServerState
+	// Cause describes the change that produced the baseline, e.g. a job description
+	Cause string `json:"cause"`
+}
+
+// UnmanagedChanges lists what changed on a server since its baseline without accmgr4
+type UnmanagedChanges struct {
+	IP              string
+	CheckedAt       time.Time
+	Baseline        ManagedBaseline
+	AddedPackages   []string
+	RemovedPackages []string
+	AddedServices   []string
+	RemovedServices []string
+	Error           string
+	// current is the state the report was computed from, adopted when changes are accepted
+	current ServerState
+}
+
+// Changed reports whether anything differs from the baseline
+func (c UnmanagedChanges) Changed() bool {
+	return len(c.AddedPackages)+len(c.RemovedPackages)+len(c.AddedServices)+len(c.RemovedServices) > 0
+}
+
+// summary describes the changes in one line for alerts
+func (c UnmanagedChanges) summary() string {
+	var parts []string
+	for _, part := range []struct {
+		label string
+		items []string
+	}{
+		{"packages added", c.AddedPackages},
+		{"packages removed", c.RemovedPackages},
+		{"services enabled", c.AddedServices},
+		{"services disabled", c.RemovedServices},
+	} {
+		if len(part.items) > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", len(part.items), part.label))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// listServicesScript prints every service enabled at boot, on systemd or OpenRC
+const listServicesScript = `if command -v systemctl >/dev/null 2>&1; then
+  systemctl list-unit-files --type=service --state=enabled --no-legend 2>/dev/null | awk '{print $1}'
+elif command -v rc-update >/dev/null 2>&1; then
+  rc-update show default 2>/dev/null | awk '{print $1}'
+fi
+exit 0
+`
+
+// baselinesFile stores the per-server baselines across restarts
+const baselinesFile = "baselines.json"
+
+var (
+	baselinesMu sync.Mutex
+	baselines   = make(map[string]ManagedBaseline)
+
+	unmanagedMu     sync.RWMutex
+	unmanagedReport = make(map[string]UnmanagedChanges)
+	// lastUnmanagedRun is when the report worker last finished a round
+	lastUnmanagedRun time.Time
+)
+
+// unmanagedCheckInterval returns how often servers are compared with their baselines,
+// defaulting to six hours
+func (h HealthSettings) unmanagedCheckInterval() time.Duration {
+	if h.UnmanagedCheckIntervalSeconds <= 0 {
+		return 6 * time.Hour
+	}
+	return time.Duration(h.UnmanagedCheckIntervalSeconds) * time.Second
+}
+
+// loadBaselines reads baselines.json; a missing file means no server has a baseline yet
+func loadBaselines() error {
+	file, err := os.Open(baselinesFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	baselinesMu.Lock()
+	defer baselinesMu.Unlock()
+	return json.NewDecoder(file).Decode(&baselines)
+}
+
+// saveBaselines writes baselines.json; callers hold baselinesMu
+func saveBaselines() error {
+	file, err := os.Create(baselinesFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(baselines)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+// captureServerState lists the installed packages and enabled services of a Linux server
+func captureServerState(ip string, server ServerInfo) (ServerState, error) {
+	state := ServerState{CapturedAt: time.Now()}
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		return state, err
+	}
+	result, err := runProbeCommand(ip, server, manager.List())
+	if err := commandError(result, err); err != nil {
+		return state, fmt.Errorf("listing packages: %w", err)
+	}
+	state.Packages = sortedFields(result.Stdout)
+
+	result, err = runProbeCommand(ip, server, listServicesScript)
+	if err := commandError(result, err); err != nil {
+		return state, fmt.Errorf("listing services: %w", err)
+	}
+	state.Services = sortedFields(result.Stdout)
+	return state, nil
+}
+
+// sortedFields splits command output into a sorted list without duplicates
+func sortedFields(output string) []string {
+	fields := strings.Fields(output)
+	sort.Strings(fields)
+	return slices.Compact(fields)
+}
+
+// setBaseline stores a server's baseline, persists it and marks the server clean in the report
+func setBaseline(ip string, state ServerState, cause string) ManagedBaseline {
+	baseline := ManagedBaseline{ServerState: state, Cause: cause}
+	baselinesMu.Lock()
+	baselines[ip] = baseline
+	if err := saveBaselines(); err != nil {
+		fmt.Println("❌ Saving baselines:", err)
+	}
+	baselinesMu.Unlock()
+
+	unmanagedMu.Lock()
+	unmanagedReport[ip] = UnmanagedChanges{IP: ip, CheckedAt: state.CapturedAt, Baseline: baseline, current: state}
+	unmanagedMu.Unlock()
+	clearAlert("unmanaged:" + ip)
+	return baseline
+}
+
+// recordManagedChange re-captures a server's baseline in the background after accmgr4
+// changed it, so the change is not reported as unmanaged
+func recordManagedChange(ip, cause string) {
+	server, ok := serversSnapshot()[ip]
+	if !ok || server.isWindows() {
+		return
+	}
+	go func() {
+		defer catchWorkerPanic("unmanaged-changes")
+		state, err := captureServerState(ip, server)
+		if err != nil {
+			fmt.Printf("⚠️ Could not record the baseline for %s after %s: %v\n", ip, cause, err)
+			return
+		}
+		setBaseline(ip, state, cause)
+	}()
+}
+
+// diffSorted returns the entries only in a and the entries only in b; both are sorted
+func diffSorted(a, b []string) (onlyA, onlyB []string) {
+	for _, item := range a {
+		if _, found := slices.BinarySearch(b, item); !found {
+			onlyA = append(onlyA, item)
+		}
+	}
+	for _, item := range b {
+		if _, found := slices.BinarySearch(a, item); !found {
+			onlyB = append(onlyB, item)
+		}
+	}
+	return onlyA, onlyB
+}
+
+// checkUnmanagedChanges compares a server with its baseline. A server without one gets its
+// current state as the first baseline.
+func checkUnmanagedChanges(ip string, server ServerInfo) UnmanagedChanges {
+	changes := UnmanagedChanges{IP: ip, CheckedAt: time.Now()}
+	state, err := captureServerState(ip, server)
+	if err != nil {
+		changes.Error = err.Error()
+		return changes
+	}
+	changes.current = state
+
+	baselinesMu.Lock()
+	baseline, ok := baselines[ip]
+	baselinesMu.Unlock()
+	if !ok {
+		changes.Baseline = setBaseline(ip, state, "first inventory")
+		return changes
+	}
+	changes.Baseline = baseline
+	changes.RemovedPackages, changes.AddedPackages = diffSorted(baseline.Packages, state.Packages)
+	changes.RemovedServices, changes.AddedServices = diffSorted(baseline.Services, state.Services)
+	return changes
+}
+
+// runUnmanagedChangeReport compares every Linux server with its baseline on the configured
+// interval and alerts on changes made outside accmgr4.
+// It runs under superviseWorker, which restarts it if it panics.
+func runUnmanagedChangeReport() {
+	for {
+		reportUnmanagedChanges()
+		time.Sleep(settings.Health.unmanagedCheckInterval())
+	}
+}
+
+// reportUnmanagedChanges checks every Linux server in parallel and replaces the report
+func reportUnmanagedChanges() {
+	servers := serversSnapshot()
+	fanOut(linuxServerIPs(servers), func(i int, ip string) {
+		defer catchWorkerPanic("unmanaged-changes")
+		changes := checkUnmanagedChanges(ip, servers[ip])
+
+		unmanagedMu.Lock()
+		unmanagedReport[ip] = changes
+		unmanagedMu.Unlock()
+
+		alertKey := "unmanaged:" + ip
+		switch {
+		case changes.Changed():
+			raiseAlert(alertKey, ip, "warning", "Changes made outside accmgr4: "+changes.summary())
+		case changes.Error == "":
+			clearAlert(alertKey)
+		}
+	})
+
+	unmanagedMu.Lock()
+	lastUnmanagedRun = time.Now()
+	unmanagedMu.Unlock()
+}
+
+// unmanagedChangesHandler shows the latest report, servers with changes first
+func unmanagedChangesHandler(w http.ResponseWriter, r *http.Request) {
+	servers := requestServers(r)
+	unmanagedMu.RLock()
+	report := make([]UnmanagedChanges, 0, len(unmanagedReport))
+	for ip, changes := range unmanagedReport {
+		if _, ok := servers[ip]; ok {
+			report = append(report, changes)
+		}
+	}
+	ranAt := lastUnmanagedRun
+	unmanagedMu.RUnlock()
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Changed() != report[j].Changed() {
+			return report[i].Changed()
+		}
+		return report[i].IP < report[j].IP
+	})
+
+	renderTemplate(w, r, "templates/unmanaged.html", map[string]interface{}{
+		"Report": report,
+		"RanAt":  ranAt,
+	})
+}
+
+// runUnmanagedReportHandler runs the report now instead of waiting for the next round
+func runUnmanagedReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reportUnmanagedChanges()
+	http.Redirect(w, r, appPath(r, "/unmanaged-changes"), http.StatusSeeOther)
+}
+
+// acceptUnmanagedChangesHandler adopts a server's reported state as its new baseline, for
+// changes an operator has reviewed and wants to keep
+func acceptUnmanagedChangesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := r.FormValue("server_ip")
+	unmanagedMu.RLock()
+	changes, ok := unmanagedReport[ip]
+	unmanagedMu.RUnlock()
+	if !ok || changes.Error != "" {
+		http.Error(w, "No report for this server", http.StatusNotFound)
+		return
+	}
+	setBaseline(ip, changes.current, "accepted unmanaged changes")
+	http.Redirect(w, r, appPath(r, "/unmanaged-changes"), http.StatusSeeOther)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Markers the upgrade script prints with the number of pending upgrades before and after
+const (
+	pendingMarker   = "__ACCMGR_PENDING__="
+	remainingMarker = "__ACCMGR_REMAINING__="
+)
+
+// UpgradeResult is the outcome of upgrading every package on one server
+type UpgradeResult struct {
+	IP      string
+	Manager string
+	// Pending is how many packages had upgrades available and Remaining how many still do
+	// afterwards; both are -1 when the script stopped before counting
+	Pending   int
+	Remaining int
+	Result    CommandResult
+	Err       error
+}
+
+// Upgraded is how many packages the run upgraded, or -1 when unknown
+func (u UpgradeResult) Upgraded() int {
+	if u.Pending < 0 || u.Remaining < 0 {
+		return -1
+	}
+	return max(u.Pending-u.Remaining, 0)
+}
+
+// OK reports whether the upgrade ran and exited successfully
+func (u UpgradeResult) OK() bool {
+	return u.Err == nil && u.Result.OK()
+}
+
+// upgradeScript refreshes the index, counts pending upgrades, runs upgrade and counts again,
+// printing the counts with pendingMarker and remainingMarker. upgradable lists the upgrades
+// that upgrade applies, one per line.
+func upgradeScript(manager PackageManager, upgrade, upgradable, verbosity string) string {
+	var script strings.Builder
+	script.WriteString(numberedStep(0, 2, manager.Name()+" update") + " && " + manager.Update(verbosity) + " && ")
+	script.WriteString("echo " + pendingMarker + "$(" + upgradable + " | wc -l) && ")
+	script.WriteString(numberedStep(1, 2, upgrade) + " && " + upgrade + " && ")
+	script.WriteString("echo " + remainingMarker + "$(" + upgradable + " | wc -l)")
+	return script.String()
+}
+
+// splitUpgradeCounts removes the count markers from stdout and returns the counts, -1 for
+// a marker that was not printed
+func splitUpgradeCounts(stdout string) (string, int, int) {
+	pending, remaining := -1, -1
+	var clean strings.Builder
+	for _, line := range strings.SplitAfter(stdout, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if value, ok := strings.CutPrefix(trimmed, pendingMarker); ok {
+			pending, _ = strconv.Atoi(strings.TrimSpace(value))
+			continue
+		}
+		if value, ok := strings.CutPrefix(trimmed, remainingMarker); ok {
+			remaining, _ = strconv.Atoi(strings.TrimSpace(value))
+			continue
+		}
+		clean.WriteString(line)
+	}
+	return clean.String(), pending, remaining
+}
+
+// upgradeServer upgrades every package on a Linux server as its own job of the given
+// priority, or only those with security updates when security is set. A zero timeout keeps
+// the default time limit.
+func upgradeServer(ip string, server ServerInfo, security bool, verbosity, operator string, timeout time.Duration, priority string) UpgradeResult {
+	upgrade := UpgradeResult{IP: ip, Pending: -1, Remaining: -1}
+	server, err := operatorServer(server, operator)
+	if err != nil {
+		upgrade.Err = err
+		return upgrade
+	}
+	manager, err := detectPackageManager(ip, server)
+	if err != nil {
+		upgrade.Err = err
+		return upgrade
+	}
+	upgrade.Manager = manager.Name()
+
+	command, upgradable := manager.Upgrade(verbosity), manager.Upgradable()
+	description := "Upgrade all packages with " + manager.Name()
+	if security {
+		if command, upgradable, err = securityCommands(manager, verbosity); err != nil {
+			upgrade.Err = err
+			return upgrade
+		}
+		description = "Apply security updates with " + manager.Name()
+	}
+	job := startPriorityJob(operator, "upgrade", ip, description, priority)
+	job.setTimeout(timeout)
+	script := tracedScript(upgradeScript(manager, command, upgradable, verbosity), verbosity, false)
+	result, err := runPrivilegedCommandLive(job.context(), ip, server, operatorScript(server, script, operator, job.ID), job.output)
+	result.Stdout, upgrade.Pending, upgrade.Remaining = splitUpgradeCounts(result.Stdout)
+	if err == nil && result.OK() && upgrade.Upgraded() >= 0 {
+		job.progress(fmt.Sprintf("%d packages upgraded", upgrade.Upgraded()))
+	}
+	job.finishCommand(result, err)
+	upgrade.Result, upgrade.Err = result, err
+	return upgrade
+}
+
+// upgradeTargets returns the servers an upgrade request names: one server by IP or every
+// server in a group
+func upgradeTargets(ip, group string) map[string]ServerInfo {
+	targets := make(map[string]ServerInfo)
+	for candidate, server := range serversSnapshot() {
+		if (ip != "" && candidate == ip) || (group != "" && server.Group == group) {
+			targets[candidate] = server
+		}
+	}
+	return targets
+}
+
+// upgradePackagesHandler upgrades every package on one server or on every server in a
+// group, in parallel, and summarizes how many packages each server upgraded
+func upgradePackagesHandler(w http.ResponseWriter, r *http.Request) {
+	runUpgrades(w, r, false)
+}
+
+// runUpgrades serves upgradePackagesHandler and securityUpdatesHandler, which differ only in
+// whether every package or only those with security updates are upgraded
+func runUpgrades(w http.ResponseWriter, r *http.Request, security bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	group := strings.TrimSpace(r.FormValue("group"))
+	if (ip == "") == (group == "") {
+		http.Error(w, "Choose either a server or a group", http.StatusBadRequest)
+		return
+	}
+	timeout, err := parseJobTimeout(r.FormValue("timeout"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	priority, err := parseJobPriority(r.FormValue("priority"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	targets := upgradeTargets(ip, group)
+	if len(targets) == 0 {
+		http.Error(w, "No matching servers", http.StatusNotFound)
+		return
+	}
+	if !serversAllowed(w, r, slices.Collect(maps.Keys(targets))) {
+		return
+	}
+	// The upgrade jobs show up on the jobs page as they start
+	submitted(r, "/jobs")
+	report := upgradeTargetsReport(ip, group, targets, security, parseVerbosity(r.FormValue("verbosity")), requestOperator(r), timeout, priority)
+	renderTemplate(w, r, "templates/logs.html", report.Log)
+}
+
+// UpgradeReport summarizes an upgrade of several servers
+type UpgradeReport struct {
+	// Servers is how many Linux servers were upgraded, Failed how many of them failed and
+	// Skipped how many Windows servers were left out
+	Servers  int
+	Failed   int
+	Skipped  int
+	Upgraded int
+	Log      string
+}
+
+// upgradeTargetsReport upgrades the Linux targets in parallel and writes the log that names
+// them by ip or group
+func upgradeTargetsReport(ip, group string, targets map[string]ServerInfo, security bool, verbosity, operator string, timeout time.Duration, priority string) UpgradeReport {
+	var ips, skipped []string
+	for candidate, server := range targets {
+		if server.isWindows() {
+			skipped = append(skipped, candidate)
+			continue
+		}
+		ips = append(ips, candidate)
+	}
+	sort.Strings(ips)
+	sort.Strings(skipped)
+
+	results := make([]UpgradeResult, len(ips))
+	fanOut(ips, func(i int, ip string) {
+		results[i] = upgradeServer(ip, targets[ip], security, verbosity, operator, timeout, priority)
+	})
+
+	title, noun := "⬆️ Package upgrade", "packages upgraded"
+	if security {
+		title, noun = "🛡️ Security updates", "security updates applied"
+	}
+	var logBuilder strings.Builder
+	if group != "" {
+		logBuilder.WriteString(title + " for group " + group + "\n\n")
+	} else {
+		logBuilder.WriteString(title + " for " + ip + "\n\n")
+	}
+
+	upgraded, failed := 0, 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: %v\n", result.IP, result.Err))
+		case !result.Result.OK():
+			failed++
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: %s failed with %s\n", result.IP, result.Manager, result.Result.Status()))
+		case result.Upgraded() < 0:
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: %s upgrade finished; package count unavailable\n", result.IP, result.Manager))
+		default:
+			upgraded += result.Upgraded()
+			line := fmt.Sprintf("✅ %s: %d %s with %s", result.IP, result.Upgraded(), noun, result.Manager)
+			if result.Remaining > 0 {
+				line += fmt.Sprintf(", %d held back", result.Remaining)
+			}
+			logBuilder.WriteString(line + "\n")
+		}
+	}
+	for _, candidate := range skipped {
+		logBuilder.WriteString(fmt.Sprintf("⏭️ %s: skipped, upgrades are not available for Windows servers\n", candidate))
+	}
+	logBuilder.WriteString(fmt.Sprintf("\nSummary: %d %s on %d of %d servers", upgraded, noun, len(results)-failed, len(results)))
+	if len(skipped) > 0 {
+		logBuilder.WriteString(fmt.Sprintf(", %d skipped", len(skipped)))
+	}
+	logBuilder.WriteString("\n")
+
+	for _, result := range results {
+		logBuilder.WriteString("\n--- " + result.IP + " ---\n")
+		if result.Err != nil {
+			logBuilder.WriteString(result.Err.Error() + "\n")
+			continue
+		}
+		logBuilder.WriteString(verbosityOutput(result.Result.Output(), verbosity, result.OK()))
+	}
+
+	return UpgradeReport{Servers: len(results), Failed: failed, Skipped: len(skipped), Upgraded: upgraded, Log: logBuilder.String()}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// Catalog hooks and compose files may use variables such as {{.Port}} or {{.Version}}, so
+// one entry covers several configurations. The software page prompts for each variable of
+// the selected entries and the values are substituted before anything runs.
+
+// variableValuePattern is what a variable value may contain. Values are substituted as they
+// are, into shell commands and YAML alike, so nothing that quotes, separates or expands is
+// allowed.
+var variableValuePattern = regexp.MustCompile(`^[A-Za-z0-9._:/@+-]+$`)
+
+// variableField is the software form field holding a variable's value for one entry
+func variableField(software, name string) string {
+	return "var." + software + "." + name
+}
+
+// templateVariables returns the variables the texts use, in order of first use
+func templateVariables(texts []string) ([]string, error) {
+	var names []string
+	for _, text := range texts {
+		tmpl, err := texttemplate.New("").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl.Tree != nil {
+			collectVariables(tmpl.Tree.Root, &names)
+		}
+	}
+	return names, nil
+}
+
+// collectVariables appends the top-level field names a template node refers to
+func collectVariables(node parse.Node, names *[]string) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			collectVariables(child, names)
+		}
+	case *parse.ActionNode:
+		collectVariables(node.Pipe, names)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, command := range node.Cmds {
+			for _, arg := range command.Args {
+				collectVariables(arg, names)
+			}
+		}
+	case *parse.FieldNode:
+		if !slices.Contains(*names, node.Ident[0]) {
+			*names = append(*names, node.Ident[0])
+		}
+	case *parse.IfNode:
+		collectBranchVariables(&node.BranchNode, names)
+	case *parse.RangeNode:
+		collectBranchVariables(&node.BranchNode, names)
+	case *parse.WithNode:
+		collectBranchVariables(&node.BranchNode, names)
+	}
+}
+
+// collectBranchVariables collects from the condition and both branches of an if, range or with
+func collectBranchVariables(node *parse.BranchNode, names *[]string) {
+	collectVariables(node.Pipe, names)
+	collectVariables(node.List, names)
+	collectVariables(node.ElseList, names)
+}
+
+// variableTexts are the parts of an entry that may use variables
+func variableTexts(preInstall, postInstall []string, verify, compose string) []string {
+	texts := slices.Concat(preInstall, postInstall)
+	if verify != "" {
+		texts = append(texts, verify)
+	}
+	if compose != "" {
+		texts = append(texts, compose)
+	}
+	return texts
+}
+
+// Variables lists the variables the entry's hooks and compose file use, for the prompts on
+// the software page; entries are validated when saved, so a parse error means none
+func (s Software) Variables() []string {
+	names, _ := templateVariables(variableTexts(s.PreInstall, s.PostInstall, s.Verify, s.Compose))
+	return names
+}
+
+// renderVariable substitutes values into one text, failing on a variable without a value
+func renderVariable(text string, values map[string]string) (string, error) {
+	tmpl, err := texttemplate.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, values); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// applyVariables reads the values of a selection's variables from the software form and
+// substitutes them into its hooks and compose file. Version falls back to the version the
+// selection pins. Removals run neither hooks nor the compose file, so they need no values.
+func applyVariables(selection *softwareSelection, r *http.Request) error {
+	names, err := templateVariables(variableTexts(selection.PreInstall, selection.PostInstall, selection.Verify, selection.Compose))
+	if err != nil || len(names) == 0 || r.FormValue("operation") == "uninstall" {
+		return err
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		value := strings.TrimSpace(r.FormValue(variableField(selection.Name, name)))
+		if value == "" && name == "Version" {
+			value = selection.Version
+		}
+		switch {
+		case value == "":
+			return fmt.Errorf("enter a value for %s of %s", name, selection.Name)
+		case !variableValuePattern.MatchString(value):
+			return fmt.Errorf("invalid value %q for %s of %s: use letters, digits and . _ : / @ + -", value, name, selection.Name)
+		}
+		values[name] = value
+	}
+
+	render := func(texts []string) ([]string, error) {
+		rendered := make([]string, len(texts))
+		for i, text := range texts {
+			if rendered[i], err = renderVariable(text, values); err != nil {
+				return nil, fmt.Errorf("%s: %w", selection.Name, err)
+			}
+		}
+		return rendered, nil
+	}
+	if selection.PreInstall, err = render(selection.PreInstall); err != nil {
+		return err
+	}
+	if selection.PostInstall, err = render(selection.PostInstall); err != nil {
+		return err
+	}
+	if selection.Verify != "" {
+		verify, err := render([]string{selection.Verify})
+		if err != nil {
+			return err
+		}
+		selection.Verify = verify[0]
+	}
+	if selection.Compose != "" {
+		compose, err := render([]string{selection.Compose})
+		if err != nil {
+			return err
+		}
+		selection.Compose = compose[0]
+	}
+	return nil
+}
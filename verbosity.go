@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Install log verbosity levels, chosen per job
+const (
+	// verbosityQuiet passes -q to the package manager and keeps only the tail of a successful log
+	verbosityQuiet = "quiet"
+	// verbosityNormal runs commands as written and keeps the whole log
+	verbosityNormal = "normal"
+	// verbosityDebug traces every command with set -x and asks the package manager for more detail
+	verbosityDebug = "debug"
+)
+
+// quietLogLines is how many trailing output lines a successful quiet job keeps
+const quietLogLines = 20
+
+// parseVerbosity maps a form value to a verbosity level, defaulting to normal
+func parseVerbosity(value string) string {
+	switch value {
+	case verbosityQuiet, verbosityDebug:
+		return value
+	}
+	return verbosityNormal
+}
+
+// tracedScript turns on command tracing for debug jobs; the trace goes to stderr
+func tracedScript(script, verbosity string, windows bool) string {
+	if verbosity != verbosityDebug {
+		return script
+	}
+	if windows {
+		return "Set-PSDebug -Trace 1\n" + script
+	}
+	return "set -x\n" + script
+}
+
+// verbosityOutput trims command output for the job log. Quiet jobs that succeed keep only the
+// last quietLogLines lines; failures always keep everything so they can be diagnosed.
+func verbosityOutput(output, verbosity string, succeeded bool) string {
+	if verbosity != verbosityQuiet || !succeeded {
+		return output
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) <= quietLogLines {
+		return output
+	}
+	omitted := len(lines) - quietLogLines
+	return fmt.Sprintf("… %d earlier lines omitted (quiet)\n", omitted) + strings.Join(lines[omitted:], "") + "\n"
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/base64"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// platformWindows marks a server as a Windows host reached through OpenSSH for Windows
+const platformWindows = "windows"
+
+// isWindows reports whether scripts for this server must be PowerShell
+func (s ServerInfo) isWindows() bool {
+	return s.Platform == platformWindows
+}
+
+// powerShellBootstrap reads the whole script from stdin and runs it as one script block, so
+// multi-line scripts behave as written. A terminating error exits 1; otherwise the exit code
+// of the last native command is returned, like sh.
+const powerShellBootstrap = `$ProgressPreference = 'SilentlyContinue'
+[Console]::InputEncoding = [Text.Encoding]::UTF8
+[Console]::OutputEncoding = [Text.Encoding]::UTF8
+$script = [Console]::In.ReadToEnd()
+try {
+  & ([scriptblock]::Create($script))
+} catch {
+  [Console]::Error.WriteLine($_)
+  exit 1
+}
+exit $LASTEXITCODE
+`
+
+// powerShellCommand starts the bootstrap. -EncodedCommand avoids quoting differences between
+// cmd.exe and PowerShell, either of which may be the sshd default shell.
+var powerShellCommand = "powershell.exe -NoLogo -NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand " + encodePowerShell(powerShellBootstrap)
+
+// encodePowerShell encodes a script for -EncodedCommand, which expects base64 UTF-16LE
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	raw := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		raw = append(raw, byte(u), byte(u>>8))
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// powerShellQuote wraps a value in single quotes, which PowerShell never expands
+func powerShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// powerShellStep is scriptStep for PowerShell scripts
+func powerShellStep(name string) string {
+	return "Write-Output " + powerShellQuote(stepMarker+" "+name)
+}
+
+// withPowerShellEnv is withEnv for PowerShell scripts
+func withPowerShellEnv(script string, env map[string]string) string {
+	if len(env) == 0 {
+		return script
+	}
+	var assignments strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if !envNamePattern.MatchString(name) {
+			continue
+		}
+		assignments.WriteString("$env:" + name + " = " + powerShellQuote(env[name]) + "\n")
+	}
+	return assignments.String() + script
+}
+
+// withServerEnv prefixes a script with env in the syntax of the server's shell
+func withServerEnv(server ServerInfo, script string, env map[string]string) string {
+	if server.isWindows() {
+		return withPowerShellEnv(script, env)
+	}
+	return withEnv(script, env)
+}
+
+// linuxOnly answers the request with an error for Windows servers, for features built on
+// Linux tools such as useradd, sshd_config and /etc/environment
+func linuxOnly(w http.ResponseWriter, server ServerInfo, feature string) bool {
+	if server.isWindows() {
+		http.Error(w, "❌ "+feature+" is not available for Windows servers", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// windowsInstallScript installs a package with winget when the host has it and falls back
+// to Chocolatey. wingetArgs selects the package, e.g. "--id Git.Git --exact"; an empty
+// wingetArgs or choco skips that manager. A non-empty version installs exactly that version.
+func windowsInstallScript(wingetArgs, choco, version, verbosity string) string {
+	return windowsPackageScript("install", wingetArgs, choco, version, verbosity)
+}
+
+// windowsUninstallScript removes a package the same way windowsInstallScript installs it
+func windowsUninstallScript(wingetArgs, choco, verbosity string) string {
+	return windowsPackageScript("uninstall", wingetArgs, choco, "", verbosity)
+}
+
+// windowsPackageScript runs winget or choco with action, "install" or "uninstall"
+func windowsPackageScript(action, wingetArgs, choco, version, verbosity string) string {
+	wingetFlags, chocoFlags := "", ""
+	if version != "" {
+		wingetFlags = " --version " + powerShellQuote(version)
+		chocoFlags = wingetFlags
+	}
+	switch verbosity {
+	case verbosityQuiet:
+		chocoFlags += " --limit-output"
+	case verbosityDebug:
+		wingetFlags += " --verbose-logs"
+		chocoFlags += " --debug --verbose"
+	}
+
+	var script strings.Builder
+	branch := "if"
+	if wingetArgs != "" {
+		script.WriteString("if (Get-Command winget -ErrorAction SilentlyContinue) {\n")
+		agreements := " --accept-source-agreements"
+		if action == "install" {
+			agreements = " --accept-package-agreements" + agreements
+		}
+		script.WriteString("  " + powerShellStep("winget "+action+" "+wingetArgs) + "\n")
+		script.WriteString("  winget " + action + " " + wingetArgs + " --silent" + agreements + " --disable-interactivity" + wingetFlags + "\n")
+		branch = "} elseif"
+	}
+	if choco != "" {
+		script.WriteString(branch + " (Get-Command choco -ErrorAction SilentlyContinue) {\n")
+		script.WriteString("  " + powerShellStep("choco "+action+" "+choco) + "\n")
+		script.WriteString("  choco " + action + " " + powerShellQuote(choco) + " -y --no-progress" + chocoFlags + "\n")
+		branch = "} elseif"
+	}
+	if branch == "if" {
+		return "[Console]::Error.WriteLine('No Windows package is known for this software')\nexit 1\n"
+	}
+	script.WriteString("} else {\n")
+	script.WriteString("  [Console]::Error.WriteLine('Neither winget nor Chocolatey is installed on this server')\n")
+	script.WriteString("  exit 1\n")
+	script.WriteString("}\n")
+	return script.String()
+}
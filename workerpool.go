@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Work on many servers, such as a health round or a group upgrade, goes through one worker
+// pool: a fan-out starts at most serverWorkers goroutines, however many servers it covers,
+// and each task holds a pool token and a token of its server while it runs.
+var (
+	// serverWorkers caps the server tasks running at once across the app; -workers
+	serverWorkers = 32
+	// hostWorkers caps the tasks running at once against one server; -host-workers
+	hostWorkers = 4
+)
+
+// hostTokens limits the tasks on one server; users counts the tasks holding or waiting for
+// a token, so the tokens of idle servers are forgotten
+type hostTokens struct {
+	tokens chan struct{}
+	users  int
+}
+
+var (
+	workerTokensOnce sync.Once
+	workerTokens     chan struct{}
+
+	workerHostsMu sync.Mutex
+	workerHosts   = make(map[string]*hostTokens)
+
+	// workerStats counts the pool's tasks for the diagnostics page
+	workerStats struct {
+		running, waiting, done atomic.Int64
+	}
+)
+
+// validateWorkerPool checks the pool flags before any work starts
+func validateWorkerPool() error {
+	if serverWorkers < 1 || hostWorkers < 1 || jobWorkers < 1 {
+		return fmt.Errorf("-workers, -host-workers and -job-workers must be at least 1")
+	}
+	return nil
+}
+
+// acquireHost waits for a token of the server
+func acquireHost(ip string) *hostTokens {
+	workerHostsMu.Lock()
+	host, ok := workerHosts[ip]
+	if !ok {
+		host = &hostTokens{tokens: make(chan struct{}, hostWorkers)}
+		workerHosts[ip] = host
+	}
+	host.users++
+	workerHostsMu.Unlock()
+	host.tokens <- struct{}{}
+	return host
+}
+
+// releaseHost returns a token of the server
+func releaseHost(ip string, host *hostTokens) {
+	<-host.tokens
+	workerHostsMu.Lock()
+	if host.users--; host.users == 0 {
+		delete(workerHosts, ip)
+	}
+	workerHostsMu.Unlock()
+}
+
+// runOnWorker runs task against the server once its server and the pool have a free token.
+// The server's token is taken first, so a task held up by a busy server keeps no pool
+// token from tasks on other servers.
+func runOnWorker(ip string, task func()) {
+	workerTokensOnce.Do(func() { workerTokens = make(chan struct{}, serverWorkers) })
+	workerStats.waiting.Add(1)
+	host := acquireHost(ip)
+	workerTokens <- struct{}{}
+	workerStats.waiting.Add(-1)
+	workerStats.running.Add(1)
+	defer func() {
+		<-workerTokens
+		releaseHost(ip, host)
+		workerStats.running.Add(-1)
+		workerStats.done.Add(1)
+	}()
+	task()
+}
+
+// fanOut runs task for every server in ips through the worker pool and returns once all
+// finished. ips may name a server more than once, e.g. for several locks on it; i is the
+// position in ips. A task must not fan out again, since it holds a pool token meanwhile.
+func fanOut(ips []string, task func(i int, ip string)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(len(ips), serverWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				runOnWorker(ips[i], func() { task(i, ips[i]) })
+			}
+		}()
+	}
+	for i := range ips {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// checkWorkerPool reports how busy the worker pool is
+func checkWorkerPool() (string, string, string) {
+	running, waiting := workerStats.running.Load(), workerStats.waiting.Load()
+	workerHostsMu.Lock()
+	hosts := len(workerHosts)
+	workerHostsMu.Unlock()
+	detail := fmt.Sprintf("%d of %d workers busy (at most %d per server), %d tasks waiting, %d servers in use, %d tasks done since startup; %d job workers",
+		running, serverWorkers, hostWorkers, waiting, hosts, workerStats.done.Load(), jobWorkers)
+	if waiting > 0 && running >= int64(serverWorkers) {
+		return "warning", detail, "Every worker is busy; raise -workers if health rounds or group runs take too long."
+	}
+	return "ok", detail, ""
+}
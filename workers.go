@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// workerMinBackoff and workerMaxBackoff bound the delay before a crashed worker restarts
+	workerMinBackoff = time.Second
+	workerMaxBackoff = 5 * time.Minute
+	// workerStableAfter is how long a worker must run before its backoff resets
+	workerStableAfter = 10 * time.Minute
+	// maxWorkerPanics is how many recent panics are kept per worker
+	maxWorkerPanics = 5
+)
+
+// WorkerPanic is one recovered panic with the stack that raised it
+type WorkerPanic struct {
+	Time  time.Time `json:"time"`
+	Value string    `json:"value"`
+	Stack string    `json:"stack"`
+	// Restarted is true when the panic ended the worker itself rather than one of its tasks
+	Restarted bool `json:"restarted"`
+}
+
+// WorkerStatus is the supervisor's view of one background worker
+type WorkerStatus struct {
+	Name      string        `json:"name"`
+	Status    string        `json:"status"` // "running" or "restarting"
+	StartedAt time.Time     `json:"started_at"`
+	Restarts  int           `json:"restarts"`
+	LastExit  string        `json:"last_exit,omitempty"`
+	Panics    []WorkerPanic `json:"panics,omitempty"`
+}
+
+var (
+	workersMu sync.Mutex
+	workers   = make(map[string]*WorkerStatus)
+)
+
+// superviseWorker runs run in its own goroutine and restarts it with exponential backoff
+// whenever it panics or returns, so one crash cannot silently stop monitoring
+func superviseWorker(name string, run func()) {
+	workersMu.Lock()
+	worker := &WorkerStatus{Name: name}
+	workers[name] = worker
+	workersMu.Unlock()
+
+	go func() {
+		backoff := workerMinBackoff
+		for {
+			workersMu.Lock()
+			worker.Status = "running"
+			worker.StartedAt = time.Now()
+			workersMu.Unlock()
+
+			started := time.Now()
+			exit := runWorker(name, run)
+			if time.Since(started) > workerStableAfter {
+				backoff = workerMinBackoff
+			}
+
+			workersMu.Lock()
+			worker.Status = "restarting"
+			worker.Restarts++
+			worker.LastExit = exit
+			workersMu.Unlock()
+			fmt.Printf("⚠️ Worker %s %s; restarting in %s\n", name, exit, backoff)
+			raiseAlert("worker:"+name, "accmgr4", "critical", fmt.Sprintf("Background worker %s %s and is being restarted", name, exit))
+
+			time.Sleep(backoff)
+			backoff = min(backoff*2, workerMaxBackoff)
+		}
+	}()
+}
+
+// runWorker runs one generation of a worker and describes how it ended
+func runWorker(name string, run func()) (exit string) {
+	defer func() {
+		if v := recover(); v != nil {
+			recordWorkerPanic(name, v, debug.Stack(), true)
+			exit = fmt.Sprintf("panicked: %v", v)
+		}
+	}()
+	run()
+	return "exited"
+}
+
+// catchWorkerPanic is deferred by goroutines a worker starts for individual tasks, such as
+// polling one server. A panic there is recorded against the worker and only ends that task.
+func catchWorkerPanic(name string) {
+	if v := recover(); v != nil {
+		recordWorkerPanic(name, v, debug.Stack(), false)
+	}
+}
+
+// recordWorkerPanic logs a panic with its stack, keeps it for the diagnostics page and
+// announces it on the event stream
+func recordWorkerPanic(name string, v any, stack []byte, restarted bool) {
+	entry := WorkerPanic{Time: time.Now(), Value: fmt.Sprint(v), Stack: string(stack), Restarted: restarted}
+	fmt.Printf("❌ Worker %s panic: %s\n%s\n", name, entry.Value, entry.Stack)
+
+	workersMu.Lock()
+	worker, ok := workers[name]
+	if !ok {
+		worker = &WorkerStatus{Name: name, Status: "running"}
+		workers[name] = worker
+	}
+	worker.Panics = append(worker.Panics, entry)
+	if len(worker.Panics) > maxWorkerPanics {
+		worker.Panics = worker.Panics[len(worker.Panics)-maxWorkerPanics:]
+	}
+	workersMu.Unlock()
+
+	publishEvent("worker.panic", map[string]interface{}{"worker": name, "panic": entry})
+	if !restarted {
+		raiseAlert("worker:"+name, "accmgr4", "warning", fmt.Sprintf("Background worker %s recovered from a panic: %s", name, entry.Value))
+	}
+}
+
+// workersSnapshot returns copies of every supervised worker, sorted by name
+func workersSnapshot() []WorkerStatus {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+
+	snapshot := make([]WorkerStatus, 0, len(workers))
+	for _, worker := range workers {
+		copied := *worker
+		copied.Panics = append([]WorkerPanic(nil), worker.Panics...)
+		snapshot = append(snapshot, copied)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Name < snapshot[j].Name })
+	return snapshot
+}